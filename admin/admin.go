@@ -0,0 +1,133 @@
+package admin
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"log-collector/collector"
+	"log-collector/logging"
+	"net/http"
+	"strings"
+)
+
+// Controller admin接口操作的对象,由collector.Collector实现
+type Controller interface {
+	Readers() []collector.ReaderStatus
+	Writers() []collector.WriterStatus
+	PauseReader(name string) error
+	ResumeReader(name string) error
+	RotateWriter(name string) error
+	Flush() error
+}
+
+// Handler 运行时管理的HTTP接口,请求和响应都是JSON,客户端需要带上 Authorization: Bearer <token>
+//
+//	GET  /admin/readers               所有reader的状态
+//	POST /admin/readers/{name}/pause  暂停reader(kafka的reader暂停消费所有分区)
+//	POST /admin/readers/{name}/resume 恢复reader
+//	GET  /admin/writers               所有writer的状态
+//	POST /admin/writers/{name}/rotate 立即切割writer的文件
+//	POST /admin/writers/flush         把所有writer攒批中的日志和缓冲区立即写入
+//	GET  /admin/loglevel              程序自己的日志级别
+//	PUT  /admin/loglevel              修改日志级别,请求内容为 {"level":"debug"}
+type Handler struct {
+	c     Controller
+	token string
+	mux   *http.ServeMux
+}
+
+// NewHandler token不能为空
+func NewHandler(c Controller, token string) *Handler {
+	h := &Handler{c: c, token: token, mux: http.NewServeMux()}
+	h.mux.HandleFunc("GET /admin/readers", h.readers)
+	h.mux.HandleFunc("POST /admin/readers/{name}/pause", h.pause)
+	h.mux.HandleFunc("POST /admin/readers/{name}/resume", h.resume)
+	h.mux.HandleFunc("GET /admin/writers", h.writers)
+	h.mux.HandleFunc("POST /admin/writers/{name}/rotate", h.rotate)
+	h.mux.HandleFunc("POST /admin/writers/flush", h.flush)
+	h.mux.HandleFunc("GET /admin/loglevel", h.logLevel)
+	h.mux.HandleFunc("PUT /admin/loglevel", h.setLogLevel)
+	return h
+}
+
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !h.authorized(r) {
+		writeError(w, http.StatusUnauthorized, errors.New("unauthorized"))
+		return
+	}
+	h.mux.ServeHTTP(w, r)
+}
+
+func (h *Handler) authorized(r *http.Request) bool {
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	return ok && h.token != "" && subtle.ConstantTimeCompare([]byte(token), []byte(h.token)) == 1
+}
+
+func (h *Handler) readers(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, h.c.Readers())
+}
+
+func (h *Handler) writers(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, h.c.Writers())
+}
+
+func (h *Handler) pause(w http.ResponseWriter, r *http.Request) {
+	h.do(w, "pause reader "+r.PathValue("name"), func() error { return h.c.PauseReader(r.PathValue("name")) })
+}
+
+func (h *Handler) resume(w http.ResponseWriter, r *http.Request) {
+	h.do(w, "resume reader "+r.PathValue("name"), func() error { return h.c.ResumeReader(r.PathValue("name")) })
+}
+
+func (h *Handler) rotate(w http.ResponseWriter, r *http.Request) {
+	h.do(w, "rotate writer "+r.PathValue("name"), func() error { return h.c.RotateWriter(r.PathValue("name")) })
+}
+
+func (h *Handler) flush(w http.ResponseWriter, r *http.Request) {
+	h.do(w, "flush writers", h.c.Flush)
+}
+
+func (h *Handler) logLevel(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]string{"level": logging.Level()})
+}
+
+func (h *Handler) setLogLevel(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Level string `json:"level"`
+	}
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<10)).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	h.do(w, "set log level to "+req.Level, func() error { return logging.SetLevel(req.Level) })
+}
+
+// do 执行操作并记录日志,action为操作的描述
+func (h *Handler) do(w http.ResponseWriter, action string, op func() error) {
+	if err := op(); err != nil {
+		status := http.StatusInternalServerError
+		switch {
+		case errors.Is(err, collector.ErrNotFound):
+			status = http.StatusNotFound
+		case errors.Is(err, collector.ErrNotSupported):
+			status = http.StatusBadRequest
+		case errors.Is(err, logging.ErrUnknownLevel):
+			status = http.StatusBadRequest
+		}
+		logging.Component("admin").Warn("admin operation failed", "action", action, "error", err)
+		writeError(w, status, err)
+		return
+	}
+	logging.Component("admin").Info("admin operation", "action", action)
+	writeJSON(w, http.StatusOK, map[string]bool{"ok": true})
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, map[string]string{"error": err.Error()})
+}
@@ -0,0 +1,107 @@
+package admin
+
+import (
+	"encoding/json"
+	"fmt"
+	"log-collector/collector"
+	"log-collector/logging"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// fakeController 只有名为kafka的reader和名为file的writer
+type fakeController struct {
+	paused  bool
+	flushed int
+}
+
+func (c *fakeController) Readers() []collector.ReaderStatus {
+	return []collector.ReaderStatus{{Name: "kafka", Running: true, Paused: c.paused, Pausable: true}}
+}
+func (c *fakeController) Writers() []collector.WriterStatus {
+	return []collector.WriterStatus{{Name: "file", Written: 3, Rotatable: true}}
+}
+func (c *fakeController) PauseReader(name string) error {
+	if name != "kafka" {
+		return fmt.Errorf("reader %s %w", name, collector.ErrNotFound)
+	}
+	c.paused = true
+	return nil
+}
+func (c *fakeController) ResumeReader(name string) error {
+	if name != "kafka" {
+		return fmt.Errorf("reader %s %w", name, collector.ErrNotFound)
+	}
+	c.paused = false
+	return nil
+}
+func (c *fakeController) RotateWriter(name string) error {
+	return fmt.Errorf("writer %s: rotate %w", name, collector.ErrNotSupported)
+}
+func (c *fakeController) Flush() error {
+	c.flushed++
+	return nil
+}
+
+func TestHandler(t *testing.T) {
+	c := &fakeController{}
+	server := httptest.NewServer(NewHandler(c, "secret"))
+	defer server.Close()
+	defer logging.SetLevel("info")
+
+	do := func(method, path, token, body string) (int, string) {
+		t.Helper()
+		req, err := http.NewRequest(method, server.URL+path, strings.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		var v interface{}
+		if err := json.NewDecoder(resp.Body).Decode(&v); err != nil {
+			t.Fatalf("%s %s: %v", method, path, err)
+		}
+		got, _ := json.Marshal(v)
+		return resp.StatusCode, string(got)
+	}
+
+	tests := []struct {
+		method, path, token, body string
+		wantStatus                int
+		wantBody                  string
+	}{
+		{"GET", "/admin/readers", "", "", 401, `{"error":"unauthorized"}`},
+		{"GET", "/admin/readers", "wrong", "", 401, `{"error":"unauthorized"}`},
+		{"POST", "/admin/readers/kafka/pause", "secret", "", 200, `{"ok":true}`},
+		{"GET", "/admin/readers", "secret", "", 200, `[{"name":"kafka","pausable":true,"paused":true,"running":true}]`},
+		{"POST", "/admin/readers/kafka/resume", "secret", "", 200, `{"ok":true}`},
+		{"POST", "/admin/readers/missing/pause", "secret", "", 404, `{"error":"reader missing not found"}`},
+		{"GET", "/admin/writers", "secret", "", 200, `[{"dedicated":false,"failed":0,"name":"file","queued":0,"rotatable":true,"written":3}]`},
+		{"POST", "/admin/writers/file/rotate", "secret", "", 400, `{"error":"writer file: rotate not supported"}`},
+		{"POST", "/admin/writers/flush", "secret", "", 200, `{"ok":true}`},
+		{"PUT", "/admin/loglevel", "secret", `{"level":"DEBUG"}`, 200, `{"ok":true}`},
+		{"GET", "/admin/loglevel", "secret", "", 200, `{"level":"debug"}`},
+		{"PUT", "/admin/loglevel", "secret", `{"level":"verbose"}`, 400, `{"error":"unknown log level \"verbose\", expected one of debug, info, warn, error"}`},
+		{"PUT", "/admin/loglevel", "secret", `level=debug`, 400, `{"error":"invalid character 'l' looking for beginning of value"}`},
+	}
+	for _, tt := range tests {
+		status, body := do(tt.method, tt.path, tt.token, tt.body)
+		if status != tt.wantStatus || body != tt.wantBody {
+			t.Errorf("%s %s = %d %s, want %d %s", tt.method, tt.path, status, body, tt.wantStatus, tt.wantBody)
+		}
+	}
+	if c.paused || c.flushed != 1 {
+		t.Errorf("paused = %v, flushed = %d", c.paused, c.flushed)
+	}
+	if logging.Level() != "debug" {
+		t.Errorf("Level() = %s", logging.Level())
+	}
+}
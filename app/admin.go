@@ -0,0 +1,23 @@
+package app
+
+import (
+	"fmt"
+	"log-collector/admin"
+	"log-collector/collector"
+	"log-collector/config"
+	"log-collector/logging"
+)
+
+// startAdmin 开启运行时管理的HTTP接口,conf为nil时不开启
+// 返回的函数用于关闭HTTP服务
+func startAdmin(c *collector.Collector, conf *config.AdminConfig) (func(), error) {
+	if conf == nil {
+		return func() {}, nil
+	}
+	addr, stop, err := startServer("admin", conf.Addr, admin.NewHandler(c, conf.Token))
+	if err != nil {
+		return nil, err
+	}
+	logging.Component("admin").Info("admin endpoint listening", "url", fmt.Sprintf("http://%s/admin/", addr))
+	return stop, nil
+}
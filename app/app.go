@@ -0,0 +1,126 @@
+package app
+
+import (
+	"context"
+	"flag"
+	"log-collector/collector"
+	"log-collector/config"
+	"log-collector/logging"
+	"log-collector/metrics"
+	"os"
+)
+
+// Main 程序的入口,解析命令行参数、读取配置并开始收集日志
+// 使用第三方reader或writer时,在自己的main包中匿名导入它们后调用Main即可:
+//
+//	import (
+//		"log-collector/app"
+//		_ "example.com/internal/mywriter"
+//	)
+//
+//	func main() {
+//		app.Main()
+//	}
+func Main() {
+	//子命令
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "validate":
+			os.Exit(runValidate(os.Args[2:]))
+		case "query":
+			os.Exit(runQuery(os.Args[2:]))
+		}
+	}
+
+	//读取配置之前的日志使用默认的格式
+	logging.Init(os.Stderr, "")
+	flagconf := flag.String("conf", "config/config.yaml", "config path, eg: -conf config.yaml")
+	flag.Parse()
+	appConf, err := loadConfig(*flagconf)
+	if err != nil {
+		printConfigError(os.Stderr, err)
+		logging.Component("app").Error("get config failed")
+		os.Exit(1)
+	}
+	if err := setupLogging(appConf.Log); err != nil {
+		fatal("setup logging failed", err)
+	}
+	var (
+		inputs  []collector.Input
+		outputs []collector.Output
+	)
+	rSpecs := readerSpecs(appConf)
+	for _, name := range sortedNames(rSpecs) {
+		r, err := rSpecs[name].build()
+		if err != nil {
+			fatal("create reader failed", err, "reader", name)
+		}
+		inputs = append(inputs, collector.Input{Name: name, Reader: r})
+	}
+	wSpecs := writerSpecs(appConf)
+	for _, name := range sortedNames(wSpecs) {
+		o, err := wSpecs[name].build()
+		if err != nil {
+			fatal("create writer failed", err, "writer", name)
+		}
+		o.Name = name
+		outputs = append(outputs, o)
+	}
+	c := collector.NewCollector(inputs, outputs, appConf.BuffSize)
+	cctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	stopTail, err := startTail(c, appConf.Tail)
+	if err != nil {
+		fatal("start tail endpoint failed", err)
+	}
+	defer stopTail()
+
+	registry := metrics.NewRegistry()
+	processors, err := buildProcessors(appConf, c)
+	if err != nil {
+		fatal("create processors failed", err)
+	}
+	c.SetProcessors(processors)
+	registerMetrics(registry, nil, appConf.Processors, processors)
+	stopMetrics, err := startMetrics(registry, appConf.Metrics)
+	if err != nil {
+		fatal("start metrics endpoint failed", err)
+	}
+	defer stopMetrics()
+
+	stopAdmin, err := startAdmin(c, appConf.Admin)
+	if err != nil {
+		fatal("start admin endpoint failed", err)
+	}
+	defer stopAdmin()
+
+	//配置文件变化时重新加载
+	r := &reloader{c: c, conf: appConf, registry: registry, processors: processors}
+	if err := config.WatchConfig(*flagconf, r.reload); err != nil {
+		logging.Component("app").Warn("watch config failed, hot reload disabled", "error", err)
+	}
+	logging.Component("app").Info("begin collect log")
+	err = c.Collect(cctx)
+	if err != nil {
+		logging.Component("app").Error("collect failed", "error", err)
+		cancel()
+	}
+}
+
+// setupLogging 按配置设置程序自己的日志的格式和级别
+func setupLogging(conf config.LogConfig) error {
+	if err := logging.Init(os.Stderr, conf.Format); err != nil {
+		return err
+	}
+	if conf.Level == "" {
+		return nil
+	}
+	return logging.SetLevel(conf.Level)
+}
+
+// fatal 打印错误日志后退出,args为其他的属性
+func fatal(msg string, err error, args ...any) {
+	logging.Component("app", args...).Error(msg, "error", err)
+	os.Exit(1)
+}
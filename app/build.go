@@ -0,0 +1,195 @@
+package app
+
+import (
+	"fmt"
+	"log-collector/collector"
+	"log-collector/config"
+	"log-collector/encoder"
+	"log-collector/metrics"
+	"log-collector/processor"
+	"log-collector/reader"
+	"log-collector/spool"
+	"log-collector/writer"
+	"sort"
+)
+
+// readerSpec 一个reader的配置和创建方法
+type readerSpec struct {
+	conf  interface{} //用于重新加载时对比配置是否有变化
+	build func() (reader.Reader, error)
+}
+
+// writerSpec 一个writer的配置和创建方法
+type writerSpec struct {
+	conf  interface{} //用于重新加载时对比配置是否有变化
+	build func() (collector.Output, error)
+}
+
+// readerSpecs 根据配置列出所有的reader,key为reader的名称
+func readerSpecs(appConf config.AppConfig) map[string]readerSpec {
+	specs := make(map[string]readerSpec)
+	for _, rc := range appConf.Readers {
+		rc := rc
+		specs[rc.Name] = readerSpec{
+			conf: rc,
+			build: func() (reader.Reader, error) {
+				b, err := reader.NewBuilder(rc.Type, rc.Options)
+				if err != nil {
+					return nil, err
+				}
+				return b.Build()
+			},
+		}
+	}
+	return specs
+}
+
+// writerSpecs 根据配置列出所有的writer,key为writer的名称
+func writerSpecs(appConf config.AppConfig) map[string]writerSpec {
+	specs := make(map[string]writerSpec)
+	for _, wc := range appConf.Writers {
+		wc := wc
+		specs[wc.Name] = writerSpec{
+			conf: wc,
+			build: func() (collector.Output, error) {
+				w, err := buildWriter(wc.Type, wc.Options)
+				if err != nil {
+					return collector.Output{}, err
+				}
+				wrapped, err := wrapWriter(w, wc.Name, wc.WriterOptions)
+				if err != nil {
+					return collector.Output{}, err
+				}
+				return collector.Output{
+					Writer:    wrapped,
+					Batch:     batchOptions(wc.Batch),
+					Dedicated: wc.Dedicated,
+				}, nil
+			},
+		}
+	}
+	return specs
+}
+
+// buildProcessors 按配置的顺序创建所有的processor,processor产生的日志交给emit
+// 任何一个创建失败时,关闭已经创建的processor
+func buildProcessors(appConf config.AppConfig, emit processor.Emitter) ([]processor.Processor, error) {
+	var ps []processor.Processor
+	for _, pc := range appConf.Processors {
+		p, err := buildProcessor(pc, emit)
+		if err != nil {
+			for _, p := range ps {
+				p.Close()
+			}
+			return nil, err
+		}
+		ps = append(ps, p)
+	}
+	return ps, nil
+}
+
+// buildProcessor 根据type创建一个processor
+func buildProcessor(pc config.ProcessorConfig, emit processor.Emitter) (processor.Processor, error) {
+	b, err := processor.NewBuilder(pc.Type, pc.Options)
+	if err == nil {
+		var p processor.Processor
+		if p, err = b.Build(pc.Name, emit); err == nil {
+			return p, nil
+		}
+	}
+	return nil, fmt.Errorf("create processor %s failed: %w", pc.Name, err)
+}
+
+// registerMetrics 把提供指标的processor注册到registry,并移除old中的processor
+func registerMetrics(registry *metrics.Registry, old, ps []config.ProcessorConfig, built []processor.Processor) {
+	for _, pc := range old {
+		registry.Unregister("processor/" + pc.Name)
+	}
+	for i, p := range built {
+		if s, ok := p.(metrics.Source); ok {
+			registry.Register("processor/"+ps[i].Name, s)
+		}
+	}
+}
+
+// buildWriter 根据type创建writer
+func buildWriter(typ string, options map[string]interface{}) (writer.Writer, error) {
+	b, err := writer.NewBuilder(typ, options)
+	if err != nil {
+		return nil, err
+	}
+	return b.Build()
+}
+
+// sortedNames 按名称排序,保证创建的顺序固定
+func sortedNames[T any](specs map[string]T) []string {
+	names := make([]string, 0, len(specs))
+	for name := range specs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// wrapWriter 根据writer的通用配置,给writer套上重试、磁盘队列等功能
+// 失败时关闭w以及已经创建的死信writer,调用方不需要再关闭w
+func wrapWriter(w writer.Writer, name string, opts config.WriterOptions) (writer.Writer, error) {
+	//编码在最里面,重试、死信和磁盘队列处理的仍然是原始的日志
+	if opts.Encoding != nil {
+		enc, err := encoder.New(encoder.Type(opts.Encoding.Type), opts.Encoding.Template)
+		if err != nil {
+			w.Close()
+			return nil, fmt.Errorf("create encoder failed: %w", err)
+		}
+		w = writer.NewEncodingWriter(w, enc)
+	}
+	if opts.Retry != nil || opts.DeadLetter != nil {
+		var policy writer.RetryPolicy
+		if opts.Retry != nil {
+			policy = writer.RetryPolicy{
+				MaxAttempts:    opts.Retry.MaxAttempts,
+				InitialBackoff: opts.Retry.InitialBackoff,
+				MaxBackoff:     opts.Retry.MaxBackoff,
+				Multiplier:     opts.Retry.Multiplier,
+				Jitter:         opts.Retry.Jitter,
+			}
+		}
+		var deadLetter writer.Writer
+		if opts.DeadLetter != nil {
+			var err error
+			deadLetter, err = buildWriter(opts.DeadLetter.Type, opts.DeadLetter.Options)
+			if err != nil {
+				w.Close()
+				return nil, fmt.Errorf("create dead letter writer failed: %w", err)
+			}
+		}
+		w = writer.NewRetryWriter(w, name, policy, deadLetter)
+	}
+	//spool在最外层,重试耗尽后才算写入失败
+	if opts.Spool != nil {
+		sw, err := writer.NewSpoolWriter(w, opts.Spool.Dir, spool.Options{
+			SegmentSize: opts.Spool.SegmentSize,
+			MaxSize:     opts.Spool.MaxSize,
+			Sync:        opts.Spool.Sync,
+		})
+		if err != nil {
+			//关闭RetryWriter时也会关闭死信writer
+			w.Close()
+			return nil, err
+		}
+		w = sw
+	}
+	return w, nil
+}
+
+// batchOptions 把配置转换为collector的攒批参数,未配置的字段使用默认值
+func batchOptions(conf *config.BatchConfig) collector.BatchOptions {
+	if conf == nil {
+		return collector.DefaultBatchOptions
+	}
+	return collector.BatchOptions{
+		MaxCount: conf.MaxCount,
+		MaxBytes: conf.MaxBytes,
+		Linger:   conf.Linger,
+	}
+}
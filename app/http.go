@@ -0,0 +1,32 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"log-collector/logging"
+	"net"
+	"net/http"
+	"time"
+)
+
+// startServer 在addr上开启HTTP服务,返回实际监听的地址和关闭服务的函数
+func startServer(name, addr string, handler http.Handler) (net.Addr, func(), error) {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, nil, err
+	}
+	srv := &http.Server{Handler: handler, ReadHeaderTimeout: 10 * time.Second}
+	go func() {
+		if err := srv.Serve(ln); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			logging.Component(name).Error("server stopped", "error", err)
+		}
+	}()
+	return ln.Addr(), func() {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		//tail等长连接等不到它们结束时直接关闭
+		if err := srv.Shutdown(ctx); err != nil {
+			srv.Close()
+		}
+	}, nil
+}
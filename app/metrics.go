@@ -0,0 +1,25 @@
+package app
+
+import (
+	"fmt"
+	"log-collector/config"
+	"log-collector/logging"
+	"log-collector/metrics"
+	"net/http"
+)
+
+// startMetrics 开启Prometheus格式的metrics接口,conf为nil时不开启
+// 返回的函数用于关闭HTTP服务
+func startMetrics(registry *metrics.Registry, conf *config.MetricsConfig) (func(), error) {
+	if conf == nil {
+		return func() {}, nil
+	}
+	mux := http.NewServeMux()
+	mux.Handle(conf.Path, registry)
+	addr, stop, err := startServer("metrics", conf.Addr, mux)
+	if err != nil {
+		return nil, err
+	}
+	logging.Component("metrics").Info("metrics endpoint listening", "url", fmt.Sprintf("http://%s%s", addr, conf.Path))
+	return stop, nil
+}
@@ -0,0 +1,129 @@
+package app
+
+import (
+	"bufio"
+	"context"
+	"flag"
+	"fmt"
+	"log-collector/config"
+	"log-collector/filter"
+	"log-collector/query"
+	"log-collector/writer"
+	"os"
+	"os/signal"
+	"time"
+)
+
+// runQuery 在file writer写出的文件中查询日志,用法:
+//
+//	log-collector query -conf config.yaml [-writer file] [-since 1h | -from ... -to ...] [-filter 'level == "error"'] [-limit 100]
+//	log-collector query -dir app_log -name app ...
+//
+// 满足条件的日志按写入的顺序输出到标准输出,没有找到日志时返回1
+func runQuery(args []string) int {
+	fs := flag.NewFlagSet("query", flag.ContinueOnError)
+	conf := fs.String("conf", "config/config.yaml", "config path, eg: -conf config.yaml")
+	writerName := fs.String("writer", "", "name of the file writer to query, default all file writers in the config")
+	dir := fs.String("dir", "", "query the files in this directory instead of the file writers in the config")
+	name := fs.String("name", "app", "file name used with -dir")
+	expr := fs.String("filter", "", `filter expression, eg: level == "error" && http.status >= 500`)
+	from := fs.String("from", "", `only records at or after this time, eg: "2024-01-02 15:04:05"`)
+	to := fs.String("to", "", "only records before this time")
+	since := fs.Duration("since", 0, "only records in the last duration, eg: 1h")
+	limit := fs.Int("limit", 0, "stop after this many records, 0 means no limit")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+
+	var opts query.Options
+	var err error
+	if *expr != "" {
+		if opts.Filter, err = filter.Parse(*expr); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 2
+		}
+	}
+	if *from != "" && *since != 0 {
+		fmt.Fprintln(os.Stderr, "-from and -since can not be used together")
+		return 2
+	}
+	if *since != 0 {
+		opts.From = time.Now().Add(-*since)
+	}
+	if *from != "" {
+		if opts.From, err = query.ParseTime(*from); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 2
+		}
+	}
+	if *to != "" {
+		if opts.To, err = query.ParseTime(*to); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 2
+		}
+	}
+	opts.Limit = *limit
+
+	targets := []query.Options{{Dir: *dir, Name: *name}}
+	if *dir == "" {
+		appConf, err := loadConfig(*conf)
+		if err != nil {
+			printConfigError(os.Stderr, err)
+			return 2
+		}
+		if targets, err = fileTargets(appConf, *writerName); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 2
+		}
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	out := bufio.NewWriter(os.Stdout)
+	defer out.Flush()
+	total := 0
+	for _, t := range targets {
+		o := opts
+		o.Dir, o.Name = t.Dir, t.Name
+		if opts.Limit > 0 {
+			o.Limit = opts.Limit - total
+		}
+		n, err := query.Search(ctx, o, out)
+		total += n
+		if err != nil {
+			out.Flush()
+			fmt.Fprintf(os.Stderr, "query failed: %v\n", err)
+			return 1
+		}
+		if opts.Limit > 0 && total >= opts.Limit {
+			break
+		}
+	}
+	if total == 0 {
+		return 1
+	}
+	return 0
+}
+
+// fileTargets 配置文件中file writer的filePath和fileName,name不为空时只返回该writer
+func fileTargets(appConf config.AppConfig, name string) ([]query.Options, error) {
+	var targets []query.Options
+	for _, wc := range appConf.Writers {
+		if wc.Type != "file" || (name != "" && wc.Name != name) {
+			continue
+		}
+		b, err := writer.NewBuilder(wc.Type, wc.Options)
+		if err != nil {
+			return nil, err
+		}
+		fb := b.(*writer.FileWriterBuilder)
+		targets = append(targets, query.Options{Dir: fb.FilePath, Name: fb.FileName})
+	}
+	if len(targets) == 0 {
+		if name != "" {
+			return nil, fmt.Errorf("no file writer named %q", name)
+		}
+		return nil, fmt.Errorf("no file writer in the config, use -dir to query a directory")
+	}
+	return targets, nil
+}
@@ -0,0 +1,225 @@
+package app
+
+import (
+	"log-collector/collector"
+	"log-collector/config"
+	"log-collector/logging"
+	"log-collector/metrics"
+	"log-collector/processor"
+	"os"
+	"reflect"
+	"sync"
+)
+
+// reloader 配置文件变化时,只重新创建配置有变化的reader、processor和writer,没有变化的继续运行
+// 任何一个创建失败时,把已经生效的变化全部撤销,继续使用原来的配置
+type reloader struct {
+	mutex    sync.Mutex
+	c        *collector.Collector
+	conf     config.AppConfig //当前生效的配置
+	registry *metrics.Registry
+
+	processors []processor.Processor //当前生效的processor,和conf.Processors一一对应
+}
+
+func (r *reloader) reload(newConf config.AppConfig, err error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if err == nil {
+		err = checkConfig(newConf)
+	}
+	if err != nil {
+		logging.Component("reload").Error("reload config failed, keep the old config", "error", err)
+		return
+	}
+	//processor有变化时只重新创建配置有变化的,在替换reader和writer之前创建,失败时不需要撤销
+	var (
+		processors []processor.Processor
+		built      []rebuiltProcessor
+	)
+	processorsChanged := !reflect.DeepEqual(newConf.Processors, r.conf.Processors)
+	if processorsChanged {
+		if processors, built, err = r.rebuildProcessors(newConf.Processors); err != nil {
+			logging.Component("reload").Error("reload config failed, keep the old config", "error", err)
+			return
+		}
+	}
+	if err := r.apply(newConf); err != nil {
+		for _, b := range built {
+			b.p.Close()
+		}
+		logging.Component("reload").Error("reload config failed, rolled back to the old config", "error", err)
+		return
+	}
+	if processorsChanged {
+		//替换之前接手旧的processor的状态,例如dedup记住的ID
+		for _, b := range built {
+			if i, ok := b.p.(processor.Inheritor); ok && b.old != nil {
+				i.Inherit(b.old)
+			}
+		}
+		r.c.SetProcessors(processors)
+		registerMetrics(r.registry, r.conf.Processors, newConf.Processors, processors)
+		r.processors = processors
+		logging.Component("reload").Info("processors reloaded", "rebuilt", len(built), "total", len(processors))
+	}
+	//日志的配置立即生效,级别没有变化时保留通过admin接口修改的级别
+	if newConf.Log != r.conf.Log {
+		if err := reloadLogging(r.conf.Log, newConf.Log); err != nil {
+			logging.Component("reload").Error("reload log config failed", "error", err)
+		} else {
+			logging.Component("reload").Info("log config reloaded", "format", newConf.Log.Format, "level", logging.Level())
+		}
+	}
+	if newConf.BuffSize != r.conf.BuffSize {
+		logging.Component("reload").Warn("buffsize changed, it takes effect after restart", "old", r.conf.BuffSize, "new", newConf.BuffSize)
+	}
+	if !reflect.DeepEqual(newConf.Tail, r.conf.Tail) {
+		logging.Component("reload").Warn("tail config changed, it takes effect after restart")
+	}
+	if !reflect.DeepEqual(newConf.Metrics, r.conf.Metrics) {
+		logging.Component("reload").Warn("metrics config changed, it takes effect after restart")
+	}
+	if !reflect.DeepEqual(newConf.Admin, r.conf.Admin) {
+		logging.Component("reload").Warn("admin config changed, it takes effect after restart")
+	}
+	r.conf = newConf
+}
+
+// rebuiltProcessor 重新加载时新创建的processor,old为同名的旧processor,没有时为nil
+type rebuiltProcessor struct {
+	p, old processor.Processor
+}
+
+// rebuildProcessors 只重新创建配置有变化的processor,名称和配置都没有变化的继续使用原来的实例,
+// 这样dedup记住的ID、aggregate当前窗口的统计等状态不会因为其他processor的变化而丢失
+// 返回新的processor列表,以及其中新创建的processor(失败时由调用方关闭)
+func (r *reloader) rebuildProcessors(confs []config.ProcessorConfig) ([]processor.Processor, []rebuiltProcessor, error) {
+	current := make(map[string]int, len(r.conf.Processors))
+	for i, pc := range r.conf.Processors {
+		current[pc.Name] = i
+	}
+	var (
+		ps    []processor.Processor
+		built []rebuiltProcessor
+	)
+	for _, pc := range confs {
+		i, existed := current[pc.Name]
+		if existed && i < len(r.processors) && reflect.DeepEqual(r.conf.Processors[i], pc) {
+			ps = append(ps, r.processors[i])
+			continue
+		}
+		p, err := buildProcessor(pc, r.c)
+		if err != nil {
+			for _, b := range built {
+				b.p.Close()
+			}
+			return nil, nil, err
+		}
+		b := rebuiltProcessor{p: p}
+		if existed && i < len(r.processors) {
+			b.old = r.processors[i]
+		}
+		ps = append(ps, p)
+		built = append(built, b)
+	}
+	return ps, built, nil
+}
+
+// reloadLogging 只修改有变化的格式或者级别
+func reloadLogging(old, conf config.LogConfig) error {
+	if conf.Format != old.Format {
+		if err := logging.Init(os.Stderr, conf.Format); err != nil {
+			return err
+		}
+	}
+	if conf.Level != old.Level {
+		return logging.SetLevel(conf.Level)
+	}
+	return nil
+}
+
+// apply 让newConf生效,失败时撤销已经生效的变化
+func (r *reloader) apply(newConf config.AppConfig) error {
+	var undo []func()
+	rollback := func() {
+		for i := len(undo) - 1; i >= 0; i-- {
+			undo[i]()
+		}
+	}
+
+	//先处理writer,新的writer可以收到新的reader读到的日志
+	oldW, newW := writerSpecs(r.conf), writerSpecs(newConf)
+	for _, name := range sortedNames(newW) {
+		spec := newW[name]
+		old, existed := oldW[name]
+		if existed && reflect.DeepEqual(old.conf, spec.conf) {
+			continue
+		}
+		if err := r.c.UpdateOutput(name, spec.build); err != nil {
+			//旧的writer已经被移除了,需要恢复
+			if existed {
+				r.restoreOutput(name, old)
+			}
+			rollback()
+			return err
+		}
+		logging.Component("reload", "writer", name).Info("writer reloaded")
+		if existed {
+			undo = append(undo, func() { r.restoreOutput(name, old) })
+		} else {
+			undo = append(undo, func() { r.c.RemoveOutput(name) })
+		}
+	}
+
+	oldR, newR := readerSpecs(r.conf), readerSpecs(newConf)
+	for _, name := range sortedNames(newR) {
+		spec := newR[name]
+		old, existed := oldR[name]
+		if existed && reflect.DeepEqual(old.conf, spec.conf) {
+			continue
+		}
+		if err := r.c.UpdateReader(name, spec.build); err != nil {
+			if existed {
+				r.restoreReader(name, old)
+			}
+			rollback()
+			return err
+		}
+		logging.Component("reload", "reader", name).Info("reader reloaded")
+		if existed {
+			undo = append(undo, func() { r.restoreReader(name, old) })
+		} else {
+			undo = append(undo, func() { r.c.RemoveReader(name) })
+		}
+	}
+
+	//移除不会失败,放在最后
+	for name := range oldR {
+		if _, ok := newR[name]; !ok {
+			r.c.RemoveReader(name)
+			logging.Component("reload", "reader", name).Info("reader removed")
+		}
+	}
+	for name := range oldW {
+		if _, ok := newW[name]; !ok {
+			r.c.RemoveOutput(name)
+			logging.Component("reload", "writer", name).Info("writer removed")
+		}
+	}
+	return nil
+}
+
+// restoreOutput 按照原来的配置重新创建writer
+func (r *reloader) restoreOutput(name string, old writerSpec) {
+	if err := r.c.UpdateOutput(name, old.build); err != nil {
+		logging.Component("reload", "writer", name).Error("restore writer failed", "error", err)
+	}
+}
+
+// restoreReader 按照原来的配置重新创建reader
+func (r *reloader) restoreReader(name string, old readerSpec) {
+	if err := r.c.UpdateReader(name, old.build); err != nil {
+		logging.Component("reload", "reader", name).Error("restore reader failed", "error", err)
+	}
+}
@@ -0,0 +1,36 @@
+package app
+
+import (
+	"fmt"
+	"log-collector/collector"
+	"log-collector/config"
+	"log-collector/logging"
+	"log-collector/tail"
+	"net/http"
+)
+
+// startTail 开启实时tail的HTTP接口(GET /tail),conf为nil时不开启
+// 返回的函数用于关闭HTTP服务
+func startTail(c *collector.Collector, conf *config.TailConfig) (func(), error) {
+	if conf == nil {
+		return func() {}, nil
+	}
+	hub := tail.NewHub(tail.Options{
+		BufferSize:   conf.BufferSize,
+		MaxClients:   conf.MaxClients,
+		Token:        conf.Token,
+		WriteTimeout: conf.WriteTimeout,
+	})
+	mux := http.NewServeMux()
+	mux.Handle("/tail", hub)
+	addr, stop, err := startServer("tail", conf.Addr, mux)
+	if err != nil {
+		return nil, err
+	}
+	c.SetTap(hub)
+	logging.Component("tail").Info("tail endpoint listening", "url", fmt.Sprintf("http://%s/tail", addr))
+	return func() {
+		c.SetTap(nil)
+		stop()
+	}, nil
+}
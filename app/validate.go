@@ -0,0 +1,118 @@
+package app
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log-collector/config"
+	"log-collector/encoder"
+	"log-collector/processor"
+	"log-collector/reader"
+	"log-collector/writer"
+	"os"
+)
+
+// runValidate 检查配置文件,用法: log-collector validate -conf config.yaml
+// 配置没有问题时返回0,否则打印所有的问题并返回1,可以用在CI中
+func runValidate(args []string) int {
+	fs := flag.NewFlagSet("validate", flag.ContinueOnError)
+	conf := fs.String("conf", "config/config.yaml", "config path, eg: -conf config.yaml")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if _, err := loadConfig(*conf); err != nil {
+		printConfigError(os.Stderr, err)
+		return 1
+	}
+	fmt.Printf("%s: config is valid\n", *conf)
+	return 0
+}
+
+// loadConfig 读取配置文件,并检查每个reader和writer的类型以及该类型自己的配置
+func loadConfig(fileName string) (config.AppConfig, error) {
+	conf, err := config.GetConfig(fileName)
+	if err != nil {
+		return config.AppConfig{}, err
+	}
+	if err := checkConfig(conf); err != nil {
+		return config.AppConfig{}, err
+	}
+	return conf, nil
+}
+
+// checkConfig config包不知道有哪些类型,类型相关的检查交给reader、writer和processor包的Factory
+func checkConfig(conf config.AppConfig) error {
+	var errs config.ValidationErrors
+	for i, rc := range conf.Readers {
+		if _, err := reader.NewBuilder(rc.Type, rc.Options); err != nil {
+			errs = append(errs, fieldErrors(fmt.Sprintf("app.readers[%d]", i), err)...)
+		}
+	}
+	for i, wc := range conf.Writers {
+		path := fmt.Sprintf("app.writers[%d]", i)
+		if _, err := writer.NewBuilder(wc.Type, wc.Options); err != nil {
+			errs = append(errs, fieldErrors(path, err)...)
+		}
+		if e := wc.Encoding; e != nil {
+			if _, err := encoder.New(encoder.Type(e.Type), e.Template); err != nil {
+				field := ".encoding.type"
+				if e.Type == string(encoder.Template) {
+					field = ".encoding.template"
+				}
+				errs.Add(path+field, "%v", err)
+			}
+		}
+		if d := wc.DeadLetter; d != nil {
+			if _, err := writer.NewBuilder(d.Type, d.Options); err != nil {
+				errs = append(errs, fieldErrors(path+".deadLetter", err)...)
+			}
+		}
+	}
+	writers := make(map[string]bool)
+	for _, wc := range conf.Writers {
+		writers[wc.Name] = true
+	}
+	for i, pc := range conf.Processors {
+		path := fmt.Sprintf("app.processors[%d]", i)
+		b, err := processor.NewBuilder(pc.Type, pc.Options)
+		if err != nil {
+			errs = append(errs, fieldErrors(path, err)...)
+			continue
+		}
+		if o, ok := b.(processor.Outputs); ok {
+			outputs := o.Outputs()
+			for _, field := range sortedNames(outputs) {
+				if name := outputs[field]; !writers[name] {
+					errs.Add(path+"."+field, "writer %q does not exist", name)
+				}
+			}
+		}
+	}
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+// fieldErrors 把Factory返回的错误转换为prefix下的问题
+func fieldErrors(prefix string, err error) config.ValidationErrors {
+	var verrs config.ValidationErrors
+	if errors.As(err, &verrs) {
+		return verrs.WithPrefix(prefix)
+	}
+	return config.ValidationErrors{{Path: prefix, Reason: err.Error()}}
+}
+
+// printConfigError 打印读取配置的错误,配置有多个问题时每行打印一个
+func printConfigError(w io.Writer, err error) {
+	var verrs config.ValidationErrors
+	if !errors.As(err, &verrs) {
+		fmt.Fprintf(w, "invalid config: %v\n", err)
+		return
+	}
+	fmt.Fprintf(w, "invalid config, %d problems found:\n", len(verrs))
+	for _, e := range verrs {
+		fmt.Fprintf(w, "  - %s: %s\n", e.Path, e.Reason)
+	}
+}
@@ -2,65 +2,432 @@ package collector
 
 import (
 	"context"
-	"log"
+	"fmt"
+	"io"
+	"log-collector/logging"
+	"log-collector/message"
+	"log-collector/processor"
 	"log-collector/reader"
 	"log-collector/writer"
+	"sync"
+	"sync/atomic"
 )
 
+// Input collector的一个输入
+type Input struct {
+	Name   string
+	Reader reader.Reader
+}
+
+// Output collector的一个输出
+type Output struct {
+	Name      string
+	Writer    writer.Writer
+	Batch     BatchOptions
+	Dedicated bool //为true时只接收processor通过Emit指定发送给它的日志(汇总、告警等)
+}
+
+// Tap 旁路观察collector分发的每一条日志,例如实时tail,Publish不能阻塞
+type Tap interface {
+	Publish(msg *message.Message)
+}
+
 type Collector struct {
-	reader  []reader.Reader
-	writer  []writer.Writer
-	MsgChan chan []byte
+	MsgChan chan *message.Message
+	num     uint
+
+	//reader和sink可以在运行时通过UpdateReader、UpdateOutput等方法替换
+	mutex      sync.RWMutex
+	ctx        context.Context //Collect运行时的ctx,为nil表示还没有开始
+	errch      chan error
+	readers    []*source
+	sinks      []*sink
+	tap        Tap
+	processors []processor.Processor
+
+	emitCh chan emitted            //processor产生的日志
+	closed chan struct{}           //Collect返回后关闭,之后Emit不再阻塞
+	outs   atomic.Pointer[[]*sink] //sinks的快照,分发processor产生的日志时不需要加锁
+}
+
+// emitted processor产生的一条日志,to为writer的名称,为空时分发给所有不是dedicated的writer
+type emitted struct {
+	to  string
+	msg *message.Message
 }
 
-func NewCollector(reader []reader.Reader, writer []writer.Writer, num uint) *Collector {
-	return &Collector{
-		reader:  reader,
-		writer:  writer,
-		MsgChan: make(chan []byte, num),
+// source 一个正在运行的reader
+type source struct {
+	name   string
+	r      reader.Reader
+	cancel context.CancelFunc
+	done   chan struct{}
+	paused bool
+}
+
+func NewCollector(inputs []Input, outputs []Output, num uint) *Collector {
+	c := &Collector{
+		MsgChan: make(chan *message.Message, num),
+		num:     num,
+		emitCh:  make(chan emitted, num),
+		closed:  make(chan struct{}),
+	}
+	for _, in := range inputs {
+		c.readers = append(c.readers, &source{name: in.Name, r: in.Reader})
+	}
+	for _, o := range outputs {
+		c.sinks = append(c.sinks, newSink(o, num))
 	}
+	c.snapshotSinks()
+	return c
 }
 func (c *Collector) Collect(ctx context.Context) error {
-	errch := make(chan error)
-	//注意结束时把writer给关闭
+	ctx, cancel := context.WithCancel(ctx)
+	c.mutex.Lock()
+	c.ctx = ctx
+	c.errch = make(chan error, 1)
+	for _, s := range c.sinks {
+		s.start(ctx)
+	}
+	//reader返回错误都是大型错误,需要监听
+	for _, src := range c.readers {
+		c.startReader(src)
+	}
+	c.mutex.Unlock()
+
+	//注意结束时先等reader退出、processor把汇总等日志发送完、writer把缓存的日志写完,再把writer给关闭
+	emitDone := make(chan struct{})
 	defer func() {
-		close(errch)
-		for _, w := range c.writer {
-			w.Close()
+		cancel()
+		c.mutex.Lock()
+		for _, src := range c.readers {
+			c.stopReader(src)
+		}
+		processors := c.processors
+		c.processors = nil
+		c.mutex.Unlock()
+		closeProcessors(processors)
+		close(c.closed)
+		<-emitDone
+		c.mutex.Lock()
+		defer c.mutex.Unlock()
+		for _, s := range c.sinks {
+			s.stop()
 		}
 	}()
 
-	//reader返回错误都是大型错误,需要监听
-	for _, r := range c.reader {
-		go func(chan error) {
-			errch <- r.Read(ctx, c.MsgChan)
-		}(errch)
-	}
-
 	go c.write(ctx)
+	go func() {
+		defer close(emitDone)
+		c.emitLoop()
+	}()
 
 	//从errch中获取错误,如果有错误就返回，告知主程序取消
+	select {
+	case err := <-c.errch:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// UpdateReader 用build创建的reader替换名为name的reader,没有同名的reader时直接添加
+// 旧的reader会先停止,再创建新的reader,避免两者同时消费
+// 创建失败时旧的reader已经被移除,需要调用方决定是否恢复
+func (c *Collector) UpdateReader(name string, build func() (reader.Reader, error)) error {
+	c.removeReader(name)
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	r, err := build()
+	if err != nil {
+		return fmt.Errorf("create reader %s failed: %w", name, err)
+	}
+	src := &source{name: name, r: r}
+	c.readers = append(c.readers, src)
+	if c.ctx != nil {
+		c.startReader(src)
+	}
+	return nil
+}
+
+// RemoveReader 停止并移除名为name的reader
+func (c *Collector) RemoveReader(name string) {
+	c.removeReader(name)
+}
+
+// UpdateOutput 用build创建的输出替换名为name的输出,没有同名的输出时直接添加
+// 旧的writer会先把缓存的日志写完并关闭,再创建新的writer,避免两者同时使用同一个文件或者队列
+// 旧的writer在锁外面停止,停止期间(例如正在重试的写入)其他writer照常分发,发给这个输出的日志暂存在旧的sink中,
+// 替换时交给新的writer,不会丢失日志;创建失败时旧的输出已经被移除,暂存的日志被丢弃,需要调用方决定是否恢复
+func (c *Collector) UpdateOutput(name string, build func() (Output, error)) error {
+	c.interruptOutput(name)
+	c.mutex.RLock()
+	old := c.findOutput(name)
+	c.mutex.RUnlock()
+	if old != nil {
+		old.stop()
+	}
+
+	o, err := build()
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	var pending []*message.Message
+	if old != nil {
+		c.detachOutput(old)
+		pending = old.takePending()
+	}
+	if err != nil {
+		if len(pending) > 0 {
+			logging.Component("collector", "writer", name).Error("dropping records queued while replacing writer", "count", len(pending))
+		}
+		return fmt.Errorf("create writer %s failed: %w", name, err)
+	}
+	o.Name = name
+	s := newSink(o, c.num)
+	c.sinks = append(c.sinks, s)
+	c.snapshotSinks()
+	if c.ctx != nil {
+		s.start(c.ctx)
+	}
+	for _, msg := range pending {
+		s.send(msg)
+	}
+	return nil
+}
+
+// RemoveOutput 停止并移除名为name的输出
+// 先在锁内移除,再在锁外面停止,停止期间其他writer照常分发
+func (c *Collector) RemoveOutput(name string) {
+	c.interruptOutput(name)
+	c.mutex.Lock()
+	s := c.findOutput(name)
+	if s != nil {
+		c.detachOutput(s)
+	}
+	c.mutex.Unlock()
+	if s != nil {
+		s.stop()
+	}
+}
+
+// interruptOutput 在拿写锁之前让分发不再等待名为name的sink
+// 否则writer卡住、缓冲区满时,分发日志的协程持有读锁一直等待,替换或移除这个writer也会一直等待
+// 使用sinks的快照,不需要加锁
+func (c *Collector) interruptOutput(name string) {
+	for _, s := range *c.outs.Load() {
+		if s.name == name {
+			s.interrupt()
+		}
+	}
+}
+
+// removeReader 移除名为name的reader后,在锁外面停止它
+// reader停止前已经读到的日志需要交给分发的协程,分发时需要读锁,持有写锁等待会死锁
+func (c *Collector) removeReader(name string) {
+	c.mutex.Lock()
+	var src *source
+	for i, s := range c.readers {
+		if s.name == name {
+			src = s
+			c.readers = append(c.readers[:i:i], c.readers[i+1:]...)
+			break
+		}
+	}
+	c.mutex.Unlock()
+	if src != nil {
+		c.stopReader(src)
+	}
+}
+
+// findOutput 名为name的sink,没有时返回nil,调用前需要持有锁
+func (c *Collector) findOutput(name string) *sink {
+	for _, s := range c.sinks {
+		if s.name == name {
+			return s
+		}
+	}
+	return nil
+}
+
+// detachOutput 从sinks中移除s,之后分发的日志不会再交给它,调用前需要持有写锁
+func (c *Collector) detachOutput(s *sink) {
+	for i, cur := range c.sinks {
+		if cur == s {
+			c.sinks = append(c.sinks[:i:i], c.sinks[i+1:]...)
+			c.snapshotSinks()
+			return
+		}
+	}
+}
+
+// startReader 在后台运行reader,调用前需要持有锁
+func (c *Collector) startReader(src *source) {
+	ctx, cancel := context.WithCancel(c.ctx)
+	src.cancel = cancel
+	src.done = make(chan struct{})
+	parent := c.ctx
+	errch := c.errch
+	//给日志带上reader的名称后再交给collector
+	ch := make(chan *message.Message)
+	forwarded := make(chan struct{})
+	go func() {
+		defer close(forwarded)
+		for msg := range ch {
+			msg.Source = src.name
+			//reader交出日志后可能已经提交了offset(例如kafka),reader被停止时也要交给collector,只在collector结束时丢弃
+			select {
+			case c.MsgChan <- msg:
+			case <-parent.Done():
+			}
+		}
+	}()
+	go func() {
+		defer close(src.done)
+		err := src.r.Read(ctx, ch)
+		close(ch)
+		<-forwarded
+		//被UpdateReader/RemoveReader停止的reader不算错误
+		if ctx.Err() != nil && parent.Err() == nil {
+			return
+		}
+		select {
+		case errch <- err:
+		case <-parent.Done():
+		}
+	}()
+}
+
+// stopReader 停止reader并释放资源,等reader已经交出的日志都交给collector后返回
+// collector运行时调用前不能持有锁,见removeReader
+func (c *Collector) stopReader(src *source) {
+	if src.cancel != nil {
+		src.cancel()
+		<-src.done
+	}
+	if closer, ok := src.r.(io.Closer); ok {
+		if err := closer.Close(); err != nil {
+			logging.Component("collector", "reader", src.name).Error("close reader failed", "error", err)
+		}
+	}
+}
+
+// SetTap 设置旁路观察日志的Tap,为nil时取消
+func (c *Collector) SetTap(t Tap) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.tap = t
+}
+
+// SetProcessors 替换所有的processor,日志按ps的顺序依次经过每个processor
+// 原来的processor中不在ps里的会在替换后关闭(关闭时可能会发送当前窗口的汇总等日志),仍在ps里的继续使用
+func (c *Collector) SetProcessors(ps []processor.Processor) {
+	c.mutex.Lock()
+	old := c.processors
+	c.processors = ps
+	c.mutex.Unlock()
+	var removed []processor.Processor
+	for _, p := range old {
+		if !containsProcessor(ps, p) {
+			removed = append(removed, p)
+		}
+	}
+	//在锁外面关闭,关闭时Emit需要分发日志
+	closeProcessors(removed)
+}
+
+func containsProcessor(ps []processor.Processor, p processor.Processor) bool {
+	for _, q := range ps {
+		if q == p {
+			return true
+		}
+	}
+	return false
+}
+
+func closeProcessors(ps []processor.Processor) {
+	for _, p := range ps {
+		if err := p.Close(); err != nil {
+			logging.Component("collector").Error("close processor failed", "error", err)
+		}
+	}
+}
+
+// Emit 实现processor.Emitter,把processor产生的日志交给名为to的writer,to为空时分发给所有不是dedicated的writer
+// 缓冲区满时会阻塞,Collect返回后丢弃
+func (c *Collector) Emit(to string, msg *message.Message) {
+	select {
+	case c.emitCh <- emitted{to: to, msg: msg}:
+	case <-c.closed:
+	}
+}
+
+// snapshotSinks 修改sinks后更新快照,调用前需要持有锁
+func (c *Collector) snapshotSinks() {
+	sinks := append([]*sink(nil), c.sinks...)
+	c.outs.Store(&sinks)
+}
+
+// emitLoop 分发processor产生的日志
+// 和write不在同一个协程,并且不需要加锁,processor在Process中调用Emit时即使有人在等待写锁也不会死锁
+// Collect结束时,等processor关闭后把剩下的日志分发完才退出
+func (c *Collector) emitLoop() {
 	for {
 		select {
-		case err := <-errch:
-			return err
+		case e := <-c.emitCh:
+			c.dispatchEmitted(e)
+		case <-c.closed:
+			for len(c.emitCh) > 0 {
+				c.dispatchEmitted(<-c.emitCh)
+			}
+			return
 		}
 	}
 }
+
+// dispatchEmitted 分发给sinks的快照,正在被替换的writer可能会错过这条日志
+func (c *Collector) dispatchEmitted(e emitted) {
+	found := false
+	for _, s := range *c.outs.Load() {
+		if (e.to == "" && !s.dedicated) || s.name == e.to {
+			found = true
+			s.send(e.msg)
+		}
+	}
+	if !found && e.to != "" {
+		logging.Component("collector", "writer", e.to).Warn("writer does not exist, dropping emitted record", "source", e.msg.Source)
+	}
+}
+
+// write 日志经过processor处理后分发给每个writer
 func (c *Collector) write(ctx context.Context) {
 	for {
 		select {
 		case msg := <-c.MsgChan:
-			for _, w := range c.writer {
-				go func() {
-					err := w.Write(msg)
-					if err != nil {
-						log.Println(err)
+			//分发期间持有读锁,替换writer时会等这条日志分发完(将要被替换的writer不会阻塞分发,见interruptOutput)
+			c.mutex.RLock()
+			if c.process(msg) {
+				if c.tap != nil {
+					c.tap.Publish(msg)
+				}
+				for _, s := range c.sinks {
+					if !s.dedicated {
+						s.send(msg)
 					}
-				}()
+				}
 			}
+			c.mutex.RUnlock()
 		case <-ctx.Done():
 			return
 		}
 	}
 }
+
+// process 依次经过每个processor,返回false表示日志被丢弃,调用前需要持有锁
+func (c *Collector) process(msg *message.Message) bool {
+	for _, p := range c.processors {
+		if !p.Process(msg) {
+			return false
+		}
+	}
+	return true
+}
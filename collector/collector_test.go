@@ -0,0 +1,428 @@
+package collector
+
+import (
+	"context"
+	"log-collector/message"
+	"log-collector/processor"
+	"log-collector/reader"
+	"reflect"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// batchRecorder 记录每次WriteBatch的批次大小
+type batchRecorder struct {
+	mutex   sync.Mutex
+	batches []int
+	singles int
+}
+
+func (b *batchRecorder) Write(data []byte) error {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	b.singles++
+	return nil
+}
+func (b *batchRecorder) WriteBatch(batch [][]byte) error {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	b.batches = append(b.batches, len(batch))
+	return nil
+}
+func (b *batchRecorder) Close() error {
+	return nil
+}
+func (b *batchRecorder) snapshot() []int {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	return append([]int(nil), b.batches...)
+}
+
+func TestSink_FlushByCount(t *testing.T) {
+	w := &batchRecorder{}
+	s := newSink(Output{Writer: w, Batch: BatchOptions{MaxCount: 3, Linger: time.Hour}}, 10)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		s.run(ctx)
+		close(done)
+	}()
+	for i := 0; i < 7; i++ {
+		s.ch <- message.New([]byte("x"))
+	}
+	deadline := time.Now().Add(time.Second)
+	for len(w.snapshot()) < 2 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	//停止时把剩下不满一批的日志写完
+	cancel()
+	<-done
+	got := w.snapshot()
+	if len(got) != 3 || got[0] != 3 || got[1] != 3 || got[2] != 1 {
+		t.Errorf("unexpected batches: %v", got)
+	}
+	if w.singles != 0 {
+		t.Errorf("expected no single writes, got %d", w.singles)
+	}
+}
+
+func TestSink_FlushByLinger(t *testing.T) {
+	w := &batchRecorder{}
+	s := newSink(Output{Writer: w, Batch: BatchOptions{MaxCount: 100, Linger: 20 * time.Millisecond}}, 10)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go s.run(ctx)
+
+	s.ch <- message.New([]byte("a"))
+	s.ch <- message.New([]byte("b"))
+	deadline := time.Now().Add(time.Second)
+	for len(w.snapshot()) < 1 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	if got := w.snapshot(); len(got) != 1 || got[0] != 2 {
+		t.Errorf("unexpected batches: %v", got)
+	}
+}
+
+func TestSink_FlushByBytes(t *testing.T) {
+	w := &batchRecorder{}
+	s := newSink(Output{Writer: w, Batch: BatchOptions{MaxCount: 100, MaxBytes: 10, Linger: time.Hour}}, 10)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go s.run(ctx)
+
+	s.ch <- message.New([]byte("12345"))
+	s.ch <- message.New([]byte("67890"))
+	deadline := time.Now().Add(time.Second)
+	for len(w.snapshot()) < 1 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	if got := w.snapshot(); len(got) != 1 || got[0] != 2 {
+		t.Errorf("unexpected batches: %v", got)
+	}
+}
+
+// chanReader 把in中的日志发送给collector
+type chanReader struct {
+	in     chan []byte
+	closed chan struct{}
+}
+
+func (r *chanReader) Read(ctx context.Context, ch chan<- *message.Message) error {
+	for {
+		select {
+		case msg := <-r.in:
+			ch <- message.New(msg)
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+func (r *chanReader) Close() error {
+	close(r.closed)
+	return nil
+}
+
+// listWriter 记录写入的日志
+type listWriter struct {
+	mutex  sync.Mutex
+	got    []string
+	closed bool
+}
+
+func (l *listWriter) Write(data []byte) error {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	l.got = append(l.got, string(data))
+	return nil
+}
+func (l *listWriter) Close() error {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	l.closed = true
+	return nil
+}
+func (l *listWriter) count() int {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	return len(l.got)
+}
+
+func waitFor(t *testing.T, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("timeout")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestCollector_UpdateAtRuntime(t *testing.T) {
+	r1 := &chanReader{in: make(chan []byte), closed: make(chan struct{})}
+	w1 := &listWriter{}
+	c := NewCollector([]Input{{Name: "r", Reader: r1}}, []Output{{Name: "w", Writer: w1}}, 10)
+	ctx, cancel := context.WithCancel(context.Background())
+	errch := make(chan error, 1)
+	go func() { errch <- c.Collect(ctx) }()
+
+	r1.in <- []byte("1")
+	waitFor(t, func() bool { return w1.count() == 1 })
+
+	//替换writer,旧的writer被关闭,新的writer收到之后的日志
+	w2 := &listWriter{}
+	if err := c.UpdateOutput("w", func() (Output, error) { return Output{Writer: w2}, nil }); err != nil {
+		t.Fatal(err)
+	}
+	if !w1.closed {
+		t.Error("expected old writer to be closed")
+	}
+	r1.in <- []byte("2")
+	waitFor(t, func() bool { return w2.count() == 1 })
+
+	//替换reader,旧的reader被停止并关闭,collector继续运行
+	r2 := &chanReader{in: make(chan []byte), closed: make(chan struct{})}
+	if err := c.UpdateReader("r", func() (reader.Reader, error) { return r2, nil }); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-r1.closed:
+	default:
+		t.Error("expected old reader to be closed")
+	}
+	r2.in <- []byte("3")
+	waitFor(t, func() bool { return w2.count() == 2 })
+
+	cancel()
+	if err := <-errch; err != context.Canceled {
+		t.Errorf("Collect() error = %v", err)
+	}
+	if !w2.closed {
+		t.Error("expected writer to be closed after Collect returns")
+	}
+}
+
+// messageRecorder 记录WriteMessages收到的日志
+type messageRecorder struct {
+	listWriter
+	msgs []*message.Message
+}
+
+func (m *messageRecorder) WriteMessages(msgs []*message.Message) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.msgs = append(m.msgs, msgs...)
+	return nil
+}
+
+func (m *messageRecorder) count() int {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	return len(m.msgs)
+}
+
+func TestCollector_MessageMetadata(t *testing.T) {
+	r := &chanReader{in: make(chan []byte), closed: make(chan struct{})}
+	w := &messageRecorder{}
+	c := NewCollector([]Input{{Name: "kafka-a", Reader: r}}, []Output{{Name: "w", Writer: w, Batch: BatchOptions{Linger: time.Millisecond}}}, 10)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go c.Collect(ctx)
+
+	r.in <- []byte("x")
+	waitFor(t, func() bool { return w.count() == 1 })
+	if src := w.msgs[0].Source; src != "kafka-a" {
+		t.Errorf("Source = %q, want kafka-a", src)
+	}
+	if w.listWriter.count() != 0 {
+		t.Error("expected WriteMessages to be used instead of Write")
+	}
+}
+
+// emitProcessor 丢弃内容为drop的日志,其他日志转发一份给dedicated writer,关闭时再发送一条
+type emitProcessor struct {
+	emit processor.Emitter
+}
+
+func (p *emitProcessor) Process(msg *message.Message) bool {
+	if string(msg.Value) == "drop" {
+		return false
+	}
+	p.emit.Emit("d", message.New([]byte("seen "+string(msg.Value))))
+	return true
+}
+func (p *emitProcessor) Close() error {
+	p.emit.Emit("d", message.New([]byte("closed")))
+	return nil
+}
+
+func TestCollector_Processors(t *testing.T) {
+	r := &chanReader{in: make(chan []byte), closed: make(chan struct{})}
+	w, d := &listWriter{}, &listWriter{}
+	c := NewCollector([]Input{{Name: "r", Reader: r}}, []Output{
+		{Name: "w", Writer: w},
+		{Name: "d", Writer: d, Dedicated: true},
+	}, 10)
+	p := &emitProcessor{emit: c}
+	c.SetProcessors([]processor.Processor{p})
+	ctx, cancel := context.WithCancel(context.Background())
+	errch := make(chan error, 1)
+	go func() { errch <- c.Collect(ctx) }()
+
+	r.in <- []byte("drop")
+	r.in <- []byte("1")
+	waitFor(t, func() bool { return w.count() == 1 && d.count() == 1 })
+	//替换后仍然使用的processor不会被关闭
+	c.SetProcessors([]processor.Processor{p})
+
+	//关闭时processor发送的日志也会写入writer
+	cancel()
+	<-errch
+	if want := []string{"1"}; !reflect.DeepEqual(w.got, want) {
+		t.Errorf("writer got %q, want %q", w.got, want)
+	}
+	if want := []string{"seen 1", "closed"}; !reflect.DeepEqual(d.got, want) {
+		t.Errorf("dedicated writer got %q, want %q", d.got, want)
+	}
+}
+
+// gateWriter 每次写入都等待gate关闭
+type gateWriter struct {
+	listWriter
+	gate chan struct{}
+}
+
+func (g *gateWriter) Write(data []byte) error {
+	<-g.gate
+	return g.listWriter.Write(data)
+}
+
+func TestCollector_ReplaceStuckOutput(t *testing.T) {
+	r := &chanReader{in: make(chan []byte), closed: make(chan struct{})}
+	stuck, other := &gateWriter{gate: make(chan struct{})}, &listWriter{}
+	c := NewCollector([]Input{{Name: "r", Reader: r}}, []Output{
+		{Name: "a", Writer: stuck},
+		{Name: "b", Writer: other},
+	}, 10)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go c.Collect(ctx)
+
+	//a卡在写入第一条日志
+	r.in <- []byte("1")
+	waitFor(t, func() bool { return other.count() == 1 })
+	replaced := &listWriter{}
+	updated := make(chan error, 1)
+	go func() {
+		updated <- c.UpdateOutput("a", func() (Output, error) { return Output{Writer: replaced}, nil })
+	}()
+	time.Sleep(20 * time.Millisecond)
+
+	//等待旧的writer停止期间,其他writer照常收到日志
+	r.in <- []byte("2")
+	r.in <- []byte("3")
+	waitFor(t, func() bool { return other.count() == 3 })
+	select {
+	case err := <-updated:
+		t.Fatalf("UpdateOutput returned before the old writer stopped: %v", err)
+	default:
+	}
+
+	close(stuck.gate)
+	if err := <-updated; err != nil {
+		t.Fatal(err)
+	}
+	//停止期间发给a的日志由旧的writer写完或者交给新的writer,不会丢失也不会重复
+	waitFor(t, func() bool { return stuck.count()+replaced.count() == 3 })
+	stuck.mutex.Lock()
+	replaced.mutex.Lock()
+	got := append(append([]string(nil), stuck.got...), replaced.got...)
+	replaced.mutex.Unlock()
+	stuck.mutex.Unlock()
+	if !reflect.DeepEqual(got, []string{"1", "2", "3"}) {
+		t.Errorf("written = %v", got)
+	}
+}
+
+func TestSink_InterruptBlockedSend(t *testing.T) {
+	w := &gateWriter{gate: make(chan struct{})}
+	s := newSink(Output{Name: "w", Writer: w}, 1)
+	s.start(context.Background())
+
+	//writer卡住时第一条在写入,第二条在缓冲区,第三条的分发被阻塞
+	sent := make(chan struct{})
+	go func() {
+		defer close(sent)
+		for _, v := range []string{"1", "2", "3"} {
+			s.send(message.New([]byte(v)))
+		}
+	}()
+	select {
+	case <-sent:
+		t.Fatal("expected send to block on a stuck writer")
+	case <-time.After(20 * time.Millisecond):
+	}
+	s.interrupt()
+	select {
+	case <-sent:
+	case <-time.After(time.Second):
+		t.Fatal("send is still blocked after interrupt")
+	}
+	s.send(message.New([]byte("4")))
+
+	close(w.gate)
+	s.stop()
+	if got := w.got; !reflect.DeepEqual(got, []string{"1", "2", "3", "4"}) {
+		t.Errorf("written = %v", got)
+	}
+}
+
+// markReader 日志被collector接收后才计数,模拟kafka交出日志后提交offset
+type markReader struct {
+	in     chan []byte
+	marked atomic.Int32
+}
+
+func (r *markReader) Read(ctx context.Context, ch chan<- *message.Message) error {
+	for {
+		select {
+		case v := <-r.in:
+			select {
+			case ch <- message.New(v):
+				r.marked.Add(1)
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+func TestCollector_RemoveReaderKeepsHandedOffRecords(t *testing.T) {
+	r := &markReader{in: make(chan []byte, 10)}
+	w := &gateWriter{gate: make(chan struct{})}
+	c := NewCollector([]Input{{Name: "r", Reader: r}}, []Output{{Name: "w", Writer: w}}, 1)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go c.Collect(ctx)
+
+	//writer卡住时:一条在写入,一条在sink的缓冲区,一条在分发,一条在MsgChan,一条在转发的协程中
+	for i := 0; i < 6; i++ {
+		r.in <- []byte{byte('0' + i)}
+	}
+	waitFor(t, func() bool { return r.marked.Load() == 5 })
+
+	removed := make(chan struct{})
+	go func() {
+		defer close(removed)
+		c.RemoveReader("r")
+	}()
+	time.Sleep(20 * time.Millisecond)
+	close(w.gate)
+	<-removed
+	waitFor(t, func() bool { return w.count() == int(r.marked.Load()) })
+}
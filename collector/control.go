@@ -0,0 +1,149 @@
+package collector
+
+import (
+	"errors"
+	"fmt"
+	"log-collector/reader"
+	"log-collector/writer"
+)
+
+var (
+	// ErrNotFound 没有指定名称的reader或者writer
+	ErrNotFound = errors.New("not found")
+	// ErrNotSupported reader或者writer不支持该操作,例如暂停不是kafka的reader
+	ErrNotSupported = errors.New("not supported")
+)
+
+// ReaderStatus 一个reader的状态
+type ReaderStatus struct {
+	Name     string `json:"name"`
+	Running  bool   `json:"running"`
+	Paused   bool   `json:"paused"`
+	Pausable bool   `json:"pausable"` //是否支持暂停
+}
+
+// WriterStatus 一个writer的状态
+type WriterStatus struct {
+	Name      string `json:"name"`
+	Dedicated bool   `json:"dedicated"`
+	Queued    int    `json:"queued"`  //等待写入的条数
+	Written   int64  `json:"written"` //写入成功的条数
+	Failed    int64  `json:"failed"`  //写入失败的条数
+	Rotatable bool   `json:"rotatable"`
+}
+
+// Readers 所有reader的状态,按添加的顺序
+func (c *Collector) Readers() []ReaderStatus {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+	statuses := make([]ReaderStatus, 0, len(c.readers))
+	for _, src := range c.readers {
+		_, pausable := src.r.(reader.Pauser)
+		st := ReaderStatus{Name: src.name, Paused: src.paused, Pausable: pausable}
+		if src.done != nil {
+			select {
+			case <-src.done:
+			default:
+				st.Running = true
+			}
+		}
+		statuses = append(statuses, st)
+	}
+	return statuses
+}
+
+// Writers 所有writer的状态,按添加的顺序
+func (c *Collector) Writers() []WriterStatus {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+	statuses := make([]WriterStatus, 0, len(c.sinks))
+	for _, s := range c.sinks {
+		statuses = append(statuses, WriterStatus{
+			Name:      s.name,
+			Dedicated: s.dedicated,
+			Queued:    len(s.ch),
+			Written:   s.written.Load(),
+			Failed:    s.failed.Load(),
+			Rotatable: isRotatable(s.w),
+		})
+	}
+	return statuses
+}
+
+// PauseReader 暂停名为name的reader,reader需要实现reader.Pauser
+// 被UpdateReader替换(例如重新加载配置)后的reader不会保持暂停
+func (c *Collector) PauseReader(name string) error {
+	return c.setPaused(name, true)
+}
+
+// ResumeReader 恢复被暂停的reader
+func (c *Collector) ResumeReader(name string) error {
+	return c.setPaused(name, false)
+}
+
+func (c *Collector) setPaused(name string, paused bool) error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	for _, src := range c.readers {
+		if src.name != name {
+			continue
+		}
+		p, ok := src.r.(reader.Pauser)
+		if !ok {
+			return fmt.Errorf("reader %s: pause %w", name, ErrNotSupported)
+		}
+		if paused {
+			p.Pause()
+		} else {
+			p.Resume()
+		}
+		src.paused = paused
+		return nil
+	}
+	return fmt.Errorf("reader %s %w", name, ErrNotFound)
+}
+
+// RotateWriter 立即切割名为name的writer的文件,writer(或者被包装的writer)需要实现writer.Rotator
+func (c *Collector) RotateWriter(name string) error {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+	for _, s := range c.sinks {
+		if s.name != name {
+			continue
+		}
+		ok, err := writer.Rotate(s.w)
+		if !ok {
+			return fmt.Errorf("writer %s: rotate %w", name, ErrNotSupported)
+		}
+		return err
+	}
+	return fmt.Errorf("writer %s %w", name, ErrNotFound)
+}
+
+// Flush 把所有writer攒批中的日志和缓冲区立即写入
+func (c *Collector) Flush() error {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+	var errs []error
+	for _, s := range c.sinks {
+		if err := s.requestFlush(); err != nil {
+			errs = append(errs, fmt.Errorf("flush writer %s failed: %w", s.name, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// isRotatable w或者w包装的writer是否实现了writer.Rotator
+func isRotatable(w writer.Writer) bool {
+	for w != nil {
+		if _, ok := w.(writer.Rotator); ok {
+			return true
+		}
+		wrapper, ok := w.(writer.Wrapper)
+		if !ok {
+			return false
+		}
+		w = wrapper.Unwrap()
+	}
+	return false
+}
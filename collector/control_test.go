@@ -0,0 +1,91 @@
+package collector
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// pauseReader 记录是否被暂停
+type pauseReader struct {
+	chanReader
+	paused atomic.Bool
+}
+
+func (r *pauseReader) Pause()  { r.paused.Store(true) }
+func (r *pauseReader) Resume() { r.paused.Store(false) }
+
+func TestCollector_Control(t *testing.T) {
+	r1 := &pauseReader{chanReader: chanReader{in: make(chan []byte), closed: make(chan struct{})}}
+	r2 := &chanReader{in: make(chan []byte), closed: make(chan struct{})}
+	batch := &batchRecorder{}
+	list := &listWriter{}
+	c := NewCollector(
+		[]Input{{Name: "kafka", Reader: r1}, {Name: "other", Reader: r2}},
+		[]Output{
+			{Name: "batch", Writer: batch, Batch: BatchOptions{MaxCount: 100, Linger: time.Hour}},
+			{Name: "list", Writer: list},
+		}, 10)
+	ctx, cancel := context.WithCancel(context.Background())
+	errch := make(chan error, 1)
+	go func() { errch <- c.Collect(ctx) }()
+	defer func() {
+		cancel()
+		<-errch
+	}()
+
+	//暂停和恢复
+	if err := c.PauseReader("kafka"); err != nil {
+		t.Fatal(err)
+	}
+	if !r1.paused.Load() {
+		t.Error("expected reader to be paused")
+	}
+	if err := c.PauseReader("other"); !errors.Is(err, ErrNotSupported) {
+		t.Errorf("PauseReader(other) error = %v, want ErrNotSupported", err)
+	}
+	if err := c.PauseReader("missing"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("PauseReader(missing) error = %v, want ErrNotFound", err)
+	}
+	waitFor(t, func() bool { return c.Readers()[0].Running })
+	got := c.Readers()
+	if len(got) != 2 || got[0] != (ReaderStatus{Name: "kafka", Running: true, Paused: true, Pausable: true}) ||
+		got[1].Paused || got[1].Pausable {
+		t.Errorf("Readers() = %+v", got)
+	}
+	if err := c.ResumeReader("kafka"); err != nil {
+		t.Fatal(err)
+	}
+	if r1.paused.Load() || c.Readers()[0].Paused {
+		t.Error("expected reader to be resumed")
+	}
+
+	//linger很长时攒批的日志只有Flush后才写入
+	r2.in <- []byte("1")
+	r2.in <- []byte("2")
+	waitFor(t, func() bool { return list.count() == 2 })
+	//缓冲区为空后攒批的sink已经收到了两条日志
+	waitFor(t, func() bool { return c.Writers()[0].Queued == 0 })
+	if len(batch.snapshot()) != 0 {
+		t.Fatalf("unexpected batches before flush: %v", batch.snapshot())
+	}
+	if err := c.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	if got := batch.snapshot(); len(got) != 1 || got[0] != 2 {
+		t.Errorf("unexpected batches after flush: %v", got)
+	}
+	writers := c.Writers()
+	if len(writers) != 2 || writers[0].Written != 2 || writers[1].Written != 2 || writers[0].Rotatable {
+		t.Errorf("Writers() = %+v", writers)
+	}
+
+	if err := c.RotateWriter("list"); !errors.Is(err, ErrNotSupported) {
+		t.Errorf("RotateWriter(list) error = %v, want ErrNotSupported", err)
+	}
+	if err := c.RotateWriter("missing"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("RotateWriter(missing) error = %v, want ErrNotFound", err)
+	}
+}
@@ -0,0 +1,271 @@
+package collector
+
+import (
+	"context"
+	"errors"
+	"log-collector/logging"
+	"log-collector/message"
+	"log-collector/writer"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// BatchOptions 攒批的参数,只对实现了writer.BatchWriter或writer.MessageWriter的writer生效
+// 满足任意一个条件就会写入
+type BatchOptions struct {
+	MaxCount int           //一批最多的条数
+	MaxBytes int           //一批最多的字节数
+	Linger   time.Duration //第一条日志进入批次后最多等待的时间
+}
+
+var DefaultBatchOptions = BatchOptions{
+	MaxCount: 1000,
+	MaxBytes: 1 << 20,
+	Linger:   100 * time.Millisecond,
+}
+
+// withDefaults 给未设置的字段填上默认值
+func (o BatchOptions) withDefaults() BatchOptions {
+	if o.MaxCount <= 0 {
+		o.MaxCount = DefaultBatchOptions.MaxCount
+	}
+	if o.MaxBytes <= 0 {
+		o.MaxBytes = DefaultBatchOptions.MaxBytes
+	}
+	if o.Linger <= 0 {
+		o.Linger = DefaultBatchOptions.Linger
+	}
+	return o
+}
+
+// sink 每个writer对应一个sink,由单独的协程按顺序写入
+type sink struct {
+	name      string
+	w         writer.Writer
+	batch     BatchOptions
+	dedicated bool
+	ch        chan *message.Message
+	flushReq  chan chan error //要求把攒批中的日志和writer的缓冲区立即写入
+
+	//sink将要被替换或者移除时关闭,之后分发的日志放入pending,在stop时写入,不再阻塞分发
+	stopping     chan struct{}
+	stoppingOnce sync.Once
+	pendingMutex sync.Mutex
+	pending      []*message.Message
+
+	written atomic.Int64 //写入成功的条数
+	failed  atomic.Int64 //写入失败的条数
+
+	ctx      context.Context //sink运行时的ctx,结束后不再接收日志
+	cancel   context.CancelFunc
+	done     chan struct{}
+	stopOnce sync.Once //替换时在锁外面停止,可能和collector结束时的停止同时发生
+}
+
+func newSink(o Output, num uint) *sink {
+	return &sink{
+		name:      o.Name,
+		w:         o.Writer,
+		batch:     o.Batch.withDefaults(),
+		dedicated: o.Dedicated,
+		ch:        make(chan *message.Message, num),
+		flushReq:  make(chan chan error),
+		stopping:  make(chan struct{}),
+	}
+}
+
+// interrupt 让等待这个sink的分发不再阻塞,例如writer卡住时替换它,分发日志的协程不会一直持有collector的读锁
+func (s *sink) interrupt() {
+	s.stoppingOnce.Do(func() { close(s.stopping) })
+}
+
+// addPending 保存将要停止的sink收到的日志
+func (s *sink) addPending(msg *message.Message) {
+	s.pendingMutex.Lock()
+	s.pending = append(s.pending, msg)
+	s.pendingMutex.Unlock()
+}
+
+// takePending 取出stop之后才收到的日志,sink被替换时交给新的sink
+func (s *sink) takePending() []*message.Message {
+	s.pendingMutex.Lock()
+	defer s.pendingMutex.Unlock()
+	pending := s.pending
+	s.pending = nil
+	return pending
+}
+
+// requestFlush 把攒批中的日志写入writer,再把writer的缓冲区写入,sink没有运行时直接写入writer的缓冲区
+func (s *sink) requestFlush() error {
+	if s.ctx == nil {
+		return writer.Flush(s.w)
+	}
+	req := make(chan error, 1)
+	select {
+	case s.flushReq <- req:
+		return <-req
+	case <-s.ctx.Done():
+		return nil
+	}
+}
+
+// send 把日志交给sink,sink已经停止并且缓冲区已满时丢弃
+// sink将要停止(interrupt)时不再等待缓冲区,日志在stop时写入
+func (s *sink) send(msg *message.Message) {
+	select {
+	case <-s.stopping:
+		s.addPending(msg)
+		return
+	default:
+	}
+	select {
+	case s.ch <- msg:
+		return
+	default:
+	}
+	select {
+	case s.ch <- msg:
+	case <-s.stopping:
+		s.addPending(msg)
+	case <-s.ctx.Done():
+	}
+}
+
+// start 在后台开始写入,parent结束或者调用stop后停止
+func (s *sink) start(parent context.Context) {
+	s.ctx, s.cancel = context.WithCancel(parent)
+	s.done = make(chan struct{})
+	go func() {
+		defer close(s.done)
+		s.run(s.ctx)
+	}()
+}
+
+// stop 停止写入,把缓存的日志写完后关闭writer,可以重复调用
+func (s *sink) stop() {
+	s.stopOnce.Do(s.doStop)
+}
+
+func (s *sink) doStop() {
+	s.interrupt()
+	if s.cancel != nil {
+		s.cancel()
+		<-s.done
+	}
+	//停止之后才放入的日志(例如processor关闭时发送的汇总),以及interrupt之后分发的日志
+	batch := make([]*message.Message, 0, len(s.ch))
+	for len(s.ch) > 0 {
+		batch = append(batch, <-s.ch)
+	}
+	s.pendingMutex.Lock()
+	batch = append(batch, s.pending...)
+	s.pending = nil
+	s.pendingMutex.Unlock()
+	if len(batch) > 0 {
+		if writer.SupportsBatch(s.w) {
+			s.flush(batch)
+		} else {
+			for _, msg := range batch {
+				s.writeOne(msg)
+			}
+		}
+	}
+	if err := s.w.Close(); err != nil {
+		logging.Component("collector", "writer", s.name).Error("close writer failed", "error", err)
+	}
+}
+
+func (s *sink) run(ctx context.Context) {
+	if !writer.SupportsBatch(s.w) {
+		for {
+			select {
+			case msg := <-s.ch:
+				s.writeOne(msg)
+			case req := <-s.flushReq:
+				req <- writer.Flush(s.w)
+			case <-ctx.Done():
+				for len(s.ch) > 0 {
+					s.writeOne(<-s.ch)
+				}
+				return
+			}
+		}
+	}
+
+	var (
+		batch  []*message.Message
+		size   int
+		timer  *time.Timer
+		timerC <-chan time.Time
+	)
+	add := func(msg *message.Message) {
+		batch = append(batch, msg)
+		size += len(msg.Value)
+		if len(batch) >= s.batch.MaxCount || size >= s.batch.MaxBytes {
+			s.flush(batch)
+			batch, size = nil, 0
+		}
+	}
+	for {
+		select {
+		case msg := <-s.ch:
+			add(msg)
+			switch {
+			case len(batch) == 0 && timerC != nil:
+				//已经因为条数或者字节数写入了
+				timer.Stop()
+				timerC = nil
+			case len(batch) == 1 && timerC == nil:
+				timer = time.NewTimer(s.batch.Linger)
+				timerC = timer.C
+			}
+		case <-timerC:
+			timerC = nil
+			s.flush(batch)
+			batch, size = nil, 0
+		case req := <-s.flushReq:
+			if timerC != nil {
+				timer.Stop()
+				timerC = nil
+			}
+			s.flush(batch)
+			batch, size = nil, 0
+			req <- writer.Flush(s.w)
+		case <-ctx.Done():
+			for len(s.ch) > 0 {
+				add(<-s.ch)
+			}
+			s.flush(batch)
+			return
+		}
+	}
+}
+
+func (s *sink) writeOne(msg *message.Message) {
+	if err := s.w.Write(msg.Value); err != nil {
+		s.failed.Add(1)
+		logging.Component("collector", "writer", s.name).Error("write failed", "error", err)
+		return
+	}
+	s.written.Add(1)
+}
+
+func (s *sink) flush(batch []*message.Message) {
+	if len(batch) == 0 {
+		return
+	}
+	err := writer.Deliver(s.w, batch)
+	if err == nil {
+		s.written.Add(int64(len(batch)))
+		return
+	}
+	failed := len(batch)
+	var berr *writer.BatchError
+	if errors.As(err, &berr) {
+		failed = len(berr.Errors)
+	}
+	s.written.Add(int64(len(batch) - failed))
+	s.failed.Add(int64(failed))
+	logging.Component("collector", "writer", s.name).Error("write batch failed", "failed", failed, "total", len(batch), "error", err)
+}
@@ -1,34 +1,103 @@
 package config
 
 import (
+	"bytes"
 	"fmt"
+	"github.com/fsnotify/fsnotify"
 	"github.com/spf13/viper"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"time"
 )
 
 type VipperSetting struct {
 	*viper.Viper
 }
 type AppConfig struct {
-	BuffSize uint         `yaml:"buffsize"`
-	Reader   ReaderConfig `yaml:"reader"`
-	Writer   WriterConfig `yaml:"writer"`
+	BuffSize   uint              `yaml:"buffsize"`
+	Readers    []ReaderConfig    `yaml:"readers"`
+	Processors []ProcessorConfig `yaml:"processors"` //日志分发给writer之前按顺序经过的processor
+	Writers    []WriterConfig    `yaml:"writers"`
+	Tail       *TailConfig       `yaml:"tail"`    //实时tail的HTTP接口,不配置时不开启
+	Metrics    *MetricsConfig    `yaml:"metrics"` //Prometheus格式的metrics接口,不配置时不开启
+	Admin      *AdminConfig      `yaml:"admin"`   //运行时管理的HTTP接口,不配置时不开启
+	Log        LogConfig         `yaml:"log"`     //程序自己的日志
+
+	//旧版本的配置格式(reader.kafka、writer.file、writer.stdout),读取时会转换为Readers和Writers
+	Reader map[string]interface{} `yaml:"reader"`
+	Writer map[string]interface{} `yaml:"writer"`
 }
+
+// ReaderConfig 一个reader实例的配置
 type ReaderConfig struct {
-	Kafka *KafkaConfig `yaml:"kafka"`
+	Name    string                 `yaml:"name"`                           //reader的名称,不能重复,默认为type
+	Type    string                 `yaml:"type"`                           //reader的类型,例如kafka
+	Options map[string]interface{} `yaml:",inline" mapstructure:",remain"` //该类型reader自己的配置,由reader包解析
 }
-type KafkaConfig struct {
-	BrokersAddr []string `yaml:"brokersAddr"` //broker的地址
-	Topic       string   `yaml:"topic"`       //topic
+
+// ProcessorConfig 一个processor实例的配置
+type ProcessorConfig struct {
+	Name    string                 `yaml:"name"`                           //processor的名称,不能重复,默认为type
+	Type    string                 `yaml:"type"`                           //processor的类型,例如aggregate
+	Options map[string]interface{} `yaml:",inline" mapstructure:",remain"` //该类型processor自己的配置,由processor包解析
 }
+
+// WriterConfig 一个writer实例的配置
 type WriterConfig struct {
-	Stdout bool        `yaml:"stdout"`
-	File   *FileConfig `yaml:"file"`
+	Name          string `yaml:"name"` //writer的名称,不能重复,默认为type
+	Type          string `yaml:"type"` //writer的类型,例如file、kafka、stdout
+	WriterOptions `yaml:",inline" mapstructure:",squash"`
+	Options       map[string]interface{} `yaml:",inline" mapstructure:",remain"` //该类型writer自己的配置,由writer包解析
+}
+
+// SASLConfig kafka的SASL认证,目前只支持PLAIN
+// 密码可以用password_file从挂载的文件中读取
+type SASLConfig struct {
+	Mechanism string `yaml:"mechanism"` //默认PLAIN
+	User      string `yaml:"user"`
+	Password  string `yaml:"password"`
+}
+
+// WriterOptions 各类writer通用的可选配置
+type WriterOptions struct {
+	Spool      *SpoolConfig      `yaml:"spool"`      //磁盘队列,目的地不可用时暂存日志
+	Retry      *RetryConfig      `yaml:"retry"`      //写入失败时的重试策略
+	DeadLetter *DeadLetterConfig `yaml:"deadLetter"` //重试耗尽后日志的去处
+	Batch      *BatchConfig      `yaml:"batch"`      //攒批写入的参数,只对支持批量写入的writer生效
+	Encoding   *EncodingConfig   `yaml:"encoding"`   //写入前把日志编码为指定的格式,不配置时写入原始的日志
+	Dedicated  bool              `yaml:"dedicated"`  //为true时只接收processor指定发送给它的日志(汇总、告警等),不接收读到的日志
+}
+type SpoolConfig struct {
+	Dir         string `yaml:"dir"`         //队列文件所在的目录
+	SegmentSize int64  `yaml:"segmentSize"` //单个段文件的最大size(单位:字节)
+	MaxSize     int64  `yaml:"maxSize"`     //队列总大小上限(单位:字节),小于等于0为不限制
+	Sync        bool   `yaml:"sync"`        //每次写入后是否fsync
+}
+type RetryConfig struct {
+	MaxAttempts    int           `yaml:"maxAttempts"`    //最大尝试次数(包括第一次)
+	InitialBackoff time.Duration `yaml:"initialBackoff"` //第一次重试前的等待时间,如"100ms"
+	MaxBackoff     time.Duration `yaml:"maxBackoff"`     //等待时间的上限
+	Multiplier     float64       `yaml:"multiplier"`     //每次重试等待时间的增长倍数
+	Jitter         float64       `yaml:"jitter"`         //随机抖动的比例(0~1)
+}
+
+type BatchConfig struct {
+	MaxCount int           `yaml:"maxCount"` //一批最多的条数
+	MaxBytes int           `yaml:"maxBytes"` //一批最多的字节数
+	Linger   time.Duration `yaml:"linger"`   //第一条日志进入批次后最多等待的时间,如"100ms"
 }
-type FileConfig struct {
-	FilePath     string `yaml:"filePath"`     //文件路径
-	FileName     string `yaml:"fileName"`     //文件名称
-	MaxSize      int64  `yaml:"maxSize"`      //分割的最大size(单位:字节)
-	RotateByTime bool   `yaml:"rotateByTime"` //是否根据时间来进行切割
+
+type EncodingConfig struct {
+	Type     string `yaml:"type"`     //raw|json|logfmt|template
+	Template string `yaml:"template"` //type为template时的Go text/template
+}
+
+// DeadLetterConfig 死信的去处,和writer一样用type指定类型,例如file、kafka
+type DeadLetterConfig struct {
+	Type    string                 `yaml:"type"`
+	Options map[string]interface{} `yaml:",inline" mapstructure:",remain"`
 }
 
 func (s *VipperSetting) ReadSection(k string, v interface{}) error {
@@ -39,14 +108,59 @@ func (s *VipperSetting) ReadSection(k string, v interface{}) error {
 	return nil
 }
 
+// GetConfig 读取配置文件,填上默认值并检查配置
+// 配置有问题时返回ValidationErrors,包含所有的问题
 func GetConfig(fileName string) (AppConfig, error) {
-	var appConfig AppConfig
+	return loadConfig(fileName)
+}
+
+// WatchConfig 监听配置文件,文件变化时重新读取配置并调用onChange
+// 读取失败或者配置有问题时err不为nil,调用方应该继续使用原来的配置
+func WatchConfig(fileName string, onChange func(appConfig AppConfig, err error)) error {
 	vp := viper.New()
 	vp.SetConfigFile(fileName)
 	err := vp.ReadInConfig()
 	if err != nil {
-		panic(fmt.Errorf("read config file error:%w", err))
+		return fmt.Errorf("read config file error:%w", err)
+	}
+	vp.OnConfigChange(func(in fsnotify.Event) {
+		//重新读取一遍文件,以便拿到读取失败或者配置有问题的原因
+		onChange(loadConfig(fileName))
+	})
+	vp.WatchConfig()
+	return nil
+}
+
+// loadConfig 读取配置文件,填上默认值后检查配置
+// 解析文件后先替换配置的值中的 ${VAR},再处理 xxx_file 和 LOGCOLLECTOR_ 开头的环境变量
+func loadConfig(fileName string) (AppConfig, error) {
+	var appConfig AppConfig
+	content, err := os.ReadFile(fileName)
+	if err != nil {
+		return AppConfig{}, fmt.Errorf("read config file error:%w", err)
 	}
+	vp := viper.New()
+	vp.SetConfigType(strings.TrimPrefix(filepath.Ext(fileName), "."))
+	err = vp.ReadConfig(bytes.NewReader(content))
+	if err != nil {
+		return AppConfig{}, fmt.Errorf("read config file error:%w", err)
+	}
+
+	app, _ := vp.Get("app").(map[string]interface{})
+	if app == nil {
+		app = make(map[string]interface{})
+	}
+	if err := interpolateEnv(app, os.LookupEnv); err != nil {
+		return AppConfig{}, fmt.Errorf("read config file error:%w", err)
+	}
+	if err := resolveFileRefs(app); err != nil {
+		return AppConfig{}, err
+	}
+	if err := applyEnvOverrides(app, reflect.TypeOf(appConfig), EnvPrefix, environ()); err != nil {
+		return AppConfig{}, err
+	}
+	vp.Set("app", app)
+
 	s := &VipperSetting{
 		Viper: vp,
 	}
@@ -54,5 +168,40 @@ func GetConfig(fileName string) (AppConfig, error) {
 	if err != nil {
 		return AppConfig{}, err
 	}
+	if err := appConfig.convertLegacy(); err != nil {
+		return AppConfig{}, err
+	}
+	appConfig.setDefaults()
+	if err := appConfig.Validate(); err != nil {
+		return AppConfig{}, err
+	}
 	return appConfig, nil
 }
+
+// TailConfig 实时tail的HTTP接口,客户端用 GET /tail?filter=<表达式> 订阅日志(Server-Sent Events)
+type TailConfig struct {
+	Addr       string `yaml:"addr"`       //监听的地址,例如 127.0.0.1:9400
+	Token      string `yaml:"token"`      //不为空时客户端需要认证,可以用token_file从文件中读取
+	BufferSize int    `yaml:"bufferSize"` //每个客户端最多缓存的日志条数,缓存满了会断开该客户端,默认256
+	MaxClients int    `yaml:"maxClients"` //同时连接的客户端数量上限,默认16
+	//每次向客户端写入的超时时间,客户端不再读取时超时后断开,默认10s
+	WriteTimeout time.Duration `yaml:"writeTimeout"`
+}
+
+// MetricsConfig Prometheus格式的metrics接口
+type MetricsConfig struct {
+	Addr string `yaml:"addr"` //监听的地址,例如 127.0.0.1:9401
+	Path string `yaml:"path"` //默认/metrics
+}
+
+// LogConfig 程序自己的日志,总是输出到标准错误,不会和stdout writer写出的日志混在一起
+type LogConfig struct {
+	Format string `yaml:"format"` //text|json,默认text
+	Level  string `yaml:"level"`  //debug|info|warn|error,默认info
+}
+
+// AdminConfig 运行时管理的HTTP接口,例如暂停reader、切割文件、修改日志级别
+type AdminConfig struct {
+	Addr  string `yaml:"addr"`  //监听的地址,默认127.0.0.1:9402,只能从本机访问
+	Token string `yaml:"token"` //客户端需要认证,可以用token_file从文件中读取
+}
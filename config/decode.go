@@ -0,0 +1,44 @@
+package config
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/mitchellh/mapstructure"
+)
+
+// Decode 把配置中的原始内容(例如ReaderConfig.Options)解码到out中
+// 规则和读取配置文件时一致:字段名不区分大小写,"1s"可以解码为time.Duration,
+// 逗号分隔的字符串可以解码为列表(环境变量覆盖时就是这种格式);out中没有的配置项会返回错误
+// 解码失败时返回ValidationErrors,路径相对于input
+func Decode(input interface{}, out interface{}) error {
+	d, err := mapstructure.NewDecoder(&mapstructure.DecoderConfig{
+		DecodeHook: mapstructure.ComposeDecodeHookFunc(
+			mapstructure.StringToTimeDurationHookFunc(),
+			mapstructure.StringToSliceHookFunc(","),
+		),
+		WeaklyTypedInput: true,
+		ErrorUnused:      true,
+		Result:           out,
+	})
+	if err != nil {
+		return err
+	}
+	err = d.Decode(input)
+	var merr *mapstructure.Error
+	if !errors.As(err, &merr) {
+		return err
+	}
+	//mapstructure的错误格式为 'path' reason
+	var errs ValidationErrors
+	for _, msg := range merr.Errors {
+		path, reason := "", msg
+		if strings.HasPrefix(msg, "'") {
+			if end := strings.Index(msg[1:], "'"); end >= 0 {
+				path, reason = msg[1:end+1], strings.TrimSpace(msg[end+2:])
+			}
+		}
+		errs = append(errs, FieldError{Path: path, Reason: reason})
+	}
+	return errs
+}
@@ -0,0 +1,285 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// EnvPrefix 环境变量覆盖配置时使用的前缀
+// 例如 app.buffsize 对应 LOGCOLLECTOR_BUFFSIZE, app.readers[0].topic 对应 LOGCOLLECTOR_READERS_0_TOPIC,
+// 列表中的元素用下标表示,多个值用逗号分隔
+const EnvPrefix = "LOGCOLLECTOR"
+
+// fileSuffix 以它结尾的配置项表示从文件中读取对应配置的值,例如 password_file
+const fileSuffix = "_file"
+
+var envPattern = regexp.MustCompile(`\$?\$\{([A-Za-z_][A-Za-z0-9_]*)(:-([^}]*))?\}`)
+
+// interpolateEnv 把配置中字符串的值里的 ${VAR} 替换为环境变量的值
+// 支持 ${VAR:-default} 设置默认值, $${VAR} 表示不替换
+// 在解析YAML之后只替换值,注释和键不会被处理,环境变量的值中有": "、"#"或者换行时也不会改变配置的结构
+// 没有设置且没有默认值的环境变量会返回错误
+func interpolateEnv(m map[string]interface{}, lookup func(string) (string, bool)) error {
+	var missing []string
+	interpolateValue(m, lookup, &missing)
+	if len(missing) > 0 {
+		sort.Strings(missing)
+		return fmt.Errorf("environment variables not set: %s", strings.Join(missing, ", "))
+	}
+	return nil
+}
+
+// interpolateValue 递归替换v中的字符串,返回替换后的值,没有设置的环境变量记录到missing中
+func interpolateValue(v interface{}, lookup func(string) (string, bool), missing *[]string) interface{} {
+	switch val := v.(type) {
+	case map[string]interface{}:
+		for k, item := range val {
+			val[k] = interpolateValue(item, lookup, missing)
+		}
+	case []interface{}:
+		for i, item := range val {
+			val[i] = interpolateValue(item, lookup, missing)
+		}
+	case string:
+		return envPattern.ReplaceAllStringFunc(val, func(m string) string {
+			if strings.HasPrefix(m, "$$") {
+				return m[1:]
+			}
+			sub := envPattern.FindStringSubmatch(m)
+			if v, ok := lookup(sub[1]); ok {
+				return v
+			}
+			if sub[2] != "" {
+				return sub[3]
+			}
+			*missing = append(*missing, sub[1])
+			return m
+		})
+	}
+	return v
+}
+
+// resolveFileRefs 把配置中的 xxx_file 替换为 xxx,值为文件的内容(去掉首尾空白),用于读取挂载的密钥
+func resolveFileRefs(m map[string]interface{}) error {
+	for key, v := range m {
+		switch val := v.(type) {
+		case map[string]interface{}:
+			if err := resolveFileRefs(val); err != nil {
+				return err
+			}
+		case []interface{}:
+			for _, item := range val {
+				if sub, ok := item.(map[string]interface{}); ok {
+					if err := resolveFileRefs(sub); err != nil {
+						return err
+					}
+				}
+			}
+		case string:
+			if !strings.HasSuffix(key, fileSuffix) {
+				continue
+			}
+			base := strings.TrimSuffix(key, fileSuffix)
+			if _, exists := m[base]; exists {
+				return fmt.Errorf("both %s and %s are set", base, key)
+			}
+			content, err := readSecretFile(val)
+			if err != nil {
+				return fmt.Errorf("%s: %w", key, err)
+			}
+			m[base] = content
+			delete(m, key)
+		}
+	}
+	return nil
+}
+
+// environ 当前进程的环境变量
+func environ() map[string]string {
+	env := make(map[string]string)
+	for _, kv := range os.Environ() {
+		if k, v, ok := strings.Cut(kv, "="); ok {
+			env[k] = v
+		}
+	}
+	return env
+}
+
+// applyEnvOverrides 按照t的结构,用环境变量覆盖m中对应的配置
+// 环境变量名为 prefix_字段名(大写),加上 _FILE 后缀表示从文件中读取
+func applyEnvOverrides(m map[string]interface{}, t reflect.Type, prefix string, env map[string]string) error {
+	return applyEnv(m, t, prefix, env, map[reflect.Type]bool{})
+}
+
+// applyEnv visiting记录当前路径上的结构体,配置文件中没有的项不会重复进入同一个结构体,
+// 避免在递归的结构上无限展开
+func applyEnv(m map[string]interface{}, t reflect.Type, prefix string, env map[string]string, visiting map[reflect.Type]bool) error {
+	visiting[t] = true
+	defer delete(visiting, t)
+	var (
+		known  = make(map[string]bool) //t中有的配置项,剩下的交给remain字段
+		remain bool
+	)
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if !f.IsExported() {
+			continue
+		}
+		ft := f.Type
+		if ft.Kind() == reflect.Pointer {
+			ft = ft.Elem()
+		}
+		//嵌入的通用配置和外层在同一级
+		if f.Anonymous && ft.Kind() == reflect.Struct {
+			if err := applyEnv(m, ft, prefix, env, visiting); err != nil {
+				return err
+			}
+			for j := 0; j < ft.NumField(); j++ {
+				known[strings.ToUpper(fieldKey(ft.Field(j)))] = true
+			}
+			continue
+		}
+		//各类型自己的配置,结构由reader和writer包决定,放到最后处理
+		if strings.Contains(f.Tag.Get("mapstructure"), "remain") {
+			remain = true
+			continue
+		}
+		key := fieldKey(f)
+		known[strings.ToUpper(key)] = true
+		name := prefix + "_" + strings.ToUpper(key)
+
+		switch {
+		case ft.Kind() == reflect.Struct:
+			sub, _ := m[key].(map[string]interface{})
+			if sub == nil {
+				if visiting[ft] {
+					continue
+				}
+				sub = make(map[string]interface{})
+			}
+			if err := applyEnv(sub, ft, name, env, visiting); err != nil {
+				return err
+			}
+			//只有配置文件或者环境变量中有这一项时才设置,避免凭空创建可选的配置
+			if len(sub) > 0 {
+				m[key] = sub
+			}
+		case ft.Kind() == reflect.Slice && ft.Elem().Kind() == reflect.Struct:
+			list, _ := m[key].([]interface{})
+			for idx, item := range list {
+				sub, ok := item.(map[string]interface{})
+				if !ok {
+					continue
+				}
+				if err := applyEnv(sub, ft.Elem(), name+"_"+strconv.Itoa(idx), env, visiting); err != nil {
+					return err
+				}
+			}
+		case ft.Kind() == reflect.Map:
+			sub, _ := m[key].(map[string]interface{})
+			if sub == nil {
+				sub = make(map[string]interface{})
+			}
+			if err := applyEnvUntyped(sub, name, env, nil); err != nil {
+				return err
+			}
+			if len(sub) > 0 {
+				m[key] = sub
+			}
+		default:
+			if v, ok := env[name]; ok {
+				m[key] = v
+			}
+			if path, ok := env[name+strings.ToUpper(fileSuffix)]; ok {
+				content, err := readSecretFile(path)
+				if err != nil {
+					return fmt.Errorf("%s: %w", name+strings.ToUpper(fileSuffix), err)
+				}
+				m[key] = content
+			}
+		}
+	}
+	if remain {
+		return applyEnvUntyped(m, prefix, env, known)
+	}
+	return nil
+}
+
+// applyEnvUntyped 处理结构未知的配置(例如kafka reader自己的配置),
+// 以 prefix_ 开头的环境变量中,下划线分隔的每一段对应一级配置,例如
+// LOGCOLLECTOR_READERS_0_SASL_PASSWORD_FILE 对应 sasl.password 并从文件中读取;
+// 第一段在skip中的环境变量已经按照结构处理过了
+func applyEnvUntyped(m map[string]interface{}, prefix string, env map[string]string, skip map[string]bool) error {
+	names := make([]string, 0)
+	for name := range env {
+		if strings.HasPrefix(name, prefix+"_") {
+			names = append(names, name)
+		}
+	}
+	//同时有 XXX 和 XXX_FILE 时,XXX_FILE 排在后面,和结构已知的配置一样以文件为准
+	sort.Strings(names)
+	for _, name := range names {
+		path := strings.Split(strings.TrimPrefix(name, prefix+"_"), "_")
+		if skip[path[0]] {
+			continue
+		}
+		value := env[name]
+		if n := len(path); n > 1 && path[n-1] == strings.ToUpper(strings.TrimPrefix(fileSuffix, "_")) {
+			content, err := readSecretFile(value)
+			if err != nil {
+				return fmt.Errorf("%s: %w", name, err)
+			}
+			path, value = path[:n-1], content
+		}
+		setPath(m, path, value)
+	}
+	return nil
+}
+
+// setPath 把m中path对应的配置设置为value,中间缺少的层级会自动创建,
+// 列表只能用下标修改已有的元素
+func setPath(m map[string]interface{}, path []string, value string) {
+	key := strings.ToLower(path[0])
+	if len(path) == 1 {
+		m[key] = value
+		return
+	}
+	switch sub := m[key].(type) {
+	case map[string]interface{}:
+		setPath(sub, path[1:], value)
+	case []interface{}:
+		idx, err := strconv.Atoi(path[1])
+		if err != nil || idx < 0 || idx >= len(sub) || len(path) < 3 {
+			return
+		}
+		if item, ok := sub[idx].(map[string]interface{}); ok {
+			setPath(item, path[2:], value)
+		}
+	case nil:
+		item := make(map[string]interface{})
+		m[key] = item
+		setPath(item, path[1:], value)
+	}
+}
+
+// fieldKey 字段在配置文件中的名称(小写,和viper一致)
+func fieldKey(f reflect.StructField) string {
+	name, _, _ := strings.Cut(f.Tag.Get("yaml"), ",")
+	if name == "" {
+		name = f.Name
+	}
+	return strings.ToLower(name)
+}
+
+func readSecretFile(path string) (string, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("read secret file failed: %v", err)
+	}
+	return strings.TrimSpace(string(b)), nil
+}
@@ -0,0 +1,140 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestInterpolateEnv(t *testing.T) {
+	env := map[string]string{"BROKER": "10.0.0.1:9092", "EMPTY": "", "TRICKY": "a: b # c\nd: e"}
+	lookup := func(k string) (string, bool) {
+		v, ok := env[k]
+		return v, ok
+	}
+	tests := []struct {
+		name    string
+		in      interface{}
+		want    interface{}
+		wantErr bool
+	}{
+		{"set", "${BROKER}", "10.0.0.1:9092", false},
+		{"default", "${TOPIC:-testlog}", "testlog", false},
+		{"set but empty", "${EMPTY:-default}", "", false},
+		{"escaped", "$${BROKER}", "${BROKER}", false},
+		{"partial", "tcp://${BROKER}/x", "tcp://10.0.0.1:9092/x", false},
+		{"yaml special characters", "${TRICKY}", "a: b # c\nd: e", false},
+		{"list", []interface{}{"${BROKER}", 1}, []interface{}{"10.0.0.1:9092", 1}, false},
+		{"nested", map[string]interface{}{"sasl": map[string]interface{}{"user": "${BROKER}"}},
+			map[string]interface{}{"sasl": map[string]interface{}{"user": "10.0.0.1:9092"}}, false},
+		{"missing", "${MISSING}", nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := map[string]interface{}{"x": tt.in}
+			err := interpolateEnv(m, lookup)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("interpolateEnv() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(m["x"], tt.want) {
+				t.Errorf("interpolateEnv() = %#v, want %#v", m["x"], tt.want)
+			}
+		})
+	}
+}
+
+func TestGetConfig_EnvOverrides(t *testing.T) {
+	dir := t.TempDir()
+	secret := filepath.Join(dir, "password")
+	if err := os.WriteFile(secret, []byte("s3cret\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	fn := filepath.Join(dir, "config.yaml")
+	content := `app:
+  readers:
+    - type: kafka
+      brokersAddr: ["127.0.0.1:9092"]
+      topic: ${LC_TEST_TOPIC}     # ${LC_TEST_UNSET} in a comment is not replaced
+      groupId: ${LC_TEST_GROUP}
+      sasl:
+        user: "collector"
+        password_file: "` + secret + `"
+  writers:
+    - type: stdout
+    - type: file
+      filePath: "app_log"
+`
+	if err := os.WriteFile(fn, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("LC_TEST_TOPIC", "from-interpolation")
+	t.Setenv("LC_TEST_GROUP", "group: x # y")
+	t.Setenv("LOGCOLLECTOR_BUFFSIZE", "42")
+	t.Setenv("LOGCOLLECTOR_READERS_0_BROKERSADDR", "10.0.0.1:9092,10.0.0.2:9092")
+	t.Setenv("LOGCOLLECTOR_WRITERS_1_FILEPATH", "/var/log/app")
+	t.Setenv("LOGCOLLECTOR_WRITERS_1_SPOOL_DIR", "/var/spool/app")
+
+	conf, err := GetConfig(fn)
+	if err != nil {
+		t.Fatalf("GetConfig() error = %v", err)
+	}
+	if conf.BuffSize != 42 {
+		t.Errorf("BuffSize = %d, want 42", conf.BuffSize)
+	}
+	kafka := conf.Readers[0].Options
+	//类型自己的配置由reader包解析,这里还是字符串
+	if kafka["brokersaddr"] != "10.0.0.1:9092,10.0.0.2:9092" {
+		t.Errorf("brokersAddr = %v", kafka["brokersaddr"])
+	}
+	if kafka["topic"] != "from-interpolation" {
+		t.Errorf("topic = %v", kafka["topic"])
+	}
+	//环境变量的值不会改变YAML的结构
+	if kafka["groupid"] != "group: x # y" {
+		t.Errorf("groupId = %v", kafka["groupid"])
+	}
+	if sasl, _ := kafka["sasl"].(map[string]interface{}); sasl["password"] != "s3cret" {
+		t.Errorf("sasl = %v", kafka["sasl"])
+	}
+	file := conf.Writers[1]
+	if file.Options["filepath"] != "/var/log/app" {
+		t.Errorf("filePath = %v", file.Options["filepath"])
+	}
+	if file.Spool == nil || file.Spool.Dir != "/var/spool/app" {
+		t.Errorf("Spool = %+v", file.Spool)
+	}
+	if _, ok := file.Options["spool"]; ok {
+		t.Errorf("spool should not be left in options: %v", file.Options)
+	}
+}
+
+func TestGetConfig_EnvSecretFile(t *testing.T) {
+	dir := t.TempDir()
+	secret := filepath.Join(dir, "password")
+	os.WriteFile(secret, []byte("from-env-file"), 0600)
+	fn := filepath.Join(dir, "config.yaml")
+	content := `app:
+  readers:
+    - type: kafka
+      brokersAddr: ["127.0.0.1:9092"]
+      topic: "testlog"
+      sasl:
+        user: "collector"
+  writers:
+    - type: stdout
+`
+	os.WriteFile(fn, []byte(content), 0644)
+	//配置文件中没有的项也可以用环境变量设置
+	t.Setenv("LOGCOLLECTOR_READERS_0_SASL_PASSWORD", "from-env")
+	t.Setenv("LOGCOLLECTOR_READERS_0_SASL_PASSWORD_FILE", secret)
+
+	conf, err := GetConfig(fn)
+	if err != nil {
+		t.Fatalf("GetConfig() error = %v", err)
+	}
+	sasl, _ := conf.Readers[0].Options["sasl"].(map[string]interface{})
+	if sasl["password"] != "from-env-file" {
+		t.Errorf("password = %v, want from-env-file", sasl["password"])
+	}
+}
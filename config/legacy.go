@@ -0,0 +1,52 @@
+package config
+
+import (
+	"fmt"
+	"log-collector/logging"
+)
+
+// convertLegacy 把旧版本的配置格式转换为readers和writers列表,转换后的名称和type相同:
+//
+//	reader.kafka        -> readers: [{name: kafka, type: kafka, ...}]
+//	writer.file         -> writers: [{name: file, type: file, ...}]
+//	writer.stdout: true -> writers: [{name: stdout, type: stdout}]
+//	deadLetter.file     -> deadLetter: {type: file, ...}
+func (c *AppConfig) convertLegacy() error {
+	if len(c.Reader) > 0 || len(c.Writer) > 0 {
+		logging.Component("config").Warn("app.reader and app.writer are deprecated, use app.readers and app.writers instead")
+	}
+	if kafka, ok := c.Reader["kafka"].(map[string]interface{}); ok {
+		c.Readers = append(c.Readers, ReaderConfig{Name: "kafka", Type: "kafka", Options: kafka})
+	}
+	if file, ok := c.Writer["file"].(map[string]interface{}); ok {
+		var wc WriterConfig
+		if err := Decode(file, &wc); err != nil {
+			return fmt.Errorf("app.writer.file: %w", err)
+		}
+		wc.Name, wc.Type = "file", "file"
+		c.Writers = append(c.Writers, wc)
+	}
+	if v, ok := c.Writer["stdout"]; ok {
+		var stdout bool
+		if err := Decode(v, &stdout); err != nil {
+			return fmt.Errorf("app.writer.stdout: %w", err)
+		}
+		if stdout {
+			c.Writers = append(c.Writers, WriterConfig{Name: "stdout", Type: "stdout"})
+		}
+	}
+	c.Reader, c.Writer = nil, nil
+
+	for i := range c.Writers {
+		d := c.Writers[i].DeadLetter
+		if d == nil || d.Type != "" || len(d.Options) != 1 {
+			continue
+		}
+		for typ, v := range d.Options {
+			if opts, ok := v.(map[string]interface{}); ok {
+				d.Type, d.Options = typ, opts
+			}
+		}
+	}
+	return nil
+}
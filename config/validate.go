@@ -0,0 +1,246 @@
+package config
+
+import (
+	"fmt"
+	"net"
+	"strings"
+)
+
+const (
+	defaultBuffSize  = 100
+	defaultAdminAddr = "127.0.0.1:9402"
+	defaultLogFormat = "text"
+	defaultLogLevel  = "info"
+)
+
+// FieldError 配置中的一个问题
+type FieldError struct {
+	Path   string //出问题的字段,例如 app.readers[0].topic
+	Reason string //原因
+}
+
+func (e FieldError) Error() string {
+	return fmt.Sprintf("%s: %s", e.Path, e.Reason)
+}
+
+// ValidationErrors 配置中的所有问题
+type ValidationErrors []FieldError
+
+func (v ValidationErrors) Error() string {
+	msgs := make([]string, 0, len(v))
+	for _, e := range v {
+		msgs = append(msgs, e.Error())
+	}
+	return fmt.Sprintf("invalid config (%d problems): %s", len(v), strings.Join(msgs, "; "))
+}
+
+// Add 添加一个问题,reader和writer包检查自己的配置时使用相对路径,例如 topic
+func (v *ValidationErrors) Add(path string, format string, args ...interface{}) {
+	*v = append(*v, FieldError{Path: path, Reason: fmt.Sprintf(format, args...)})
+}
+
+// WithPrefix 给所有问题的路径加上前缀,例如 topic -> app.readers[0].topic
+func (v ValidationErrors) WithPrefix(prefix string) ValidationErrors {
+	out := make(ValidationErrors, 0, len(v))
+	for _, e := range v {
+		switch {
+		case e.Path == "":
+			e.Path = prefix
+		case prefix != "":
+			e.Path = prefix + "." + e.Path
+		}
+		out = append(out, e)
+	}
+	return out
+}
+
+// setDefaults 给没有配置的字段填上默认值
+func (c *AppConfig) setDefaults() {
+	if c.BuffSize == 0 {
+		c.BuffSize = defaultBuffSize
+	}
+	for i := range c.Readers {
+		if c.Readers[i].Name == "" {
+			c.Readers[i].Name = c.Readers[i].Type
+		}
+	}
+	for i := range c.Writers {
+		if c.Writers[i].Name == "" {
+			c.Writers[i].Name = c.Writers[i].Type
+		}
+	}
+	for i := range c.Processors {
+		if c.Processors[i].Name == "" {
+			c.Processors[i].Name = c.Processors[i].Type
+		}
+	}
+	if c.Metrics != nil && c.Metrics.Path == "" {
+		c.Metrics.Path = "/metrics"
+	}
+	if c.Admin != nil && c.Admin.Addr == "" {
+		c.Admin.Addr = defaultAdminAddr
+	}
+	if c.Log.Format == "" {
+		c.Log.Format = defaultLogFormat
+	}
+	if c.Log.Level == "" {
+		c.Log.Level = defaultLogLevel
+	}
+}
+
+// Validate 检查配置,一次返回所有的问题(ValidationErrors),没有问题时返回nil
+// 这里只检查和类型无关的部分,各类型reader和writer自己的配置由对应的Builder检查
+func (c AppConfig) Validate() error {
+	var errs ValidationErrors
+	if len(c.Readers) == 0 {
+		errs.Add("app.readers", "at least one reader is required")
+	}
+	names := make(map[string]bool)
+	for i, r := range c.Readers {
+		path := fmt.Sprintf("app.readers[%d]", i)
+		validateInstance(&errs, path, r.Name, r.Type, names)
+	}
+	if len(c.Writers) == 0 {
+		errs.Add("app.writers", "at least one writer is required")
+	}
+	names = make(map[string]bool)
+	for i, w := range c.Writers {
+		path := fmt.Sprintf("app.writers[%d]", i)
+		validateInstance(&errs, path, w.Name, w.Type, names)
+		validateOptions(&errs, path, w.WriterOptions)
+	}
+	names = make(map[string]bool)
+	for i, p := range c.Processors {
+		validateInstance(&errs, fmt.Sprintf("app.processors[%d]", i), p.Name, p.Type, names)
+	}
+	if t := c.Tail; t != nil {
+		validateAddr(&errs, "app.tail.addr", t.Addr)
+		if t.BufferSize < 0 {
+			errs.Add("app.tail.bufferSize", "must not be negative")
+		}
+		if t.MaxClients < 0 {
+			errs.Add("app.tail.maxClients", "must not be negative")
+		}
+		if t.WriteTimeout < 0 {
+			errs.Add("app.tail.writeTimeout", "must not be negative")
+		}
+	}
+	if m := c.Metrics; m != nil {
+		validateAddr(&errs, "app.metrics.addr", m.Addr)
+		if !strings.HasPrefix(m.Path, "/") {
+			errs.Add("app.metrics.path", "path must start with /")
+		}
+	}
+	if a := c.Admin; a != nil {
+		validateAddr(&errs, "app.admin.addr", a.Addr)
+		if a.Token == "" {
+			errs.Add("app.admin.token", "token is required (or set token_file)")
+		}
+	}
+	switch c.Log.Format {
+	case "", "text", "json":
+	default:
+		errs.Add("app.log.format", "unknown format %q, expected one of text, json", c.Log.Format)
+	}
+	switch strings.ToLower(c.Log.Level) {
+	case "", "debug", "info", "warn", "error":
+	default:
+		errs.Add("app.log.level", "unknown level %q, expected one of debug, info, warn, error", c.Log.Level)
+	}
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+// validateInstance 检查reader或writer的名称和类型,names记录已经出现过的名称
+func validateInstance(errs *ValidationErrors, path, name, typ string, names map[string]bool) {
+	if typ == "" {
+		errs.Add(path+".type", "type is required")
+	}
+	if name == "" {
+		return
+	}
+	if names[name] {
+		errs.Add(path+".name", "duplicate name %q, set a unique name for each instance of the same type", name)
+	}
+	names[name] = true
+}
+
+// ValidateKafka 检查kafka reader和writer共同的配置
+func ValidateKafka(errs *ValidationErrors, brokers []string, topic string, sasl *SASLConfig) {
+	if len(brokers) == 0 {
+		errs.Add("brokersAddr", "at least one broker is required")
+	}
+	for i, addr := range brokers {
+		if _, _, err := net.SplitHostPort(addr); err != nil {
+			errs.Add(fmt.Sprintf("brokersAddr[%d]", i), "%q is not a valid host:port", addr)
+		}
+	}
+	if strings.TrimSpace(topic) == "" {
+		errs.Add("topic", "topic must not be empty")
+	}
+	if sasl != nil {
+		if sasl.Mechanism != "" && sasl.Mechanism != "PLAIN" {
+			errs.Add("sasl.mechanism", "unsupported mechanism %q, only PLAIN is supported", sasl.Mechanism)
+		}
+		if sasl.User == "" {
+			errs.Add("sasl.user", "user must not be empty")
+		}
+		if sasl.Password == "" {
+			errs.Add("sasl.password", "password must not be empty (or set password_file)")
+		}
+	}
+}
+
+// validateAddr 检查监听的地址,例如 127.0.0.1:9400 或者 :9400
+func validateAddr(errs *ValidationErrors, path, addr string) {
+	if _, port, err := net.SplitHostPort(addr); err != nil || port == "" {
+		errs.Add(path, "%q is not a valid listen address, expected host:port", addr)
+	}
+}
+
+func validateOptions(errs *ValidationErrors, path string, o WriterOptions) {
+	if o.Spool != nil {
+		if o.Spool.Dir == "" {
+			errs.Add(path+".spool.dir", "dir must not be empty")
+		}
+		if o.Spool.SegmentSize < 0 {
+			errs.Add(path+".spool.segmentSize", "must not be negative")
+		}
+		if o.Spool.MaxSize < 0 {
+			errs.Add(path+".spool.maxSize", "must not be negative")
+		}
+	}
+	if o.Retry != nil {
+		if o.Retry.MaxAttempts < 0 {
+			errs.Add(path+".retry.maxAttempts", "must not be negative")
+		}
+		if o.Retry.InitialBackoff < 0 {
+			errs.Add(path+".retry.initialBackoff", "must not be negative")
+		}
+		if o.Retry.MaxBackoff < 0 {
+			errs.Add(path+".retry.maxBackoff", "must not be negative")
+		}
+		if o.Retry.Multiplier != 0 && o.Retry.Multiplier < 1 {
+			errs.Add(path+".retry.multiplier", "must be at least 1")
+		}
+		if o.Retry.Jitter < 0 || o.Retry.Jitter > 1 {
+			errs.Add(path+".retry.jitter", "must be between 0 and 1")
+		}
+	}
+	if d := o.DeadLetter; d != nil && d.Type == "" {
+		errs.Add(path+".deadLetter.type", "type is required")
+	}
+	if o.Batch != nil {
+		if o.Batch.MaxCount < 0 {
+			errs.Add(path+".batch.maxCount", "must not be negative")
+		}
+		if o.Batch.MaxBytes < 0 {
+			errs.Add(path+".batch.maxBytes", "must not be negative")
+		}
+		if o.Batch.Linger < 0 {
+			errs.Add(path+".batch.linger", "must not be negative")
+		}
+	}
+}
@@ -0,0 +1,191 @@
+package config
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestAppConfig_Validate(t *testing.T) {
+	kafka := ReaderConfig{Name: "kafka", Type: "kafka"}
+	stdout := WriterConfig{Name: "stdout", Type: "stdout"}
+	tests := []struct {
+		name      string
+		conf      AppConfig
+		wantPaths []string
+	}{
+		{
+			name: "valid",
+			conf: AppConfig{Readers: []ReaderConfig{kafka}, Writers: []WriterConfig{stdout}},
+		},
+		{
+			name:      "no reader and no writer",
+			conf:      AppConfig{},
+			wantPaths: []string{"app.readers", "app.writers"},
+		},
+		{
+			name: "missing type and duplicate name",
+			conf: AppConfig{
+				Readers: []ReaderConfig{kafka, {Name: "kafka", Type: "kafka"}},
+				Writers: []WriterConfig{{Name: "out"}},
+			},
+			wantPaths: []string{"app.readers[1].name", "app.writers[0].type"},
+		},
+		{
+			name: "bad writer options",
+			conf: AppConfig{
+				Readers: []ReaderConfig{kafka},
+				Writers: []WriterConfig{stdout, {
+					Name: "file",
+					Type: "file",
+					WriterOptions: WriterOptions{
+						Spool:      &SpoolConfig{},
+						DeadLetter: &DeadLetterConfig{},
+					},
+				}},
+			},
+			wantPaths: []string{"app.writers[1].spool.dir", "app.writers[1].deadLetter.type"},
+		},
+		{
+			name: "bad tail",
+			conf: AppConfig{
+				Readers: []ReaderConfig{kafka},
+				Writers: []WriterConfig{stdout},
+				Tail:    &TailConfig{Addr: "9400", MaxClients: -1},
+			},
+			wantPaths: []string{"app.tail.addr", "app.tail.maxClients"},
+		},
+		{
+			name: "bad processors and metrics",
+			conf: AppConfig{
+				Readers:    []ReaderConfig{kafka},
+				Writers:    []WriterConfig{stdout},
+				Processors: []ProcessorConfig{{Name: "agg", Type: "aggregate"}, {Name: "agg"}},
+				Metrics:    &MetricsConfig{Addr: ":9401", Path: "metrics"},
+			},
+			wantPaths: []string{"app.processors[1].type", "app.processors[1].name", "app.metrics.path"},
+		},
+		{
+			name: "admin without token",
+			conf: AppConfig{
+				Readers: []ReaderConfig{kafka},
+				Writers: []WriterConfig{stdout},
+				Admin:   &AdminConfig{Addr: "127.0.0.1:9402"},
+			},
+			wantPaths: []string{"app.admin.token"},
+		},
+		{
+			name: "bad log config",
+			conf: AppConfig{
+				Readers: []ReaderConfig{kafka},
+				Writers: []WriterConfig{stdout},
+				Log:     LogConfig{Format: "xml", Level: "verbose"},
+			},
+			wantPaths: []string{"app.log.format", "app.log.level"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.conf.Validate()
+			if len(tt.wantPaths) == 0 {
+				if err != nil {
+					t.Fatalf("Validate() error = %v", err)
+				}
+				return
+			}
+			var verrs ValidationErrors
+			if !errors.As(err, &verrs) {
+				t.Fatalf("expected ValidationErrors, got %v", err)
+			}
+			if len(verrs) != len(tt.wantPaths) {
+				t.Fatalf("expected %d problems, got %v", len(tt.wantPaths), verrs)
+			}
+			for i, want := range tt.wantPaths {
+				if verrs[i].Path != want {
+					t.Errorf("problem %d path = %s, want %s", i, verrs[i].Path, want)
+				}
+			}
+		})
+	}
+}
+
+func TestGetConfig_Defaults(t *testing.T) {
+	fn := filepath.Join(t.TempDir(), "config.yaml")
+	content := `app:
+  readers:
+    - type: kafka
+      brokersAddr: ["127.0.0.1:9092"]
+      topic: "testlog"
+  writers:
+    - type: file
+      filePath: "app_log"
+    - name: file-debug
+      type: file
+      filePath: "debug_log"
+`
+	if err := os.WriteFile(fn, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	conf, err := GetConfig(fn)
+	if err != nil {
+		t.Fatalf("GetConfig() error = %v", err)
+	}
+	if conf.BuffSize != defaultBuffSize {
+		t.Errorf("expected default buffsize %d, got %d", defaultBuffSize, conf.BuffSize)
+	}
+	if conf.Readers[0].Name != "kafka" || conf.Writers[0].Name != "file" || conf.Writers[1].Name != "file-debug" {
+		t.Errorf("unexpected names: %+v %+v", conf.Readers, conf.Writers)
+	}
+	if conf.Writers[1].Options["filepath"] != "debug_log" {
+		t.Errorf("expected options to keep filePath, got %v", conf.Writers[1].Options)
+	}
+}
+
+func TestGetConfig_MissingFile(t *testing.T) {
+	if _, err := GetConfig(filepath.Join(t.TempDir(), "missing.yaml")); err == nil {
+		t.Fatal("expected error for missing file")
+	}
+}
+
+func TestGetConfig_Legacy(t *testing.T) {
+	fn := filepath.Join(t.TempDir(), "config.yaml")
+	content := `app:
+  reader:
+    kafka:
+      brokersAddr: ["127.0.0.1:9092"]
+      topic: "testlog"
+  writer:
+    stdout: true
+    file:
+      filePath: "app_log"
+      spool:
+        dir: "app_spool"
+      deadLetter:
+        file:
+          filePath: "dead_letter"
+`
+	if err := os.WriteFile(fn, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	conf, err := GetConfig(fn)
+	if err != nil {
+		t.Fatalf("GetConfig() error = %v", err)
+	}
+	if len(conf.Readers) != 1 || conf.Readers[0].Type != "kafka" || conf.Readers[0].Options["topic"] != "testlog" {
+		t.Errorf("unexpected readers: %+v", conf.Readers)
+	}
+	if len(conf.Writers) != 2 || conf.Writers[0].Name != "file" || conf.Writers[1].Name != "stdout" {
+		t.Fatalf("unexpected writers: %+v", conf.Writers)
+	}
+	file := conf.Writers[0]
+	if file.Spool == nil || file.Spool.Dir != "app_spool" {
+		t.Errorf("Spool = %+v", file.Spool)
+	}
+	if _, ok := file.Options["spool"]; ok {
+		t.Errorf("spool should not be left in options: %v", file.Options)
+	}
+	if d := file.DeadLetter; d == nil || d.Type != "file" || d.Options["filepath"] != "dead_letter" {
+		t.Errorf("DeadLetter = %+v", d)
+	}
+}
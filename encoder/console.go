@@ -0,0 +1,148 @@
+package encoder
+
+import (
+	"bytes"
+	"log-collector/message"
+	"sort"
+	"strings"
+	"time"
+)
+
+// ANSI颜色
+const (
+	colorReset  = "\x1b[0m"
+	colorDim    = "\x1b[2m"
+	colorRed    = "\x1b[31m"
+	colorGreen  = "\x1b[32m"
+	colorYellow = "\x1b[33m"
+	colorBlue   = "\x1b[34m"
+	colorCyan   = "\x1b[36m"
+	colorGray   = "\x1b[90m"
+)
+
+// 控制台格式中单独显示的字段,按顺序查找第一个存在的字段
+var (
+	consoleTimeFields    = []string{"time", "ts", "timestamp", "@timestamp"}
+	consoleLevelFields   = []string{"level", "lvl", "severity"}
+	consoleServiceFields = []string{"service", "app", "logger"}
+	consoleMessageFields = []string{"msg", "message"}
+)
+
+// consoleEncoder 便于阅读的控制台格式,一行显示时间、级别、服务和消息,其余字段以key=value的形式跟在后面
+type consoleEncoder struct {
+	color bool
+}
+
+// NewConsole 创建控制台格式的Encoder,color为true时级别带颜色、其余字段变暗
+// 不是JSON对象的日志原样输出
+func NewConsole(color bool) Encoder {
+	return consoleEncoder{color: color}
+}
+
+func (c consoleEncoder) Encode(m *message.Message) ([]byte, error) {
+	fields := m.Fields()
+	if fields == nil {
+		return terminate(m.Value), nil
+	}
+	rest := make(map[string]interface{})
+	flatten(rest, "", fields)
+
+	var b bytes.Buffer
+	ts := m.Timestamp
+	if v, ok := takeField(rest, consoleTimeFields); ok {
+		ts = parseConsoleTime(v, ts)
+	}
+	c.paint(&b, colorGray, ts.Format("2006-01-02 15:04:05.000"))
+
+	level := "-"
+	if v, ok := takeField(rest, consoleLevelFields); ok {
+		level = strings.ToUpper(message.ToString(v))
+	}
+	b.WriteByte(' ')
+	c.paint(&b, levelColor(level), padRight(level, 5))
+
+	if v, ok := takeField(rest, consoleServiceFields); ok {
+		b.WriteByte(' ')
+		c.paint(&b, colorCyan, "["+message.ToString(v)+"]")
+	}
+	if v, ok := takeField(rest, consoleMessageFields); ok {
+		b.WriteByte(' ')
+		b.WriteString(message.ToString(v))
+	}
+
+	if len(rest) > 0 {
+		keys := make([]string, 0, len(rest))
+		for k := range rest {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		var pairs bytes.Buffer
+		for _, k := range keys {
+			writeLogfmtPair(&pairs, k, message.ToString(rest[k]))
+		}
+		b.WriteString("  ")
+		c.paint(&b, colorDim, pairs.String())
+	}
+	b.WriteByte('\n')
+	return b.Bytes(), nil
+}
+
+// paint color为false时不输出颜色
+func (c consoleEncoder) paint(b *bytes.Buffer, color, s string) {
+	if !c.color || color == "" {
+		b.WriteString(s)
+		return
+	}
+	b.WriteString(color)
+	b.WriteString(s)
+	b.WriteString(colorReset)
+}
+
+// takeField 取出names中第一个存在的字段,并从fields中删除
+func takeField(fields map[string]interface{}, names []string) (interface{}, bool) {
+	for _, name := range names {
+		if v, ok := fields[name]; ok {
+			delete(fields, name)
+			return v, true
+		}
+	}
+	return nil, false
+}
+
+// parseConsoleTime 解析RFC3339格式的时间或者unix时间戳(秒或者毫秒),无法解析时返回def
+func parseConsoleTime(v interface{}, def time.Time) time.Time {
+	switch val := v.(type) {
+	case string:
+		if t, err := time.Parse(time.RFC3339Nano, val); err == nil {
+			return t.Local()
+		}
+	case float64:
+		if val > 1e12 {
+			return time.UnixMilli(int64(val))
+		}
+		sec := int64(val)
+		return time.Unix(sec, int64((val-float64(sec))*1e9))
+	}
+	return def
+}
+
+func levelColor(level string) string {
+	switch level {
+	case "TRACE", "DEBUG":
+		return colorBlue
+	case "INFO", "NOTICE":
+		return colorGreen
+	case "WARN", "WARNING":
+		return colorYellow
+	case "ERROR", "ERR", "FATAL", "PANIC", "CRIT", "CRITICAL", "ALERT", "EMERG":
+		return colorRed
+	}
+	return ""
+}
+
+func padRight(s string, n int) string {
+	if len(s) >= n {
+		return s
+	}
+	return s + strings.Repeat(" ", n-len(s))
+}
@@ -0,0 +1,228 @@
+package encoder
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log-collector/message"
+	"sort"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// Type 编码的类型
+type Type string
+
+const (
+	Raw      Type = "raw"      //日志的原始内容,保证以换行结尾
+	JSON     Type = "json"     //把日志和元数据包装为一个JSON对象
+	Logfmt   Type = "logfmt"   //key=value格式
+	Template Type = "template" //用户提供的text/template
+)
+
+// Encoder 把日志编码为写入目的地的内容,每条日志编码后以换行结尾
+type Encoder interface {
+	Encode(m *message.Message) ([]byte, error)
+}
+
+// New 根据类型创建Encoder,tmpl只在typ为Template时使用
+func New(typ Type, tmpl string) (Encoder, error) {
+	switch typ {
+	case "", Raw:
+		return rawEncoder{}, nil
+	case JSON:
+		return jsonEncoder{}, nil
+	case Logfmt:
+		return logfmtEncoder{}, nil
+	case Template:
+		return newTemplateEncoder(tmpl)
+	}
+	return nil, fmt.Errorf("unknown encoding %q", typ)
+}
+
+// terminate 保证b以一个换行结尾
+func terminate(b []byte) []byte {
+	b = bytes.TrimRight(b, "\r\n")
+	return append(b[:len(b):len(b)], '\n')
+}
+
+type rawEncoder struct{}
+
+func (rawEncoder) Encode(m *message.Message) ([]byte, error) {
+	return terminate(m.Value), nil
+}
+
+// envelope JSON编码的格式,kafka的元数据只在有topic时输出
+type envelope struct {
+	Time      time.Time       `json:"time"`
+	Source    string          `json:"source,omitempty"`
+	Topic     string          `json:"topic,omitempty"`
+	Partition *int32          `json:"partition,omitempty"`
+	Offset    *int64          `json:"offset,omitempty"`
+	Key       string          `json:"key,omitempty"`
+	Message   json.RawMessage `json:"message"`
+}
+
+type jsonEncoder struct{}
+
+// Encode 日志是JSON对象或者数组时原样嵌入message,否则作为字符串
+func (jsonEncoder) Encode(m *message.Message) ([]byte, error) {
+	e := envelope{Time: m.Timestamp, Source: m.Source, Key: string(m.Key)}
+	if m.Topic != "" {
+		e.Topic, e.Partition, e.Offset = m.Topic, &m.Partition, &m.Offset
+	}
+	value := bytes.TrimSpace(m.Value)
+	if len(value) > 0 && (value[0] == '{' || value[0] == '[') && json.Valid(value) {
+		e.Message = value
+	} else {
+		s, err := json.Marshal(string(bytes.TrimRight(m.Value, "\r\n")))
+		if err != nil {
+			return nil, err
+		}
+		e.Message = s
+	}
+	b, err := json.Marshal(e)
+	if err != nil {
+		return nil, err
+	}
+	return append(b, '\n'), nil
+}
+
+// logfmtFirst logfmt中排在前面的字段,其余字段按名称排序
+var logfmtFirst = []string{"level", "msg", "message"}
+
+type logfmtEncoder struct{}
+
+// Encode 输出 time=... 和日志的字段,嵌套的字段用.连接名称;日志不是JSON对象时整条日志作为msg
+func (logfmtEncoder) Encode(m *message.Message) ([]byte, error) {
+	var b bytes.Buffer
+	writeLogfmtPair(&b, "time", m.Timestamp.Format(time.RFC3339Nano))
+	fields := m.Fields()
+	if fields == nil {
+		writeLogfmtPair(&b, "msg", strings.TrimRight(string(m.Value), "\r\n"))
+		return append(b.Bytes(), '\n'), nil
+	}
+	flat := make(map[string]interface{})
+	flatten(flat, "", fields)
+	for _, k := range logfmtFirst {
+		if v, ok := flat[k]; ok {
+			writeLogfmtPair(&b, k, message.ToString(v))
+			delete(flat, k)
+		}
+	}
+	keys := make([]string, 0, len(flat))
+	for k := range flat {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		writeLogfmtPair(&b, k, message.ToString(flat[k]))
+	}
+	return append(b.Bytes(), '\n'), nil
+}
+
+// flatten 把嵌套的对象展开,例如 {"http":{"status":200}} 展开为 http.status=200
+func flatten(out map[string]interface{}, prefix string, fields map[string]interface{}) {
+	for k, v := range fields {
+		if prefix != "" {
+			k = prefix + "." + k
+		}
+		if obj, ok := v.(map[string]interface{}); ok && len(obj) > 0 {
+			flatten(out, k, obj)
+			continue
+		}
+		out[k] = v
+	}
+}
+
+func writeLogfmtPair(b *bytes.Buffer, key, value string) {
+	if b.Len() > 0 {
+		b.WriteByte(' ')
+	}
+	b.WriteString(logfmtKey(key))
+	b.WriteByte('=')
+	if value == "" || strings.ContainsAny(value, " =\"\\") || strings.IndexFunc(value, isControl) >= 0 {
+		value = strconv.Quote(value)
+	}
+	b.WriteString(value)
+}
+
+// logfmtKey 名称中不能有空格、=和引号
+func logfmtKey(key string) string {
+	return strings.Map(func(r rune) rune {
+		if r <= ' ' || r == '=' || r == '"' {
+			return '_'
+		}
+		return r
+	}, key)
+}
+
+func isControl(r rune) bool {
+	return r < ' ' || r == 0x7f
+}
+
+// Record 模板中可以使用的数据,例如 {{.Time.Format "15:04:05"}} {{.Field "level"}} {{.Message}}
+type Record struct {
+	Message   string                 //日志的原始内容,不包括结尾的换行
+	Fields    map[string]interface{} //日志是JSON对象时解析后的字段
+	Time      time.Time
+	Source    string
+	Topic     string
+	Partition int32
+	Offset    int64
+	Key       string
+
+	msg *message.Message
+}
+
+// Field 查找字段或者元数据,规则同message.Lookup,找不到时为空字符串
+func (r Record) Field(name string) string {
+	s, _ := r.msg.LookupString(name)
+	return s
+}
+
+// templateFuncs 模板中可以使用的函数
+var templateFuncs = template.FuncMap{
+	"json": func(v interface{}) (string, error) {
+		b, err := json.Marshal(v)
+		return string(b), err
+	},
+	"upper": strings.ToUpper,
+	"lower": strings.ToLower,
+}
+
+type templateEncoder struct {
+	tmpl *template.Template
+}
+
+func newTemplateEncoder(text string) (*templateEncoder, error) {
+	if text == "" {
+		return nil, fmt.Errorf("template must not be empty")
+	}
+	tmpl, err := template.New("encoding").Funcs(templateFuncs).Parse(text)
+	if err != nil {
+		return nil, err
+	}
+	return &templateEncoder{tmpl: tmpl}, nil
+}
+
+func (t *templateEncoder) Encode(m *message.Message) ([]byte, error) {
+	var b bytes.Buffer
+	err := t.tmpl.Execute(&b, Record{
+		Message:   strings.TrimRight(string(m.Value), "\r\n"),
+		Fields:    m.Fields(),
+		Time:      m.Timestamp,
+		Source:    m.Source,
+		Topic:     m.Topic,
+		Partition: m.Partition,
+		Offset:    m.Offset,
+		Key:       string(m.Key),
+		msg:       m,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return terminate(b.Bytes()), nil
+}
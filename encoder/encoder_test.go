@@ -0,0 +1,97 @@
+package encoder
+
+import (
+	"log-collector/message"
+	"testing"
+	"time"
+)
+
+func TestEncoders(t *testing.T) {
+	ts := time.Date(2024, 3, 1, 10, 0, 0, 0, time.UTC)
+	kafka := func(value string) *message.Message {
+		return &message.Message{Value: []byte(value), Source: "kafka", Topic: "app", Partition: 0, Offset: 42, Timestamp: ts}
+	}
+	plain := func(value string) *message.Message {
+		return &message.Message{Value: []byte(value), Timestamp: ts}
+	}
+	tests := []struct {
+		name string
+		typ  Type
+		tmpl string
+		msg  *message.Message
+		want string
+	}{
+		{"raw adds newline", Raw, "", plain("100% done"), "100% done\n"},
+		{"raw keeps single newline", Raw, "", plain("line\r\n\n"), "line\n"},
+		{"json object", JSON, "", kafka(`{"a":1}`),
+			`{"time":"2024-03-01T10:00:00Z","source":"kafka","topic":"app","partition":0,"offset":42,"message":{"a":1}}` + "\n"},
+		{"json text", JSON, "", plain("plain \"text\"\n"),
+			`{"time":"2024-03-01T10:00:00Z","message":"plain \"text\""}` + "\n"},
+		{"logfmt object", Logfmt, "", plain(`{"msg":"hello world","level":"info","http":{"status":200},"user":"","ok":true}`),
+			`time=2024-03-01T10:00:00Z level=info msg="hello world" http.status=200 ok=true user=""` + "\n"},
+		{"logfmt text", Logfmt, "", plain("a=b"), `time=2024-03-01T10:00:00Z msg="a=b"` + "\n"},
+		{"template", Template, `{{.Time.Format "15:04:05"}} [{{.Field "level" | upper}}] {{.Topic}}/{{.Offset}} {{.Field "msg"}}`,
+			kafka(`{"level":"warn","msg":"disk full"}`), "10:00:00 [WARN] app/42 disk full\n"},
+		{"template json", Template, `{{json .Fields}}`, plain(`{"b":2,"a":1}`), `{"a":1,"b":2}` + "\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			enc, err := New(tt.typ, tt.tmpl)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := enc.Encode(tt.msg)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != tt.want {
+				t.Errorf("Encode() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNew_Invalid(t *testing.T) {
+	for _, tt := range []struct {
+		typ  Type
+		tmpl string
+	}{
+		{"xml", ""},
+		{Template, ""},
+		{Template, "{{.Field"},
+	} {
+		if _, err := New(tt.typ, tt.tmpl); err == nil {
+			t.Errorf("New(%q, %q) expected error", tt.typ, tt.tmpl)
+		}
+	}
+}
+
+func TestConsole(t *testing.T) {
+	ts := time.Date(2024, 3, 1, 10, 0, 0, 0, time.UTC)
+	local := ts.Local().Format("2006-01-02 15:04:05.000")
+	tests := []struct {
+		name  string
+		color bool
+		value string
+		want  string
+	}{
+		{"plain", false, `{"time":"2024-03-01T10:00:00Z","level":"info","service":"api","msg":"started","port":8080,"http":{"tls":true}}`,
+			local + " INFO  [api] started  http.tls=true port=8080\n"},
+		{"color", true, `{"ts":1709287200,"level":"error","msg":"boom"}`,
+			"\x1b[90m" + local + "\x1b[0m \x1b[31mERROR\x1b[0m boom\n"},
+		{"color rest dimmed", true, `{"ts":1709287200000,"lvl":"custom","message":"x","a":"b c"}`,
+			"\x1b[90m" + local + "\x1b[0m CUSTOM x  \x1b[2ma=\"b c\"\x1b[0m\n"},
+		{"raw fallback", true, "not json", "not json\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := NewConsole(tt.color).Encode(&message.Message{Value: []byte(tt.value), Timestamp: ts})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != tt.want {
+				t.Errorf("Encode() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,307 @@
+package fileindex
+
+import (
+	"encoding/json"
+	"fmt"
+	"log-collector/message"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const (
+	Version        = 2                //版本1的索引记录的是日志的元数据中的时间,和查询使用的时间不一致,不再使用
+	IndexSuffix    = ".idx"           //索引文件为 <日志文件>.idx,例如 app-2024_01_02.log.idx
+	ManifestSuffix = ".manifest.json" //清单文件为 <fileName>.manifest.json,和日志文件在同一个目录
+)
+
+// Segment 日志文件中连续的一段,记录这一段中日志的条数和时间范围
+// 查询时可以直接跳过时间范围不匹配的段
+type Segment struct {
+	Offset  int64     `json:"offset"`  //这一段的起始位置(字节),到下一段的Offset或者文件末尾为止
+	Count   int64     `json:"count"`   //日志条数
+	MinTime time.Time `json:"minTime"` //为零值时表示不知道这一段的时间(例如建立索引之前写入的内容),查询时需要读取
+	MaxTime time.Time `json:"maxTime"`
+}
+
+// Overlaps 这一段中是否可能有[from, to)之间的日志,from或to为零值时表示不限制
+func (s Segment) Overlaps(from, to time.Time) bool {
+	return overlaps(s.MinTime, s.MaxTime, from, to)
+}
+
+// Index 一个日志文件的稀疏索引,每隔一定的字节数开始一个新的段
+type Index struct {
+	Version  int       `json:"version"`
+	File     string    `json:"file"`  //日志文件的名称(不包括目录)
+	Size     int64     `json:"size"`  //建立索引时文件的大小,之后追加的内容不在索引中
+	Count    int64     `json:"count"` //日志条数,不包括Segments中不知道时间的段
+	MinTime  time.Time `json:"minTime"`
+	MaxTime  time.Time `json:"maxTime"`
+	Segments []Segment `json:"segments"`
+}
+
+// New 创建file的索引,size大于0时说明文件中已经有内容,这部分内容作为一个不知道时间的段
+func New(file string, size int64) *Index {
+	idx := &Index{Version: Version, File: filepath.Base(file), Size: size}
+	if size > 0 {
+		idx.Segments = append(idx.Segments, Segment{})
+	}
+	return idx
+}
+
+// Add 记录一条从offset开始、长度为n字节、时间为t的日志
+// 当前的段超过segmentSize字节(或者不知道时间)时开始新的段;t为零值时记为不知道时间的段,查询时总是读取
+func (idx *Index) Add(offset, n int64, t time.Time, segmentSize int64) {
+	last := len(idx.Segments) - 1
+	if t.IsZero() {
+		if last < 0 || !idx.Segments[last].MinTime.IsZero() {
+			idx.Segments = append(idx.Segments, Segment{Offset: offset})
+		}
+		idx.Size = offset + n
+		return
+	}
+	if last < 0 || idx.Segments[last].MinTime.IsZero() || offset-idx.Segments[last].Offset >= segmentSize {
+		idx.Segments = append(idx.Segments, Segment{Offset: offset, MinTime: t, MaxTime: t})
+		last++
+	}
+	seg := &idx.Segments[last]
+	seg.Count++
+	if t.Before(seg.MinTime) {
+		seg.MinTime = t
+	}
+	if t.After(seg.MaxTime) {
+		seg.MaxTime = t
+	}
+	idx.Count++
+	if idx.MinTime.IsZero() || t.Before(idx.MinTime) {
+		idx.MinTime = t
+	}
+	if t.After(idx.MaxTime) {
+		idx.MaxTime = t
+	}
+	idx.Size = offset + n
+}
+
+// Overlaps 文件中是否可能有[from, to)之间的日志
+func (idx *Index) Overlaps(from, to time.Time) bool {
+	if idx.Count == 0 || idx.hasUnknown() {
+		return true
+	}
+	return overlaps(idx.MinTime, idx.MaxTime, from, to)
+}
+
+// hasUnknown 是否有不知道时间的段
+func (idx *Index) hasUnknown() bool {
+	for _, s := range idx.Segments {
+		if s.MinTime.IsZero() {
+			return true
+		}
+	}
+	return false
+}
+
+// Ranges 需要读取的[start, end)区间,相邻的区间会合并;end为-1表示读到文件末尾
+// 索引之后追加的内容(Size之后)总是需要读取
+func (idx *Index) Ranges(from, to time.Time) [][2]int64 {
+	var ranges [][2]int64
+	add := func(start, end int64) {
+		if n := len(ranges); n > 0 && ranges[n-1][1] == start {
+			ranges[n-1][1] = end
+			return
+		}
+		ranges = append(ranges, [2]int64{start, end})
+	}
+	for i, s := range idx.Segments {
+		end := idx.Size
+		if i+1 < len(idx.Segments) {
+			end = idx.Segments[i+1].Offset
+		}
+		if s.Overlaps(from, to) {
+			add(s.Offset, end)
+		}
+	}
+	add(idx.Size, -1)
+	return ranges
+}
+
+// Path 日志文件对应的索引文件,压缩后的日志文件(.gz)使用压缩前的索引
+func Path(logFile string) string {
+	return strings.TrimSuffix(logFile, ".gz") + IndexSuffix
+}
+
+// Read 读取日志文件对应的索引
+func Read(logFile string) (*Index, error) {
+	var idx Index
+	if err := readJSON(Path(logFile), &idx); err != nil {
+		return nil, err
+	}
+	if idx.Version != Version {
+		return nil, fmt.Errorf("unsupported index version %d", idx.Version)
+	}
+	return &idx, nil
+}
+
+// Write 把索引写入日志文件对应的索引文件
+func (idx *Index) Write(logFile string) error {
+	return writeJSON(Path(logFile), idx)
+}
+
+// ManifestEntry 清单中的一个日志文件
+type ManifestEntry struct {
+	File    string    `json:"file"` //日志文件的名称(不包括目录),压缩后为.gz结尾的名称
+	Size    int64     `json:"size"`
+	Count   int64     `json:"count"`
+	MinTime time.Time `json:"minTime"`
+	MaxTime time.Time `json:"maxTime"`
+}
+
+// Overlaps 文件中是否可能有[from, to)之间的日志
+func (e ManifestEntry) Overlaps(from, to time.Time) bool {
+	return e.Count == 0 || overlaps(e.MinTime, e.MaxTime, from, to)
+}
+
+// Manifest 一个FileWriter在目录中写出的所有文件,按写入的顺序排列
+type Manifest struct {
+	Version int             `json:"version"`
+	Files   []ManifestEntry `json:"files"`
+}
+
+// ManifestPath dir中name的清单文件
+func ManifestPath(dir, name string) string {
+	return filepath.Join(dir, name+ManifestSuffix)
+}
+
+// ReadManifest 读取清单,文件不存在时返回空的清单
+func ReadManifest(dir, name string) (*Manifest, error) {
+	m := &Manifest{Version: Version}
+	if err := readJSON(ManifestPath(dir, name), m); err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	if m.Version != Version {
+		return nil, fmt.Errorf("unsupported manifest version %d", m.Version)
+	}
+	return m, nil
+}
+
+// Update 用索引更新清单中对应的文件,没有时添加到最后
+func (m *Manifest) Update(idx *Index) {
+	entry := ManifestEntry{File: idx.File, Size: idx.Size, Count: idx.Count, MinTime: idx.MinTime, MaxTime: idx.MaxTime}
+	if idx.hasUnknown() {
+		//有不知道时间的内容时不能用时间范围跳过这个文件
+		entry.Count = 0
+		entry.MinTime, entry.MaxTime = time.Time{}, time.Time{}
+	}
+	for i := range m.Files {
+		if m.Files[i].File == idx.File {
+			m.Files[i] = entry
+			return
+		}
+	}
+	m.Files = append(m.Files, entry)
+}
+
+// Lookup 查找日志文件(名称,不包括目录),file压缩前的名称也可以找到
+func (m *Manifest) Lookup(file string) (ManifestEntry, bool) {
+	plain := strings.TrimSuffix(file, ".gz")
+	for _, e := range m.Files {
+		if e.File == file || e.File == plain {
+			return e, true
+		}
+	}
+	return ManifestEntry{}, false
+}
+
+// Prune 删除dir中已经不存在的文件,被压缩的文件改为压缩后的名称
+func (m *Manifest) Prune(dir string) {
+	files := m.Files[:0]
+	for _, e := range m.Files {
+		if _, err := os.Stat(filepath.Join(dir, e.File)); err != nil {
+			gz := e.File + ".gz"
+			if _, err := os.Stat(filepath.Join(dir, gz)); err != nil {
+				continue
+			}
+			e.File = gz
+		}
+		files = append(files, e)
+	}
+	m.Files = files
+}
+
+// Write 写入dir中name的清单
+func (m *Manifest) Write(dir, name string) error {
+	return writeJSON(ManifestPath(dir, name), m)
+}
+
+// TimeFields 日志中表示时间的字段,按顺序查找第一个存在的字段
+var TimeFields = []string{"time", "ts", "timestamp", "@timestamp"}
+
+// RecordTime 日志中的时间,支持RFC3339格式的字符串和unix时间戳(秒或者毫秒)
+// 建立索引和查询都使用这个时间,索引才能正确地跳过不需要的段
+func RecordTime(m *message.Message) (time.Time, bool) {
+	fields := m.Fields()
+	if fields == nil {
+		return time.Time{}, false
+	}
+	for _, name := range TimeFields {
+		v, ok := fields[name]
+		if !ok {
+			continue
+		}
+		switch val := v.(type) {
+		case string:
+			if t, err := time.Parse(time.RFC3339Nano, strings.TrimSpace(val)); err == nil {
+				return t, true
+			}
+		case float64:
+			if val > 1e12 {
+				return time.UnixMilli(int64(val)), true
+			}
+			sec := int64(val)
+			return time.Unix(sec, int64((val-float64(sec))*1e9)), true
+		}
+		return time.Time{}, false
+	}
+	return time.Time{}, false
+}
+
+// overlaps [lo, hi]和[from, to)是否有交集,from或to为零值时表示不限制
+func overlaps(lo, hi, from, to time.Time) bool {
+	if lo.IsZero() {
+		return true
+	}
+	if !from.IsZero() && hi.Before(from) {
+		return false
+	}
+	if !to.IsZero() && !lo.Before(to) {
+		return false
+	}
+	return true
+}
+
+func readJSON(path string, v interface{}) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		return fmt.Errorf("failed to parse %s: %v", path, err)
+	}
+	return nil
+}
+
+// writeJSON 先写临时文件再重命名,查询时不会读到写了一半的文件
+func writeJSON(path string, v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0666); err != nil {
+		return fmt.Errorf("failed to write %s: %v", path, err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return fmt.Errorf("failed to write %s: %v", path, err)
+	}
+	return nil
+}
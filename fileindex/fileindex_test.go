@@ -0,0 +1,97 @@
+package fileindex
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestIndex_Ranges(t *testing.T) {
+	base := time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC)
+	idx := New("app.log", 10) //已有10字节不知道时间的内容
+	for i := 0; i < 6; i++ {
+		//每条日志10字节,每段20字节
+		idx.Add(10+int64(i)*10, 10, base.Add(time.Duration(i)*time.Hour), 20)
+	}
+	if len(idx.Segments) != 4 || idx.Count != 6 || idx.Size != 70 {
+		t.Fatalf("unexpected index %+v", idx)
+	}
+	if !idx.MinTime.Equal(base) || !idx.MaxTime.Equal(base.Add(5*time.Hour)) {
+		t.Errorf("unexpected time bounds %v - %v", idx.MinTime, idx.MaxTime)
+	}
+	tests := []struct {
+		name     string
+		from, to time.Time
+		want     [][2]int64
+	}{
+		{"all", time.Time{}, time.Time{}, [][2]int64{{0, -1}}},
+		{"middle", base.Add(2 * time.Hour), base.Add(3 * time.Hour), [][2]int64{{0, 10}, {30, 50}, {70, -1}}},
+		{"after", base.Add(10 * time.Hour), time.Time{}, [][2]int64{{0, 10}, {70, -1}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := idx.Ranges(tt.from, tt.to); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Ranges() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestManifest(t *testing.T) {
+	dir := t.TempDir()
+	base := time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC)
+	for _, name := range []string{"app-2024_01_01.log.gz", "app-2024_01_02.log"} {
+		if err := os.WriteFile(filepath.Join(dir, name), nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	m, err := ReadManifest(dir, "app")
+	if err != nil {
+		t.Fatal(err)
+	}
+	old := New("app-2024_01_01.log", 0)
+	old.Add(0, 10, base.Add(-time.Hour), 1<<20)
+	cur := New(filepath.Join(dir, "app-2024_01_02.log"), 0)
+	cur.Add(0, 10, base.Add(time.Hour), 1<<20)
+	gone := New("app-2023_12_31.log", 0)
+	for _, idx := range []*Index{gone, old, cur} {
+		m.Update(idx)
+	}
+	m.Prune(dir)
+	if err := m.Write(dir, "app"); err != nil {
+		t.Fatal(err)
+	}
+
+	m, err = ReadManifest(dir, "app")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(m.Files) != 2 || m.Files[0].File != "app-2024_01_01.log.gz" || m.Files[1].File != "app-2024_01_02.log" {
+		t.Fatalf("unexpected manifest %+v", m.Files)
+	}
+	e, ok := m.Lookup("app-2024_01_02.log.gz")
+	if !ok || e.Count != 1 {
+		t.Errorf("Lookup() = %+v, %v", e, ok)
+	}
+	if e.Overlaps(base.Add(2*time.Hour), time.Time{}) || !e.Overlaps(base, base.Add(2*time.Hour)) {
+		t.Error("unexpected Overlaps result")
+	}
+}
+
+func TestIndex_AddUnknown(t *testing.T) {
+	base := time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC)
+	idx := New("app.log", 0)
+	idx.Add(0, 10, base, 100)
+	idx.Add(10, 10, time.Time{}, 100) //没有时间的日志
+	idx.Add(20, 10, time.Time{}, 100)
+	idx.Add(30, 10, base.Add(time.Hour), 100)
+	if len(idx.Segments) != 3 || idx.Count != 2 || idx.Size != 40 || idx.Segments[1].Offset != 10 || idx.Segments[2].Offset != 30 {
+		t.Fatalf("unexpected index %+v", idx)
+	}
+	// 不知道时间的段总是需要读取
+	if got, want := idx.Ranges(base.Add(2*time.Hour), time.Time{}), [][2]int64{{10, 30}, {40, -1}}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Ranges() = %v, want %v", got, want)
+	}
+}
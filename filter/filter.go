@@ -0,0 +1,347 @@
+package filter
+
+import (
+	"encoding/json"
+	"fmt"
+	"log-collector/message"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Filter 解析后的过滤表达式,可以并发使用
+//
+// 表达式由比较组成,可以用 &&(and)、||(or)、!(not) 和括号组合,例如:
+//
+//	level == "error" && @topic == "payment"
+//	http.status >= 500 || msg contains "timeout"
+//	!(service =~ "^test-") and user_id
+//
+// 比较的左右两边是字段(用.访问嵌套的字段,@开头的为元数据,同message.Lookup)或者字面量(字符串、数字、true、false、null);
+// 运算符有 == != < <= > >= =~(正则匹配) !~ contains。两边都是数字时按数字比较,否则按字符串比较;
+// 单独的字段表示字段存在并且不是空字符串、false、0或者null。字段不存在时除了!=和!~,其他比较都为false
+type Filter struct {
+	expr string
+	root node
+}
+
+// Parse 解析过滤表达式
+func Parse(expr string) (*Filter, error) {
+	p := &parser{lex: newLexer(expr)}
+	if err := p.next(); err != nil {
+		return nil, err
+	}
+	root, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if p.tok.kind != tokEOF {
+		return nil, p.errorf("unexpected %s", p.tok)
+	}
+	return &Filter{expr: expr, root: root}, nil
+}
+
+// Match 日志是否满足表达式,f为nil时所有日志都满足
+func (f *Filter) Match(m *message.Message) bool {
+	if f == nil {
+		return true
+	}
+	return f.root.eval(m)
+}
+
+func (f *Filter) String() string {
+	return f.expr
+}
+
+// node 表达式树的节点
+type node interface {
+	eval(m *message.Message) bool
+}
+
+type andNode struct{ left, right node }
+
+func (n andNode) eval(m *message.Message) bool { return n.left.eval(m) && n.right.eval(m) }
+
+type orNode struct{ left, right node }
+
+func (n orNode) eval(m *message.Message) bool { return n.left.eval(m) || n.right.eval(m) }
+
+type notNode struct{ expr node }
+
+func (n notNode) eval(m *message.Message) bool { return !n.expr.eval(m) }
+
+// truthyNode 单独的字段或者字面量
+type truthyNode struct{ operand operand }
+
+func (n truthyNode) eval(m *message.Message) bool {
+	v, ok := n.operand.value(m)
+	if !ok {
+		return false
+	}
+	switch val := v.(type) {
+	case nil:
+		return false
+	case bool:
+		return val
+	case string:
+		return val != ""
+	}
+	if f, ok := toNumber(v); ok {
+		return f != 0
+	}
+	return true
+}
+
+type compareNode struct {
+	op          string
+	left, right operand
+	re          *regexp.Regexp //op为=~和!~时的正则
+}
+
+func (n compareNode) eval(m *message.Message) bool {
+	l, lok := n.left.value(m)
+	switch n.op {
+	case "=~":
+		return lok && n.re.MatchString(toString(l))
+	case "!~":
+		return !lok || !n.re.MatchString(toString(l))
+	}
+	r, rok := n.right.value(m)
+	if !lok || !rok {
+		return n.op == "!="
+	}
+	if n.op == "contains" {
+		return strings.Contains(toString(l), toString(r))
+	}
+
+	var cmp int
+	lf, lnum := toNumber(l)
+	rf, rnum := toNumber(r)
+	switch {
+	case l == nil || r == nil:
+		//null只和null相等
+		if n.op != "==" && n.op != "!=" {
+			return false
+		}
+		if (l == nil) != (r == nil) {
+			cmp = 1
+		}
+	case lnum && rnum:
+		switch {
+		case lf < rf:
+			cmp = -1
+		case lf > rf:
+			cmp = 1
+		}
+	default:
+		cmp = strings.Compare(toString(l), toString(r))
+	}
+	switch n.op {
+	case "==":
+		return cmp == 0
+	case "!=":
+		return cmp != 0
+	case "<":
+		return cmp < 0
+	case "<=":
+		return cmp <= 0
+	case ">":
+		return cmp > 0
+	case ">=":
+		return cmp >= 0
+	}
+	return false
+}
+
+// operand 比较的一边,field不为空时是字段,否则是字面量
+type operand struct {
+	field   string
+	literal interface{}
+}
+
+func (o operand) value(m *message.Message) (interface{}, bool) {
+	if o.field == "" {
+		return o.literal, true
+	}
+	return m.Lookup(o.field)
+}
+
+// toNumber 数字和数字的字符串转换为float64
+func toNumber(v interface{}) (float64, bool) {
+	switch val := v.(type) {
+	case float64:
+		return val, true
+	case int32:
+		return float64(val), true
+	case int64:
+		return float64(val), true
+	case int:
+		return float64(val), true
+	case json.Number:
+		f, err := val.Float64()
+		return f, err == nil
+	case string:
+		f, err := strconv.ParseFloat(strings.TrimSpace(val), 64)
+		return f, err == nil
+	}
+	return 0, false
+}
+
+func toString(v interface{}) string {
+	if t, ok := v.(time.Time); ok {
+		return t.Format(time.RFC3339Nano)
+	}
+	return message.ToString(v)
+}
+
+type parser struct {
+	lex *lexer
+	tok token
+}
+
+func (p *parser) next() error {
+	tok, err := p.lex.next()
+	if err != nil {
+		return err
+	}
+	p.tok = tok
+	return nil
+}
+
+func (p *parser) errorf(format string, args ...interface{}) error {
+	return fmt.Errorf("filter: %s at position %d", fmt.Sprintf(format, args...), p.tok.pos+1)
+}
+
+// is 当前token是否是关键字或者运算符text
+func (p *parser) is(text string) bool {
+	return (p.tok.kind == tokOp || p.tok.kind == tokIdent) && p.tok.text == text
+}
+
+func (p *parser) parseOr() (node, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.is("||") || p.is("or") {
+		if err := p.next(); err != nil {
+			return nil, err
+		}
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = orNode{left, right}
+	}
+	return left, nil
+}
+
+func (p *parser) parseAnd() (node, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for p.is("&&") || p.is("and") {
+		if err := p.next(); err != nil {
+			return nil, err
+		}
+		right, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		left = andNode{left, right}
+	}
+	return left, nil
+}
+
+func (p *parser) parseUnary() (node, error) {
+	if p.is("!") || p.is("not") {
+		if err := p.next(); err != nil {
+			return nil, err
+		}
+		expr, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return notNode{expr}, nil
+	}
+	if p.is("(") {
+		if err := p.next(); err != nil {
+			return nil, err
+		}
+		expr, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if !p.is(")") {
+			return nil, p.errorf("expected ) but got %s", p.tok)
+		}
+		return expr, p.next()
+	}
+	return p.parseComparison()
+}
+
+var compareOps = map[string]bool{
+	"==": true, "!=": true, "<": true, "<=": true, ">": true, ">=": true, "=~": true, "!~": true, "contains": true,
+}
+
+func (p *parser) parseComparison() (node, error) {
+	left, err := p.parseOperand()
+	if err != nil {
+		return nil, err
+	}
+	if !compareOps[p.tok.text] || (p.tok.kind != tokOp && p.tok.kind != tokIdent) {
+		return truthyNode{left}, nil
+	}
+	op := p.tok.text
+	if err := p.next(); err != nil {
+		return nil, err
+	}
+	rightTok := p.tok
+	right, err := p.parseOperand()
+	if err != nil {
+		return nil, err
+	}
+	n := compareNode{op: op, left: left, right: right}
+	if op == "=~" || op == "!~" {
+		pattern, ok := right.literal.(string)
+		if right.field != "" || !ok {
+			return nil, fmt.Errorf("filter: %s expects a string pattern at position %d", op, rightTok.pos+1)
+		}
+		if n.re, err = regexp.Compile(pattern); err != nil {
+			return nil, fmt.Errorf("filter: invalid pattern at position %d: %v", rightTok.pos+1, err)
+		}
+	}
+	return n, nil
+}
+
+func (p *parser) parseOperand() (operand, error) {
+	tok := p.tok
+	var o operand
+	switch tok.kind {
+	case tokString:
+		o.literal = tok.text
+	case tokNumber:
+		f, err := strconv.ParseFloat(tok.text, 64)
+		if err != nil {
+			return o, p.errorf("invalid number %q", tok.text)
+		}
+		o.literal = f
+	case tokIdent:
+		switch tok.text {
+		case "true":
+			o.literal = true
+		case "false":
+			o.literal = false
+		case "null":
+			o.literal = nil
+		case "and", "or", "not", "contains":
+			return o, p.errorf("unexpected %s", tok)
+		default:
+			o.field = tok.text
+		}
+	default:
+		return o, p.errorf("expected a field or value but got %s", tok)
+	}
+	return o, p.next()
+}
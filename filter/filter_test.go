@@ -0,0 +1,84 @@
+package filter
+
+import (
+	"log-collector/message"
+	"testing"
+	"time"
+)
+
+func TestFilter_Match(t *testing.T) {
+	msg := &message.Message{
+		Value:     []byte(`{"level":"error","msg":"upstream timeout","http":{"status":503},"user":"","retry":false,"tags":["a"]}`),
+		Topic:     "payment",
+		Partition: 3,
+		Offset:    100,
+		Timestamp: time.Date(2024, 3, 1, 10, 0, 0, 0, time.UTC),
+	}
+	plain := &message.Message{Value: []byte("plain text")}
+	tests := []struct {
+		expr string
+		want bool
+	}{
+		{`level == "error"`, true},
+		{`level != "error"`, false},
+		{`level == 'error' && @topic == "payment"`, true},
+		{`level == "info" || @topic == "payment"`, true},
+		{`http.status >= 500`, true},
+		{`http.status < 500`, false},
+		{`http.status == "503"`, true},
+		{`@partition == 3 and @offset > 99`, true},
+		{`msg contains "timeout"`, true},
+		{`msg =~ "^up.*out$"`, true},
+		{`msg !~ 'time\w+'`, false},
+		{`!(level == "error")`, false},
+		{`not level == "error" or http.status`, true},
+		{`user`, false},
+		{`retry`, false},
+		{`missing`, false},
+		{`missing != "x"`, true},
+		{`missing == "x"`, false},
+		{`missing !~ "x"`, true},
+		{`missing == null`, false},
+		{`user == ""`, true},
+		{`@timestamp >= "2024-03-01"`, true},
+		{`level == "error" && (msg contains "db" || http.status == 503)`, true},
+	}
+	for _, tt := range tests {
+		f, err := Parse(tt.expr)
+		if err != nil {
+			t.Errorf("Parse(%q) error = %v", tt.expr, err)
+			continue
+		}
+		if got := f.Match(msg); got != tt.want {
+			t.Errorf("%q Match() = %v, want %v", tt.expr, got, tt.want)
+		}
+	}
+
+	f, _ := Parse(`level == "error"`)
+	if f.Match(plain) {
+		t.Errorf("non-JSON record should not match field comparisons")
+	}
+	var none *Filter
+	if !none.Match(plain) {
+		t.Errorf("nil filter should match everything")
+	}
+}
+
+func TestParse_Invalid(t *testing.T) {
+	for _, expr := range []string{
+		``,
+		`level ==`,
+		`level == "error`,
+		`(level == "error"`,
+		`level == "a" &&`,
+		`msg =~ "("`,
+		`msg =~ level`,
+		`level # 1`,
+		`a b`,
+		`and`,
+	} {
+		if _, err := Parse(expr); err == nil {
+			t.Errorf("Parse(%q) expected error", expr)
+		}
+	}
+}
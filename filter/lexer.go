@@ -0,0 +1,117 @@
+package filter
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+type tokenKind int
+
+const (
+	tokEOF    tokenKind = iota
+	tokIdent            //字段名称或者关键字
+	tokString           //"..."或者'...'
+	tokNumber           //
+	tokOp               //运算符和括号
+)
+
+type token struct {
+	kind tokenKind
+	text string //字符串为去掉引号、转义后的内容
+	pos  int    //在表达式中的位置
+}
+
+func (t token) String() string {
+	switch t.kind {
+	case tokEOF:
+		return "end of expression"
+	case tokString:
+		return strconv.Quote(t.text)
+	}
+	return fmt.Sprintf("%q", t.text)
+}
+
+// 两个字符的运算符需要先于一个字符的匹配
+var operators = []string{"==", "!=", "<=", ">=", "=~", "!~", "&&", "||", "<", ">", "!", "(", ")"}
+
+type lexer struct {
+	input string
+	pos   int
+}
+
+func newLexer(input string) *lexer {
+	return &lexer{input: input}
+}
+
+func (l *lexer) next() (token, error) {
+	for l.pos < len(l.input) && strings.ContainsRune(" \t\r\n", rune(l.input[l.pos])) {
+		l.pos++
+	}
+	start := l.pos
+	if l.pos >= len(l.input) {
+		return token{kind: tokEOF, pos: start}, nil
+	}
+	ch := l.input[l.pos]
+	switch {
+	case ch == '"' || ch == '\'':
+		return l.lexString(ch)
+	case ch == '-' || ch >= '0' && ch <= '9':
+		for l.pos++; l.pos < len(l.input) && isNumberChar(l.input[l.pos]); l.pos++ {
+		}
+		return token{kind: tokNumber, text: l.input[start:l.pos], pos: start}, nil
+	case isIdentStart(ch):
+		for l.pos++; l.pos < len(l.input) && isIdentChar(l.input[l.pos]); l.pos++ {
+		}
+		return token{kind: tokIdent, text: l.input[start:l.pos], pos: start}, nil
+	}
+	for _, op := range operators {
+		if strings.HasPrefix(l.input[l.pos:], op) {
+			l.pos += len(op)
+			return token{kind: tokOp, text: op, pos: start}, nil
+		}
+	}
+	return token{}, fmt.Errorf("filter: unexpected character %q at position %d", ch, start+1)
+}
+
+// lexString 双引号的字符串支持Go的转义,单引号的字符串只有\'和\\需要转义,便于写正则
+func (l *lexer) lexString(quote byte) (token, error) {
+	start := l.pos
+	var b strings.Builder
+	for l.pos++; l.pos < len(l.input); l.pos++ {
+		ch := l.input[l.pos]
+		switch {
+		case ch == quote:
+			l.pos++
+			if quote == '"' {
+				s, err := strconv.Unquote(l.input[start:l.pos])
+				if err != nil {
+					return token{}, fmt.Errorf("filter: invalid string at position %d: %v", start+1, err)
+				}
+				return token{kind: tokString, text: s, pos: start}, nil
+			}
+			return token{kind: tokString, text: b.String(), pos: start}, nil
+		case ch == '\\' && l.pos+1 < len(l.input):
+			l.pos++
+			if next := l.input[l.pos]; quote == '\'' && next != '\'' && next != '\\' {
+				b.WriteByte('\\')
+			}
+			b.WriteByte(l.input[l.pos])
+		default:
+			b.WriteByte(ch)
+		}
+	}
+	return token{}, fmt.Errorf("filter: unterminated string at position %d", start+1)
+}
+
+func isIdentStart(ch byte) bool {
+	return ch == '_' || ch == '@' || ch >= 'a' && ch <= 'z' || ch >= 'A' && ch <= 'Z'
+}
+
+func isIdentChar(ch byte) bool {
+	return isIdentStart(ch) || ch == '.' || ch == '-' || ch >= '0' && ch <= '9'
+}
+
+func isNumberChar(ch byte) bool {
+	return ch >= '0' && ch <= '9' || ch == '.' || ch == 'e' || ch == 'E' || ch == '+' || ch == '-'
+}
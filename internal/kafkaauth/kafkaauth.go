@@ -0,0 +1,22 @@
+// Package kafkaauth kafka reader和writer共用的连接broker的TLS和SASL配置
+package kafkaauth
+
+import "github.com/IBM/sarama"
+
+// Auth 连接broker的TLS和SASL配置
+type Auth struct {
+	TLS      bool   //是否使用TLS连接broker
+	User     string //为空时不使用SASL
+	Password string
+}
+
+// Apply 把认证配置写入sarama的配置,SASL目前只支持PLAIN
+func (a Auth) Apply(config *sarama.Config) {
+	config.Net.TLS.Enable = a.TLS
+	if a.User != "" {
+		config.Net.SASL.Enable = true
+		config.Net.SASL.Mechanism = sarama.SASLTypePlaintext
+		config.Net.SASL.User = a.User
+		config.Net.SASL.Password = a.Password
+	}
+}
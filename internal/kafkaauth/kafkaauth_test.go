@@ -0,0 +1,22 @@
+package kafkaauth
+
+import (
+	"testing"
+
+	"github.com/IBM/sarama"
+)
+
+func TestAuth_Apply(t *testing.T) {
+	config := sarama.NewConfig()
+	Auth{TLS: true, User: "user", Password: "pw"}.Apply(config)
+	if !config.Net.TLS.Enable || !config.Net.SASL.Enable || config.Net.SASL.Mechanism != sarama.SASLTypePlaintext ||
+		config.Net.SASL.User != "user" || config.Net.SASL.Password != "pw" {
+		t.Errorf("unexpected net config %+v", config.Net)
+	}
+
+	config = sarama.NewConfig()
+	Auth{}.Apply(config)
+	if config.Net.TLS.Enable || config.Net.SASL.Enable {
+		t.Error("expected TLS and SASL to stay disabled")
+	}
+}
@@ -0,0 +1,64 @@
+package logging
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"strings"
+)
+
+// 日志的格式
+const (
+	FormatText = "text" //key=value格式,默认
+	FormatJSON = "json" //每行一个JSON对象,方便日志平台解析
+)
+
+var (
+	// ErrUnknownLevel 不支持的日志级别
+	ErrUnknownLevel = errors.New("unknown log level")
+	// ErrUnknownFormat 不支持的日志格式
+	ErrUnknownFormat = errors.New("unknown log format")
+)
+
+// level 程序自己的日志的级别,可以在运行时修改(例如通过admin接口)
+var level = new(slog.LevelVar)
+
+// Init 把slog和标准库log的输出交给带级别的handler,标准库log输出的日志为info级别
+// w一般为os.Stderr,不能是stdout writer写入的os.Stdout,否则程序自己的日志会混在收集的日志中
+// format为FormatText或FormatJSON,为空时为FormatText
+func Init(w io.Writer, format string) error {
+	opts := &slog.HandlerOptions{Level: level}
+	var h slog.Handler
+	switch format {
+	case "", FormatText:
+		h = slog.NewTextHandler(w, opts)
+	case FormatJSON:
+		h = slog.NewJSONHandler(w, opts)
+	default:
+		return fmt.Errorf("%w %q, expected one of text, json", ErrUnknownFormat, format)
+	}
+	slog.SetDefault(slog.New(h))
+	return nil
+}
+
+// SetLevel 修改日志的级别,name为debug、info、warn或error(不区分大小写)
+func SetLevel(name string) error {
+	var l slog.Level
+	if err := l.UnmarshalText([]byte(name)); err != nil {
+		return fmt.Errorf("%w %q, expected one of debug, info, warn, error", ErrUnknownLevel, name)
+	}
+	level.Set(l)
+	return nil
+}
+
+// Level 当前日志的级别,例如info
+func Level() string {
+	return strings.ToLower(level.Level().String())
+}
+
+// Component 带有component属性的logger,args为其他的属性,例如 Component("writer", "writer", name)
+// 在打印日志时获取,不要保存,这样Init修改格式后立即生效
+func Component(name string, args ...any) *slog.Logger {
+	return slog.Default().With(append([]any{"component", name}, args...)...)
+}
@@ -0,0 +1,71 @@
+package logging
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"log"
+	"strings"
+	"testing"
+)
+
+func TestInit(t *testing.T) {
+	defer SetLevel("info")
+
+	var buf bytes.Buffer
+	if err := Init(&buf, FormatJSON); err != nil {
+		t.Fatal(err)
+	}
+	Component("reader", "topic", "applog", "partition", 3).Error("consume messages failed", "error", errors.New("boom"))
+	var got map[string]interface{}
+	if err := json.Unmarshal(buf.Bytes(), &got); err != nil {
+		t.Fatalf("expected JSON, got %q", buf.String())
+	}
+	for key, want := range map[string]interface{}{
+		"level":     "ERROR",
+		"msg":       "consume messages failed",
+		"component": "reader",
+		"topic":     "applog",
+		"partition": float64(3),
+		"error":     "boom",
+	} {
+		if got[key] != want {
+			t.Errorf("%s = %v, want %v", key, got[key], want)
+		}
+	}
+
+	//级别以下的日志不输出,标准库log的日志为info级别
+	buf.Reset()
+	if err := SetLevel("WARN"); err != nil {
+		t.Fatal(err)
+	}
+	if Level() != "warn" {
+		t.Errorf("Level() = %s", Level())
+	}
+	Component("app").Info("hidden")
+	log.Print("hidden too")
+	if buf.Len() != 0 {
+		t.Errorf("expected nothing below warn, got %q", buf.String())
+	}
+	SetLevel("info")
+	log.Print("from std log")
+	if !strings.Contains(buf.String(), `"msg":"from std log"`) {
+		t.Errorf("expected std log in JSON, got %q", buf.String())
+	}
+
+	buf.Reset()
+	if err := Init(&buf, FormatText); err != nil {
+		t.Fatal(err)
+	}
+	Component("tail").Warn("dropping slow client", "client", "10.0.0.1:1234")
+	if got := buf.String(); !strings.Contains(got, "level=WARN msg=\"dropping slow client\" component=tail client=10.0.0.1:1234") {
+		t.Errorf("unexpected text output %q", got)
+	}
+
+	if err := Init(&buf, "xml"); !errors.Is(err, ErrUnknownFormat) {
+		t.Errorf("Init(xml) error = %v, want ErrUnknownFormat", err)
+	}
+	if err := SetLevel("verbose"); !errors.Is(err, ErrUnknownLevel) {
+		t.Errorf("SetLevel(verbose) error = %v, want ErrUnknownLevel", err)
+	}
+}
@@ -0,0 +1,96 @@
+package message
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"time"
+)
+
+// magic 编码后的日志以它开头,用来和旧版本只保存了日志内容的数据区分
+var magic = []byte("\x00LM1")
+
+var errCorrupt = errors.New("message: corrupt encoding")
+
+// Marshal 把日志和元数据编码为二进制,用于写入磁盘队列
+// 格式: magic | source | topic | partition | offset | key | timestamp | value,
+// 字符串和key为uvarint长度加内容,数字为varint,value占用剩下的所有字节
+func Marshal(m *Message) []byte {
+	b := make([]byte, 0, len(magic)+len(m.Source)+len(m.Topic)+len(m.Key)+len(m.Value)+32)
+	b = append(b, magic...)
+	b = appendBytes(b, []byte(m.Source))
+	b = appendBytes(b, []byte(m.Topic))
+	b = binary.AppendVarint(b, int64(m.Partition))
+	b = binary.AppendVarint(b, m.Offset)
+	b = appendBytes(b, m.Key)
+	var ts int64
+	if !m.Timestamp.IsZero() {
+		ts = m.Timestamp.UnixNano()
+	}
+	b = binary.AppendVarint(b, ts)
+	return append(b, m.Value...)
+}
+
+// Unmarshal 解码Marshal的结果,不是以magic开头的数据当作只有内容的日志
+func Unmarshal(b []byte) (*Message, error) {
+	if !bytes.HasPrefix(b, magic) {
+		return &Message{Value: b}, nil
+	}
+	d := decoder{b: b[len(magic):]}
+	m := &Message{
+		Source:    string(d.bytes()),
+		Topic:     string(d.bytes()),
+		Partition: int32(d.varint()),
+		Offset:    d.varint(),
+		Key:       d.bytes(),
+	}
+	if ts := d.varint(); ts != 0 {
+		m.Timestamp = time.Unix(0, ts)
+	}
+	if d.err != nil {
+		return nil, d.err
+	}
+	m.Value = d.b
+	return m, nil
+}
+
+func appendBytes(b, v []byte) []byte {
+	b = binary.AppendUvarint(b, uint64(len(v)))
+	return append(b, v...)
+}
+
+// decoder 依次读取各个字段,出错后后面的读取都返回零值
+type decoder struct {
+	b   []byte
+	err error
+}
+
+func (d *decoder) varint() int64 {
+	if d.err != nil {
+		return 0
+	}
+	v, n := binary.Varint(d.b)
+	if n <= 0 {
+		d.err = errCorrupt
+		return 0
+	}
+	d.b = d.b[n:]
+	return v
+}
+
+func (d *decoder) bytes() []byte {
+	if d.err != nil {
+		return nil
+	}
+	l, n := binary.Uvarint(d.b)
+	if n <= 0 || uint64(len(d.b)-n) < l {
+		d.err = errCorrupt
+		return nil
+	}
+	v := d.b[n : n+int(l)]
+	d.b = d.b[n+int(l):]
+	if len(v) == 0 {
+		return nil
+	}
+	return v
+}
@@ -0,0 +1,138 @@
+package message
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Message reader读到的一条日志,以及它的元数据
+// 同一条日志会被分发给所有的writer,writer不能修改它
+type Message struct {
+	Value     []byte    //日志的原始内容
+	Source    string    //读到这条日志的reader的名称
+	Topic     string    //kafka的topic,其他reader为空
+	Partition int32     //kafka的partition
+	Offset    int64     //kafka的offset
+	Key       []byte    //kafka消息的key
+	Timestamp time.Time //日志产生的时间,reader不知道时为读到的时间
+
+	once   sync.Once
+	fields map[string]interface{}
+}
+
+// New 创建只有内容的日志,时间为当前时间
+func New(value []byte) *Message {
+	return &Message{Value: value, Timestamp: time.Now()}
+}
+
+// Fields 把Value当作JSON对象解析后的字段,不是JSON对象时返回nil
+// 第一次调用时才会解析,结果会被缓存,可以并发调用
+func (m *Message) Fields() map[string]interface{} {
+	m.once.Do(func() {
+		var fields map[string]interface{}
+		if json.Unmarshal(m.Value, &fields) == nil {
+			m.fields = fields
+		}
+	})
+	return m.fields
+}
+
+// DecodeFields 同Fields,但是数字解析为json.Number,超过2^53的整数(例如雪花ID、纳秒时间戳)不会丢失精度
+// 每次调用都会重新解析,结果不会被缓存
+func DecodeFields(value []byte) map[string]interface{} {
+	dec := json.NewDecoder(bytes.NewReader(value))
+	dec.UseNumber()
+	var fields map[string]interface{}
+	if dec.Decode(&fields) != nil || dec.More() {
+		return nil
+	}
+	return fields
+}
+
+// Lookup 查找name对应的值
+// 以@开头的名称表示元数据: @source、@topic、@partition、@offset、@key、@timestamp,@value为日志的原始内容;
+// 其他名称从Fields中查找,用.访问嵌套的字段,例如 kubernetes.namespace
+func (m *Message) Lookup(name string) (interface{}, bool) {
+	if strings.HasPrefix(name, "@") {
+		return m.LookupIn(nil, name)
+	}
+	return m.LookupIn(m.Fields(), name)
+}
+
+// LookupIn 同Lookup,但是字段从fields中查找,例如DecodeFields解析的字段
+func (m *Message) LookupIn(fields map[string]interface{}, name string) (interface{}, bool) {
+	if strings.HasPrefix(name, "@") {
+		switch name {
+		case "@source":
+			return m.Source, true
+		case "@topic":
+			return m.Topic, true
+		case "@partition":
+			return m.Partition, true
+		case "@offset":
+			return m.Offset, true
+		case "@key":
+			return string(m.Key), true
+		case "@timestamp":
+			return m.Timestamp, true
+		case "@value":
+			return string(m.Value), true
+		}
+		return nil, false
+	}
+	var cur interface{} = fields
+	for _, part := range strings.Split(name, ".") {
+		obj, ok := cur.(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+		if cur, ok = obj[part]; !ok {
+			return nil, false
+		}
+	}
+	return cur, true
+}
+
+// LookupString 同Lookup,值会被转换为字符串,对象和数组转换为JSON
+func (m *Message) LookupString(name string) (string, bool) {
+	v, ok := m.Lookup(name)
+	if !ok {
+		return "", false
+	}
+	return ToString(v), true
+}
+
+// ToString 把字段的值转换为字符串
+func ToString(v interface{}) string {
+	switch val := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return val
+	case float64:
+		return strconv.FormatFloat(val, 'f', -1, 64)
+	case bool:
+		return strconv.FormatBool(val)
+	case time.Time:
+		return val.Format(time.RFC3339Nano)
+	case map[string]interface{}, []interface{}:
+		b, _ := json.Marshal(val)
+		return string(b)
+	default:
+		return fmt.Sprint(val)
+	}
+}
+
+// Values 所有日志的内容
+func Values(msgs []*Message) [][]byte {
+	values := make([][]byte, len(msgs))
+	for i, m := range msgs {
+		values[i] = m.Value
+	}
+	return values
+}
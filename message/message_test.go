@@ -0,0 +1,83 @@
+package message
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestMessage_Lookup(t *testing.T) {
+	m := &Message{
+		Value:     []byte(`{"level":"error","code":500,"kubernetes":{"namespace":"prod"}}`),
+		Topic:     "applog",
+		Partition: 3,
+		Key:       []byte("k1"),
+	}
+	tests := []struct {
+		name   string
+		want   string
+		wantOK bool
+	}{
+		{"level", "error", true},
+		{"code", "500", true},
+		{"kubernetes.namespace", "prod", true},
+		{"kubernetes", `{"namespace":"prod"}`, true},
+		{"@topic", "applog", true},
+		{"@partition", "3", true},
+		{"@key", "k1", true},
+		{"@value", `{"level":"error","code":500,"kubernetes":{"namespace":"prod"}}`, true},
+		{"missing", "", false},
+		{"level.sub", "", false},
+		{"@unknown", "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := m.LookupString(tt.name)
+			if ok != tt.wantOK || got != tt.want {
+				t.Errorf("LookupString(%q) = %q, %v, want %q, %v", tt.name, got, ok, tt.want, tt.wantOK)
+			}
+		})
+	}
+	if New([]byte("plain text")).Fields() != nil {
+		t.Error("expected nil fields for non-JSON value")
+	}
+}
+
+func TestDecodeFields(t *testing.T) {
+	m := New([]byte(`{"trace":{"id":9007199254740993}}`))
+	if v, ok := m.LookupIn(DecodeFields(m.Value), "trace.id"); !ok || ToString(v) != "9007199254740993" {
+		t.Errorf("LookupIn() = %v, %v", v, ok)
+	}
+	if DecodeFields([]byte(`{"a":1} {"b":2}`)) != nil || DecodeFields([]byte("plain text")) != nil {
+		t.Error("expected nil fields for a value that is not a single JSON object")
+	}
+}
+
+func TestMarshal(t *testing.T) {
+	m := &Message{
+		Value:     []byte("hello"),
+		Source:    "kafka-a",
+		Topic:     "applog",
+		Partition: 7,
+		Offset:    12345,
+		Key:       []byte("key"),
+		Timestamp: time.Unix(1700000000, 123),
+	}
+	got, err := Unmarshal(Marshal(m))
+	if err != nil {
+		t.Fatalf("Unmarshal() error = %v", err)
+	}
+	if got.Source != m.Source || got.Topic != m.Topic || got.Partition != m.Partition || got.Offset != m.Offset ||
+		!reflect.DeepEqual(got.Key, m.Key) || !got.Timestamp.Equal(m.Timestamp) || string(got.Value) != "hello" {
+		t.Errorf("Unmarshal() = %+v, want %+v", got, m)
+	}
+
+	//旧版本磁盘队列中只有日志内容
+	old, err := Unmarshal([]byte("raw log"))
+	if err != nil || string(old.Value) != "raw log" {
+		t.Errorf("Unmarshal(raw) = %+v, %v", old, err)
+	}
+	if _, err := Unmarshal(Marshal(m)[:6]); err == nil {
+		t.Error("expected error for truncated data")
+	}
+}
@@ -0,0 +1,182 @@
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"math"
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// 指标的类型,同Prometheus的TYPE
+const (
+	Counter   = "counter"
+	Gauge     = "gauge"
+	Histogram = "histogram"
+)
+
+var (
+	nameRe    = regexp.MustCompile(`^[a-zA-Z_:][a-zA-Z0-9_:]*$`)
+	invalidRe = regexp.MustCompile(`[^a-zA-Z0-9_]`)
+)
+
+// Label 时间序列的一个label
+type Label struct {
+	Name  string
+	Value string
+}
+
+// Sample 一个时间序列的值,Suffix为名称的后缀,例如直方图的_bucket、_sum、_count
+type Sample struct {
+	Suffix string
+	Labels []Label
+	Value  float64
+}
+
+// Family 同一个名称的一组时间序列
+type Family struct {
+	Name    string
+	Help    string
+	Type    string
+	Samples []Sample
+}
+
+// Source 提供指标的组件,例如aggregate processor,每次抓取时调用
+type Source interface {
+	Metrics() []Family
+}
+
+// Registry 汇总所有Source的指标,以Prometheus的文本格式输出
+type Registry struct {
+	mutex   sync.RWMutex
+	sources map[string]Source
+}
+
+func NewRegistry() *Registry {
+	return &Registry{sources: make(map[string]Source)}
+}
+
+// Register 注册名为name的Source,同名的Source会被替换
+func (r *Registry) Register(name string, s Source) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.sources[name] = s
+}
+
+// Unregister 移除名为name的Source
+func (r *Registry) Unregister(name string) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	delete(r.sources, name)
+}
+
+// Gather 所有Source的指标,同名的Family会被合并,按名称排序
+func (r *Registry) Gather() []Family {
+	r.mutex.RLock()
+	names := make([]string, 0, len(r.sources))
+	for name := range r.sources {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	sources := make([]Source, len(names))
+	for i, name := range names {
+		sources[i] = r.sources[name]
+	}
+	r.mutex.RUnlock()
+
+	byName := make(map[string]*Family)
+	var order []string
+	for _, s := range sources {
+		for _, f := range s.Metrics() {
+			if existing, ok := byName[f.Name]; ok {
+				existing.Samples = append(existing.Samples, f.Samples...)
+				continue
+			}
+			f := f
+			byName[f.Name] = &f
+			order = append(order, f.Name)
+		}
+	}
+	sort.Strings(order)
+	families := make([]Family, len(order))
+	for i, name := range order {
+		families[i] = *byName[name]
+	}
+	return families
+}
+
+// ServeHTTP 以Prometheus的文本格式输出所有的指标
+func (r *Registry) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	bw := bufio.NewWriter(w)
+	WriteText(bw, r.Gather())
+	bw.Flush()
+}
+
+// WriteText 把指标写为Prometheus的文本格式
+func WriteText(w *bufio.Writer, families []Family) {
+	for _, f := range families {
+		if f.Help != "" {
+			fmt.Fprintf(w, "# HELP %s %s\n", f.Name, escapeHelp(f.Help))
+		}
+		if f.Type != "" {
+			fmt.Fprintf(w, "# TYPE %s %s\n", f.Name, f.Type)
+		}
+		for _, s := range f.Samples {
+			w.WriteString(f.Name)
+			w.WriteString(s.Suffix)
+			if len(s.Labels) > 0 {
+				w.WriteByte('{')
+				for i, l := range s.Labels {
+					if i > 0 {
+						w.WriteByte(',')
+					}
+					fmt.Fprintf(w, "%s=\"%s\"", l.Name, escapeLabel(l.Value))
+				}
+				w.WriteByte('}')
+			}
+			w.WriteByte(' ')
+			w.WriteString(FormatValue(s.Value))
+			w.WriteByte('\n')
+		}
+	}
+}
+
+// FormatValue 格式化指标的值,无穷大为+Inf/-Inf
+func FormatValue(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+// ValidName 是否是合法的指标名称
+func ValidName(name string) bool {
+	return nameRe.MatchString(name)
+}
+
+// LabelName 把字段名称转换为合法的label名称,例如 http.status -> http_status
+func LabelName(field string) string {
+	name := invalidRe.ReplaceAllString(strings.TrimPrefix(field, "@"), "_")
+	if name == "" || (name[0] >= '0' && name[0] <= '9') {
+		name = "_" + name
+	}
+	return name
+}
+
+func escapeHelp(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "\n", `\n`).Replace(s)
+}
+
+func escapeLabel(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`).Replace(s)
+}
@@ -0,0 +1,63 @@
+package metrics
+
+import (
+	"math"
+	"net/http/httptest"
+	"testing"
+)
+
+type staticSource []Family
+
+func (s staticSource) Metrics() []Family {
+	return s
+}
+
+func TestRegistry_ServeHTTP(t *testing.T) {
+	r := NewRegistry()
+	r.Register("b", staticSource{{
+		Name: "records_total", Help: "Number of\nrecords", Type: Counter,
+		Samples: []Sample{{Labels: []Label{{Name: "service", Value: `a"b`}}, Value: 3}},
+	}})
+	r.Register("a", staticSource{
+		{Name: "records_total", Type: Counter, Samples: []Sample{{Labels: []Label{{Name: "service", Value: "c"}}, Value: 1}}},
+		{Name: "latency", Type: Histogram, Samples: []Sample{
+			{Suffix: "_bucket", Labels: []Label{{Name: "le", Value: "+Inf"}}, Value: 2},
+			{Suffix: "_sum", Value: 0.5},
+			{Suffix: "_count", Value: 2},
+		}},
+	})
+	r.Register("removed", staticSource{{Name: "gone", Samples: []Sample{{Value: 1}}}})
+	r.Unregister("removed")
+
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	want := `# TYPE latency histogram
+latency_bucket{le="+Inf"} 2
+latency_sum 0.5
+latency_count 2
+# TYPE records_total counter
+records_total{service="c"} 1
+records_total{service="a\"b"} 3
+`
+	if got := rec.Body.String(); got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestFormatValue(t *testing.T) {
+	cases := map[float64]string{1: "1", 0.25: "0.25", 1e21: "1e+21", math.Inf(1): "+Inf"}
+	for v, want := range cases {
+		if got := FormatValue(v); got != want {
+			t.Errorf("FormatValue(%v) = %q, want %q", v, got, want)
+		}
+	}
+}
+
+func TestLabelName(t *testing.T) {
+	cases := map[string]string{"service": "service", "http.status": "http_status", "@topic": "topic", "1x": "_1x"}
+	for field, want := range cases {
+		if got := LabelName(field); got != want {
+			t.Errorf("LabelName(%q) = %q, want %q", field, got, want)
+		}
+	}
+}
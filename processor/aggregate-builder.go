@@ -0,0 +1,215 @@
+package processor
+
+import (
+	"fmt"
+	"log-collector/config"
+	"log-collector/filter"
+	"log-collector/metrics"
+	"sort"
+	"time"
+)
+
+// 聚合的指标类型
+const (
+	MetricCounter   = "counter"   //计数,配置了field时累加field的值
+	MetricHistogram = "histogram" //field的分布:条数、总和、最小、最大、分位数以及直方图的桶
+)
+
+var (
+	defaultBuckets   = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+	defaultQuantiles = []float64{0.5, 0.9, 0.99}
+)
+
+// AggregateConfig 配置文件中aggregate processor的配置
+type AggregateConfig struct {
+	Window    time.Duration     `yaml:"window"`    //滚动窗口的长度,默认1m
+	Filter    string            `yaml:"filter"`    //只统计满足过滤表达式的日志,为空时统计所有日志
+	GroupBy   []string          `yaml:"groupBy"`   //分组的字段,例如[service, level]
+	Metrics   []AggregateMetric `yaml:"metrics"`   //统计的指标,默认为一个名为log_records_total的计数
+	MaxGroups int               `yaml:"maxGroups"` //分组数量的上限,超过后新的分组合并到值为__overflow__的分组,默认10000
+	EmitTo    string            `yaml:"emitTo"`    //每个窗口结束时把汇总的日志发送给这个writer,为空时不发送
+}
+
+// AggregateMetric 一个统计的指标
+type AggregateMetric struct {
+	Name      string    `yaml:"name"`      //指标的名称,同时是汇总日志中的字段名
+	Type      string    `yaml:"type"`      //counter|histogram,默认counter
+	Field     string    `yaml:"field"`     //统计的字段,值需要是数字;counter不配置时统计条数
+	Help      string    `yaml:"help"`      //指标的说明
+	Buckets   []float64 `yaml:"buckets"`   //histogram的桶的上限
+	Quantiles []float64 `yaml:"quantiles"` //histogram汇总时计算的分位数,默认[0.5, 0.9, 0.99]
+}
+
+func init() {
+	Register("aggregate", newAggregateBuilder)
+}
+
+// newAggregateBuilder 解析并检查aggregate processor的配置
+func newAggregateBuilder(options map[string]interface{}) (Builder, error) {
+	var conf AggregateConfig
+	if err := config.Decode(options, &conf); err != nil {
+		return nil, err
+	}
+	var errs config.ValidationErrors
+	if conf.Window < 0 {
+		errs.Add("window", "must not be negative")
+	}
+	var f *filter.Filter
+	if conf.Filter != "" {
+		var err error
+		if f, err = filter.Parse(conf.Filter); err != nil {
+			errs.Add("filter", "%v", err)
+		}
+	}
+	for i, field := range conf.GroupBy {
+		if field == "" {
+			errs.Add(fmt.Sprintf("groupBy[%d]", i), "field must not be empty")
+		}
+	}
+	if conf.MaxGroups < 0 {
+		errs.Add("maxGroups", "must not be negative")
+	}
+	names := make(map[string]bool)
+	for i, m := range conf.Metrics {
+		path := fmt.Sprintf("metrics[%d]", i)
+		if !metrics.ValidName(m.Name) {
+			errs.Add(path+".name", "%q is not a valid metric name", m.Name)
+		} else if names[m.Name] {
+			errs.Add(path+".name", "duplicate metric name %q", m.Name)
+		}
+		names[m.Name] = true
+		switch m.Type {
+		case "", MetricCounter:
+		case MetricHistogram:
+			if m.Field == "" {
+				errs.Add(path+".field", "field is required for histogram")
+			}
+		default:
+			errs.Add(path+".type", "unknown type %q, expected counter or histogram", m.Type)
+		}
+		if !sort.Float64sAreSorted(m.Buckets) {
+			errs.Add(path+".buckets", "buckets must be in increasing order")
+		}
+		for j, q := range m.Quantiles {
+			if q <= 0 || q > 1 {
+				errs.Add(fmt.Sprintf("%s.quantiles[%d]", path, j), "quantile must be in (0, 1]")
+			}
+		}
+	}
+	if len(errs) > 0 {
+		return nil, errs
+	}
+	b := NewAggregateBuilder(conf.Window, conf.GroupBy...).
+		WithFilter(f).
+		WithMaxGroups(conf.MaxGroups).
+		WithEmitTo(conf.EmitTo)
+	for _, m := range conf.Metrics {
+		b.WithMetric(m)
+	}
+	return b, nil
+}
+
+type AggregateBuilder struct {
+	Window    time.Duration
+	GroupBy   []string
+	Filter    *filter.Filter
+	Metrics   []AggregateMetric
+	MaxGroups int
+	EmitTo    string
+}
+
+// NewAggregateBuilder 按groupBy字段分组,每个window统计一次,window小于等于0时为1m
+func NewAggregateBuilder(window time.Duration, groupBy ...string) *AggregateBuilder {
+	return &AggregateBuilder{Window: window, GroupBy: groupBy}
+}
+
+// WithFilter 只统计满足f的日志,f为nil时统计所有日志
+func (a *AggregateBuilder) WithFilter(f *filter.Filter) *AggregateBuilder {
+	a.Filter = f
+	return a
+}
+
+// WithMetric 添加一个统计的指标,没有添加时为一个名为log_records_total的计数
+func (a *AggregateBuilder) WithMetric(m AggregateMetric) *AggregateBuilder {
+	a.Metrics = append(a.Metrics, m)
+	return a
+}
+
+// WithMaxGroups 设置分组数量的上限,小于等于0时为10000
+func (a *AggregateBuilder) WithMaxGroups(n int) *AggregateBuilder {
+	a.MaxGroups = n
+	return a
+}
+
+// WithEmitTo 每个窗口结束时把汇总的日志发送给名为writer的writer,为空时不发送
+func (a *AggregateBuilder) WithEmitTo(writer string) *AggregateBuilder {
+	a.EmitTo = writer
+	return a
+}
+
+func (a *AggregateBuilder) Outputs() map[string]string {
+	if a.EmitTo == "" {
+		return nil
+	}
+	return map[string]string{"emitTo": a.EmitTo}
+}
+
+func (a *AggregateBuilder) Build(name string, emit Emitter) (Processor, error) {
+	window := a.Window
+	if window <= 0 {
+		window = time.Minute
+	}
+	maxGroups := a.MaxGroups
+	if maxGroups <= 0 {
+		maxGroups = 10000
+	}
+	specs := a.Metrics
+	if len(specs) == 0 {
+		specs = []AggregateMetric{{Name: "log_records_total", Help: "Number of log records"}}
+	}
+	specs = append([]AggregateMetric(nil), specs...)
+	for i := range specs {
+		m := &specs[i]
+		if !metrics.ValidName(m.Name) {
+			return nil, fmt.Errorf("invalid metric name: %q", m.Name)
+		}
+		switch m.Type {
+		case "":
+			m.Type = MetricCounter
+		case MetricCounter:
+		case MetricHistogram:
+			if m.Field == "" {
+				return nil, fmt.Errorf("metric %s: field is required for histogram", m.Name)
+			}
+			if len(m.Buckets) == 0 {
+				m.Buckets = defaultBuckets
+			}
+			if len(m.Quantiles) == 0 {
+				m.Quantiles = defaultQuantiles
+			}
+		default:
+			return nil, fmt.Errorf("metric %s: unknown type %q", m.Name, m.Type)
+		}
+	}
+	labels := make([]string, len(a.GroupBy))
+	for i, field := range a.GroupBy {
+		labels[i] = metrics.LabelName(field)
+	}
+	p := &Aggregator{
+		name:      name,
+		window:    window,
+		groupBy:   a.GroupBy,
+		labels:    labels,
+		filter:    a.Filter,
+		specs:     specs,
+		maxGroups: maxGroups,
+		emitTo:    a.EmitTo,
+		emit:      emit,
+		groups:    make(map[string]*aggGroup),
+		stop:      make(chan struct{}),
+		done:      make(chan struct{}),
+	}
+	p.start = time.Now()
+	go p.run()
+	return p, nil
+}
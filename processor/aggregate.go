@@ -0,0 +1,342 @@
+package processor
+
+import (
+	"encoding/json"
+	"log-collector/filter"
+	"log-collector/message"
+	"log-collector/metrics"
+	"math"
+	"math/rand"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	overflowGroup = "__overflow__"
+	reservoirSize = 1024 //每个分组每个窗口最多保留的样本数,用于计算分位数
+)
+
+// Aggregator 把日志统计为指标,按字段分组,每个滚动窗口汇总一次
+// 累计的值通过Metrics暴露给metrics接口(Prometheus格式),配置了emitTo时每个窗口结束后发送汇总的日志
+// 日志本身不受影响,会继续分发给writer
+type Aggregator struct {
+	name      string
+	window    time.Duration
+	groupBy   []string
+	labels    []string //groupBy对应的label名称
+	filter    *filter.Filter
+	specs     []AggregateMetric
+	maxGroups int
+	emitTo    string
+	emit      Emitter
+
+	mutex  sync.Mutex
+	groups map[string]*aggGroup
+	start  time.Time //当前窗口的开始时间
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+// aggGroup 一个分组的统计
+type aggGroup struct {
+	values  []string //groupBy字段的值
+	count   int64    //当前窗口的条数
+	metrics []aggValue
+}
+
+// aggValue 一个指标在一个分组中的值
+type aggValue struct {
+	//累计的值,暴露给metrics接口
+	total   float64  //counter的值,histogram的总和
+	n       uint64   //histogram的条数
+	buckets []uint64 //histogram每个桶的条数(不累加)
+
+	//当前窗口的值
+	window    float64 //counter的值,histogram的总和
+	windowN   int64
+	min, max  float64
+	samples   []float64
+	quantiles []float64 //上一个窗口的分位数,暴露给metrics接口
+}
+
+func (p *Aggregator) Process(msg *message.Message) bool {
+	if !p.filter.Match(msg) {
+		return true
+	}
+	values := make([]string, len(p.groupBy))
+	for i, field := range p.groupBy {
+		values[i], _ = msg.LookupString(field)
+	}
+	key := strings.Join(values, "\x00")
+
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	g, ok := p.groups[key]
+	if !ok {
+		if len(p.groups) >= p.maxGroups {
+			for i := range values {
+				values[i] = overflowGroup
+			}
+			key = strings.Join(values, "\x00")
+			g = p.groups[key]
+		}
+		if g == nil {
+			g = &aggGroup{values: values, metrics: make([]aggValue, len(p.specs))}
+			for i, spec := range p.specs {
+				if spec.Type == MetricHistogram {
+					g.metrics[i].buckets = make([]uint64, len(spec.Buckets))
+				}
+			}
+			p.groups[key] = g
+		}
+	}
+	g.count++
+	for i, spec := range p.specs {
+		v := &g.metrics[i]
+		if spec.Field == "" {
+			v.total++
+			v.window++
+			continue
+		}
+		raw, ok := msg.Lookup(spec.Field)
+		if !ok {
+			continue
+		}
+		f, ok := toFloat(raw)
+		if !ok {
+			continue
+		}
+		if spec.Type == MetricCounter {
+			v.total += f
+			v.window += f
+			continue
+		}
+		v.observe(spec, f)
+	}
+	return true
+}
+
+// observe histogram记录一个值
+func (v *aggValue) observe(spec AggregateMetric, f float64) {
+	v.total += f
+	v.n++
+	if i := sort.SearchFloat64s(spec.Buckets, f); i < len(spec.Buckets) {
+		v.buckets[i]++
+	}
+	if v.windowN == 0 || f < v.min {
+		v.min = f
+	}
+	if v.windowN == 0 || f > v.max {
+		v.max = f
+	}
+	v.window += f
+	v.windowN++
+	//蓄水池抽样,样本数量有上限
+	if len(v.samples) < reservoirSize {
+		v.samples = append(v.samples, f)
+	} else if j := rand.Int63n(v.windowN); j < reservoirSize {
+		v.samples[j] = f
+	}
+}
+
+// run 每个窗口结束时汇总一次,窗口和时钟对齐(例如window为1m时在每分钟的0秒)
+func (p *Aggregator) run() {
+	defer close(p.done)
+	for {
+		now := time.Now()
+		timer := time.NewTimer(now.Truncate(p.window).Add(p.window).Sub(now))
+		select {
+		case end := <-timer.C:
+			p.flush(end)
+		case <-p.stop:
+			timer.Stop()
+			return
+		}
+	}
+}
+
+// flush 汇总当前窗口并开始新的窗口
+func (p *Aggregator) flush(end time.Time) {
+	p.mutex.Lock()
+	start := p.start
+	p.start = end
+	var records []*message.Message
+	for _, g := range p.groups {
+		if g.count > 0 && p.emitTo != "" {
+			records = append(records, p.summary(g, start, end))
+		}
+		g.count = 0
+		for i, spec := range p.specs {
+			v := &g.metrics[i]
+			v.quantiles = nil
+			if spec.Type == MetricHistogram && len(v.samples) > 0 {
+				v.quantiles = quantiles(v.samples, spec.Quantiles)
+			}
+			v.window, v.windowN, v.samples = 0, 0, v.samples[:0]
+		}
+	}
+	p.mutex.Unlock()
+
+	//在锁外面发送,Emit可能会阻塞
+	sort.Slice(records, func(i, j int) bool { return string(records[i].Value) < string(records[j].Value) })
+	for _, r := range records {
+		p.emit.Emit(p.emitTo, r)
+	}
+}
+
+// summary 一个分组在一个窗口中的汇总,例如:
+//
+//	{"time":"...","processor":"errors","windowStart":"...","window":"1m0s","service":"api","count":12,"latency":{"count":12,"sum":3.1,...}}
+func (p *Aggregator) summary(g *aggGroup, start, end time.Time) *message.Message {
+	record := map[string]interface{}{
+		"time":        end.Format(time.RFC3339Nano),
+		"windowStart": start.Format(time.RFC3339Nano),
+		"window":      p.window.String(),
+		"processor":   p.name,
+		"count":       g.count,
+	}
+	for i, field := range p.groupBy {
+		record[field] = g.values[i]
+	}
+	for i, spec := range p.specs {
+		v := &g.metrics[i]
+		if spec.Type == MetricCounter {
+			record[spec.Name] = v.window
+			continue
+		}
+		h := map[string]interface{}{"count": v.windowN}
+		if v.windowN > 0 {
+			h["sum"] = v.window
+			h["min"] = v.min
+			h["max"] = v.max
+			h["avg"] = v.window / float64(v.windowN)
+			for j, q := range quantiles(v.samples, spec.Quantiles) {
+				h[quantileKey(spec.Quantiles[j])] = q
+			}
+		}
+		record[spec.Name] = h
+	}
+	value, _ := json.Marshal(record)
+	return &message.Message{Value: value, Source: p.name, Timestamp: end}
+}
+
+// Metrics 每个指标的累计值,histogram还有上一个窗口的分位数(<name>_quantile)
+func (p *Aggregator) Metrics() []metrics.Family {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	keys := make([]string, 0, len(p.groups))
+	for key := range p.groups {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var families []metrics.Family
+	for i, spec := range p.specs {
+		f := metrics.Family{Name: spec.Name, Help: spec.Help, Type: metrics.Counter}
+		if spec.Type == MetricHistogram {
+			f.Type = metrics.Histogram
+		}
+		qf := metrics.Family{
+			Name: spec.Name + "_quantile",
+			Help: "Quantiles of " + spec.Name + " in the last window",
+			Type: metrics.Gauge,
+		}
+		for _, key := range keys {
+			g := p.groups[key]
+			labels := p.groupLabels(g)
+			v := &g.metrics[i]
+			if spec.Type == MetricCounter {
+				f.Samples = append(f.Samples, metrics.Sample{Labels: labels, Value: v.total})
+				continue
+			}
+			var cumulative uint64
+			for j, le := range spec.Buckets {
+				cumulative += v.buckets[j]
+				f.Samples = append(f.Samples, metrics.Sample{
+					Suffix: "_bucket",
+					Labels: withLabel(labels, "le", metrics.FormatValue(le)),
+					Value:  float64(cumulative),
+				})
+			}
+			f.Samples = append(f.Samples,
+				metrics.Sample{Suffix: "_bucket", Labels: withLabel(labels, "le", "+Inf"), Value: float64(v.n)},
+				metrics.Sample{Suffix: "_sum", Labels: labels, Value: v.total},
+				metrics.Sample{Suffix: "_count", Labels: labels, Value: float64(v.n)},
+			)
+			for j, q := range v.quantiles {
+				qf.Samples = append(qf.Samples, metrics.Sample{
+					Labels: withLabel(labels, "quantile", metrics.FormatValue(spec.Quantiles[j])),
+					Value:  q,
+				})
+			}
+		}
+		families = append(families, f)
+		if spec.Type == MetricHistogram {
+			families = append(families, qf)
+		}
+	}
+	return families
+}
+
+// groupLabels 分组的label,包括processor的名称
+func (p *Aggregator) groupLabels(g *aggGroup) []metrics.Label {
+	labels := make([]metrics.Label, 0, len(p.labels)+1)
+	labels = append(labels, metrics.Label{Name: "processor", Value: p.name})
+	for i, name := range p.labels {
+		labels = append(labels, metrics.Label{Name: name, Value: g.values[i]})
+	}
+	return labels
+}
+
+// Close 停止定时汇总,把当前窗口汇总后发送
+func (p *Aggregator) Close() error {
+	close(p.stop)
+	<-p.done
+	p.flush(time.Now())
+	return nil
+}
+
+func withLabel(labels []metrics.Label, name, value string) []metrics.Label {
+	out := make([]metrics.Label, len(labels), len(labels)+1)
+	copy(out, labels)
+	return append(out, metrics.Label{Name: name, Value: value})
+}
+
+// quantiles 用nearest-rank方法计算分位数
+func quantiles(samples []float64, qs []float64) []float64 {
+	if len(samples) == 0 {
+		return nil
+	}
+	sorted := append([]float64(nil), samples...)
+	sort.Float64s(sorted)
+	out := make([]float64, len(qs))
+	for i, q := range qs {
+		rank := int(math.Ceil(q*float64(len(sorted)))) - 1
+		out[i] = sorted[max(rank, 0)]
+	}
+	return out
+}
+
+// quantileKey 汇总日志中分位数的字段名,例如0.99 -> p99,0.999 -> p99.9
+func quantileKey(q float64) string {
+	return "p" + strconv.FormatFloat(math.Round(q*1e8)/1e6, 'f', -1, 64)
+}
+
+// toFloat 数字或者数字的字符串转换为float64
+func toFloat(v interface{}) (float64, bool) {
+	switch val := v.(type) {
+	case float64:
+		return val, true
+	case string:
+		f, err := strconv.ParseFloat(strings.TrimSpace(val), 64)
+		return f, err == nil
+	case bool, nil:
+		return 0, false
+	}
+	f, err := strconv.ParseFloat(message.ToString(v), 64)
+	return f, err == nil
+}
@@ -0,0 +1,179 @@
+package processor
+
+import (
+	"bufio"
+	"encoding/json"
+	"log-collector/config"
+	"log-collector/message"
+	"log-collector/metrics"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// emitRecorder 记录processor发送的日志
+type emitRecorder struct {
+	mutex sync.Mutex
+	to    []string
+	msgs  []*message.Message
+}
+
+func (e *emitRecorder) Emit(to string, msg *message.Message) {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	e.to = append(e.to, to)
+	e.msgs = append(e.msgs, msg)
+}
+
+func buildAggregate(t *testing.T, options map[string]interface{}, emit Emitter) *Aggregator {
+	t.Helper()
+	b, err := NewBuilder("aggregate", options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p, err := b.Build("agg", emit)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { p.Close() })
+	return p.(*Aggregator)
+}
+
+func metricsText(s metrics.Source) string {
+	var sb strings.Builder
+	w := bufio.NewWriter(&sb)
+	metrics.WriteText(w, s.Metrics())
+	w.Flush()
+	return sb.String()
+}
+
+func TestAggregator(t *testing.T) {
+	emit := &emitRecorder{}
+	p := buildAggregate(t, map[string]interface{}{
+		"window":  "1h",
+		"filter":  `level != "debug"`,
+		"groupBy": []interface{}{"service"},
+		"emitTo":  "summary",
+		"metrics": []interface{}{
+			map[string]interface{}{"name": "records_total"},
+			map[string]interface{}{"name": "bytes_total", "field": "bytes"},
+			map[string]interface{}{"name": "latency_seconds", "type": "histogram", "field": "latency", "buckets": []interface{}{0.1, 1}},
+		},
+	}, emit)
+
+	for _, line := range []string{
+		`{"service":"api","level":"info","bytes":100,"latency":0.05}`,
+		`{"service":"api","level":"error","bytes":"50","latency":0.5}`,
+		`{"service":"api","level":"debug","bytes":1000,"latency":9}`,
+		`{"service":"web","level":"info","latency":2}`,
+	} {
+		if !p.Process(message.New([]byte(line))) {
+			t.Fatal("aggregate must not drop records")
+		}
+	}
+
+	got := metricsText(p)
+	for _, want := range []string{
+		`records_total{processor="agg",service="api"} 2`,
+		`records_total{processor="agg",service="web"} 1`,
+		`bytes_total{processor="agg",service="api"} 150`,
+		`latency_seconds_bucket{processor="agg",service="api",le="0.1"} 1`,
+		`latency_seconds_bucket{processor="agg",service="api",le="1"} 2`,
+		`latency_seconds_bucket{processor="agg",service="web",le="+Inf"} 1`,
+		`latency_seconds_sum{processor="agg",service="api"} 0.55`,
+		`latency_seconds_count{processor="agg",service="web"} 1`,
+	} {
+		if !strings.Contains(got, want+"\n") {
+			t.Errorf("metrics missing %q:\n%s", want, got)
+		}
+	}
+
+	start := p.start
+	p.flush(start.Add(time.Hour))
+	if len(emit.msgs) != 2 {
+		t.Fatalf("expected 2 summary records, got %d", len(emit.msgs))
+	}
+	if emit.to[0] != "summary" {
+		t.Errorf("emitted to %q, want summary", emit.to[0])
+	}
+	var record struct {
+		Service string             `json:"service"`
+		Count   int                `json:"count"`
+		Bytes   float64            `json:"bytes_total"`
+		Latency map[string]float64 `json:"latency_seconds"`
+		Window  string             `json:"window"`
+	}
+	for _, msg := range emit.msgs {
+		if err := json.Unmarshal(msg.Value, &record); err != nil {
+			t.Fatal(err)
+		}
+		if record.Service == "api" {
+			break
+		}
+	}
+	if record.Service != "api" || record.Count != 2 || record.Bytes != 150 || record.Window != "1h0m0s" {
+		t.Errorf("unexpected summary: %+v", record)
+	}
+	if l := record.Latency; l["count"] != 2 || l["min"] != 0.05 || l["max"] != 0.5 || l["p50"] != 0.05 || l["p99"] != 0.5 {
+		t.Errorf("unexpected latency summary: %v", l)
+	}
+	if q := metricsText(p); !strings.Contains(q, `latency_seconds_quantile{processor="agg",service="api",quantile="0.9"} 0.5`) {
+		t.Errorf("expected quantiles of the last window:\n%s", q)
+	}
+
+	//新的窗口没有日志时不发送汇总,累计的值不变
+	p.flush(start.Add(2 * time.Hour))
+	if len(emit.msgs) != 2 {
+		t.Errorf("expected no summary for an empty window, got %d records", len(emit.msgs))
+	}
+	if !strings.Contains(metricsText(p), `records_total{processor="agg",service="api"} 2`) {
+		t.Error("expected counters to be cumulative")
+	}
+}
+
+func TestAggregator_MaxGroups(t *testing.T) {
+	p := buildAggregate(t, map[string]interface{}{
+		"window":    "1h",
+		"groupBy":   []interface{}{"user"},
+		"maxGroups": 2,
+	}, &emitRecorder{})
+	for _, user := range []string{"a", "b", "c", "d", "a"} {
+		p.Process(message.New([]byte(`{"user":"` + user + `"}`)))
+	}
+	got := metricsText(p)
+	for _, want := range []string{
+		`log_records_total{processor="agg",user="a"} 2`,
+		`log_records_total{processor="agg",user="b"} 1`,
+		`log_records_total{processor="agg",user="__overflow__"} 2`,
+	} {
+		if !strings.Contains(got, want+"\n") {
+			t.Errorf("metrics missing %q:\n%s", want, got)
+		}
+	}
+}
+
+func TestNewAggregateBuilder_Invalid(t *testing.T) {
+	_, err := NewBuilder("aggregate", map[string]interface{}{
+		"window": "-1s",
+		"filter": "level ==",
+		"metrics": []interface{}{
+			map[string]interface{}{"name": "bad-name"},
+			map[string]interface{}{"name": "latency", "type": "histogram"},
+			map[string]interface{}{"name": "x", "type": "gauge", "quantiles": []interface{}{1.5}},
+		},
+	})
+	verrs, ok := err.(config.ValidationErrors)
+	if !ok {
+		t.Fatalf("expected ValidationErrors, got %v", err)
+	}
+	want := []string{"window", "filter", "metrics[0].name", "metrics[1].field", "metrics[2].type", "metrics[2].quantiles[0]"}
+	if len(verrs) != len(want) {
+		t.Fatalf("got %v, want paths %v", verrs, want)
+	}
+	for i, e := range verrs {
+		if e.Path != want[i] {
+			t.Errorf("problem %d path = %q, want %q", i, e.Path, want[i])
+		}
+	}
+}
@@ -0,0 +1,183 @@
+package processor
+
+import (
+	"fmt"
+	"log-collector/config"
+	"log-collector/filter"
+	"log-collector/writer"
+	"time"
+)
+
+// AlertConfig 配置文件中alert processor的配置
+type AlertConfig struct {
+	Rules     []AlertRule            `yaml:"rules"`
+	EmitTo    string                 `yaml:"emitTo"`    //告警发送给这个writer(一般是dedicated的writer)
+	Webhook   map[string]interface{} `yaml:"webhook"`   //告警发送给这个webhook,配置同webhook writer,format默认为raw(每个告警一个请求)
+	MaxGroups int                    `yaml:"maxGroups"` //每个规则分组数量的上限,超过后新的分组合并到值为__overflow__的分组,默认10000
+}
+
+// AlertRule 一条告警规则:window内满足match的日志达到threshold条时告警
+type AlertRule struct {
+	Name      string            `yaml:"name"`      //规则的名称,同一个processor中不能重复
+	Match     string            `yaml:"match"`     //过滤表达式,例如 level == "error" && service == "payment"
+	Threshold int               `yaml:"threshold"` //告警的条数,默认1(每条满足的日志都告警)
+	Window    time.Duration     `yaml:"window"`    //统计的滑动窗口,默认1m
+	Cooldown  time.Duration     `yaml:"cooldown"`  //告警后这段时间内不再重复告警,默认同window
+	GroupBy   []string          `yaml:"groupBy"`   //分组的字段,每个分组单独统计和告警
+	Labels    map[string]string `yaml:"labels"`    //附加到告警中的信息,例如severity
+}
+
+func init() {
+	Register("alert", newAlertBuilder)
+}
+
+// newAlertBuilder 解析并检查alert processor的配置
+func newAlertBuilder(options map[string]interface{}) (Builder, error) {
+	var conf AlertConfig
+	if err := config.Decode(options, &conf); err != nil {
+		return nil, err
+	}
+	var errs config.ValidationErrors
+	if len(conf.Rules) == 0 {
+		errs.Add("rules", "at least one rule is required")
+	}
+	names := make(map[string]bool)
+	for i, r := range conf.Rules {
+		path := fmt.Sprintf("rules[%d]", i)
+		if r.Name == "" {
+			errs.Add(path+".name", "name is required")
+		} else if names[r.Name] {
+			errs.Add(path+".name", "duplicate rule name %q", r.Name)
+		}
+		names[r.Name] = true
+		if r.Match == "" {
+			errs.Add(path+".match", "match is required")
+		} else if _, err := filter.Parse(r.Match); err != nil {
+			errs.Add(path+".match", "%v", err)
+		}
+		if r.Threshold < 0 {
+			errs.Add(path+".threshold", "must not be negative")
+		}
+		if r.Window < 0 {
+			errs.Add(path+".window", "must not be negative")
+		}
+		if r.Cooldown < 0 {
+			errs.Add(path+".cooldown", "must not be negative")
+		}
+		for j, field := range r.GroupBy {
+			if field == "" {
+				errs.Add(fmt.Sprintf("%s.groupBy[%d]", path, j), "field must not be empty")
+			}
+		}
+	}
+	if conf.MaxGroups < 0 {
+		errs.Add("maxGroups", "must not be negative")
+	}
+	var webhook writer.Builder
+	if conf.Webhook != nil {
+		var err error
+		if webhook, err = writer.NewBuilder("webhook", conf.Webhook); err != nil {
+			var verrs config.ValidationErrors
+			if e, ok := err.(config.ValidationErrors); ok {
+				verrs = e.WithPrefix("webhook")
+			} else {
+				verrs = config.ValidationErrors{{Path: "webhook", Reason: err.Error()}}
+			}
+			errs = append(errs, verrs...)
+		} else if wb, ok := webhook.(*writer.WebhookWriterBuilder); ok && wb.Format == "" {
+			wb.WithFormat(writer.WebhookRaw)
+		}
+	}
+	if conf.EmitTo == "" && conf.Webhook == nil {
+		errs.Add("emitTo", "either emitTo or webhook is required")
+	}
+	if len(errs) > 0 {
+		return nil, errs
+	}
+	b := NewAlertBuilder(conf.Rules...).
+		WithEmitTo(conf.EmitTo).
+		WithWebhook(webhook).
+		WithMaxGroups(conf.MaxGroups)
+	return b, nil
+}
+
+type AlertBuilder struct {
+	Rules     []AlertRule
+	EmitTo    string
+	Webhook   writer.Builder
+	MaxGroups int
+}
+
+func NewAlertBuilder(rules ...AlertRule) *AlertBuilder {
+	return &AlertBuilder{Rules: rules}
+}
+
+// WithEmitTo 告警发送给名为writer的writer,为空时不发送
+func (a *AlertBuilder) WithEmitTo(writer string) *AlertBuilder {
+	a.EmitTo = writer
+	return a
+}
+
+// WithWebhook 告警发送给b创建的writer(一般是webhook writer),为nil时不发送
+// 这个writer由processor自己管理,在后台发送,不会阻塞日志的分发
+func (a *AlertBuilder) WithWebhook(b writer.Builder) *AlertBuilder {
+	a.Webhook = b
+	return a
+}
+
+// WithMaxGroups 设置每个规则分组数量的上限,小于等于0时为10000
+func (a *AlertBuilder) WithMaxGroups(n int) *AlertBuilder {
+	a.MaxGroups = n
+	return a
+}
+
+func (a *AlertBuilder) Outputs() map[string]string {
+	if a.EmitTo == "" {
+		return nil
+	}
+	return map[string]string{"emitTo": a.EmitTo}
+}
+
+func (a *AlertBuilder) Build(name string, emit Emitter) (Processor, error) {
+	if len(a.Rules) == 0 {
+		return nil, fmt.Errorf("at least one rule is required")
+	}
+	maxGroups := a.MaxGroups
+	if maxGroups <= 0 {
+		maxGroups = 10000
+	}
+	p := &Alerter{
+		name:      name,
+		emitTo:    a.EmitTo,
+		emit:      emit,
+		maxGroups: maxGroups,
+		now:       time.Now,
+	}
+	for _, r := range a.Rules {
+		f, err := filter.Parse(r.Match)
+		if err != nil {
+			return nil, fmt.Errorf("rule %s: %w", r.Name, err)
+		}
+		if r.Threshold <= 0 {
+			r.Threshold = 1
+		}
+		if r.Window <= 0 {
+			r.Window = time.Minute
+		}
+		if r.Cooldown <= 0 {
+			r.Cooldown = r.Window
+		}
+		p.rules = append(p.rules, &alertRule{AlertRule: r, filter: f, groups: make(map[string]*alertGroup)})
+	}
+	if a.Webhook != nil {
+		w, err := a.Webhook.Build()
+		if err != nil {
+			return nil, fmt.Errorf("create webhook failed: %w", err)
+		}
+		p.webhook = w
+		p.queue = make(chan []byte, alertQueueSize)
+		p.done = make(chan struct{})
+		go p.sendLoop()
+	}
+	return p, nil
+}
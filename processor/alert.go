@@ -0,0 +1,213 @@
+package processor
+
+import (
+	"encoding/json"
+	"log-collector/filter"
+	"log-collector/logging"
+	"log-collector/message"
+	"log-collector/metrics"
+	"log-collector/writer"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	alertQueueSize  = 100  //等待发送给webhook的告警数量上限,超过后丢弃
+	alertSampleSize = 1024 //告警中附带的日志内容的长度上限
+)
+
+// Alerter 按规则检查每条日志,滑动窗口内满足条件的日志达到阈值时告警
+// 告警后在cooldown内同一个规则(同一个分组)不会重复告警,期间被抑制的次数会附带在下一次告警中
+// 日志本身不受影响,会继续分发给writer
+type Alerter struct {
+	name      string
+	emitTo    string
+	emit      Emitter
+	maxGroups int
+	now       func() time.Time
+
+	mutex sync.Mutex
+	rules []*alertRule
+
+	webhook writer.Writer
+	queue   chan []byte
+	done    chan struct{}
+}
+
+type alertRule struct {
+	AlertRule
+	filter     *filter.Filter
+	groups     map[string]*alertGroup
+	fired      int64 //累计告警的次数
+	suppressed int64 //累计被抑制的次数
+}
+
+// alertGroup 一个规则的一个分组的状态
+type alertGroup struct {
+	values     []string
+	hits       []time.Time //最近threshold条满足条件的日志的时间,环形
+	next       int         //hits中下一个写入的位置,hits满了之后也是最早的一条
+	last       time.Time   //最后一条满足条件的日志的时间
+	fired      time.Time   //上一次告警的时间
+	suppressed int         //上一次告警之后被抑制的次数
+}
+
+func (p *Alerter) Process(msg *message.Message) bool {
+	var alerts []*message.Message
+	p.mutex.Lock()
+	now := p.now()
+	for _, r := range p.rules {
+		if !r.filter.Match(msg) {
+			continue
+		}
+		g := p.group(r, msg, now)
+		if !g.hit(r.Threshold, r.Window, now) {
+			continue
+		}
+		if !g.fired.IsZero() && now.Sub(g.fired) < r.Cooldown {
+			g.suppressed++
+			r.suppressed++
+			continue
+		}
+		alerts = append(alerts, p.alert(r, g, msg, now))
+		g.fired = now
+		g.suppressed = 0
+		r.fired++
+	}
+	p.mutex.Unlock()
+
+	for _, a := range alerts {
+		p.send(a)
+	}
+	return true
+}
+
+// group 找到日志所在的分组,分组满了时先清理过期的分组,仍然满时使用__overflow__分组
+func (p *Alerter) group(r *alertRule, msg *message.Message, now time.Time) *alertGroup {
+	values := make([]string, len(r.GroupBy))
+	for i, field := range r.GroupBy {
+		values[i], _ = msg.LookupString(field)
+	}
+	key := strings.Join(values, "\x00")
+	if g, ok := r.groups[key]; ok {
+		return g
+	}
+	if len(r.groups) >= p.maxGroups {
+		ttl := max(r.Window, r.Cooldown)
+		for k, g := range r.groups {
+			if now.Sub(g.last) > ttl && now.Sub(g.fired) > ttl {
+				delete(r.groups, k)
+			}
+		}
+	}
+	if len(r.groups) >= p.maxGroups {
+		for i := range values {
+			values[i] = overflowGroup
+		}
+		key = strings.Join(values, "\x00")
+		if g, ok := r.groups[key]; ok {
+			return g
+		}
+	}
+	g := &alertGroup{values: values, hits: make([]time.Time, 0, r.Threshold)}
+	r.groups[key] = g
+	return g
+}
+
+// hit 记录一条满足条件的日志,返回window内是否达到了threshold条,达到时重新开始计数
+func (g *alertGroup) hit(threshold int, window time.Duration, now time.Time) bool {
+	g.last = now
+	if len(g.hits) < threshold {
+		g.hits = append(g.hits, now)
+		if len(g.hits) < threshold {
+			return false
+		}
+	} else {
+		g.hits[g.next] = now
+		g.next = (g.next + 1) % threshold
+	}
+	if now.Sub(g.hits[g.next]) > window {
+		return false
+	}
+	g.hits, g.next = g.hits[:0], 0
+	return true
+}
+
+// alert 告警的内容,例如:
+//
+//	{"time":"...","alert":"payment-errors","processor":"alerts","match":"...","threshold":50,"window":"1m0s","service":"payment","suppressed":0,"labels":{"severity":"critical"},"sample":"..."}
+func (p *Alerter) alert(r *alertRule, g *alertGroup, msg *message.Message, now time.Time) *message.Message {
+	sample := string(msg.Value)
+	if len(sample) > alertSampleSize {
+		sample = sample[:alertSampleSize]
+	}
+	record := map[string]interface{}{
+		"time":       now.Format(time.RFC3339Nano),
+		"alert":      r.Name,
+		"processor":  p.name,
+		"match":      r.Match,
+		"threshold":  r.Threshold,
+		"window":     r.Window.String(),
+		"suppressed": g.suppressed,
+		"sample":     sample,
+	}
+	for i, field := range r.GroupBy {
+		record[field] = g.values[i]
+	}
+	if len(r.Labels) > 0 {
+		record["labels"] = r.Labels
+	}
+	value, _ := json.Marshal(record)
+	return &message.Message{Value: value, Source: p.name, Timestamp: now}
+}
+
+// send 把告警发送给emitTo的writer和webhook,webhook在后台发送,队列满时丢弃
+func (p *Alerter) send(a *message.Message) {
+	logging.Component("processor", "processor", p.name).Info("alert fired", "alert", string(a.Value))
+	if p.emitTo != "" {
+		p.emit.Emit(p.emitTo, a)
+	}
+	if p.queue == nil {
+		return
+	}
+	select {
+	case p.queue <- a.Value:
+	default:
+		logging.Component("processor", "processor", p.name).Warn("webhook queue is full, dropping alert")
+	}
+}
+
+// sendLoop 按顺序把告警发送给webhook
+func (p *Alerter) sendLoop() {
+	defer close(p.done)
+	for value := range p.queue {
+		if err := p.webhook.Write(value); err != nil {
+			logging.Component("processor", "processor", p.name).Error("send alert to webhook failed", "error", err)
+		}
+	}
+}
+
+// Metrics 每个规则累计告警和被抑制的次数
+func (p *Alerter) Metrics() []metrics.Family {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	fired := metrics.Family{Name: "log_alerts_total", Help: "Number of alerts fired", Type: metrics.Counter}
+	suppressed := metrics.Family{Name: "log_alerts_suppressed_total", Help: "Number of alerts suppressed by cooldown", Type: metrics.Counter}
+	for _, r := range p.rules {
+		labels := []metrics.Label{{Name: "processor", Value: p.name}, {Name: "rule", Value: r.Name}}
+		fired.Samples = append(fired.Samples, metrics.Sample{Labels: labels, Value: float64(r.fired)})
+		suppressed.Samples = append(suppressed.Samples, metrics.Sample{Labels: labels, Value: float64(r.suppressed)})
+	}
+	return []metrics.Family{fired, suppressed}
+}
+
+// Close 把队列中的告警发送给webhook后关闭webhook
+func (p *Alerter) Close() error {
+	if p.queue == nil {
+		return nil
+	}
+	close(p.queue)
+	<-p.done
+	return p.webhook.Close()
+}
@@ -0,0 +1,189 @@
+package processor
+
+import (
+	"encoding/json"
+	"io"
+	"log-collector/config"
+	"log-collector/message"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAlerter(t *testing.T) {
+	emit := &emitRecorder{}
+	b, err := NewBuilder("alert", map[string]interface{}{
+		"emitTo": "alerts",
+		"rules": []interface{}{
+			map[string]interface{}{
+				"name":      "payment-errors",
+				"match":     `level == "error" && service == "payment"`,
+				"threshold": 3,
+				"window":    "1m",
+				"cooldown":  "5m",
+				"labels":    map[string]interface{}{"severity": "critical"},
+			},
+			map[string]interface{}{
+				"name":    "panic",
+				"match":   `@value contains "panic:"`,
+				"groupBy": []interface{}{"@source"},
+			},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	p, err := b.Build("alerts", emit)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+	a := p.(*Alerter)
+	now := time.Date(2024, 1, 2, 8, 0, 0, 0, time.UTC)
+	a.now = func() time.Time { return now }
+
+	paymentError := func(after time.Duration) {
+		now = now.Add(after)
+		a.Process(message.New([]byte(`{"level":"error","service":"payment"}`)))
+	}
+	//窗口内不到3条不告警,窗口外的不算
+	paymentError(0)
+	paymentError(50 * time.Second)
+	a.Process(message.New([]byte(`{"level":"error","service":"order"}`)))
+	paymentError(20 * time.Second)
+	if len(emit.msgs) != 0 {
+		t.Fatalf("expected no alert, got %d", len(emit.msgs))
+	}
+	paymentError(time.Second)
+	if len(emit.msgs) != 1 || emit.to[0] != "alerts" {
+		t.Fatalf("expected 1 alert to writer alerts, got %d %v", len(emit.msgs), emit.to)
+	}
+	var alert struct {
+		Alert      string            `json:"alert"`
+		Threshold  int               `json:"threshold"`
+		Suppressed int               `json:"suppressed"`
+		Labels     map[string]string `json:"labels"`
+		Source     string            `json:"@source"`
+	}
+	if err := json.Unmarshal(emit.msgs[0].Value, &alert); err != nil {
+		t.Fatal(err)
+	}
+	if alert.Alert != "payment-errors" || alert.Threshold != 3 || alert.Labels["severity"] != "critical" {
+		t.Errorf("unexpected alert: %s", emit.msgs[0].Value)
+	}
+
+	//cooldown内再次达到阈值不告警,cooldown之后的告警带上被抑制的次数
+	for i := 0; i < 3; i++ {
+		paymentError(time.Second)
+	}
+	if len(emit.msgs) != 1 {
+		t.Fatalf("expected alert to be suppressed, got %d alerts", len(emit.msgs))
+	}
+	now = now.Add(5 * time.Minute)
+	for i := 0; i < 3; i++ {
+		paymentError(time.Second)
+	}
+	if len(emit.msgs) != 2 {
+		t.Fatalf("expected 2 alerts, got %d", len(emit.msgs))
+	}
+	if err := json.Unmarshal(emit.msgs[1].Value, &alert); err != nil {
+		t.Fatal(err)
+	}
+	if alert.Suppressed != 1 {
+		t.Errorf("suppressed = %d, want 1", alert.Suppressed)
+	}
+
+	//不是JSON的日志也可以匹配,每个分组单独告警
+	for _, src := range []string{"a", "b", "a"} {
+		a.Process(&message.Message{Value: []byte("panic: runtime error"), Source: src})
+	}
+	if len(emit.msgs) != 4 {
+		t.Fatalf("expected 4 alerts, got %d", len(emit.msgs))
+	}
+	if err := json.Unmarshal(emit.msgs[3].Value, &alert); err != nil {
+		t.Fatal(err)
+	}
+	if alert.Alert != "panic" || alert.Source != "b" {
+		t.Errorf("unexpected alert: %s", emit.msgs[3].Value)
+	}
+
+	got := metricsText(a)
+	for _, want := range []string{
+		`log_alerts_total{processor="alerts",rule="payment-errors"} 2`,
+		`log_alerts_suppressed_total{processor="alerts",rule="payment-errors"} 1`,
+		`log_alerts_total{processor="alerts",rule="panic"} 2`,
+	} {
+		if !strings.Contains(got, want+"\n") {
+			t.Errorf("metrics missing %q:\n%s", want, got)
+		}
+	}
+}
+
+func TestAlerter_Webhook(t *testing.T) {
+	bodies := make(chan string, 10)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		bodies <- string(body)
+	}))
+	defer srv.Close()
+
+	b, err := NewBuilder("alert", map[string]interface{}{
+		"webhook": map[string]interface{}{"url": srv.URL},
+		"rules":   []interface{}{map[string]interface{}{"name": "panic", "match": `@value contains "panic:"`}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	p, err := b.Build("alerts", &emitRecorder{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.Process(message.New([]byte("panic: boom")))
+	//关闭时把队列中的告警发送完
+	if err := p.Close(); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case body := <-bodies:
+		var alert map[string]interface{}
+		if err := json.Unmarshal([]byte(body), &alert); err != nil {
+			t.Fatalf("expected a single JSON alert, got %q", body)
+		}
+		if alert["alert"] != "panic" || alert["sample"] != "panic: boom" {
+			t.Errorf("unexpected alert: %s", body)
+		}
+	default:
+		t.Fatal("expected alert to be sent to webhook")
+	}
+}
+
+func TestNewAlertBuilder_Invalid(t *testing.T) {
+	_, err := NewBuilder("alert", map[string]interface{}{
+		"webhook": map[string]interface{}{"url": "ftp://example.com"},
+		"rules": []interface{}{
+			map[string]interface{}{"name": "a", "match": "level ==", "threshold": -1},
+			map[string]interface{}{"name": "a"},
+		},
+	})
+	verrs, ok := err.(config.ValidationErrors)
+	if !ok {
+		t.Fatalf("expected ValidationErrors, got %v", err)
+	}
+	want := []string{"rules[0].match", "rules[0].threshold", "rules[1].name", "rules[1].match", "webhook.url"}
+	if len(verrs) != len(want) {
+		t.Fatalf("got %v, want paths %v", verrs, want)
+	}
+	for i, e := range verrs {
+		if e.Path != want[i] {
+			t.Errorf("problem %d path = %q, want %q", i, e.Path, want[i])
+		}
+	}
+
+	if _, err := NewBuilder("alert", map[string]interface{}{
+		"rules": []interface{}{map[string]interface{}{"name": "a", "match": "level"}},
+	}); err == nil || !strings.Contains(err.Error(), "emitTo") {
+		t.Errorf("expected error for missing emitTo and webhook, got %v", err)
+	}
+}
@@ -0,0 +1,134 @@
+package processor
+
+import (
+	"container/list"
+	"fmt"
+	"log-collector/config"
+	"time"
+)
+
+// DedupConfig 配置文件中dedup processor的配置
+type DedupConfig struct {
+	Fields        []string      `yaml:"fields"`        //作为ID的字段,可以是@topic等元数据;为空或者日志中都没有时使用内容的hash
+	IncludeOffset bool          `yaml:"includeOffset"` //ID中加上kafka的topic、partition和offset,只去掉重复投递的同一条消息
+	Window        time.Duration `yaml:"window"`        //第一次出现之后这段时间内重复的日志会被丢弃,默认10m
+	MaxEntries    int           `yaml:"maxEntries"`    //最多记住的ID数量,超过后忘记最早的,默认100000
+	Persist       *DedupPersist `yaml:"persist"`       //把记住的ID保存到文件,重启后继续去重
+}
+
+// DedupPersist 保存记住的ID
+type DedupPersist struct {
+	Path     string        `yaml:"path"`
+	Interval time.Duration `yaml:"interval"` //保存的间隔,默认10s;关闭时也会保存
+}
+
+func init() {
+	Register("dedup", newDedupBuilder)
+}
+
+// newDedupBuilder 解析并检查dedup processor的配置
+func newDedupBuilder(options map[string]interface{}) (Builder, error) {
+	var conf DedupConfig
+	if err := config.Decode(options, &conf); err != nil {
+		return nil, err
+	}
+	var errs config.ValidationErrors
+	for i, field := range conf.Fields {
+		if field == "" {
+			errs.Add(fmt.Sprintf("fields[%d]", i), "field must not be empty")
+		}
+	}
+	if conf.Window < 0 {
+		errs.Add("window", "must not be negative")
+	}
+	if conf.MaxEntries < 0 {
+		errs.Add("maxEntries", "must not be negative")
+	}
+	if p := conf.Persist; p != nil {
+		if p.Path == "" {
+			errs.Add("persist.path", "path must not be empty")
+		}
+		if p.Interval < 0 {
+			errs.Add("persist.interval", "must not be negative")
+		}
+	}
+	if len(errs) > 0 {
+		return nil, errs
+	}
+	b := NewDedupBuilder(conf.Window, conf.Fields...).
+		WithIncludeOffset(conf.IncludeOffset).
+		WithMaxEntries(conf.MaxEntries)
+	if p := conf.Persist; p != nil {
+		b.WithPersist(p.Path, p.Interval)
+	}
+	return b, nil
+}
+
+type DedupBuilder struct {
+	Window          time.Duration
+	Fields          []string
+	IncludeOffset   bool
+	MaxEntries      int
+	PersistPath     string
+	PersistInterval time.Duration
+}
+
+// NewDedupBuilder 按fields去重,window小于等于0时为10m,没有fields时按日志内容去重
+func NewDedupBuilder(window time.Duration, fields ...string) *DedupBuilder {
+	return &DedupBuilder{Window: window, Fields: fields}
+}
+
+// WithIncludeOffset ID中是否加上kafka的topic、partition和offset
+func (d *DedupBuilder) WithIncludeOffset(include bool) *DedupBuilder {
+	d.IncludeOffset = include
+	return d
+}
+
+// WithMaxEntries 设置最多记住的ID数量,小于等于0时为100000
+func (d *DedupBuilder) WithMaxEntries(n int) *DedupBuilder {
+	d.MaxEntries = n
+	return d
+}
+
+// WithPersist 每interval把记住的ID保存到path,创建时从path读取;interval小于等于0时为10s
+func (d *DedupBuilder) WithPersist(path string, interval time.Duration) *DedupBuilder {
+	d.PersistPath = path
+	d.PersistInterval = interval
+	return d
+}
+
+func (d *DedupBuilder) Build(name string, emit Emitter) (Processor, error) {
+	window := d.Window
+	if window <= 0 {
+		window = 10 * time.Minute
+	}
+	maxEntries := d.MaxEntries
+	if maxEntries <= 0 {
+		maxEntries = 100000
+	}
+	p := &Deduper{
+		name:          name,
+		fields:        d.Fields,
+		includeOffset: d.IncludeOffset,
+		window:        window,
+		maxEntries:    maxEntries,
+		path:          d.PersistPath,
+		now:           time.Now,
+		seen:          make(map[dedupKey]*list.Element),
+		order:         list.New(),
+	}
+	if p.path == "" {
+		return p, nil
+	}
+	if err := p.load(); err != nil {
+		return nil, fmt.Errorf("load dedup state failed: %w", err)
+	}
+	interval := d.PersistInterval
+	if interval <= 0 {
+		interval = 10 * time.Second
+	}
+	p.stop = make(chan struct{})
+	p.done = make(chan struct{})
+	go p.run(interval)
+	return p, nil
+}
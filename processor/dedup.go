@@ -0,0 +1,272 @@
+package processor
+
+import (
+	"bufio"
+	"bytes"
+	"container/list"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"log-collector/logging"
+	"log-collector/message"
+	"log-collector/metrics"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// dedupMagic 保存的文件的开头,后面每条记录为16字节的ID和8字节的第一次出现的时间(unix纳秒,大端)
+const dedupMagic = "LCDEDUP1"
+
+// dedupKey 日志ID的hash,只保存hash可以控制内存的大小
+type dedupKey [16]byte
+
+// dedupEntry 记住的一个ID
+type dedupEntry struct {
+	key  dedupKey
+	seen time.Time //第一次出现的时间
+}
+
+// Deduper 丢弃window内重复的日志,例如kafka rebalance后重复投递的消息
+// 记住的ID按第一次出现的时间排序,过期或者超过maxEntries时忘记最早的
+type Deduper struct {
+	name          string
+	fields        []string
+	includeOffset bool
+	window        time.Duration
+	maxEntries    int
+	path          string
+	now           func() time.Time
+
+	mutex   sync.Mutex
+	seen    map[dedupKey]*list.Element
+	order   *list.List //*dedupEntry,最早的在前面
+	dropped int64
+	dirty   bool     //保存之后是否有变化
+	next    *Deduper //配置变化后接手状态的新的Deduper,之后的日志交给它处理
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+func (p *Deduper) Process(msg *message.Message) bool {
+	key := p.key(msg)
+	p.mutex.Lock()
+	if next := p.next; next != nil {
+		p.mutex.Unlock()
+		return next.Process(msg)
+	}
+	defer p.mutex.Unlock()
+	now := p.now()
+	p.expire(now)
+	if _, ok := p.seen[key]; ok {
+		p.dropped++
+		return false
+	}
+	p.seen[key] = p.order.PushBack(&dedupEntry{key: key, seen: now})
+	p.dirty = true
+	for p.order.Len() > p.maxEntries {
+		p.remove(p.order.Front())
+	}
+	return true
+}
+
+// Inherit 接手旧的Deduper记住的ID,按新的window和maxEntries忘记多余的,代替Build时从文件读取的状态
+// 旧的Deduper不会再保存,避免两个实例写同一个文件时用旧的状态覆盖新的状态
+func (p *Deduper) Inherit(old Processor) {
+	prev, ok := old.(*Deduper)
+	if !ok || prev == p {
+		return
+	}
+	prev.mutex.Lock()
+	defer prev.mutex.Unlock()
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	p.seen = make(map[dedupKey]*list.Element, prev.order.Len())
+	p.order = list.New()
+	now := p.now()
+	for e := prev.order.Front(); e != nil; e = e.Next() {
+		entry := *e.Value.(*dedupEntry)
+		if now.Sub(entry.seen) >= p.window {
+			continue
+		}
+		p.seen[entry.key] = p.order.PushBack(&entry)
+	}
+	for p.order.Len() > p.maxEntries {
+		p.remove(p.order.Front())
+	}
+	p.dirty = true
+	prev.next = p
+	prev.dirty = false
+}
+
+// key 日志的ID:配置的字段的值,没有配置或者都不存在时为日志的内容,需要时加上topic、partition和offset
+func (p *Deduper) key(msg *message.Message) dedupKey {
+	h := fnv.New128a()
+	found := false
+	for _, field := range p.fields {
+		v, ok := msg.LookupString(field)
+		if ok {
+			found = true
+		}
+		//每个值前面加上长度,避免不同的字段组合出相同的内容
+		fmt.Fprintf(h, "%d:%s", len(v), v)
+	}
+	if !found {
+		h.Write([]byte{0})
+		h.Write(msg.Value)
+	}
+	if p.includeOffset {
+		fmt.Fprintf(h, "\x00%d:%s/%d/%d", len(msg.Topic), msg.Topic, msg.Partition, msg.Offset)
+	}
+	var key dedupKey
+	h.Sum(key[:0])
+	return key
+}
+
+// expire 忘记window之前出现的ID,调用前需要持有锁
+func (p *Deduper) expire(now time.Time) {
+	for e := p.order.Front(); e != nil; e = p.order.Front() {
+		if now.Sub(e.Value.(*dedupEntry).seen) < p.window {
+			return
+		}
+		p.remove(e)
+	}
+}
+
+func (p *Deduper) remove(e *list.Element) {
+	delete(p.seen, e.Value.(*dedupEntry).key)
+	p.order.Remove(e)
+	p.dirty = true
+}
+
+// run 定时保存记住的ID
+func (p *Deduper) run(interval time.Duration) {
+	defer close(p.done)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if err := p.save(); err != nil {
+				logging.Component("processor", "processor", p.name).Error("save dedup state failed", "path", p.path, "error", err)
+			}
+		case <-p.stop:
+			return
+		}
+	}
+}
+
+// load 读取保存的ID,文件不存在时忽略,已经过期的不再记住
+func (p *Deduper) load() error {
+	f, err := os.Open(p.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	r := bufio.NewReader(f)
+	magic := make([]byte, len(dedupMagic))
+	if _, err := io.ReadFull(r, magic); err != nil || !bytes.Equal(magic, []byte(dedupMagic)) {
+		return fmt.Errorf("%s is not a dedup state file", p.path)
+	}
+	now := p.now()
+	var record [len(dedupKey{}) + 8]byte
+	for {
+		if _, err := io.ReadFull(r, record[:]); err != nil {
+			if err == io.EOF {
+				break
+			}
+			return fmt.Errorf("read %s: %w", p.path, err)
+		}
+		var key dedupKey
+		copy(key[:], record[:len(key)])
+		seen := time.Unix(0, int64(binary.BigEndian.Uint64(record[len(key):])))
+		if _, ok := p.seen[key]; ok || now.Sub(seen) >= p.window {
+			continue
+		}
+		p.seen[key] = p.order.PushBack(&dedupEntry{key: key, seen: seen})
+	}
+	for p.order.Len() > p.maxEntries {
+		p.remove(p.order.Front())
+	}
+	p.dirty = false
+	return nil
+}
+
+// save 有变化时把记住的ID写入临时文件后替换原来的文件,避免写了一半时退出
+func (p *Deduper) save() error {
+	p.mutex.Lock()
+	if !p.dirty || p.next != nil {
+		p.mutex.Unlock()
+		return nil
+	}
+	var buf bytes.Buffer
+	buf.Grow(len(dedupMagic) + p.order.Len()*(len(dedupKey{})+8))
+	buf.WriteString(dedupMagic)
+	var ts [8]byte
+	for e := p.order.Front(); e != nil; e = e.Next() {
+		entry := e.Value.(*dedupEntry)
+		buf.Write(entry.key[:])
+		binary.BigEndian.PutUint64(ts[:], uint64(entry.seen.UnixNano()))
+		buf.Write(ts[:])
+	}
+	p.dirty = false
+	p.mutex.Unlock()
+
+	err := writeState(p.path, buf.Bytes())
+	if err != nil {
+		//下次继续尝试保存
+		p.mutex.Lock()
+		p.dirty = true
+		p.mutex.Unlock()
+	}
+	return err
+}
+
+// writeState 写入临时文件后替换原来的文件
+func writeState(path string, data []byte) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// Metrics 丢弃的日志条数和记住的ID数量
+func (p *Deduper) Metrics() []metrics.Family {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	labels := []metrics.Label{{Name: "processor", Value: p.name}}
+	return []metrics.Family{
+		{
+			Name: "log_dedup_dropped_total", Help: "Number of duplicate records dropped", Type: metrics.Counter,
+			Samples: []metrics.Sample{{Labels: labels, Value: float64(p.dropped)}},
+		},
+		{
+			Name: "log_dedup_entries", Help: "Number of record IDs remembered", Type: metrics.Gauge,
+			Samples: []metrics.Sample{{Labels: labels, Value: float64(p.order.Len())}},
+		},
+	}
+}
+
+// Close 停止定时保存,配置了persist时最后保存一次
+func (p *Deduper) Close() error {
+	if p.path == "" {
+		return nil
+	}
+	close(p.stop)
+	<-p.done
+	if err := p.save(); err != nil {
+		return fmt.Errorf("save dedup state failed: %w", err)
+	}
+	return nil
+}
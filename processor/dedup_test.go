@@ -0,0 +1,145 @@
+package processor
+
+import (
+	"log-collector/message"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDeduper(t *testing.T) {
+	b, err := NewBuilder("dedup", map[string]interface{}{
+		"fields":     []interface{}{"id"},
+		"window":     "1m",
+		"maxEntries": 3,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	p, err := b.Build("dedup", &emitRecorder{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+	d := p.(*Deduper)
+	now := time.Date(2024, 1, 2, 8, 0, 0, 0, time.UTC)
+	d.now = func() time.Time { return now }
+
+	process := func(value string) bool {
+		return d.Process(message.New([]byte(value)))
+	}
+	if !process(`{"id":"a","n":1}`) || process(`{"id":"a","n":2}`) {
+		t.Error("expected the second record with the same id to be dropped")
+	}
+	//没有id字段时按内容去重
+	if !process(`plain`) || process(`plain`) || !process(`plain 2`) {
+		t.Error("expected records without id to be deduplicated by content")
+	}
+	//超过maxEntries时忘记最早的
+	process(`{"id":"b"}`)
+	if !process(`{"id":"a"}`) {
+		t.Error("expected the oldest id to be forgotten")
+	}
+	//过期后不再是重复的
+	now = now.Add(time.Minute)
+	if !process(`{"id":"b"}`) {
+		t.Error("expected id to expire after window")
+	}
+	if got := metricsText(d); !strings.Contains(got, `log_dedup_dropped_total{processor="dedup"} 2`) {
+		t.Errorf("unexpected metrics:\n%s", got)
+	}
+}
+
+func TestDeduper_IncludeOffset(t *testing.T) {
+	p, err := NewDedupBuilder(time.Minute).WithIncludeOffset(true).Build("dedup", &emitRecorder{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+	msg := func(partition int32, offset int64) *message.Message {
+		return &message.Message{Value: []byte("x"), Topic: "t", Partition: partition, Offset: offset}
+	}
+	if !p.Process(msg(0, 1)) || p.Process(msg(0, 1)) {
+		t.Error("expected redelivered message to be dropped")
+	}
+	if !p.Process(msg(0, 2)) || !p.Process(msg(1, 1)) {
+		t.Error("expected same content at other offsets to be kept")
+	}
+}
+
+func TestDeduper_Persist(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state", "dedup.state")
+	b := NewDedupBuilder(time.Hour, "id").WithPersist(path, time.Hour)
+	p, err := b.Build("dedup", &emitRecorder{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.Process(message.New([]byte(`{"id":"a"}`)))
+	p.Process(message.New([]byte(`{"id":"b"}`)))
+	if err := p.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	//重启后继续去重,已经过期的不再记住
+	p, err = b.Build("dedup", &emitRecorder{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+	if p.Process(message.New([]byte(`{"id":"a"}`))) {
+		t.Error("expected id seen before restart to be dropped")
+	}
+	if !p.Process(message.New([]byte(`{"id":"c"}`))) {
+		t.Error("expected new id to be kept")
+	}
+
+	expired := NewDedupBuilder(time.Nanosecond, "id").WithPersist(path, time.Hour)
+	p2, err := expired.Build("dedup", &emitRecorder{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p2.Close()
+	if n := p2.(*Deduper).order.Len(); n != 0 {
+		t.Errorf("expected expired ids to be skipped, got %d", n)
+	}
+}
+
+func TestDeduper_Inherit(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "dedup.state")
+	old, err := NewDedupBuilder(time.Hour, "id").WithPersist(path, time.Hour).Build("dedup", &emitRecorder{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	old.Process(message.New([]byte(`{"id":"a"}`)))
+
+	//配置变化后重新创建,文件中还没有a
+	p, err := NewDedupBuilder(2*time.Hour, "id").WithPersist(path, time.Hour).Build("dedup", &emitRecorder{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.(Inheritor).Inherit(old)
+	//替换完成之前旧的processor收到的日志交给新的processor
+	if old.Process(message.New([]byte(`{"id":"a"}`))) || !old.Process(message.New([]byte(`{"id":"b"}`))) {
+		t.Error("expected the old deduper to forward records to the new one")
+	}
+	if err := old.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if p.Process(message.New([]byte(`{"id":"b"}`))) {
+		t.Error("expected id seen by the old deduper to be dropped")
+	}
+	if err := p.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	//文件中是新的Deduper的状态,没有被旧的覆盖
+	p, err = NewDedupBuilder(time.Hour, "id").WithPersist(path, time.Hour).Build("dedup", &emitRecorder{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+	if n := p.(*Deduper).order.Len(); n != 2 {
+		t.Errorf("expected 2 ids to be saved, got %d", n)
+	}
+}
@@ -0,0 +1,103 @@
+package processor
+
+import (
+	"fmt"
+	"log-collector/config"
+	"log-collector/message"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Processor 在日志分发给writer之前,按配置的顺序依次处理每条日志
+// Process只会在collector分发日志的协程中调用,不需要考虑并发;但processor自己的定时任务需要自己加锁
+type Processor interface {
+	// Process 返回false时丢弃这条日志,后面的processor和writer都不会收到
+	// 不能修改msg,需要产生新的日志时通过Emitter发送
+	Process(msg *message.Message) bool
+
+	// Close 停止定时任务,需要时把还没有发送的结果(例如当前窗口的汇总)发送出去
+	Close() error
+}
+
+// Inheritor 配置变化后重新创建的processor,在替换同名的旧processor时接手它的状态(例如dedup记住的ID)
+// 接手之后旧的processor不再保存状态,在替换完成之前收到的日志交给新的processor处理
+type Inheritor interface {
+	Inherit(old Processor)
+}
+
+// Emitter processor产生的新日志(汇总、告警等)通过Emitter交给collector
+// to为writer的名称,为空时分发给所有不是dedicated的writer;Emit可能会阻塞,但不会丢弃日志
+type Emitter interface {
+	Emit(to string, msg *message.Message)
+}
+
+// EmitterFunc 把函数转换为Emitter
+type EmitterFunc func(to string, msg *message.Message)
+
+func (f EmitterFunc) Emit(to string, msg *message.Message) {
+	f(to, msg)
+}
+
+type Builder interface {
+	// Build 创建processor,name为配置中的名称,emit用于发送processor产生的日志
+	Build(name string, emit Emitter) (Processor, error)
+}
+
+// Outputs 会把日志发送给指定writer的Builder实现该接口,用于检查配置中的writer是否存在
+// 返回值的key为配置的路径(相对路径),value为writer的名称
+type Outputs interface {
+	Outputs() map[string]string
+}
+
+// Factory 根据配置创建Builder,options为配置文件中该processor除name、type以外的部分
+// Factory只解析和检查配置;配置有问题时返回config.ValidationErrors(使用相对路径)
+type Factory func(options map[string]interface{}) (Builder, error)
+
+var (
+	registryMutex sync.RWMutex
+	factories     = make(map[string]Factory) //type到Factory的映射
+)
+
+// Register 注册type对应的Factory,一般在包的init()中调用
+// type为空、factory为nil或者同一个type重复注册时会panic
+func Register(typ string, factory Factory) {
+	registryMutex.Lock()
+	defer registryMutex.Unlock()
+	if typ == "" {
+		panic("processor: Register type is empty")
+	}
+	if factory == nil {
+		panic("processor: Register factory is nil for type " + typ)
+	}
+	if _, dup := factories[typ]; dup {
+		panic("processor: Register called twice for type " + typ)
+	}
+	factories[typ] = factory
+}
+
+// NewBuilder 根据type找到对应的Factory并创建Builder
+func NewBuilder(typ string, options map[string]interface{}) (Builder, error) {
+	registryMutex.RLock()
+	f, ok := factories[typ]
+	registryMutex.RUnlock()
+	if !ok {
+		return nil, config.ValidationErrors{{
+			Path:   "type",
+			Reason: fmt.Sprintf("unknown processor type %q, supported types: %s", typ, strings.Join(Types(), ", ")),
+		}}
+	}
+	return f(options)
+}
+
+// Types 返回支持的所有type,按字母排序
+func Types() []string {
+	registryMutex.RLock()
+	defer registryMutex.RUnlock()
+	types := make([]string, 0, len(factories))
+	for typ := range factories {
+		types = append(types, typ)
+	}
+	sort.Strings(types)
+	return types
+}
@@ -0,0 +1,246 @@
+package processor
+
+import (
+	"fmt"
+	"log-collector/config"
+	"log-collector/metrics"
+	"time"
+)
+
+// 超过限制时的处理方式
+const (
+	RateLimitDrop     = "drop"     //丢弃
+	RateLimitSample   = "sample"   //按sampleRate保留一部分,其余丢弃
+	RateLimitOverflow = "overflow" //发送给overflowTo的writer,不再分发给其他writer
+)
+
+// RateLimitConfig 配置文件中ratelimit processor的配置
+type RateLimitConfig struct {
+	KeyBy           []string            `yaml:"keyBy"`           //限流的key,例如[service]或者[@topic];为空时所有日志共用一个限制
+	Rate            float64             `yaml:"rate"`            //每秒允许的条数
+	Burst           int                 `yaml:"burst"`           //允许的突发条数,默认同rate
+	Overrides       []RateLimitOverride `yaml:"overrides"`       //指定key的限制
+	Action          string              `yaml:"action"`          //drop|sample|overflow,默认drop
+	SampleRate      float64             `yaml:"sampleRate"`      //action为sample时超过限制的日志保留的比例,例如0.01
+	OverflowTo      string              `yaml:"overflowTo"`      //action为overflow时发送给这个writer
+	SummaryInterval time.Duration       `yaml:"summaryInterval"` //汇总被限制的条数的间隔,默认1m
+	SummaryTo       string              `yaml:"summaryTo"`       //汇总的日志发送给这个writer,为空时分发给所有不是dedicated的writer
+	MaxKeys         int                 `yaml:"maxKeys"`         //key数量的上限,超过后新的key合并到值为__overflow__的key,默认10000
+}
+
+// RateLimitRule 一个key的限制
+type RateLimitRule struct {
+	Rate  float64 `yaml:"rate"`
+	Burst int     `yaml:"burst"`
+}
+
+// RateLimitOverride 配置文件中指定key的限制
+// 用列表而不是 key: 限制 的map配置,因为读取配置时map的key会被转换为小写,而key是区分大小写的
+type RateLimitOverride struct {
+	Key           string `yaml:"key"` //keyBy字段的值,多个字段用/连接,例如 Payment,区分大小写
+	RateLimitRule `yaml:",inline" mapstructure:",squash"`
+}
+
+func init() {
+	Register("ratelimit", newRateLimitBuilder)
+}
+
+// newRateLimitBuilder 解析并检查ratelimit processor的配置
+func newRateLimitBuilder(options map[string]interface{}) (Builder, error) {
+	if _, ok := options["overrides"].(map[string]interface{}); ok {
+		return nil, config.ValidationErrors{{
+			Path:   "overrides",
+			Reason: "must be a list of {key, rate, burst}, map keys lose their case when the config is loaded",
+		}}
+	}
+	var conf RateLimitConfig
+	if err := config.Decode(options, &conf); err != nil {
+		return nil, err
+	}
+	var errs config.ValidationErrors
+	for i, field := range conf.KeyBy {
+		if field == "" {
+			errs.Add(fmt.Sprintf("keyBy[%d]", i), "field must not be empty")
+		}
+	}
+	validateRateLimitRule(&errs, "", RateLimitRule{Rate: conf.Rate, Burst: conf.Burst})
+	keys := make(map[string]bool, len(conf.Overrides))
+	for i, o := range conf.Overrides {
+		prefix := fmt.Sprintf("overrides[%d].", i)
+		if keys[o.Key] {
+			errs.Add(prefix+"key", "duplicate key %q", o.Key)
+		}
+		keys[o.Key] = true
+		validateRateLimitRule(&errs, prefix, o.RateLimitRule)
+	}
+	switch conf.Action {
+	case "", RateLimitDrop:
+	case RateLimitSample:
+		if conf.SampleRate <= 0 || conf.SampleRate > 1 {
+			errs.Add("sampleRate", "must be in (0, 1] when action is sample")
+		}
+	case RateLimitOverflow:
+		if conf.OverflowTo == "" {
+			errs.Add("overflowTo", "overflowTo is required when action is overflow")
+		}
+	default:
+		errs.Add("action", "unknown action %q, expected one of drop, sample, overflow", conf.Action)
+	}
+	if conf.SummaryInterval < 0 {
+		errs.Add("summaryInterval", "must not be negative")
+	}
+	if conf.MaxKeys < 0 {
+		errs.Add("maxKeys", "must not be negative")
+	}
+	if len(errs) > 0 {
+		return nil, errs
+	}
+	b := NewRateLimitBuilder(conf.Rate, conf.Burst, conf.KeyBy...).
+		WithAction(conf.Action, conf.SampleRate, conf.OverflowTo).
+		WithSummary(conf.SummaryInterval, conf.SummaryTo).
+		WithMaxKeys(conf.MaxKeys)
+	for _, o := range conf.Overrides {
+		b.WithOverride(o.Key, o.RateLimitRule)
+	}
+	return b, nil
+}
+
+func validateRateLimitRule(errs *config.ValidationErrors, prefix string, rule RateLimitRule) {
+	if rule.Rate <= 0 {
+		errs.Add(prefix+"rate", "must be positive")
+	}
+	if rule.Burst < 0 {
+		errs.Add(prefix+"burst", "must not be negative")
+	}
+}
+
+type RateLimitBuilder struct {
+	KeyBy           []string
+	Rate            float64
+	Burst           int
+	Overrides       map[string]RateLimitRule
+	Action          string
+	SampleRate      float64
+	OverflowTo      string
+	SummaryInterval time.Duration
+	SummaryTo       string
+	MaxKeys         int
+}
+
+// NewRateLimitBuilder 每个key每秒允许rate条日志,burst小于等于0时同rate
+func NewRateLimitBuilder(rate float64, burst int, keyBy ...string) *RateLimitBuilder {
+	return &RateLimitBuilder{Rate: rate, Burst: burst, KeyBy: keyBy}
+}
+
+// WithOverride 设置指定key的限制,key为keyBy字段的值,多个字段用/连接
+func (r *RateLimitBuilder) WithOverride(key string, rule RateLimitRule) *RateLimitBuilder {
+	if r.Overrides == nil {
+		r.Overrides = make(map[string]RateLimitRule)
+	}
+	r.Overrides[key] = rule
+	return r
+}
+
+// WithAction 设置超过限制时的处理方式,为空时为RateLimitDrop
+// sampleRate为RateLimitSample保留的比例,overflowTo为RateLimitOverflow发送给的writer
+func (r *RateLimitBuilder) WithAction(action string, sampleRate float64, overflowTo string) *RateLimitBuilder {
+	r.Action = action
+	r.SampleRate = sampleRate
+	r.OverflowTo = overflowTo
+	return r
+}
+
+// WithSummary 每interval汇总一次被限制的条数,发送给名为to的writer
+// interval小于等于0时为1m,to为空时分发给所有不是dedicated的writer
+func (r *RateLimitBuilder) WithSummary(interval time.Duration, to string) *RateLimitBuilder {
+	r.SummaryInterval = interval
+	r.SummaryTo = to
+	return r
+}
+
+// WithMaxKeys 设置key数量的上限,小于等于0时为10000
+func (r *RateLimitBuilder) WithMaxKeys(n int) *RateLimitBuilder {
+	r.MaxKeys = n
+	return r
+}
+
+func (r *RateLimitBuilder) Outputs() map[string]string {
+	outputs := make(map[string]string)
+	if r.Action == RateLimitOverflow && r.OverflowTo != "" {
+		outputs["overflowTo"] = r.OverflowTo
+	}
+	if r.SummaryTo != "" {
+		outputs["summaryTo"] = r.SummaryTo
+	}
+	return outputs
+}
+
+func (r *RateLimitBuilder) Build(name string, emit Emitter) (Processor, error) {
+	if r.Rate <= 0 {
+		return nil, fmt.Errorf("rate must be positive")
+	}
+	action := r.Action
+	switch action {
+	case "":
+		action = RateLimitDrop
+	case RateLimitDrop:
+	case RateLimitSample:
+		if r.SampleRate <= 0 || r.SampleRate > 1 {
+			return nil, fmt.Errorf("sampleRate must be in (0, 1]")
+		}
+	case RateLimitOverflow:
+		if r.OverflowTo == "" {
+			return nil, fmt.Errorf("overflowTo is required when action is overflow")
+		}
+	default:
+		return nil, fmt.Errorf("unknown action %q", action)
+	}
+	interval := r.SummaryInterval
+	if interval <= 0 {
+		interval = time.Minute
+	}
+	maxKeys := r.MaxKeys
+	if maxKeys <= 0 {
+		maxKeys = 10000
+	}
+	labels := make([]string, len(r.KeyBy))
+	for i, field := range r.KeyBy {
+		labels[i] = metrics.LabelName(field)
+	}
+	overrides := make(map[string]RateLimitRule, len(r.Overrides))
+	for key, rule := range r.Overrides {
+		if rule.Rate <= 0 {
+			return nil, fmt.Errorf("override %s: rate must be positive", key)
+		}
+		overrides[key] = withDefaultBurst(rule)
+	}
+	p := &RateLimiter{
+		name:       name,
+		keyBy:      r.KeyBy,
+		labels:     labels,
+		rule:       withDefaultBurst(RateLimitRule{Rate: r.Rate, Burst: r.Burst}),
+		overrides:  overrides,
+		action:     action,
+		sampleRate: r.SampleRate,
+		overflowTo: r.OverflowTo,
+		interval:   interval,
+		summaryTo:  r.SummaryTo,
+		maxKeys:    maxKeys,
+		emit:       emit,
+		now:        time.Now,
+		buckets:    make(map[string]*bucket),
+		stop:       make(chan struct{}),
+		done:       make(chan struct{}),
+	}
+	p.start = p.now()
+	go p.run()
+	return p, nil
+}
+
+// withDefaultBurst burst小于等于0时同rate(至少为1)
+func withDefaultBurst(rule RateLimitRule) RateLimitRule {
+	if rule.Burst <= 0 {
+		rule.Burst = max(int(rule.Rate), 1)
+	}
+	return rule
+}
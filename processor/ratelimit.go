@@ -0,0 +1,223 @@
+package processor
+
+import (
+	"encoding/json"
+	"log-collector/message"
+	"log-collector/metrics"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// RateLimiter 按key的令牌桶限流,超过限制的日志按action丢弃、抽样或者发送给overflow的writer
+// 每个汇总间隔结束时发送一条汇总的日志,记录每个key被限制的条数
+type RateLimiter struct {
+	name       string
+	keyBy      []string
+	labels     []string //keyBy对应的label名称
+	rule       RateLimitRule
+	overrides  map[string]RateLimitRule
+	action     string
+	sampleRate float64
+	overflowTo string
+	interval   time.Duration
+	summaryTo  string
+	maxKeys    int
+	emit       Emitter
+	now        func() time.Time
+
+	mutex   sync.Mutex
+	buckets map[string]*bucket
+	start   time.Time //当前汇总间隔的开始时间
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+// bucket 一个key的令牌桶
+type bucket struct {
+	values []string //keyBy字段的值
+	rule   RateLimitRule
+	tokens float64
+	last   time.Time //上次补充令牌的时间
+	sample float64   //抽样的累计值,满1时保留一条
+
+	suppressed int64 //当前汇总间隔被限制的条数
+	sampled    int64 //当前汇总间隔超过限制但被抽样保留的条数
+	total      int64 //累计被限制的条数,暴露给metrics接口
+}
+
+func (p *RateLimiter) Process(msg *message.Message) bool {
+	values := make([]string, len(p.keyBy))
+	for i, field := range p.keyBy {
+		values[i], _ = msg.LookupString(field)
+	}
+
+	p.mutex.Lock()
+	now := p.now()
+	b := p.bucket(values, now)
+	if b.take(now) {
+		p.mutex.Unlock()
+		return true
+	}
+	if p.action == RateLimitSample {
+		//加上误差,避免0.1累加10次小于1
+		if b.sample += p.sampleRate; b.sample >= 1-1e-9 {
+			b.sample--
+			b.sampled++
+			p.mutex.Unlock()
+			return true
+		}
+	}
+	b.suppressed++
+	b.total++
+	p.mutex.Unlock()
+
+	if p.action == RateLimitOverflow {
+		p.emit.Emit(p.overflowTo, msg)
+	}
+	return false
+}
+
+// bucket 找到values对应的令牌桶,key的数量达到上限时使用__overflow__,调用前需要持有锁
+func (p *RateLimiter) bucket(values []string, now time.Time) *bucket {
+	key := strings.Join(values, "\x00")
+	if b, ok := p.buckets[key]; ok {
+		return b
+	}
+	if len(p.buckets) >= p.maxKeys {
+		for i := range values {
+			values[i] = overflowGroup
+		}
+		key = strings.Join(values, "\x00")
+		if b, ok := p.buckets[key]; ok {
+			return b
+		}
+	}
+	rule, ok := p.overrides[strings.Join(values, "/")]
+	if !ok {
+		rule = p.rule
+	}
+	b := &bucket{values: values, rule: rule, tokens: float64(rule.Burst), last: now}
+	p.buckets[key] = b
+	return b
+}
+
+// refill 按经过的时间补充令牌,最多burst个
+func (b *bucket) refill(now time.Time) {
+	if elapsed := now.Sub(b.last); elapsed > 0 {
+		b.tokens = min(b.tokens+elapsed.Seconds()*b.rule.Rate, float64(b.rule.Burst))
+		b.last = now
+	}
+}
+
+// take 取一个令牌,没有令牌时返回false
+func (b *bucket) take(now time.Time) bool {
+	b.refill(now)
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
+
+// run 每个汇总间隔发送一次汇总的日志
+func (p *RateLimiter) run() {
+	defer close(p.done)
+	ticker := time.NewTicker(p.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			p.flush()
+		case <-p.stop:
+			return
+		}
+	}
+}
+
+// flush 汇总当前间隔被限制的条数,并清理空闲的key(令牌已经补满并且从来没有被限制过)
+func (p *RateLimiter) flush() {
+	p.mutex.Lock()
+	now := p.now()
+	start := p.start
+	p.start = now
+	keys := make([]string, 0, len(p.buckets))
+	for key := range p.buckets {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	var records []*message.Message
+	for _, key := range keys {
+		b := p.buckets[key]
+		if b.suppressed > 0 || b.sampled > 0 {
+			records = append(records, p.summary(b, start, now))
+			b.suppressed, b.sampled = 0, 0
+		}
+		b.refill(now)
+		if b.total == 0 && b.tokens >= float64(b.rule.Burst) {
+			delete(p.buckets, key)
+		}
+	}
+	p.mutex.Unlock()
+
+	for _, r := range records {
+		p.emit.Emit(p.summaryTo, r)
+	}
+}
+
+// summary 一个key在一个汇总间隔中被限制的条数,例如:
+//
+//	{"time":"...","processor":"ratelimit","windowStart":"...","action":"drop","service":"api","rate":100,"burst":100,"suppressed":1234}
+func (p *RateLimiter) summary(b *bucket, start, end time.Time) *message.Message {
+	record := map[string]interface{}{
+		"time":        end.Format(time.RFC3339Nano),
+		"windowStart": start.Format(time.RFC3339Nano),
+		"processor":   p.name,
+		"action":      p.action,
+		"rate":        b.rule.Rate,
+		"burst":       b.rule.Burst,
+		"suppressed":  b.suppressed,
+	}
+	if p.action == RateLimitSample {
+		record["sampled"] = b.sampled
+	}
+	for i, field := range p.keyBy {
+		record[field] = b.values[i]
+	}
+	value, _ := json.Marshal(record)
+	return &message.Message{Value: value, Source: p.name, Timestamp: end}
+}
+
+// Metrics 每个被限制过的key累计被限制的条数
+func (p *RateLimiter) Metrics() []metrics.Family {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	keys := make([]string, 0, len(p.buckets))
+	for key, b := range p.buckets {
+		if b.total > 0 {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	f := metrics.Family{Name: "log_ratelimit_suppressed_total", Help: "Number of records over the rate limit", Type: metrics.Counter}
+	for _, key := range keys {
+		b := p.buckets[key]
+		labels := make([]metrics.Label, 0, len(p.labels)+1)
+		labels = append(labels, metrics.Label{Name: "processor", Value: p.name})
+		for i, name := range p.labels {
+			labels = append(labels, metrics.Label{Name: name, Value: b.values[i]})
+		}
+		f.Samples = append(f.Samples, metrics.Sample{Labels: labels, Value: float64(b.total)})
+	}
+	return []metrics.Family{f}
+}
+
+// Close 停止定时汇总,把当前间隔的汇总发送出去
+func (p *RateLimiter) Close() error {
+	close(p.stop)
+	<-p.done
+	p.flush()
+	return nil
+}
@@ -0,0 +1,195 @@
+package processor
+
+import (
+	"encoding/json"
+	"log-collector/config"
+	"log-collector/message"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func buildRateLimit(t *testing.T, options map[string]interface{}, emit Emitter) (*RateLimiter, *time.Time) {
+	t.Helper()
+	b, err := NewBuilder("ratelimit", options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p, err := b.Build("limit", emit)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { p.Close() })
+	r := p.(*RateLimiter)
+	now := time.Date(2024, 1, 2, 8, 0, 0, 0, time.UTC)
+	r.now = func() time.Time { return now }
+	r.start = now
+	return r, &now
+}
+
+// count 发送n条日志,返回没有被丢弃的条数
+func count(p Processor, value string, n int) int {
+	kept := 0
+	for i := 0; i < n; i++ {
+		if p.Process(message.New([]byte(value))) {
+			kept++
+		}
+	}
+	return kept
+}
+
+func TestRateLimiter_Drop(t *testing.T) {
+	emit := &emitRecorder{}
+	p, now := buildRateLimit(t, map[string]interface{}{
+		"keyBy":     []interface{}{"service"},
+		"rate":      10,
+		"burst":     5,
+		"overrides": []interface{}{map[string]interface{}{"key": "payment", "rate": 100}},
+		"summaryTo": "summary",
+	}, emit)
+
+	api := `{"service":"api"}`
+	if kept := count(p, api, 8); kept != 5 {
+		t.Errorf("kept %d records, want burst 5", kept)
+	}
+	//每个key单独限流,override的key使用自己的限制
+	if kept := count(p, `{"service":"payment"}`, 120); kept != 100 {
+		t.Errorf("kept %d payment records, want 100", kept)
+	}
+	//令牌按rate补充
+	*now = now.Add(300 * time.Millisecond)
+	if kept := count(p, api, 5); kept != 3 {
+		t.Errorf("kept %d records after 300ms, want 3", kept)
+	}
+
+	*now = now.Add(time.Minute)
+	p.flush()
+	if len(emit.msgs) != 2 || emit.to[0] != "summary" {
+		t.Fatalf("expected 2 summaries to writer summary, got %d %v", len(emit.msgs), emit.to)
+	}
+	var summary struct {
+		Service    string `json:"service"`
+		Suppressed int    `json:"suppressed"`
+		Action     string `json:"action"`
+	}
+	if err := json.Unmarshal(emit.msgs[0].Value, &summary); err != nil {
+		t.Fatal(err)
+	}
+	if summary.Service != "api" || summary.Suppressed != 5 || summary.Action != "drop" {
+		t.Errorf("unexpected summary: %s", emit.msgs[0].Value)
+	}
+
+	//没有被限制的间隔不发送汇总
+	p.flush()
+	if len(emit.msgs) != 2 {
+		t.Errorf("expected no summary, got %d records", len(emit.msgs))
+	}
+	got := metricsText(p)
+	for _, want := range []string{
+		`log_ratelimit_suppressed_total{processor="limit",service="api"} 5`,
+		`log_ratelimit_suppressed_total{processor="limit",service="payment"} 20`,
+	} {
+		if !strings.Contains(got, want+"\n") {
+			t.Errorf("metrics missing %q:\n%s", want, got)
+		}
+	}
+}
+
+func TestRateLimiter_Sample(t *testing.T) {
+	emit := &emitRecorder{}
+	p, _ := buildRateLimit(t, map[string]interface{}{
+		"rate":       1,
+		"action":     "sample",
+		"sampleRate": 0.1,
+	}, emit)
+	if kept := count(p, "x", 101); kept != 11 {
+		t.Errorf("kept %d records, want 1 + 10 sampled", kept)
+	}
+	p.flush()
+	if len(emit.msgs) != 1 || emit.to[0] != "" {
+		t.Fatalf("expected 1 summary to all writers, got %d %v", len(emit.msgs), emit.to)
+	}
+	if v := string(emit.msgs[0].Value); !strings.Contains(v, `"sampled":10`) || !strings.Contains(v, `"suppressed":90`) {
+		t.Errorf("unexpected summary: %s", v)
+	}
+}
+
+func TestRateLimiter_Overflow(t *testing.T) {
+	emit := &emitRecorder{}
+	p, _ := buildRateLimit(t, map[string]interface{}{
+		"keyBy":      []interface{}{"@topic"},
+		"rate":       1,
+		"action":     "overflow",
+		"overflowTo": "overflow",
+	}, emit)
+	msg := &message.Message{Value: []byte("x"), Topic: "t"}
+	if !p.Process(msg) || p.Process(msg) {
+		t.Fatal("expected the second record to be over the limit")
+	}
+	if len(emit.msgs) != 1 || emit.to[0] != "overflow" || emit.msgs[0] != msg {
+		t.Errorf("expected record to be sent to the overflow writer, got %v", emit.to)
+	}
+}
+
+func TestNewRateLimitBuilder_Invalid(t *testing.T) {
+	_, err := NewBuilder("ratelimit", map[string]interface{}{
+		"burst":     -1,
+		"overrides": []interface{}{map[string]interface{}{"key": "payment", "rate": 0}},
+		"action":    "overflow",
+	})
+	verrs, ok := err.(config.ValidationErrors)
+	if !ok {
+		t.Fatalf("expected ValidationErrors, got %v", err)
+	}
+	want := []string{"rate", "burst", "overrides[0].rate", "overflowTo"}
+	if len(verrs) != len(want) {
+		t.Fatalf("got %v, want paths %v", verrs, want)
+	}
+	for i, e := range verrs {
+		if e.Path != want[i] {
+			t.Errorf("problem %d path = %q, want %q", i, e.Path, want[i])
+		}
+	}
+}
+
+func TestRateLimitConfig_MixedCaseOverride(t *testing.T) {
+	fn := filepath.Join(t.TempDir(), "config.yaml")
+	content := `app:
+  readers:
+    - type: kafka
+  processors:
+    - type: ratelimit
+      keyBy: [service]
+      rate: 1
+      overrides:
+        - {key: "Payment", rate: 100}
+    - name: legacy
+      type: ratelimit
+      rate: 1
+      overrides:
+        Payment:
+          rate: 100
+  writers:
+    - type: stdout
+`
+	if err := os.WriteFile(fn, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	conf, err := config.GetConfig(fn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p, _ := buildRateLimit(t, conf.Processors[0].Options, &emitRecorder{})
+	if kept := count(p, `{"service":"Payment"}`, 10); kept != 10 {
+		t.Errorf("kept %d records, want the override burst 100 to apply", kept)
+	}
+	if kept := count(p, `{"service":"payment"}`, 10); kept != 1 {
+		t.Errorf("kept %d records, want the default burst 1", kept)
+	}
+	//map的key已经被转换为小写,不能再使用
+	if _, err := NewBuilder(conf.Processors[1].Type, conf.Processors[1].Options); err == nil {
+		t.Error("expected an error for overrides configured as a map")
+	}
+}
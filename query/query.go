@@ -0,0 +1,241 @@
+package query
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io"
+	"io/fs"
+	"log-collector/fileindex"
+	"log-collector/filter"
+	"log-collector/message"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// File FileWriter写出的一个文件,文件名为 <fileName>[-YYYY_MM_DD][-(n)].log,压缩后加上.gz
+type File struct {
+	Path       string
+	Date       time.Time //按时间切割时文件的日期(本地时间0点),零值表示没有按时间切割
+	Index      int       //按大小切割的序号,第一个文件为0
+	Compressed bool
+	Size       int64 //文件的大小,压缩后的文件为压缩后的大小
+	ModTime    time.Time
+}
+
+// Overlaps 文件中是否可能有[from, to)之间的日志,from或to为零值时表示不限制
+// 文件的最后修改时间是其中最后一条日志的上限,带日期的文件只有当天的日志
+func (f File) Overlaps(from, to time.Time) bool {
+	if !from.IsZero() && !f.ModTime.IsZero() && f.ModTime.Before(from) {
+		return false
+	}
+	if f.Date.IsZero() {
+		return true
+	}
+	if !from.IsZero() && !f.Date.AddDate(0, 0, 1).After(from) {
+		return false
+	}
+	if !to.IsZero() && !f.Date.Before(to) {
+		return false
+	}
+	return true
+}
+
+// namePattern 匹配name的文件名
+func namePattern(name string) *regexp.Regexp {
+	return regexp.MustCompile(`^` + regexp.QuoteMeta(name) + `(?:-(\d{4}_\d{2}_\d{2}))?(?:-\((\d+)\))?\.log(\.gz)?$`)
+}
+
+// ListFiles 查找dir(包括子目录)下name写出的所有文件,按写入的先后顺序排序
+func ListFiles(dir, name string) ([]File, error) {
+	re := namePattern(name)
+	var files []File
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+		match := re.FindStringSubmatch(d.Name())
+		if match == nil {
+			return nil
+		}
+		f := File{Path: path, Compressed: match[3] != ""}
+		if match[1] != "" {
+			if f.Date, err = time.ParseInLocation("2006_01_02", match[1], time.Local); err != nil {
+				return nil
+			}
+		}
+		if match[2] != "" {
+			f.Index, _ = strconv.Atoi(match[2])
+		}
+		if info, err := d.Info(); err == nil {
+			f.Size, f.ModTime = info.Size(), info.ModTime()
+		}
+		files = append(files, f)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.SliceStable(files, func(i, j int) bool {
+		a, b := files[i], files[j]
+		if !a.Date.Equal(b.Date) {
+			return a.Date.Before(b.Date)
+		}
+		if a.Index != b.Index {
+			return a.Index < b.Index
+		}
+		return a.Path < b.Path
+	})
+	return files, nil
+}
+
+// Options 查询的条件
+type Options struct {
+	Dir    string         //FileWriter的filePath
+	Name   string         //FileWriter的fileName
+	From   time.Time      //只查询这个时间之后(包括)的日志,零值表示不限制
+	To     time.Time      //只查询这个时间之前(不包括)的日志,零值表示不限制
+	Filter *filter.Filter //为nil时不过滤
+	Limit  int            //最多输出的日志条数,小于等于0为不限制
+}
+
+// Search 按时间范围跳过不需要的文件,把剩下的文件中满足条件的日志按顺序写入out,返回输出的日志条数
+// 日志的时间取自time、ts、timestamp或@timestamp字段,没有时间的日志(包括不是JSON的日志)只按文件的时间范围判断
+// 目录中有FileWriter写出的清单和索引时,用它们跳过不需要的文件和文件中不需要的段;
+// 索引中记录的是同样的时间(fileindex.RecordTime),没有时间的日志所在的段总是会被读取
+func Search(ctx context.Context, opts Options, out io.Writer) (int, error) {
+	files, err := ListFiles(opts.Dir, opts.Name)
+	if err != nil {
+		return 0, err
+	}
+	//清单读取失败时不使用清单
+	manifest, _ := fileindex.ReadManifest(opts.Dir, opts.Name)
+	n := 0
+	for _, f := range files {
+		if !f.Overlaps(opts.From, opts.To) {
+			continue
+		}
+		if manifest != nil && filepath.Dir(f.Path) == filepath.Clean(opts.Dir) {
+			if e, ok := manifest.Lookup(filepath.Base(f.Path)); ok && f.complete(e.Size) && !e.Overlaps(opts.From, opts.To) {
+				continue
+			}
+		}
+		if err := ctx.Err(); err != nil {
+			return n, err
+		}
+		count, err := searchFile(f, opts, opts.Limit-n, out)
+		n += count
+		if err != nil {
+			return n, fmt.Errorf("%s: %w", f.Path, err)
+		}
+		if opts.Limit > 0 && n >= opts.Limit {
+			break
+		}
+	}
+	return n, nil
+}
+
+// complete 文件在建立索引之后没有再写入,压缩后的文件不会再写入
+func (f File) complete(indexedSize int64) bool {
+	return f.Compressed || f.Size == indexedSize
+}
+
+// searchFile 在一个文件中查询,limit小于等于0为不限制
+func searchFile(f File, opts Options, limit int, out io.Writer) (int, error) {
+	file, err := os.Open(f.Path)
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+
+	var readers []io.Reader
+	switch idx, err := fileindex.Read(f.Path); {
+	case f.Compressed:
+		gz, err := gzip.NewReader(file)
+		if err != nil {
+			return 0, err
+		}
+		defer gz.Close()
+		readers = append(readers, gz)
+	case err == nil && idx.File == filepath.Base(f.Path) && idx.Size <= f.Size:
+		//只读取索引中时间范围匹配的段,以及建立索引之后追加的内容
+		for _, r := range idx.Ranges(opts.From, opts.To) {
+			length := r[1] - r[0]
+			if r[1] < 0 {
+				length = f.Size - r[0]
+			}
+			readers = append(readers, io.NewSectionReader(file, r[0], length))
+		}
+	default:
+		readers = append(readers, file)
+	}
+
+	n := 0
+	for _, r := range readers {
+		count, err := scan(r, f, opts, limit-n, out)
+		n += count
+		if err != nil || (limit > 0 && n >= limit) {
+			return n, err
+		}
+	}
+	return n, nil
+}
+
+// scan 按行读取r,把满足条件的日志写入out,limit小于等于0为不限制
+func scan(r io.Reader, f File, opts Options, limit int, out io.Writer) (int, error) {
+	br := bufio.NewReaderSize(r, 64*1024)
+	n := 0
+	for {
+		line, err := br.ReadBytes('\n')
+		if len(line) > 0 {
+			value := bytes.TrimRight(line, "\r\n")
+			m := &message.Message{Value: value, Source: f.Path, Timestamp: f.ModTime}
+			t, hasTime := fileindex.RecordTime(m)
+			if hasTime {
+				m.Timestamp = t
+			}
+			if len(value) > 0 && (!hasTime || inRange(t, opts.From, opts.To)) && opts.Filter.Match(m) {
+				if _, err := out.Write(append(value, '\n')); err != nil {
+					return n, err
+				}
+				n++
+				if limit > 0 && n >= limit {
+					return n, nil
+				}
+			}
+		}
+		if err == io.EOF {
+			return n, nil
+		}
+		if err != nil {
+			return n, err
+		}
+	}
+}
+
+// inRange t是否在[from, to)之间
+func inRange(t, from, to time.Time) bool {
+	return (from.IsZero() || !t.Before(from)) && (to.IsZero() || t.Before(to))
+}
+
+// ParseTime 解析命令行中的时间: RFC3339、"2006-01-02 15:04:05"或者"2006-01-02"(本地时间)
+func ParseTime(s string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339Nano, s); err == nil {
+		return t, nil
+	}
+	for _, layout := range []string{"2006-01-02 15:04:05", "2006-01-02T15:04:05", "2006-01-02"} {
+		if t, err := time.ParseInLocation(layout, s, time.Local); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid time %q, expected RFC3339, \"2006-01-02 15:04:05\" or \"2006-01-02\"", s)
+}
@@ -0,0 +1,200 @@
+package query
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"log-collector/fileindex"
+	"log-collector/filter"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func writeLog(t *testing.T, path string, lines []string, mtime time.Time) {
+	t.Helper()
+	data := []byte(strings.Join(lines, "\n") + "\n")
+	if strings.HasSuffix(path, ".gz") {
+		var buf bytes.Buffer
+		gz := gzip.NewWriter(&buf)
+		gz.Write(data)
+		gz.Close()
+		data = buf.Bytes()
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(path, mtime, mtime); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestListFiles(t *testing.T) {
+	dir := t.TempDir()
+	day1 := time.Date(2024, 1, 1, 0, 0, 0, 0, time.Local)
+	for _, name := range []string{
+		"app-2024_01_02-(2).log", "app-2024_01_02-(10).log.gz", "app-2024_01_01.log",
+		"app-2024_01_02.log", "archive/app-2024_01_02-(1).log.gz",
+		"app-error.log", "myapp.log", "app.log.bak",
+	} {
+		writeLog(t, filepath.Join(dir, name), []string{"x"}, day1)
+	}
+	files, err := ListFiles(dir, "app")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, f := range files {
+		rel, _ := filepath.Rel(dir, f.Path)
+		got = append(got, filepath.ToSlash(rel))
+	}
+	want := []string{
+		"app-2024_01_01.log", "app-2024_01_02.log", "archive/app-2024_01_02-(1).log.gz",
+		"app-2024_01_02-(2).log", "app-2024_01_02-(10).log.gz",
+	}
+	if strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Errorf("ListFiles() = %v, want %v", got, want)
+	}
+	if !files[2].Compressed || files[2].Index != 1 || !files[2].Date.Equal(day1.AddDate(0, 0, 1)) {
+		t.Errorf("unexpected file %+v", files[2])
+	}
+}
+
+func TestFile_Overlaps(t *testing.T) {
+	day := time.Date(2024, 1, 2, 0, 0, 0, 0, time.Local)
+	dated := File{Date: day, ModTime: day.Add(23 * time.Hour)}
+	undated := File{ModTime: day.Add(12 * time.Hour)}
+	tests := []struct {
+		name     string
+		file     File
+		from, to time.Time
+		want     bool
+	}{
+		{"no range", dated, time.Time{}, time.Time{}, true},
+		{"day before", dated, time.Time{}, day, false},
+		{"day after", dated, day.AddDate(0, 0, 1), time.Time{}, false},
+		{"same day", dated, day.Add(time.Hour), day.Add(2 * time.Hour), true},
+		{"modified before from", undated, day.Add(13 * time.Hour), time.Time{}, false},
+		{"undated to", undated, time.Time{}, day.AddDate(0, 0, -10), true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.file.Overlaps(tt.from, tt.to); got != tt.want {
+				t.Errorf("Overlaps() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSearch(t *testing.T) {
+	dir := t.TempDir()
+	day1 := time.Date(2024, 1, 1, 0, 0, 0, 0, time.Local)
+	day2 := day1.AddDate(0, 0, 1)
+	writeLog(t, filepath.Join(dir, "app-2024_01_01.log"), []string{
+		`{"time":"` + day1.Add(time.Hour).Format(time.RFC3339) + `","level":"error","msg":"a"}`,
+	}, day1.Add(2*time.Hour))
+	writeLog(t, filepath.Join(dir, "app-2024_01_02.log.gz"), []string{
+		`{"time":"` + day2.Add(time.Hour).Format(time.RFC3339) + `","level":"info","msg":"b"}`,
+		`{"time":"` + day2.Add(2*time.Hour).Format(time.RFC3339) + `","level":"error","msg":"c"}`,
+		`not json`,
+	}, day2.Add(3*time.Hour))
+	writeLog(t, filepath.Join(dir, "app-2024_01_02-(1).log"), []string{
+		`{"ts":` + strconv.FormatInt(day2.Add(3*time.Hour).Unix(), 10) + `,"level":"error","msg":"d"}`,
+		`{"time":"` + day2.Add(5*time.Hour).Format(time.RFC3339) + `","level":"error","msg":"e"}`,
+	}, day2.Add(6*time.Hour))
+
+	f, err := filter.Parse(`level == "error"`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	search := func(opts Options) string {
+		t.Helper()
+		opts.Dir, opts.Name = dir, "app"
+		var out bytes.Buffer
+		n, err := Search(context.Background(), opts, &out)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if n != strings.Count(out.String(), "\n") {
+			t.Errorf("Search() = %d, but wrote %q", n, out.String())
+		}
+		var msgs []string
+		for _, line := range strings.Split(strings.TrimSpace(out.String()), "\n") {
+			if i := strings.Index(line, `"msg":"`); i >= 0 {
+				line = line[i+7 : i+8]
+			}
+			msgs = append(msgs, line)
+		}
+		return strings.Join(msgs, ",")
+	}
+
+	if got := search(Options{Filter: f}); got != "a,c,d,e" {
+		t.Errorf("filter: got %s", got)
+	}
+	if got := search(Options{From: day2, To: day2.Add(5 * time.Hour)}); got != "b,c,not json,d" {
+		t.Errorf("time range: got %s", got)
+	}
+	if got := search(Options{Filter: f, From: day2, Limit: 2}); got != "c,d" {
+		t.Errorf("limit: got %s", got)
+	}
+}
+
+func TestParseTime(t *testing.T) {
+	for _, s := range []string{"2024-01-02T03:04:05Z", "2024-01-02 03:04:05", "2024-01-02"} {
+		if _, err := ParseTime(s); err != nil {
+			t.Errorf("ParseTime(%q) error = %v", s, err)
+		}
+	}
+	if _, err := ParseTime("yesterday"); err == nil {
+		t.Error("expected an error")
+	}
+}
+
+func TestSearch_Index(t *testing.T) {
+	dir := t.TempDir()
+	base := time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC)
+	lines := []string{`{"msg":"a"}`, `{"msg":"b"}`, `{"msg":"c"}`, `{"msg":"d"}`}
+	path := filepath.Join(dir, "app.log")
+	writeLog(t, path, lines, base.Add(10*time.Hour))
+	// 每条日志12字节,每段一条,第i条的时间为base+i小时
+	idx := fileindex.New(path, 0)
+	for i := range lines[:3] {
+		idx.Add(int64(i)*12, 12, base.Add(time.Duration(i)*time.Hour), 12)
+	}
+	if err := idx.Write(path); err != nil {
+		t.Fatal(err)
+	}
+
+	var out bytes.Buffer
+	opts := Options{Dir: dir, Name: "app", From: base.Add(time.Hour), To: base.Add(90 * time.Minute)}
+	if _, err := Search(context.Background(), opts, &out); err != nil {
+		t.Fatal(err)
+	}
+	// 只读取第2条所在的段和索引之后追加的第4条
+	if got := out.String(); got != "{\"msg\":\"b\"}\n{\"msg\":\"d\"}\n" {
+		t.Errorf("got %q", got)
+	}
+
+	// 清单中文件的时间范围不匹配时跳过整个文件
+	idx.Add(36, 12, base.Add(3*time.Hour), 12)
+	m := &fileindex.Manifest{Version: fileindex.Version}
+	m.Update(idx)
+	if err := m.Write(dir, "app"); err != nil {
+		t.Fatal(err)
+	}
+	os.Remove(fileindex.Path(path))
+	out.Reset()
+	opts.From, opts.To = base.Add(5*time.Hour), time.Time{}
+	if _, err := Search(context.Background(), opts, &out); err != nil {
+		t.Fatal(err)
+	}
+	if got := out.String(); got != "" {
+		t.Errorf("got %q", got)
+	}
+}
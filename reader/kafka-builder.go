@@ -1,12 +1,51 @@
 package reader
 
-import "fmt"
+import (
+	"fmt"
+	"log-collector/config"
+	"log-collector/internal/kafkaauth"
+)
 
 const GROUPID = "appLog"
 
+// KafkaConfig 配置文件中kafka reader的配置
+type KafkaConfig struct {
+	BrokersAddr []string           `yaml:"brokersAddr"` //broker的地址
+	Topic       string             `yaml:"topic"`       //topic
+	GroupID     string             `yaml:"groupId"`     //消费者组,默认为appLog
+	TLS         bool               `yaml:"tls"`         //是否使用TLS连接broker
+	SASL        *config.SASLConfig `yaml:"sasl"`        //SASL认证
+}
+
+func init() {
+	Register("kafka", newKafkaBuilder)
+}
+
+// newKafkaBuilder 解析并检查kafka reader的配置
+func newKafkaBuilder(options map[string]interface{}) (Builder, error) {
+	var conf KafkaConfig
+	if err := config.Decode(options, &conf); err != nil {
+		return nil, err
+	}
+	var errs config.ValidationErrors
+	config.ValidateKafka(&errs, conf.BrokersAddr, conf.Topic, conf.SASL)
+	if len(errs) > 0 {
+		return nil, errs
+	}
+	b := NewKafkaReaderBuilder(conf.BrokersAddr, conf.Topic).WithTLS(conf.TLS).WithGroupID(conf.GroupID)
+	if conf.SASL != nil {
+		b.WithSASL(conf.SASL.User, conf.SASL.Password)
+	}
+	return b, nil
+}
+
 type KafkaReaderBuilder struct {
-	BrokersAddr []string
-	Topic       string
+	BrokersAddr  []string
+	Topic        string
+	GroupID      string //消费者组,为空时为GROUPID
+	TLS          bool   //是否使用TLS连接broker
+	SASLUser     string //SASL/PLAIN认证的用户名,为空时不认证
+	SASLPassword string
 }
 
 func NewKafkaReaderBuilder(addr []string, topic string) *KafkaReaderBuilder {
@@ -16,8 +55,32 @@ func NewKafkaReaderBuilder(addr []string, topic string) *KafkaReaderBuilder {
 	}
 }
 
+// WithGroupID 设置消费者组,同一个集群上消费同一个topic的多个reader需要使用不同的消费者组
+func (k *KafkaReaderBuilder) WithGroupID(groupID string) *KafkaReaderBuilder {
+	k.GroupID = groupID
+	return k
+}
+
+// WithTLS 设置是否使用TLS连接broker
+func (k *KafkaReaderBuilder) WithTLS(enable bool) *KafkaReaderBuilder {
+	k.TLS = enable
+	return k
+}
+
+// WithSASL 使用SASL/PLAIN认证
+func (k *KafkaReaderBuilder) WithSASL(user, password string) *KafkaReaderBuilder {
+	k.SASLUser = user
+	k.SASLPassword = password
+	return k
+}
+
 func (k *KafkaReaderBuilder) Build() (Reader, error) {
-	r, err := newKafkaReader(k.BrokersAddr, k.Topic, GROUPID)
+	auth := kafkaauth.Auth{TLS: k.TLS, User: k.SASLUser, Password: k.SASLPassword}
+	groupID := k.GroupID
+	if groupID == "" {
+		groupID = GROUPID
+	}
+	r, err := newKafkaReader(k.BrokersAddr, k.Topic, groupID, auth)
 	if err != nil {
 		return nil, fmt.Errorf("error creating Kafka %w", err)
 	}
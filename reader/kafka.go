@@ -4,7 +4,10 @@ import (
 	"context"
 	"fmt"
 	"github.com/IBM/sarama"
-	"log"
+	"log-collector/internal/kafkaauth"
+	"log-collector/logging"
+	"log-collector/message"
+	"sync"
 )
 
 // KafkaReader 结构体
@@ -12,13 +15,17 @@ type KafkaReader struct {
 	consumerGroup sarama.ConsumerGroup
 	topic         string
 	groupID       string
+
+	pauseMutex sync.Mutex
+	paused     bool //为true时新分配到的分区也会被暂停
 }
 
 // newKafkaReader 初始化 KafkaReader
-func newKafkaReader(brokers []string, topic, groupID string) (*KafkaReader, error) {
+func newKafkaReader(brokers []string, topic, groupID string, auth kafkaauth.Auth) (*KafkaReader, error) {
 	config := sarama.NewConfig()
 	config.Consumer.Offsets.Initial = sarama.OffsetOldest
 	config.Consumer.Offsets.AutoCommit.Enable = true // 启用自动提交偏移量
+	auth.Apply(config)
 
 	// 创建消费者组
 	consumerGroup, err := sarama.NewConsumerGroup(brokers, groupID, config)
@@ -35,7 +42,8 @@ func newKafkaReader(brokers []string, topic, groupID string) (*KafkaReader, erro
 
 // Kafka 消费者处理器
 type messageHandler struct {
-	ch chan<- []byte
+	ch chan<- *message.Message
+	r  *KafkaReader
 }
 
 // Setup 初始化消费者
@@ -50,9 +58,29 @@ func (h *messageHandler) Cleanup(sess sarama.ConsumerGroupSession) error {
 
 // ConsumeClaim 消费消息
 func (h *messageHandler) ConsumeClaim(sess sarama.ConsumerGroupSession, claim sarama.ConsumerGroupClaim) error {
+	//暂停期间rebalance分配到的分区同样需要暂停
+	h.r.pauseMutex.Lock()
+	if h.r.paused {
+		h.r.consumerGroup.Pause(map[string][]int32{claim.Topic(): {claim.Partition()}})
+	}
+	h.r.pauseMutex.Unlock()
+	logger := logging.Component("reader", "topic", claim.Topic(), "partition", claim.Partition())
+	logger.Debug("partition claimed", "initialOffset", claim.InitialOffset())
+	defer logger.Debug("partition released")
 	for msg := range claim.Messages() {
-		// 处理消息
-		h.ch <- msg.Value
+		// 处理消息,reader停止时不再阻塞在通道上
+		select {
+		case h.ch <- &message.Message{
+			Value:     msg.Value,
+			Topic:     msg.Topic,
+			Partition: msg.Partition,
+			Offset:    msg.Offset,
+			Key:       msg.Key,
+			Timestamp: msg.Timestamp,
+		}:
+		case <-sess.Context().Done():
+			return nil
+		}
 		// 提交偏移量，表示消息已被消费
 		sess.MarkMessage(msg, "")
 	}
@@ -60,16 +88,16 @@ func (h *messageHandler) ConsumeClaim(sess sarama.ConsumerGroupSession, claim sa
 }
 
 // Read 从 Kafka 中读取消息
-func (k *KafkaReader) Read(ctx context.Context, ch chan<- []byte) error {
-	handler := &messageHandler{ch: ch}
+func (k *KafkaReader) Read(ctx context.Context, ch chan<- *message.Message) error {
+	handler := &messageHandler{ch: ch, r: k}
 
 	// 启动消费者组
 	for {
 		// 这里传递的参数包括消费者组的上下文（以便控制退出）、消费者组 ID 和消费的 topic
 		err := k.consumerGroup.Consume(ctx, []string{k.topic}, handler)
 		if err != nil {
-			// 发生错误时打印日志并返回
-			log.Printf("Error consuming messages: %v", err)
+			// 发生错误时打印日志,ctx没有结束时重新加入消费者组
+			logging.Component("reader", "topic", k.topic, "group", k.groupID).Error("consume messages failed", "error", err)
 		}
 
 		// 检查是否已收到停止信号（退出条件）
@@ -78,3 +106,24 @@ func (k *KafkaReader) Read(ctx context.Context, ch chan<- []byte) error {
 		}
 	}
 }
+
+// Pause 暂停消费所有分配到的分区,仍然留在消费者组中
+func (k *KafkaReader) Pause() {
+	k.pauseMutex.Lock()
+	defer k.pauseMutex.Unlock()
+	k.paused = true
+	k.consumerGroup.PauseAll()
+}
+
+// Resume 恢复消费所有的分区
+func (k *KafkaReader) Resume() {
+	k.pauseMutex.Lock()
+	defer k.pauseMutex.Unlock()
+	k.paused = false
+	k.consumerGroup.ResumeAll()
+}
+
+// Close 关闭消费者组,离开消费者组后分区会重新分配给组内其他的消费者
+func (k *KafkaReader) Close() error {
+	return k.consumerGroup.Close()
+}
@@ -2,6 +2,7 @@ package reader
 
 import (
 	"context"
+	"log-collector/message"
 	"testing"
 )
 
@@ -11,7 +12,7 @@ func TestRead(t *testing.T) {
 	if err != nil {
 		t.Fatal(err)
 	}
-	var MsgCh = make(chan []byte, 10)
+	var MsgCh = make(chan *message.Message, 10)
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
@@ -21,7 +22,7 @@ func TestRead(t *testing.T) {
 			case <-ctx2.Done():
 				return
 			case msg := <-MsgCh:
-				t.Log(string(msg))
+				t.Log(string(msg.Value))
 			}
 		}
 	}(ctx)
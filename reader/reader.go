@@ -1,9 +1,19 @@
 package reader
 
-import "context"
+import (
+	"context"
+	"log-collector/message"
+)
 
+// Reader 读取日志并传入ch,日志中尽量带上元数据(例如kafka的topic、partition、offset)
 type Reader interface {
-	Read(ctx context.Context, ch chan<- []byte) error
+	Read(ctx context.Context, ch chan<- *message.Message) error
+}
+
+// Pauser 支持暂停的reader实现该接口,暂停期间不再读取新的日志,但不会离开消费者组(不会触发rebalance)
+type Pauser interface {
+	Pause()
+	Resume()
 }
 
 type Builder interface {
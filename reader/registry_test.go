@@ -0,0 +1,48 @@
+package reader
+
+import (
+	"errors"
+	"log-collector/config"
+	"testing"
+)
+
+func TestNewBuilder(t *testing.T) {
+	tests := []struct {
+		name      string
+		typ       string
+		options   map[string]interface{}
+		wantPaths []string
+	}{
+		{"kafka", "kafka", map[string]interface{}{"brokersaddr": "127.0.0.1:9092", "topic": "testlog", "groupid": "g1"}, nil},
+		{"unknown type", "mq", nil, []string{"type"}},
+		{"bad kafka", "kafka", map[string]interface{}{"brokersaddr": []interface{}{"localhost"}}, []string{"brokersAddr[0]", "topic"}},
+		{"unknown key", "kafka", map[string]interface{}{"topics": "testlog"}, []string{""}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b, err := NewBuilder(tt.typ, tt.options)
+			if len(tt.wantPaths) == 0 {
+				if err != nil {
+					t.Fatalf("NewBuilder() error = %v", err)
+				}
+				kb := b.(*KafkaReaderBuilder)
+				if len(kb.BrokersAddr) != 1 || kb.Topic != "testlog" || kb.GroupID != "g1" {
+					t.Errorf("unexpected builder %+v", kb)
+				}
+				return
+			}
+			var verrs config.ValidationErrors
+			if !errors.As(err, &verrs) {
+				t.Fatalf("expected ValidationErrors, got %v", err)
+			}
+			if len(verrs) != len(tt.wantPaths) {
+				t.Fatalf("expected %d problems, got %v", len(tt.wantPaths), verrs)
+			}
+			for i, want := range tt.wantPaths {
+				if verrs[i].Path != want {
+					t.Errorf("problem %d path = %s, want %s", i, verrs[i].Path, want)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,448 @@
+package spool
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"log-collector/logging"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+//基于磁盘分段文件的队列,用于在writer的目的地不可用时暂存日志
+
+var (
+	// ErrFull 队列已达到大小上限
+	ErrFull = errors.New("spool: queue is full")
+	// ErrClosed 队列已关闭
+	ErrClosed = errors.New("spool: queue is closed")
+)
+
+const (
+	headerSize         = 8 //长度(4字节) + crc32(4字节)
+	segmentExt         = ".seg"
+	cursorFileName     = "cursor"
+	defaultSegmentSize = 64 << 20
+)
+
+var crcTable = crc32.MakeTable(crc32.Castagnoli)
+
+// Options 队列的可选项
+type Options struct {
+	SegmentSize int64 //单个段文件的最大size(单位:字节),小于等于0时使用默认值64MB
+	MaxSize     int64 //队列总大小上限(单位:字节),小于等于0为不限制
+	Sync        bool  //每次写入后是否fsync
+}
+
+// position 队列中的一个位置
+type position struct {
+	id  uint64 //段文件id
+	off int64  //段文件内的偏移
+}
+
+// Queue 基于磁盘分段文件的FIFO队列
+// 每条记录都带有crc32校验,读游标持久化在cursor文件中,重启后从上次确认的位置继续读取
+// 只支持一个消费者: Peek取出记录,处理成功后调用Ack确认
+type Queue struct {
+	dir  string
+	opts Options
+
+	mutex     sync.Mutex
+	segments  []uint64         //现存的段文件id,升序
+	sizes     map[uint64]int64 //每个段文件的大小
+	total     int64            //所有段文件的大小之和
+	writeFile *os.File         //当前追加写入的段文件(总是最后一个段)
+	readFile  *os.File         //当前读取的段文件
+	readID    uint64           //readFile对应的段文件id
+	cursor    position         //已确认的读位置
+	pending   []position       //上次Peek返回的每条记录之后的位置
+	closed    bool
+	notify    chan struct{}
+}
+
+// Open 打开(或创建)dir目录下的队列
+func Open(dir string, opts Options) (*Queue, error) {
+	if opts.SegmentSize <= 0 {
+		opts.SegmentSize = defaultSegmentSize
+	}
+	if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+		return nil, fmt.Errorf("failed to create spool directory: %v", err)
+	}
+	q := &Queue{
+		dir:    dir,
+		opts:   opts,
+		sizes:  make(map[uint64]int64),
+		notify: make(chan struct{}, 1),
+	}
+	if err := q.load(); err != nil {
+		return nil, err
+	}
+	return q, nil
+}
+
+// load 扫描目录中的段文件和游标,恢复队列状态
+func (q *Queue) load() error {
+	entries, err := os.ReadDir(q.dir)
+	if err != nil {
+		return fmt.Errorf("failed to read spool directory: %v", err)
+	}
+	for _, e := range entries {
+		name := e.Name()
+		if e.IsDir() || !strings.HasSuffix(name, segmentExt) {
+			continue
+		}
+		id, err := strconv.ParseUint(strings.TrimSuffix(name, segmentExt), 10, 64)
+		if err != nil {
+			continue
+		}
+		info, err := e.Info()
+		if err != nil {
+			return fmt.Errorf("failed to stat segment %s: %v", name, err)
+		}
+		q.segments = append(q.segments, id)
+		q.sizes[id] = info.Size()
+	}
+	sort.Slice(q.segments, func(i, j int) bool { return q.segments[i] < q.segments[j] })
+
+	if len(q.segments) == 0 {
+		q.segments = []uint64{1}
+		q.sizes[1] = 0
+	}
+	q.cursor = position{id: q.segments[0]}
+	if c, ok := q.readCursor(); ok && c.id >= q.segments[0] {
+		if _, exists := q.sizes[c.id]; exists && c.off <= q.sizes[c.id] {
+			q.cursor = c
+		}
+	}
+	//游标之前的段已经被消费完,可能是上次退出前还没来得及删除
+	q.removeBefore(q.cursor.id)
+
+	last := q.lastID()
+	if err := q.recover(last); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(q.segmentPath(last), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0666)
+	if err != nil {
+		return fmt.Errorf("failed to open segment: %v", err)
+	}
+	q.writeFile = f
+	for _, id := range q.segments {
+		q.total += q.sizes[id]
+	}
+	return nil
+}
+
+// recover 检查最后一个段文件,截掉进程崩溃时写了一半的记录
+func (q *Queue) recover(id uint64) error {
+	f, err := os.OpenFile(q.segmentPath(id), os.O_CREATE|os.O_RDWR, 0666)
+	if err != nil {
+		return fmt.Errorf("failed to open segment: %v", err)
+	}
+	defer f.Close()
+
+	r := bufio.NewReader(f)
+	var off int64
+	for {
+		n, err := readRecord(r, nil)
+		if err != nil {
+			break
+		}
+		off += n
+	}
+	if off < q.sizes[id] {
+		logging.Component("spool", "dir", q.dir).Warn("truncating segment", "segment", id, "from", q.sizes[id], "to", off)
+		if err := f.Truncate(off); err != nil {
+			return fmt.Errorf("failed to truncate segment: %v", err)
+		}
+	}
+	q.sizes[id] = off
+	if q.cursor.id == id && q.cursor.off > off {
+		q.cursor.off = off
+	}
+	return nil
+}
+
+// Append 向队列末尾追加一条记录
+func (q *Queue) Append(data []byte) error {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	if q.closed {
+		return ErrClosed
+	}
+	size := int64(headerSize + len(data))
+	if q.opts.MaxSize > 0 && q.total+size > q.opts.MaxSize {
+		return ErrFull
+	}
+	last := q.lastID()
+	if q.sizes[last] > 0 && q.sizes[last]+size > q.opts.SegmentSize {
+		if err := q.rotate(); err != nil {
+			return err
+		}
+		last = q.lastID()
+	}
+
+	buf := make([]byte, size)
+	binary.BigEndian.PutUint32(buf[0:4], uint32(len(data)))
+	binary.BigEndian.PutUint32(buf[4:8], crc32.Checksum(data, crcTable))
+	copy(buf[headerSize:], data)
+	if _, err := q.writeFile.Write(buf); err != nil {
+		return fmt.Errorf("failed to write spool segment: %v", err)
+	}
+	if q.opts.Sync {
+		if err := q.writeFile.Sync(); err != nil {
+			return fmt.Errorf("failed to sync spool segment: %v", err)
+		}
+	}
+	q.sizes[last] += size
+	q.total += size
+
+	select {
+	case q.notify <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// rotate 关闭当前的段文件,开始写一个新的段
+func (q *Queue) rotate() error {
+	if err := q.writeFile.Close(); err != nil {
+		return fmt.Errorf("failed to close segment: %v", err)
+	}
+	id := q.lastID() + 1
+	f, err := os.OpenFile(q.segmentPath(id), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0666)
+	if err != nil {
+		return fmt.Errorf("failed to create segment: %v", err)
+	}
+	q.writeFile = f
+	q.segments = append(q.segments, id)
+	q.sizes[id] = 0
+	return nil
+}
+
+// Peek 从已确认的位置开始最多读取max条记录,不会移动游标
+// 再次调用Peek会从已确认的位置重新读取
+func (q *Queue) Peek(max int) ([][]byte, error) {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	if q.closed {
+		return nil, ErrClosed
+	}
+	q.pending = q.pending[:0]
+
+	var records [][]byte
+	pos := q.cursor
+	for len(records) < max {
+		if pos.off >= q.sizes[pos.id] {
+			next, ok := q.nextID(pos.id)
+			if !ok {
+				break
+			}
+			pos = position{id: next}
+			continue
+		}
+		data, n, err := q.readAt(pos)
+		if err != nil {
+			if errors.Is(err, errCorrupted) {
+				//记录损坏,跳过该段剩下的内容
+				logging.Component("spool", "dir", q.dir).Warn("corrupted record, skipping rest of segment", "segment", pos.id, "offset", pos.off)
+				pos.off = q.sizes[pos.id]
+				if len(records) == 0 {
+					q.cursor = pos
+				}
+				continue
+			}
+			return nil, err
+		}
+		pos.off += n
+		records = append(records, data)
+		q.pending = append(q.pending, pos)
+	}
+	return records, nil
+}
+
+// Ack 确认上次Peek返回的前n条记录已经处理完毕
+func (q *Queue) Ack(n int) error {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	if q.closed {
+		return ErrClosed
+	}
+	if n <= 0 {
+		return nil
+	}
+	if n > len(q.pending) {
+		return fmt.Errorf("spool: ack %d records, but only %d pending", n, len(q.pending))
+	}
+	pos := q.pending[n-1]
+	q.pending = q.pending[:0]
+	//游标如果在段的末尾,直接移动到下一个段,以便删除已经消费完的段
+	for pos.off >= q.sizes[pos.id] {
+		next, ok := q.nextID(pos.id)
+		if !ok {
+			break
+		}
+		pos = position{id: next}
+	}
+	q.cursor = pos
+	q.removeBefore(pos.id)
+	return q.writeCursor()
+}
+
+// Wait 返回一个在有新记录写入时可读的通道
+func (q *Queue) Wait() <-chan struct{} {
+	return q.notify
+}
+
+// Size 返回队列在磁盘上占用的字节数
+func (q *Queue) Size() int64 {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	return q.total
+}
+
+// Close 关闭队列,未确认的记录保留在磁盘上,下次Open时继续读取
+func (q *Queue) Close() error {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	if q.closed {
+		return nil
+	}
+	q.closed = true
+	if q.readFile != nil {
+		q.readFile.Close()
+		q.readFile = nil
+	}
+	err := q.writeCursor()
+	if cerr := q.writeFile.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+var errCorrupted = errors.New("spool: corrupted record")
+
+// readAt 读取pos处的一条记录,返回记录内容和占用的字节数
+func (q *Queue) readAt(pos position) ([]byte, int64, error) {
+	if q.readFile == nil || q.readID != pos.id {
+		if q.readFile != nil {
+			q.readFile.Close()
+			q.readFile = nil
+		}
+		f, err := os.Open(q.segmentPath(pos.id))
+		if err != nil {
+			return nil, 0, fmt.Errorf("failed to open segment: %v", err)
+		}
+		q.readFile = f
+		q.readID = pos.id
+	}
+	//只允许读到已经写完的位置
+	r := io.NewSectionReader(q.readFile, pos.off, q.sizes[pos.id]-pos.off)
+	var data []byte
+	n, err := readRecord(r, &data)
+	if err != nil {
+		return nil, 0, err
+	}
+	return data, n, nil
+}
+
+// readRecord 从r中读取一条记录并校验,data不为nil时返回记录内容
+func readRecord(r io.Reader, data *[]byte) (int64, error) {
+	var header [headerSize]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		return 0, errCorrupted
+	}
+	length := binary.BigEndian.Uint32(header[0:4])
+	sum := binary.BigEndian.Uint32(header[4:8])
+	buf := make([]byte, length)
+	if _, err := io.ReadFull(r, buf); err != nil {
+		return 0, errCorrupted
+	}
+	if crc32.Checksum(buf, crcTable) != sum {
+		return 0, errCorrupted
+	}
+	if data != nil {
+		*data = buf
+	}
+	return int64(headerSize) + int64(length), nil
+}
+
+// removeBefore 删除id之前的段文件
+func (q *Queue) removeBefore(id uint64) {
+	for len(q.segments) > 1 && q.segments[0] < id {
+		old := q.segments[0]
+		if q.readFile != nil && q.readID == old {
+			q.readFile.Close()
+			q.readFile = nil
+		}
+		if err := os.Remove(q.segmentPath(old)); err != nil && !os.IsNotExist(err) {
+			logging.Component("spool", "dir", q.dir).Error("remove segment failed", "segment", old, "error", err)
+		}
+		q.total -= q.sizes[old]
+		delete(q.sizes, old)
+		q.segments = q.segments[1:]
+	}
+}
+
+func (q *Queue) lastID() uint64 {
+	return q.segments[len(q.segments)-1]
+}
+
+func (q *Queue) nextID(id uint64) (uint64, bool) {
+	for _, s := range q.segments {
+		if s > id {
+			return s, true
+		}
+	}
+	return 0, false
+}
+
+func (q *Queue) segmentPath(id uint64) string {
+	return filepath.Join(q.dir, fmt.Sprintf("%020d%s", id, segmentExt))
+}
+
+// readCursor 读取持久化的游标
+func (q *Queue) readCursor() (position, bool) {
+	b, err := os.ReadFile(filepath.Join(q.dir, cursorFileName))
+	if err != nil || len(b) != 20 {
+		return position{}, false
+	}
+	if crc32.Checksum(b[:16], crcTable) != binary.BigEndian.Uint32(b[16:20]) {
+		return position{}, false
+	}
+	return position{
+		id:  binary.BigEndian.Uint64(b[0:8]),
+		off: int64(binary.BigEndian.Uint64(b[8:16])),
+	}, true
+}
+
+// writeCursor 持久化游标,先写临时文件再重命名,保证游标文件不会写坏
+func (q *Queue) writeCursor() error {
+	var b [20]byte
+	binary.BigEndian.PutUint64(b[0:8], q.cursor.id)
+	binary.BigEndian.PutUint64(b[8:16], uint64(q.cursor.off))
+	binary.BigEndian.PutUint32(b[16:20], crc32.Checksum(b[:16], crcTable))
+
+	tmp := filepath.Join(q.dir, cursorFileName+".tmp")
+	f, err := os.OpenFile(tmp, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0666)
+	if err != nil {
+		return fmt.Errorf("failed to write spool cursor: %v", err)
+	}
+	if _, err := f.Write(b[:]); err != nil {
+		f.Close()
+		return fmt.Errorf("failed to write spool cursor: %v", err)
+	}
+	if q.opts.Sync {
+		f.Sync()
+	}
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("failed to write spool cursor: %v", err)
+	}
+	return os.Rename(tmp, filepath.Join(q.dir, cursorFileName))
+}
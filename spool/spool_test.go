@@ -0,0 +1,169 @@
+package spool
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestQueue_AppendPeekAck(t *testing.T) {
+	q, err := Open(t.TempDir(), Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer q.Close()
+
+	for i := 0; i < 3; i++ {
+		if err := q.Append([]byte(fmt.Sprintf("msg%d", i))); err != nil {
+			t.Fatal(err)
+		}
+	}
+	records, err := q.Peek(2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 2 || string(records[0]) != "msg0" || string(records[1]) != "msg1" {
+		t.Fatalf("unexpected records: %q", records)
+	}
+	//没有Ack之前,再次Peek会得到同样的数据
+	records, _ = q.Peek(1)
+	if string(records[0]) != "msg0" {
+		t.Fatalf("expected msg0, got %q", records[0])
+	}
+	if err := q.Ack(1); err != nil {
+		t.Fatal(err)
+	}
+	records, _ = q.Peek(10)
+	if len(records) != 2 || string(records[0]) != "msg1" {
+		t.Fatalf("unexpected records after ack: %q", records)
+	}
+}
+
+func TestQueue_ReplayAfterReopen(t *testing.T) {
+	dir := t.TempDir()
+	q, err := Open(dir, Options{SegmentSize: 32})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 10; i++ {
+		if err := q.Append([]byte(fmt.Sprintf("message-%d", i))); err != nil {
+			t.Fatal(err)
+		}
+	}
+	records, _ := q.Peek(4)
+	if len(records) != 4 {
+		t.Fatalf("expected 4 records, got %d", len(records))
+	}
+	if err := q.Ack(4); err != nil {
+		t.Fatal(err)
+	}
+	if err := q.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	q, err = Open(dir, Options{SegmentSize: 32})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer q.Close()
+	records, err = q.Peek(100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 6 {
+		t.Fatalf("expected 6 records after reopen, got %d", len(records))
+	}
+	for i, r := range records {
+		if want := fmt.Sprintf("message-%d", i+4); string(r) != want {
+			t.Errorf("record %d = %q, want %q", i, r, want)
+		}
+	}
+}
+
+func TestQueue_SegmentsRemovedAfterAck(t *testing.T) {
+	dir := t.TempDir()
+	q, err := Open(dir, Options{SegmentSize: 20})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer q.Close()
+	for i := 0; i < 5; i++ {
+		q.Append([]byte("0123456789"))
+	}
+	records, _ := q.Peek(5)
+	q.Ack(len(records))
+
+	segs, _ := filepath.Glob(filepath.Join(dir, "*"+segmentExt))
+	if len(segs) != 1 {
+		t.Errorf("expected 1 segment left, got %d", len(segs))
+	}
+}
+
+func TestQueue_MaxSize(t *testing.T) {
+	q, err := Open(t.TempDir(), Options{MaxSize: 30})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer q.Close()
+	if err := q.Append([]byte("0123456789")); err != nil {
+		t.Fatal(err)
+	}
+	if err := q.Append([]byte("0123456789")); err != ErrFull {
+		t.Fatalf("expected ErrFull, got %v", err)
+	}
+}
+
+func TestQueue_TruncateTornWrite(t *testing.T) {
+	dir := t.TempDir()
+	q, err := Open(dir, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	q.Append([]byte("complete"))
+	q.Close()
+
+	//模拟进程崩溃时只写了一半的记录
+	seg := filepath.Join(dir, fmt.Sprintf("%020d%s", 1, segmentExt))
+	f, _ := os.OpenFile(seg, os.O_WRONLY|os.O_APPEND, 0666)
+	f.Write([]byte{0, 0, 0, 100, 1, 2})
+	f.Close()
+
+	q, err = Open(dir, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer q.Close()
+	q.Append([]byte("after"))
+	records, _ := q.Peek(10)
+	if len(records) != 2 || string(records[0]) != "complete" || string(records[1]) != "after" {
+		t.Fatalf("unexpected records: %q", records)
+	}
+}
+
+func TestQueue_SkipCorruptedSegment(t *testing.T) {
+	dir := t.TempDir()
+	q, err := Open(dir, Options{SegmentSize: 16})
+	if err != nil {
+		t.Fatal(err)
+	}
+	q.Append([]byte("first"))
+	q.Append([]byte("second"))
+	q.Close()
+
+	//破坏第一个段文件中的数据
+	seg := filepath.Join(dir, fmt.Sprintf("%020d%s", 1, segmentExt))
+	f, _ := os.OpenFile(seg, os.O_WRONLY, 0666)
+	f.WriteAt([]byte("XX"), headerSize)
+	f.Close()
+
+	q, err = Open(dir, Options{SegmentSize: 16})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer q.Close()
+	records, _ := q.Peek(10)
+	if len(records) != 1 || string(records[0]) != "second" {
+		t.Fatalf("unexpected records: %q", records)
+	}
+}
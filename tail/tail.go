@@ -0,0 +1,234 @@
+package tail
+
+import (
+	"bytes"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"log-collector/encoder"
+	"log-collector/filter"
+	"log-collector/logging"
+	"log-collector/message"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	defaultBufferSize   = 256
+	defaultMaxClients   = 16
+	heartbeatInterval   = 15 * time.Second
+	defaultWriteTimeout = 10 * time.Second
+)
+
+// Options Hub的参数
+type Options struct {
+	BufferSize int    //每个客户端最多缓存的日志条数,缓存满了说明客户端太慢,会被断开,小于等于0时为256
+	MaxClients int    //同时连接的客户端数量上限,小于等于0时为16
+	Token      string //不为空时客户端需要带上 Authorization: Bearer <token> 或者 ?token=<token>
+	//每次写入(包括flush)的超时时间,客户端不再读取时写入会一直阻塞,超时后断开该客户端,小于等于0时为10s
+	WriteTimeout time.Duration
+}
+
+// Hub 把collector分发的日志实时推送给正在tail的客户端(Server-Sent Events)
+// Publish不会阻塞,客户端跟不上时直接断开该客户端,不会拖慢collector
+type Hub struct {
+	opts    Options
+	mutex   sync.RWMutex
+	clients map[*client]struct{}
+	count   atomic.Int32
+}
+
+// client 一个正在tail的客户端
+type client struct {
+	filter   *filter.Filter
+	ch       chan *message.Message
+	dropped  chan struct{} //客户端太慢被断开时关闭
+	dropOnce sync.Once
+}
+
+func (c *client) drop() {
+	c.dropOnce.Do(func() { close(c.dropped) })
+}
+
+func NewHub(opts Options) *Hub {
+	if opts.BufferSize <= 0 {
+		opts.BufferSize = defaultBufferSize
+	}
+	if opts.MaxClients <= 0 {
+		opts.MaxClients = defaultMaxClients
+	}
+	if opts.WriteTimeout <= 0 {
+		opts.WriteTimeout = defaultWriteTimeout
+	}
+	return &Hub{opts: opts, clients: make(map[*client]struct{})}
+}
+
+// Publish 把日志推送给过滤条件匹配的客户端,没有客户端时几乎没有开销
+func (h *Hub) Publish(m *message.Message) {
+	if h.count.Load() == 0 {
+		return
+	}
+	h.mutex.RLock()
+	defer h.mutex.RUnlock()
+	for c := range h.clients {
+		if !c.filter.Match(m) {
+			continue
+		}
+		select {
+		case c.ch <- m:
+		default:
+			c.drop()
+		}
+	}
+}
+
+// subscribe 添加客户端,超过数量上限时返回false
+func (h *Hub) subscribe(f *filter.Filter) (*client, bool) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	if len(h.clients) >= h.opts.MaxClients {
+		return nil, false
+	}
+	c := &client{
+		filter:  f,
+		ch:      make(chan *message.Message, h.opts.BufferSize),
+		dropped: make(chan struct{}),
+	}
+	h.clients[c] = struct{}{}
+	h.count.Store(int32(len(h.clients)))
+	return c, true
+}
+
+func (h *Hub) unsubscribe(c *client) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	delete(h.clients, c)
+	h.count.Store(int32(len(h.clients)))
+}
+
+// ServeHTTP GET ?filter=<表达式>&format=raw|json|logfmt
+// 每条日志是一个事件,多行的日志分成多个data行;kafka的日志以 topic/partition/offset 作为事件的id;
+// 客户端太慢被断开前会收到一个dropped事件
+func (h *Hub) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !h.authorized(r) {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	var (
+		f   *filter.Filter
+		err error
+	)
+	if expr := r.URL.Query().Get("filter"); expr != "" {
+		if f, err = filter.Parse(expr); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+	format := encoder.Type(r.URL.Query().Get("format"))
+	if format == encoder.Template {
+		http.Error(w, "format template is not supported", http.StatusBadRequest)
+		return
+	}
+	enc, err := encoder.New(format, "")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if _, ok := w.(http.Flusher); !ok {
+		http.Error(w, "streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+	c, ok := h.subscribe(f)
+	if !ok {
+		http.Error(w, "too many tail clients", http.StatusServiceUnavailable)
+		return
+	}
+	defer h.unsubscribe(c)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.Header().Set("X-Accel-Buffering", "no") //nginx不要缓存
+	w.WriteHeader(http.StatusOK)
+
+	//客户端不再读取(例如卡住但是连接没有断开)时写入会一直阻塞,不会收到dropped,也不会释放名额
+	//每次写入前设置超时,超时后返回,断开该客户端
+	rc := http.NewResponseController(w)
+	send := func(data []byte) bool {
+		if err := rc.SetWriteDeadline(time.Now().Add(h.opts.WriteTimeout)); err != nil && !errors.Is(err, http.ErrNotSupported) {
+			return false
+		}
+		if _, err := w.Write(data); err != nil {
+			return false
+		}
+		return rc.Flush() == nil
+	}
+	if !send([]byte(": connected\n\n")) {
+		return
+	}
+
+	heartbeat := time.NewTicker(heartbeatInterval)
+	defer heartbeat.Stop()
+	var buf bytes.Buffer
+	for {
+		select {
+		case m := <-c.ch:
+			buf.Reset()
+			writeEvent(&buf, m, enc)
+			//把已经到达的日志一起写入,减少flush的次数
+			for n := len(c.ch); n > 0; n-- {
+				writeEvent(&buf, <-c.ch, enc)
+			}
+			if !send(buf.Bytes()) {
+				logging.Component("tail").Warn("write to tail client failed", "client", r.RemoteAddr)
+				return
+			}
+		case <-heartbeat.C:
+			if !send([]byte(": ping\n\n")) {
+				return
+			}
+		case <-c.dropped:
+			logging.Component("tail").Warn("dropping slow client", "client", r.RemoteAddr)
+			send([]byte("event: dropped\ndata: client too slow\n\n"))
+			return
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
+
+func (h *Hub) authorized(r *http.Request) bool {
+	if h.opts.Token == "" {
+		return true
+	}
+	token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if token == "" {
+		//浏览器的EventSource不能设置请求头
+		token = r.URL.Query().Get("token")
+	}
+	return subtle.ConstantTimeCompare([]byte(token), []byte(h.opts.Token)) == 1
+}
+
+// writeEvent 把一条日志写为一个SSE事件
+func writeEvent(buf *bytes.Buffer, m *message.Message, enc encoder.Encoder) {
+	data, err := enc.Encode(m)
+	if err != nil {
+		data = m.Value
+	}
+	if m.Topic != "" {
+		fmt.Fprintf(buf, "id: %s/%d/%d\n", m.Topic, m.Partition, m.Offset)
+	}
+	for _, line := range strings.Split(strings.TrimRight(string(data), "\r\n"), "\n") {
+		buf.WriteString("data: ")
+		buf.WriteString(strings.TrimRight(line, "\r"))
+		buf.WriteByte('\n')
+	}
+	buf.WriteByte('\n')
+}
@@ -0,0 +1,160 @@
+package tail
+
+import (
+	"bufio"
+	"fmt"
+	"log-collector/filter"
+	"log-collector/message"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// readEvent 读取一个SSE事件(到空行为止),跳过注释
+func readEvent(t *testing.T, r *bufio.Reader) []string {
+	t.Helper()
+	var lines []string
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			t.Fatalf("read event: %v", err)
+		}
+		line = strings.TrimRight(line, "\n")
+		if line == "" {
+			if len(lines) > 0 {
+				return lines
+			}
+			continue
+		}
+		if !strings.HasPrefix(line, ":") {
+			lines = append(lines, line)
+		}
+	}
+}
+
+// waitClients 等待客户端订阅完成
+func waitClients(t *testing.T, h *Hub, n int32) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for h.count.Load() != n {
+		if time.Now().After(deadline) {
+			t.Fatalf("expected %d clients, got %d", n, h.count.Load())
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestHub_Stream(t *testing.T) {
+	h := NewHub(Options{Token: "secret"})
+	srv := httptest.NewServer(h)
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL + "?filter=" + `level+%3D%3D+"error"`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("expected 401 without token, got %d", resp.StatusCode)
+	}
+	resp, err = http.Get(srv.URL + "?token=secret&filter=level+%3D%3D")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Fatalf("expected 400 for invalid filter, got %d", resp.StatusCode)
+	}
+
+	req, _ := http.NewRequest(http.MethodGet, srv.URL+"?filter="+`level+%3D%3D+"error"`, nil)
+	req.Header.Set("Authorization", "Bearer secret")
+	resp, err = http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if ct := resp.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Fatalf("unexpected content type %q", ct)
+	}
+	waitClients(t, h, 1)
+
+	h.Publish(&message.Message{Value: []byte(`{"level":"info","msg":"skip"}`)})
+	h.Publish(&message.Message{Value: []byte("{\"level\":\"error\",\n\"msg\":\"boom\"}"), Topic: "app", Partition: 1, Offset: 42})
+	got := readEvent(t, bufio.NewReader(resp.Body))
+	want := []string{"id: app/1/42", `data: {"level":"error",`, `data: "msg":"boom"}`}
+	if strings.Join(got, "|") != strings.Join(want, "|") {
+		t.Errorf("got event %q, want %q", got, want)
+	}
+}
+
+func TestHub_DropSlowClient(t *testing.T) {
+	h := NewHub(Options{BufferSize: 2, MaxClients: 1})
+	c, ok := h.subscribe(nil)
+	if !ok {
+		t.Fatal("subscribe failed")
+	}
+	if _, ok := h.subscribe(nil); ok {
+		t.Error("expected subscribe to fail when MaxClients is reached")
+	}
+	done := make(chan struct{})
+	go func() {
+		//客户端不读取,Publish也不能阻塞
+		for i := 0; i < 10; i++ {
+			h.Publish(&message.Message{Value: []byte("x")})
+		}
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Publish blocked on a slow client")
+	}
+	select {
+	case <-c.dropped:
+	default:
+		t.Error("expected the slow client to be dropped")
+	}
+	h.unsubscribe(c)
+	if h.count.Load() != 0 {
+		t.Errorf("expected no clients, got %d", h.count.Load())
+	}
+}
+
+func TestHub_WriteTimeout(t *testing.T) {
+	h := NewHub(Options{BufferSize: 1024, WriteTimeout: 100 * time.Millisecond})
+	srv := httptest.NewServer(h)
+	defer srv.Close()
+
+	//客户端连接后不再读取,也不断开
+	conn, err := net.Dial("tcp", srv.Listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	fmt.Fprintf(conn, "GET / HTTP/1.1\r\nHost: %s\r\n\r\n", srv.Listener.Addr())
+	waitClients(t, h, 1)
+
+	//足够填满连接的缓冲区,写入会阻塞,超时后断开该客户端并释放名额
+	value := []byte(strings.Repeat("x", 1<<20))
+	for i := 0; i < 64; i++ {
+		h.Publish(&message.Message{Value: value})
+	}
+	waitClients(t, h, 0)
+}
+
+func TestHub_Filter(t *testing.T) {
+	f, err := filter.Parse(`@topic == "payment"`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := NewHub(Options{})
+	c, _ := h.subscribe(f)
+	h.Publish(&message.Message{Value: []byte("a"), Topic: "orders"})
+	h.Publish(&message.Message{Value: []byte("b"), Topic: "payment"})
+	if len(c.ch) != 1 || string((<-c.ch).Value) != "b" {
+		t.Error("expected only the matching record to be delivered")
+	}
+}
@@ -0,0 +1,189 @@
+package writer
+
+import (
+	"fmt"
+	"log-collector/config"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// ClickHouseConfig 配置文件中clickhouse writer的配置
+type ClickHouseConfig struct {
+	URL      string             `yaml:"url"`      //HTTP接口的地址,例如 http://clickhouse:8123
+	Database string             `yaml:"database"` //默认default
+	Table    string             `yaml:"table"`    //
+	Columns  []ClickHouseColumn `yaml:"columns"`  //列和字段的映射,为空时日志本身就是一行
+	Settings map[string]string  `yaml:"settings"` //插入时的设置,例如 async_insert: "1"
+	Username string             `yaml:"username"` //
+	Password string             `yaml:"password"` //
+	Gzip     bool               `yaml:"gzip"`     //是否gzip压缩请求内容
+	Timeout  time.Duration      `yaml:"timeout"`  //请求的超时时间,默认30s
+	TLS      *TLSOptions        `yaml:"tls"`
+}
+
+// ClickHouseColumn 一个列的映射
+// 用列表而不是 列名: 字段名称 的map配置,因为读取配置时map的key会被转换为小写,列名是区分大小写的
+type ClickHouseColumn struct {
+	Column string `yaml:"column"` //列名,区分大小写
+	Field  string `yaml:"field"`  //字段名称,@开头的为元数据
+}
+
+func init() {
+	Register("clickhouse", newClickHouseBuilder)
+}
+
+// newClickHouseBuilder 解析并检查clickhouse writer的配置
+func newClickHouseBuilder(options map[string]interface{}) (Builder, error) {
+	if _, ok := options["columns"].(map[string]interface{}); ok {
+		return nil, config.ValidationErrors{{
+			Path:   "columns",
+			Reason: "must be a list of {column, field}, map keys lose their case when the config is loaded",
+		}}
+	}
+	var conf ClickHouseConfig
+	if err := config.Decode(options, &conf); err != nil {
+		return nil, err
+	}
+	var errs config.ValidationErrors
+	if u, err := url.Parse(conf.URL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		errs.Add("url", "%q is not a valid http(s) url", conf.URL)
+	}
+	if conf.Table == "" {
+		errs.Add("table", "table must not be empty")
+	}
+	columns := make(map[string]string, len(conf.Columns))
+	for i, c := range conf.Columns {
+		path := fmt.Sprintf("columns[%d]", i)
+		if c.Column == "" {
+			errs.Add(path+".column", "column name must not be empty")
+		} else if _, dup := columns[c.Column]; dup {
+			errs.Add(path+".column", "duplicate column %q", c.Column)
+		}
+		if c.Field == "" {
+			errs.Add(path+".field", "field name must not be empty")
+		}
+		columns[c.Column] = c.Field
+	}
+	if conf.Timeout < 0 {
+		errs.Add("timeout", "must not be negative")
+	}
+	if conf.TLS != nil {
+		conf.TLS.validate(&errs, "tls")
+	}
+	if len(errs) > 0 {
+		return nil, errs
+	}
+	b := NewClickHouseWriterBuilder(conf.URL, conf.Table).
+		WithDatabase(conf.Database).
+		WithColumns(columns).
+		WithSettings(conf.Settings).
+		WithAuth(conf.Username, conf.Password).
+		WithGzip(conf.Gzip).
+		WithTimeout(conf.Timeout)
+	if conf.TLS != nil {
+		b.WithTLS(*conf.TLS)
+	}
+	return b, nil
+}
+
+type ClickHouseWriterBuilder struct {
+	URL      string
+	Database string
+	Table    string
+	Columns  map[string]string
+	Settings map[string]string
+	Username string
+	Password string
+	Gzip     bool
+	Timeout  time.Duration
+	TLS      *TLSOptions
+}
+
+func NewClickHouseWriterBuilder(addr, table string) *ClickHouseWriterBuilder {
+	return &ClickHouseWriterBuilder{URL: addr, Table: table}
+}
+
+// WithDatabase 设置表所在的数据库,为空时为default
+func (c *ClickHouseWriterBuilder) WithDatabase(database string) *ClickHouseWriterBuilder {
+	c.Database = database
+	return c
+}
+
+// WithColumns 设置列名到字段名称的映射,为空时日志本身(JSON对象)就是一行
+func (c *ClickHouseWriterBuilder) WithColumns(columns map[string]string) *ClickHouseWriterBuilder {
+	c.Columns = columns
+	return c
+}
+
+// WithSettings 设置插入时的设置,默认使用 date_time_input_format=best_effort
+func (c *ClickHouseWriterBuilder) WithSettings(settings map[string]string) *ClickHouseWriterBuilder {
+	c.Settings = settings
+	return c
+}
+
+// WithAuth 设置用户名和密码,user为空时使用ClickHouse的默认用户
+func (c *ClickHouseWriterBuilder) WithAuth(user, password string) *ClickHouseWriterBuilder {
+	c.Username = user
+	c.Password = password
+	return c
+}
+
+// WithGzip 设置是否gzip压缩请求内容
+func (c *ClickHouseWriterBuilder) WithGzip(enable bool) *ClickHouseWriterBuilder {
+	c.Gzip = enable
+	return c
+}
+
+// WithTimeout 设置请求的超时时间,小于等于0时为30s
+func (c *ClickHouseWriterBuilder) WithTimeout(timeout time.Duration) *ClickHouseWriterBuilder {
+	c.Timeout = timeout
+	return c
+}
+
+// WithTLS 设置https连接的TLS配置
+func (c *ClickHouseWriterBuilder) WithTLS(opts TLSOptions) *ClickHouseWriterBuilder {
+	c.TLS = &opts
+	return c
+}
+
+func (c *ClickHouseWriterBuilder) Build() (Writer, error) {
+	if _, err := url.Parse(c.URL); err != nil {
+		return nil, fmt.Errorf("invalid clickhouse url: %w", err)
+	}
+	if c.Table == "" {
+		return nil, fmt.Errorf("clickhouse table must not be empty")
+	}
+	database := c.Database
+	if database == "" {
+		database = "default"
+	}
+	//RFC3339等格式的时间(例如@timestamp)也可以插入DateTime的列
+	settings := map[string]string{"date_time_input_format": "best_effort"}
+	for k, v := range c.Settings {
+		settings[k] = v
+	}
+	timeout := c.Timeout
+	if timeout <= 0 {
+		timeout = 30 * time.Second
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if c.TLS != nil {
+		tlsConf, err := c.TLS.build()
+		if err != nil {
+			return nil, err
+		}
+		transport.TLSClientConfig = tlsConf
+	}
+	return &ClickHouseWriter{
+		url:      c.URL,
+		database: database,
+		table:    c.Table,
+		columns:  c.Columns,
+		settings: settings,
+		username: c.Username,
+		password: c.Password,
+		gzip:     c.Gzip,
+		client:   &http.Client{Timeout: timeout, Transport: transport},
+	}, nil
+}
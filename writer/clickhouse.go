@@ -0,0 +1,469 @@
+package writer
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log-collector/message"
+	"math"
+	"math/big"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// clickhouseDataErrors 数据本身有问题的错误码,插入整批失败时会逐条插入找出有问题的日志
+var clickhouseDataErrors = map[int]bool{
+	6:   true, //CANNOT_PARSE_TEXT
+	26:  true, //CANNOT_PARSE_QUOTED_STRING
+	27:  true, //CANNOT_PARSE_INPUT_ASSERTION_FAILED
+	38:  true, //CANNOT_PARSE_DATE
+	41:  true, //CANNOT_PARSE_DATETIME
+	53:  true, //TYPE_MISMATCH
+	69:  true, //ARGUMENT_OUT_OF_BOUND
+	70:  true, //CANNOT_CONVERT_TYPE
+	72:  true, //CANNOT_PARSE_NUMBER
+	117: true, //INCORRECT_DATA
+	131: true, //TOO_LARGE_STRING_SIZE
+	321: true, //VALUE_IS_OUT_OF_RANGE_OF_DATA_TYPE
+	349: true, //CANNOT_INSERT_NULL_IN_ORDINARY_COLUMN
+	376: true, //CANNOT_PARSE_UUID
+	407: true, //DECIMAL_OVERFLOW
+}
+
+// clickhouseSchemaErrors 表结构或者配置有问题的错误码,重试不会成功,表结构需要重新读取
+var clickhouseSchemaErrors = map[int]bool{
+	16:  true, //NO_SUCH_COLUMN_IN_TABLE
+	60:  true, //UNKNOWN_TABLE
+	62:  true, //SYNTAX_ERROR
+	81:  true, //UNKNOWN_DATABASE
+	497: true, //ACCESS_DENIED
+	516: true, //AUTHENTICATION_FAILED
+}
+
+var clickhouseErrorCode = regexp.MustCompile(`Code: (\d+)`)
+
+// clickhouseError ClickHouse返回的错误,code为异常的错误码
+type clickhouseError struct {
+	*httpError
+	code int
+}
+
+// newClickHouseError 从X-ClickHouse-Exception-Code或者错误信息中解析错误码
+func newClickHouseError(resp *http.Response) *clickhouseError {
+	e := &clickhouseError{httpError: newHTTPError(resp)}
+	code := resp.Header.Get("X-ClickHouse-Exception-Code")
+	if code == "" {
+		if m := clickhouseErrorCode.FindStringSubmatch(e.body); m != nil {
+			code = m[1]
+		}
+	}
+	e.code, _ = strconv.Atoi(code)
+	return e
+}
+
+// Permanent 数据和表结构的错误重试也不会成功,其他错误按照HTTP状态码判断
+func (e *clickhouseError) Permanent() bool {
+	if clickhouseDataErrors[e.code] || clickhouseSchemaErrors[e.code] {
+		return true
+	}
+	return e.httpError.Permanent()
+}
+
+// ClickHouseWriter 通过HTTP接口把日志以JSONEachRow格式批量插入ClickHouse的表
+// columns把日志的字段(或者@开头的元数据)映射为表的列,没有配置时日志本身(必须是JSON对象)就是一行,表中没有的字段会被忽略;
+// 插入前按照表结构检查并转换每一行的值,不匹配的日志作为永久性错误通过BatchError返回,不影响同一批的其他日志,
+// ClickHouse仍然因为数据错误拒绝整批插入时,逐条插入找出有问题的日志
+type ClickHouseWriter struct {
+	url      string //ClickHouse HTTP接口的地址
+	database string
+	table    string
+	columns  map[string]string //列名 -> 字段名称
+	settings map[string]string //插入时的设置,例如 async_insert
+	username string
+	password string
+	gzip     bool
+	client   *http.Client
+
+	mutex  sync.Mutex
+	schema map[string]string //列名 -> 类型,第一次写入时从ClickHouse读取
+}
+
+func (c *ClickHouseWriter) Write(data []byte) error {
+	return c.WriteMessages([]*message.Message{message.New(data)})
+}
+
+func (c *ClickHouseWriter) WriteBatch(batch [][]byte) error {
+	msgs := make([]*message.Message, len(batch))
+	for i, data := range batch {
+		msgs[i] = message.New(data)
+	}
+	return c.WriteMessages(msgs)
+}
+
+// WriteMessages 在一个请求中插入整批日志,部分日志有问题时返回BatchError
+func (c *ClickHouseWriter) WriteMessages(msgs []*message.Message) error {
+	if len(msgs) == 0 {
+		return nil
+	}
+	schema, err := c.loadSchema()
+	if err != nil {
+		return err
+	}
+	for col := range c.columns {
+		if _, ok := schema[col]; !ok {
+			return Permanent(fmt.Errorf("clickhouse: column %q does not exist in table %s or is not insertable", col, c.qualifiedTable()))
+		}
+	}
+
+	var (
+		errs    = make(map[int]error)
+		rows    [][]byte
+		indexes []int //rows中每一行对应的日志在msgs中的下标
+	)
+	for i, m := range msgs {
+		row, err := c.row(m, schema)
+		if err != nil {
+			errs[i] = Permanent(err)
+			continue
+		}
+		rows = append(rows, row)
+		indexes = append(indexes, i)
+	}
+	if len(rows) > 0 {
+		if err := c.insert(rows); err != nil {
+			var ce *clickhouseError
+			if !errors.As(err, &ce) || !clickhouseDataErrors[ce.code] {
+				if len(errs) == 0 {
+					return err
+				}
+				for _, i := range indexes {
+					errs[i] = err
+				}
+				return &BatchError{Errors: errs}
+			}
+			//整批被拒绝,逐条插入找出有问题的日志
+			for j, row := range rows {
+				if err := c.insert([][]byte{row}); err != nil {
+					errs[indexes[j]] = err
+				}
+			}
+		}
+	}
+	if len(errs) > 0 {
+		return &BatchError{Errors: errs}
+	}
+	return nil
+}
+
+func (c *ClickHouseWriter) Close() error {
+	c.client.CloseIdleConnections()
+	return nil
+}
+
+// row 把日志转换为JSONEachRow的一行
+// 数字按json.Number解析,超过2^53的整数插入(U)Int64等列时不会被改变
+func (c *ClickHouseWriter) row(m *message.Message, schema map[string]string) ([]byte, error) {
+	values := make(map[string]interface{})
+	fields := message.DecodeFields(m.Value)
+	if len(c.columns) == 0 {
+		if fields == nil {
+			return nil, errors.New("clickhouse: record is not a JSON object")
+		}
+		for name, v := range fields {
+			if _, ok := schema[name]; ok {
+				values[name] = v
+			}
+		}
+	} else {
+		for col, field := range c.columns {
+			if !strings.HasPrefix(field, "@") && fields == nil {
+				return nil, errors.New("clickhouse: record is not a JSON object")
+			}
+			if v, ok := m.LookupIn(fields, field); ok {
+				values[col] = v
+			}
+		}
+	}
+	for col, v := range values {
+		converted, err := convertClickHouseValue(schema[col], v)
+		if err != nil {
+			return nil, fmt.Errorf("clickhouse: column %s %s: %w", col, schema[col], err)
+		}
+		values[col] = converted
+	}
+	return json.Marshal(values)
+}
+
+// loadSchema 读取表中可以插入的列和类型,结果会被缓存
+func (c *ClickHouseWriter) loadSchema() (map[string]string, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if c.schema != nil {
+		return c.schema, nil
+	}
+	resp, err := c.post(nil, []byte("DESCRIBE TABLE "+c.qualifiedTable()+" FORMAT JSONEachRow"))
+	if err != nil {
+		return nil, fmt.Errorf("clickhouse: describe table failed: %w", err)
+	}
+	defer drainBody(resp)
+	schema := make(map[string]string)
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(nil, 1<<20)
+	for scanner.Scan() {
+		var col struct {
+			Name        string `json:"name"`
+			Type        string `json:"type"`
+			DefaultType string `json:"default_type"`
+		}
+		if err := json.Unmarshal(scanner.Bytes(), &col); err != nil {
+			return nil, fmt.Errorf("clickhouse: invalid describe table response: %w", err)
+		}
+		//MATERIALIZED和ALIAS的列不能插入
+		if col.DefaultType != "MATERIALIZED" && col.DefaultType != "ALIAS" {
+			schema[col.Name] = col.Type
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("clickhouse: read describe table response failed: %w", err)
+	}
+	c.schema = schema
+	return schema, nil
+}
+
+// insert 插入多行
+func (c *ClickHouseWriter) insert(rows [][]byte) error {
+	params := url.Values{"query": {"INSERT INTO " + c.qualifiedTable() + " FORMAT JSONEachRow"}}
+	resp, err := c.post(params, append(bytes.Join(rows, []byte("\n")), '\n'))
+	if err != nil {
+		var ce *clickhouseError
+		if errors.As(err, &ce) && clickhouseSchemaErrors[ce.code] {
+			//表结构可能已经改变,下次写入时重新读取
+			c.mutex.Lock()
+			c.schema = nil
+			c.mutex.Unlock()
+		}
+		return err
+	}
+	drainBody(resp)
+	return nil
+}
+
+// post 发送请求,params为查询参数(会加上settings),非2xx的响应返回clickhouseError
+func (c *ClickHouseWriter) post(params url.Values, body []byte) (*http.Response, error) {
+	u, err := url.Parse(c.url)
+	if err != nil {
+		return nil, Permanent(fmt.Errorf("clickhouse: %w", err))
+	}
+	q := u.Query()
+	for k, v := range c.settings {
+		q.Set(k, v)
+	}
+	for k, v := range params {
+		q[k] = v
+	}
+	u.RawQuery = q.Encode()
+
+	header := http.Header{"Content-Type": {"text/plain; charset=utf-8"}}
+	if c.gzip {
+		var buf bytes.Buffer
+		zw := gzip.NewWriter(&buf)
+		zw.Write(body)
+		if err := zw.Close(); err != nil {
+			return nil, Permanent(fmt.Errorf("clickhouse: gzip failed: %w", err))
+		}
+		body = buf.Bytes()
+		header.Set("Content-Encoding", "gzip")
+	}
+	req, err := http.NewRequest(http.MethodPost, u.String(), bytes.NewReader(body))
+	if err != nil {
+		return nil, Permanent(fmt.Errorf("clickhouse: %w", err))
+	}
+	req.Header = header
+	if c.username != "" {
+		req.Header.Set("X-ClickHouse-User", c.username)
+		req.Header.Set("X-ClickHouse-Key", c.password)
+	}
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("clickhouse: request failed: %w", err)
+	}
+	if resp.StatusCode/100 != 2 {
+		defer drainBody(resp)
+		return nil, fmt.Errorf("clickhouse: %w", newClickHouseError(resp))
+	}
+	return resp, nil
+}
+
+func (c *ClickHouseWriter) qualifiedTable() string {
+	return quoteClickHouseIdent(c.database) + "." + quoteClickHouseIdent(c.table)
+}
+
+func quoteClickHouseIdent(name string) string {
+	return "`" + strings.NewReplacer(`\`, `\\`, "`", "\\`").Replace(name) + "`"
+}
+
+// unwrapClickHouseType 如果typ是 wrapper(X) 的形式,返回X
+func unwrapClickHouseType(typ, wrapper string) (string, bool) {
+	if strings.HasPrefix(typ, wrapper+"(") && strings.HasSuffix(typ, ")") {
+		return strings.TrimSpace(typ[len(wrapper)+1 : len(typ)-1]), true
+	}
+	return "", false
+}
+
+// convertClickHouseValue 检查v是否可以插入typ类型的列,并转换为ClickHouse能够解析的JSON值
+// 数字的字符串转换为数字,对象和数组插入String列时转换为JSON字符串,null插入非Nullable的列时使用列的默认值
+func convertClickHouseValue(typ string, v interface{}) (interface{}, error) {
+	if inner, ok := unwrapClickHouseType(typ, "LowCardinality"); ok {
+		return convertClickHouseValue(inner, v)
+	}
+	if inner, ok := unwrapClickHouseType(typ, "Nullable"); ok {
+		typ = inner
+	}
+	switch val := v.(type) {
+	case nil:
+		return nil, nil
+	case time.Time:
+		v = val.UTC().Format(time.RFC3339Nano)
+	case int32:
+		v = float64(val)
+	case int64:
+		v = json.Number(strconv.FormatInt(val, 10))
+	}
+
+	switch {
+	case strings.HasPrefix(typ, "Int") || strings.HasPrefix(typ, "UInt"):
+		return convertClickHouseInt(typ, v)
+	case strings.HasPrefix(typ, "Float") || strings.HasPrefix(typ, "Decimal"):
+		switch val := v.(type) {
+		case float64, json.Number:
+			return val, nil
+		case string:
+			if _, err := strconv.ParseFloat(strings.TrimSpace(val), 64); err == nil {
+				return json.Number(strings.TrimSpace(val)), nil
+			}
+		}
+		return nil, fmt.Errorf("expected a number, got %s", describeJSONValue(v))
+	case typ == "Bool":
+		switch val := v.(type) {
+		case bool:
+			return val, nil
+		case string:
+			if b, err := strconv.ParseBool(val); err == nil {
+				return b, nil
+			}
+		case float64:
+			if val == 0 || val == 1 {
+				return val == 1, nil
+			}
+		case json.Number:
+			if val == "0" || val == "1" {
+				return val == "1", nil
+			}
+		}
+		return nil, fmt.Errorf("expected a bool, got %s", describeJSONValue(v))
+	case strings.HasPrefix(typ, "String") || strings.HasPrefix(typ, "FixedString"):
+		return message.ToString(v), nil
+	case strings.HasPrefix(typ, "Date"), strings.HasPrefix(typ, "Enum"):
+		switch v.(type) {
+		case string, float64, json.Number:
+			return v, nil
+		}
+		return nil, fmt.Errorf("expected a string or number, got %s", describeJSONValue(v))
+	case typ == "UUID" || strings.HasPrefix(typ, "IPv"):
+		if s, ok := v.(string); ok {
+			return s, nil
+		}
+		return nil, fmt.Errorf("expected a string, got %s", describeJSONValue(v))
+	}
+	if inner, ok := unwrapClickHouseType(typ, "Array"); ok {
+		arr, ok := v.([]interface{})
+		if !ok {
+			return nil, fmt.Errorf("expected an array, got %s", describeJSONValue(v))
+		}
+		out := make([]interface{}, len(arr))
+		for i, elem := range arr {
+			converted, err := convertClickHouseValue(inner, elem)
+			if err != nil {
+				return nil, fmt.Errorf("element %d: %w", i, err)
+			}
+			out[i] = converted
+		}
+		return out, nil
+	}
+	//Map、Tuple、JSON等其他类型交给ClickHouse检查
+	return v, nil
+}
+
+// convertClickHouseInt 检查整数的范围,Int128等更大的类型只检查是否是整数
+func convertClickHouseInt(typ string, v interface{}) (interface{}, error) {
+	unsigned := strings.HasPrefix(typ, "UInt")
+	bits, err := strconv.Atoi(strings.TrimPrefix(strings.TrimPrefix(typ, "U"), "Int"))
+	if err != nil {
+		return v, nil
+	}
+	//带小数点或者指数的数字(例如1.0、1e3)按浮点数检查
+	if n, ok := v.(json.Number); ok && strings.ContainsAny(string(n), ".eE") {
+		f, err := n.Float64()
+		if err != nil {
+			return nil, fmt.Errorf("expected an integer, got %s", n)
+		}
+		v = f
+	}
+	var s string
+	switch val := v.(type) {
+	case float64:
+		if val != math.Trunc(val) || math.IsInf(val, 0) {
+			return nil, fmt.Errorf("expected an integer, got %v", val)
+		}
+		s = strconv.FormatFloat(val, 'f', -1, 64)
+	case json.Number:
+		s = string(val)
+	case string:
+		s = strings.TrimSpace(val)
+	default:
+		return nil, fmt.Errorf("expected an integer, got %s", describeJSONValue(v))
+	}
+	if bits > 64 {
+		if _, ok := new(big.Int).SetString(s, 10); !ok {
+			return nil, fmt.Errorf("expected an integer, got %q", s)
+		}
+		return json.Number(s), nil
+	}
+	if unsigned {
+		_, err = strconv.ParseUint(s, 10, bits)
+	} else {
+		_, err = strconv.ParseInt(s, 10, bits)
+	}
+	if err != nil {
+		var numErr *strconv.NumError
+		if errors.As(err, &numErr) && errors.Is(numErr.Err, strconv.ErrRange) {
+			return nil, fmt.Errorf("%s is out of range", s)
+		}
+		return nil, fmt.Errorf("expected an integer, got %q", s)
+	}
+	return json.Number(s), nil
+}
+
+// describeJSONValue 错误信息中值的描述
+func describeJSONValue(v interface{}) string {
+	switch val := v.(type) {
+	case string:
+		return strconv.Quote(val)
+	case map[string]interface{}:
+		return "an object"
+	case []interface{}:
+		return "an array"
+	case bool:
+		return strconv.FormatBool(val)
+	default:
+		return fmt.Sprint(val)
+	}
+}
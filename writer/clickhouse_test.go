@@ -0,0 +1,250 @@
+package writer
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"log-collector/config"
+	"log-collector/message"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// clickhouseServer 模拟ClickHouse的HTTP接口,status列为负数的行会导致整批插入失败
+type clickhouseServer struct {
+	*httptest.Server
+	mutex   sync.Mutex
+	inserts int
+	rows    []map[string]interface{}
+}
+
+func newClickHouseServer(t *testing.T) *clickhouseServer {
+	s := &clickhouseServer{}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.mutex.Lock()
+		defer s.mutex.Unlock()
+		if r.Header.Get("X-ClickHouse-User") != "writer" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		query := r.URL.Query().Get("query")
+		if query == "" {
+			b, _ := io.ReadAll(r.Body)
+			if !strings.HasPrefix(string(b), "DESCRIBE TABLE `logs`.`events`") {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			for _, col := range []string{
+				`{"name":"ts","type":"DateTime64(3)","default_type":""}`,
+				`{"name":"level","type":"LowCardinality(String)","default_type":""}`,
+				`{"name":"status","type":"Nullable(UInt16)","default_type":""}`,
+				`{"name":"attrs","type":"String","default_type":""}`,
+				`{"name":"topic","type":"String","default_type":""}`,
+				`{"name":"day","type":"Date","default_type":"MATERIALIZED"}`,
+			} {
+				io.WriteString(w, col+"\n")
+			}
+			return
+		}
+		if query != "INSERT INTO `logs`.`events` FORMAT JSONEachRow" || r.URL.Query().Get("date_time_input_format") != "best_effort" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		s.inserts++
+		var rows []map[string]interface{}
+		scanner := bufio.NewScanner(r.Body)
+		for scanner.Scan() {
+			var row map[string]interface{}
+			json.Unmarshal(scanner.Bytes(), &row)
+			if row["level"] == "reject" {
+				w.Header().Set("X-ClickHouse-Exception-Code", "27")
+				w.WriteHeader(http.StatusInternalServerError)
+				io.WriteString(w, "Code: 27. DB::Exception: Cannot parse input")
+				return
+			}
+			rows = append(rows, row)
+		}
+		s.rows = append(s.rows, rows...)
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
+
+func newTestClickHouseWriter(t *testing.T, srv *clickhouseServer) MessageWriter {
+	w, err := NewClickHouseWriterBuilder(srv.URL, "events").
+		WithDatabase("logs").
+		WithAuth("writer", "secret").
+		WithColumns(map[string]string{
+			"ts":     "@timestamp",
+			"topic":  "@topic",
+			"level":  "level",
+			"status": "http.status",
+			"attrs":  "attrs",
+		}).
+		Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { w.Close() })
+	return w.(MessageWriter)
+}
+
+func TestClickHouseWriter_ColumnMapping(t *testing.T) {
+	srv := newClickHouseServer(t)
+	w := newTestClickHouseWriter(t, srv)
+	ts := time.Date(2024, 3, 1, 10, 0, 0, 0, time.UTC)
+	msgs := []*message.Message{
+		{Value: []byte(`{"level":"info","http":{"status":"200"},"attrs":{"a":1}}`), Topic: "app", Timestamp: ts},
+		{Value: []byte(`{"level":"warn","http":{"status":"abc"}}`), Topic: "app", Timestamp: ts},
+		{Value: []byte(`not json`), Topic: "app", Timestamp: ts},
+		{Value: []byte(`{"level":"error","http":{"status":70000}}`), Topic: "app", Timestamp: ts},
+		{Value: []byte(`{"level":"debug","http":{"status":null}}`), Topic: "app", Timestamp: ts},
+	}
+	err := w.WriteMessages(msgs)
+	be, ok := err.(*BatchError)
+	if !ok {
+		t.Fatalf("expected BatchError, got %v", err)
+	}
+	if len(be.Errors) != 3 || be.Errors[1] == nil || be.Errors[2] == nil || be.Errors[3] == nil || !be.Permanent() {
+		t.Errorf("unexpected record errors: %v", be.Errors)
+	}
+	if srv.inserts != 1 || len(srv.rows) != 2 {
+		t.Fatalf("expected 1 insert with 2 rows, got %d inserts: %v", srv.inserts, srv.rows)
+	}
+	row := srv.rows[0]
+	if row["ts"] != "2024-03-01T10:00:00Z" || row["topic"] != "app" || row["status"] != float64(200) || row["attrs"] != `{"a":1}` {
+		t.Errorf("unexpected row %v", row)
+	}
+	if v, ok := srv.rows[1]["status"]; !ok || v != nil {
+		t.Errorf("expected null status, got %v", srv.rows[1])
+	}
+}
+
+func TestClickHouseWriter_FallbackPerRecord(t *testing.T) {
+	srv := newClickHouseServer(t)
+	w := newTestClickHouseWriter(t, srv)
+	msgs := []*message.Message{
+		message.New([]byte(`{"level":"info"}`)),
+		message.New([]byte(`{"level":"reject"}`)),
+		message.New([]byte(`{"level":"warn"}`)),
+	}
+	err := w.WriteMessages(msgs)
+	be, ok := err.(*BatchError)
+	if !ok || len(be.Errors) != 1 || !IsPermanent(be.Errors[1]) {
+		t.Fatalf("expected permanent error for record 1, got %v", err)
+	}
+	if len(srv.rows) != 2 || srv.rows[0]["level"] != "info" || srv.rows[1]["level"] != "warn" {
+		t.Errorf("unexpected rows %v", srv.rows)
+	}
+}
+
+func TestConvertClickHouseValue(t *testing.T) {
+	tests := []struct {
+		typ     string
+		value   interface{}
+		want    string
+		wantErr bool
+	}{
+		{"Int8", float64(-128), "-128", false},
+		{"Int8", float64(128), "", true},
+		{"UInt32", "42", "42", false},
+		{"UInt32", float64(-1), "", true},
+		{"Int64", float64(1.5), "", true},
+		{"UInt64", json.Number("9007199254740993"), "9007199254740993", false},
+		{"Int32", json.Number("1e3"), "1000", false},
+		{"Int32", json.Number("1.5"), "", true},
+		{"Bool", json.Number("1"), "true", false},
+		{"Int256", "123456789012345678901234567890", "123456789012345678901234567890", false},
+		{"Float64", "1.5", "1.5", false},
+		{"Decimal(10, 2)", "abc", "", true},
+		{"Bool", "true", "true", false},
+		{"Bool", float64(2), "", true},
+		{"String", []interface{}{"a"}, `"[\"a\"]"`, false},
+		{"Array(Nullable(Int32))", []interface{}{float64(1), nil}, "[1,null]", false},
+		{"Array(String)", "a", "", true},
+		{"DateTime", map[string]interface{}{}, "", true},
+		{"UInt16", nil, "null", false},
+	}
+	for _, tt := range tests {
+		got, err := convertClickHouseValue(tt.typ, tt.value)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("convertClickHouseValue(%s, %v) error = %v, wantErr %v", tt.typ, tt.value, err, tt.wantErr)
+			continue
+		}
+		if err != nil {
+			continue
+		}
+		if b, _ := json.Marshal(got); string(b) != tt.want {
+			t.Errorf("convertClickHouseValue(%s, %v) = %s, want %s", tt.typ, tt.value, b, tt.want)
+		}
+	}
+}
+
+func TestClickHouseWriter_RowLargeInteger(t *testing.T) {
+	//2^53+1,解析为float64时会变成9007199254740992
+	m := message.New([]byte(`{"id":9007199254740993,"trace":{"id":18446744073709551615}}`))
+	for _, c := range []*ClickHouseWriter{{}, {columns: map[string]string{"id": "id", "trace_id": "trace.id"}}} {
+		row, err := c.row(m, map[string]string{"id": "Int64", "trace_id": "UInt64"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.Contains(string(row), `"id":9007199254740993`) {
+			t.Errorf("unexpected row %s", row)
+		}
+		if len(c.columns) > 0 && !strings.Contains(string(row), `"trace_id":18446744073709551615`) {
+			t.Errorf("unexpected row %s", row)
+		}
+	}
+}
+
+func TestClickHouseConfig_MixedCaseColumns(t *testing.T) {
+	fn := filepath.Join(t.TempDir(), "config.yaml")
+	content := `app:
+  readers:
+    - type: kafka
+  writers:
+    - type: clickhouse
+      url: "http://clickhouse:8123"
+      table: "events"
+      columns:
+        - {column: "userId", field: "@key"}
+        - {column: "HTTPStatus", field: "http.status"}
+    - name: legacy
+      type: clickhouse
+      url: "http://clickhouse:8123"
+      table: "events"
+      columns:
+        userId: "@key"
+`
+	if err := os.WriteFile(fn, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	conf, err := config.GetConfig(fn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := NewBuilder(conf.Writers[0].Type, conf.Writers[0].Options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w, err := b.Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+	want := map[string]string{"userId": "@key", "HTTPStatus": "http.status"}
+	if got := w.(*ClickHouseWriter).columns; !reflect.DeepEqual(got, want) {
+		t.Errorf("columns = %v, want %v", got, want)
+	}
+	//map的key已经被转换为小写,不能再使用
+	if _, err := NewBuilder(conf.Writers[1].Type, conf.Writers[1].Options); err == nil {
+		t.Error("expected an error for columns configured as a map")
+	}
+}
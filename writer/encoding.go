@@ -0,0 +1,105 @@
+package writer
+
+import (
+	"errors"
+	"fmt"
+	"log-collector/encoder"
+	"log-collector/message"
+)
+
+// EncodingWriter 写入前用Encoder把日志编码为目的地需要的格式,元数据保持不变
+// 放在被包装的writer外面、重试和磁盘队列里面,死信和磁盘队列中保存的仍然是原始的日志
+type EncodingWriter struct {
+	inner Writer
+	enc   encoder.Encoder
+}
+
+func NewEncodingWriter(inner Writer, enc encoder.Encoder) *EncodingWriter {
+	return &EncodingWriter{inner: inner, enc: enc}
+}
+
+func (e *EncodingWriter) Write(data []byte) error {
+	return e.WriteMessages([]*message.Message{message.New(data)})
+}
+
+func (e *EncodingWriter) WriteBatch(batch [][]byte) error {
+	msgs := make([]*message.Message, len(batch))
+	for i, data := range batch {
+		msgs[i] = message.New(data)
+	}
+	return e.WriteMessages(msgs)
+}
+
+// WriteMessages 编码失败的日志作为永久性错误通过BatchError返回,其他日志照常写入
+func (e *EncodingWriter) WriteMessages(msgs []*message.Message) error {
+	var (
+		errs    = make(map[int]error)
+		encoded = make([]*message.Message, 0, len(msgs))
+		indexes = make([]int, 0, len(msgs)) //encoded中每条日志在msgs中的下标
+	)
+	for i, m := range msgs {
+		value, err := e.enc.Encode(m)
+		if err != nil {
+			errs[i] = Permanent(fmt.Errorf("encode failed: %w", err))
+			continue
+		}
+		encoded = append(encoded, &message.Message{
+			Value:     value,
+			Source:    m.Source,
+			Topic:     m.Topic,
+			Partition: m.Partition,
+			Offset:    m.Offset,
+			Key:       m.Key,
+			Timestamp: m.Timestamp,
+		})
+		indexes = append(indexes, i)
+	}
+	if len(errs) == 0 {
+		return e.deliver(encoded)
+	}
+	if len(encoded) > 0 {
+		if err := e.deliver(encoded); err != nil {
+			//把inner返回的错误对应到msgs中的下标
+			var be *BatchError
+			if errors.As(err, &be) {
+				for i, ierr := range be.Errors {
+					errs[indexes[i]] = ierr
+				}
+			} else {
+				for _, i := range indexes {
+					errs[i] = err
+				}
+			}
+		}
+	}
+	return &BatchError{Errors: errs}
+}
+
+// deliver inner不支持批量写入时逐条写入,失败的日志通过BatchError返回,重试时不会重复写入已经成功的日志
+func (e *EncodingWriter) deliver(msgs []*message.Message) error {
+	if SupportsBatch(e.inner) {
+		return Deliver(e.inner, msgs)
+	}
+	errs := make(map[int]error)
+	for i, m := range msgs {
+		if err := e.inner.Write(m.Value); err != nil {
+			errs[i] = err
+		}
+	}
+	if len(errs) == 0 {
+		return nil
+	}
+	if len(msgs) == 1 {
+		return errs[0]
+	}
+	return &BatchError{Errors: errs}
+}
+
+// Unwrap 实现Wrapper,返回被包装的writer
+func (e *EncodingWriter) Unwrap() Writer {
+	return e.inner
+}
+
+func (e *EncodingWriter) Close() error {
+	return e.inner.Close()
+}
@@ -0,0 +1,44 @@
+package writer
+
+import (
+	"errors"
+	"log-collector/encoder"
+	"log-collector/message"
+	"testing"
+	"time"
+)
+
+// failOnWriter 写入内容等于fail的日志时返回错误
+type failOnWriter struct {
+	memWriter
+	fail string
+}
+
+func (f *failOnWriter) Write(data []byte) error {
+	if string(data) == f.fail {
+		return errors.New("write failed")
+	}
+	return f.memWriter.Write(data)
+}
+
+func TestEncodingWriter(t *testing.T) {
+	enc, err := encoder.New(encoder.Template, `{{.Topic}}: {{.Message}}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	inner := &failOnWriter{fail: "app: b\n"}
+	w := NewEncodingWriter(inner, enc)
+	msgs := []*message.Message{
+		{Value: []byte("a"), Topic: "app", Timestamp: time.Now()},
+		{Value: []byte("b"), Topic: "app", Timestamp: time.Now()},
+		{Value: []byte("c"), Topic: "app", Timestamp: time.Now()},
+	}
+	err = w.WriteMessages(msgs)
+	var be *BatchError
+	if !errors.As(err, &be) || len(be.Errors) != 1 || be.Errors[1] == nil {
+		t.Fatalf("expected BatchError for record 1, got %v", err)
+	}
+	if len(inner.records) != 2 || string(inner.records[0]) != "app: a\n" || string(inner.records[1]) != "app: c\n" {
+		t.Errorf("unexpected records %q", inner.records)
+	}
+}
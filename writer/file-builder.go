@@ -1,10 +1,106 @@
 package writer
 
+import (
+	"fmt"
+	"log-collector/config"
+	"os"
+	"time"
+)
+
+// FileConfig 配置文件中file writer的配置
+type FileConfig struct {
+	FilePath      string           `yaml:"filePath"`      //文件路径
+	FileName      string           `yaml:"fileName"`      //文件名称,默认app
+	MaxSize       int64            `yaml:"maxSize"`       //分割的最大size(单位:字节)
+	RotateByTime  bool             `yaml:"rotateByTime"`  //是否根据时间来进行切割
+	BufferSize    int              `yaml:"bufferSize"`    //写缓冲区大小(单位:字节),小于等于0为不使用缓冲区
+	FlushInterval time.Duration    `yaml:"flushInterval"` //缓冲区定时写入文件的间隔,默认1s
+	Sync          *FileSyncConfig  `yaml:"sync"`          //fsync的策略,默认从不主动fsync
+	Index         *FileIndexConfig `yaml:"index"`         //配置时给每个文件建立稀疏索引,query子命令可以直接跳到需要的位置
+}
+type FileSyncConfig struct {
+	Policy   string        `yaml:"policy"`   //interval|bytes|rotate|never
+	Interval time.Duration `yaml:"interval"` //policy为interval时fsync的间隔
+	Bytes    int64         `yaml:"bytes"`    //policy为bytes时每写入多少字节fsync一次
+}
+type FileIndexConfig struct {
+	SegmentSize int64         `yaml:"segmentSize"` //每隔多少字节记录一个索引项,默认1MB
+	Interval    time.Duration `yaml:"interval"`    //写入过程中每隔多久更新一次索引文件,默认10s,切割和关闭时也会更新
+}
+
+func init() {
+	Register("file", newFileBuilder)
+}
+
+// newFileBuilder 解析并检查file writer的配置
+func newFileBuilder(options map[string]interface{}) (Builder, error) {
+	var conf FileConfig
+	if err := config.Decode(options, &conf); err != nil {
+		return nil, err
+	}
+	var errs config.ValidationErrors
+	if conf.FilePath == "" {
+		errs.Add("filePath", "filePath must not be empty")
+	}
+	if conf.BufferSize < 0 {
+		errs.Add("bufferSize", "must not be negative")
+	}
+	if conf.FlushInterval < 0 {
+		errs.Add("flushInterval", "must not be negative")
+	}
+	if conf.Sync != nil {
+		switch SyncPolicy(conf.Sync.Policy) {
+		case "", SyncNever, SyncOnRotate, SyncInterval, SyncBytes:
+		default:
+			errs.Add("sync.policy", "unknown policy %q, expected one of interval, bytes, rotate, never", conf.Sync.Policy)
+		}
+		if conf.Sync.Interval < 0 {
+			errs.Add("sync.interval", "must not be negative")
+		}
+		if conf.Sync.Bytes < 0 {
+			errs.Add("sync.bytes", "must not be negative")
+		}
+	}
+	if conf.Index != nil {
+		if conf.Index.SegmentSize < 0 {
+			errs.Add("index.segmentSize", "must not be negative")
+		}
+		if conf.Index.Interval < 0 {
+			errs.Add("index.interval", "must not be negative")
+		}
+	}
+	if len(errs) > 0 {
+		return nil, errs
+	}
+	if conf.FileName == "" {
+		conf.FileName = "app"
+	}
+	b := NewFileWriterBuilder(conf.FilePath, conf.FileName, conf.MaxSize, conf.RotateByTime).
+		WithBuffer(conf.BufferSize, conf.FlushInterval)
+	if conf.Sync != nil {
+		b.WithSync(SyncPolicy(conf.Sync.Policy), conf.Sync.Interval, conf.Sync.Bytes)
+	}
+	if conf.Index != nil {
+		b.WithIndex(conf.Index.SegmentSize, conf.Index.Interval)
+	}
+	return b, nil
+}
+
 type FileWriterBuilder struct {
 	FilePath     string
 	FileName     string
 	MaxSize      int64
 	RotateByTime bool //是否根据时间来进行切割
+
+	BufferSize    int           //写缓冲区大小,小于等于0为不使用缓冲区
+	FlushInterval time.Duration //缓冲区定时写入文件的间隔
+	SyncPolicy    SyncPolicy    //fsync的策略
+	SyncInterval  time.Duration //SyncPolicy为SyncInterval时fsync的间隔
+	SyncBytes     int64         //SyncPolicy为SyncBytes时每写入多少字节fsync一次
+
+	Index            bool          //是否建立索引
+	IndexSegmentSize int64         //每隔多少字节记录一个索引项
+	IndexInterval    time.Duration //写入过程中更新索引文件的间隔
 }
 
 func NewFileWriterBuilder(filePath string, fileName string, maxSize int64, rotateByTime bool) *FileWriterBuilder {
@@ -15,11 +111,68 @@ func NewFileWriterBuilder(filePath string, fileName string, maxSize int64, rotat
 		RotateByTime: rotateByTime,
 	}
 }
+
+// WithBuffer 使用大小为size的写缓冲区,并每隔flushInterval写入文件(小于等于0时为1s)
+func (f *FileWriterBuilder) WithBuffer(size int, flushInterval time.Duration) *FileWriterBuilder {
+	f.BufferSize = size
+	f.FlushInterval = flushInterval
+	return f
+}
+
+// WithSync 设置fsync的策略,interval和bytes分别只对SyncInterval和SyncBytes生效
+func (f *FileWriterBuilder) WithSync(policy SyncPolicy, interval time.Duration, bytes int64) *FileWriterBuilder {
+	f.SyncPolicy = policy
+	f.SyncInterval = interval
+	f.SyncBytes = bytes
+	return f
+}
+
+// WithIndex 给每个文件建立稀疏索引(<文件名>.idx),并在目录中维护清单(<fileName>.manifest.json)
+// segmentSize和interval小于等于0时分别为1MB和10s
+func (f *FileWriterBuilder) WithIndex(segmentSize int64, interval time.Duration) *FileWriterBuilder {
+	f.Index = true
+	f.IndexSegmentSize = segmentSize
+	f.IndexInterval = interval
+	return f
+}
+
+// Build 创建FileWriter,FilePath不存在时会自动创建
 func (f *FileWriterBuilder) Build() (Writer, error) {
-	return &FileWriter{
+	if err := os.MkdirAll(f.FilePath, os.ModePerm); err != nil {
+		return nil, fmt.Errorf("failed to create directory: %v", err)
+	}
+	w := &FileWriter{
 		filePath:     f.FilePath,
 		filename:     f.FileName,
 		maxSize:      f.MaxSize,
 		rotateByTime: f.RotateByTime,
-	}, nil
+		bufferSize:   f.BufferSize,
+		syncPolicy:   f.SyncPolicy,
+		syncBytes:    f.SyncBytes,
+	}
+	if f.Index {
+		w.indexer = newFileIndexer(f.FilePath, f.FileName, f.IndexSegmentSize, f.IndexInterval)
+	}
+	interval := f.FlushInterval
+	if interval <= 0 {
+		interval = time.Second
+	}
+	switch f.SyncPolicy {
+	case "", SyncNever, SyncOnRotate:
+	case SyncInterval:
+		if f.SyncInterval > 0 {
+			interval = f.SyncInterval
+		}
+	case SyncBytes:
+		if w.syncBytes <= 0 {
+			w.syncBytes = 1 << 20
+		}
+	default:
+		return nil, fmt.Errorf("unknown sync policy: %q", f.SyncPolicy)
+	}
+	//有缓冲区时需要定时写入文件,SyncInterval需要定时fsync
+	if w.bufferSize > 0 || w.syncPolicy == SyncInterval {
+		w.startTicker(interval)
+	}
+	return w, nil
 }
@@ -0,0 +1,93 @@
+package writer
+
+import (
+	"log-collector/fileindex"
+	"log-collector/logging"
+	"log-collector/message"
+	"time"
+)
+
+const (
+	defaultIndexSegmentSize = 1 << 20
+	defaultIndexInterval    = 10 * time.Second
+)
+
+// fileIndexer 给FileWriter写出的文件建立稀疏索引(fileindex.Index),并维护目录中的清单(fileindex.Manifest)
+// 索引在切割文件、关闭以及每隔interval时写入磁盘,调用者需要持有FileWriter的锁
+type fileIndexer struct {
+	dir         string
+	name        string
+	segmentSize int64         //每一段的字节数
+	interval    time.Duration //写入索引的间隔
+
+	file     string //当前的日志文件
+	index    *fileindex.Index
+	manifest *fileindex.Manifest
+	lastSave time.Time
+}
+
+func newFileIndexer(dir, name string, segmentSize int64, interval time.Duration) *fileIndexer {
+	if segmentSize <= 0 {
+		segmentSize = defaultIndexSegmentSize
+	}
+	if interval <= 0 {
+		interval = defaultIndexInterval
+	}
+	return &fileIndexer{dir: dir, name: name, segmentSize: segmentSize, interval: interval}
+}
+
+// open 开始记录file的索引,size为文件已有的大小
+// 文件已有的内容和原来的索引一致时继续使用原来的索引,否则已有的内容作为不知道时间的段
+func (x *fileIndexer) open(file string, size int64) {
+	x.file = file
+	if idx, err := fileindex.Read(file); err == nil && idx.Size == size {
+		x.index = idx
+	} else {
+		x.index = fileindex.New(file, size)
+	}
+	x.lastSave = time.Now()
+}
+
+// add 记录一条日志,到了写入的间隔时把索引写入磁盘
+// 使用写入文件的内容中的时间,和query查询时过滤的时间一致;没有时间的日志记为不知道时间的段
+func (x *fileIndexer) add(offset, n int64, data []byte) {
+	if x.index == nil {
+		return
+	}
+	t, _ := fileindex.RecordTime(&message.Message{Value: data})
+	x.index.Add(offset, n, t, x.segmentSize)
+	if time.Since(x.lastSave) >= x.interval {
+		x.save()
+	}
+}
+
+// save 写入当前文件的索引并更新清单,失败时只打印日志,不影响日志的写入
+func (x *fileIndexer) save() {
+	if x.index == nil {
+		return
+	}
+	x.lastSave = time.Now()
+	if err := x.index.Write(x.file); err != nil {
+		logging.Component("writer", "file", x.file).Error("write index failed", "error", err)
+		return
+	}
+	if x.manifest == nil {
+		m, err := fileindex.ReadManifest(x.dir, x.name)
+		if err != nil {
+			logging.Component("writer", "dir", x.dir).Warn("read manifest failed, creating a new one", "error", err)
+			m = &fileindex.Manifest{Version: fileindex.Version}
+		}
+		x.manifest = m
+	}
+	x.manifest.Prune(x.dir)
+	x.manifest.Update(x.index)
+	if err := x.manifest.Write(x.dir, x.name); err != nil {
+		logging.Component("writer", "dir", x.dir).Error("write manifest failed", "error", err)
+	}
+}
+
+// close 写入当前文件的索引,切割文件和关闭时调用
+func (x *fileIndexer) close() {
+	x.save()
+	x.index = nil
+}
@@ -1,13 +1,27 @@
 package writer
 
 import (
+	"bufio"
 	"fmt"
+	"log-collector/logging"
+	"log-collector/message"
 	"os"
 	"path/filepath"
+	"strings"
 	"sync"
 	"time"
 )
 
+// SyncPolicy 什么时候调用fsync把数据刷到磁盘
+type SyncPolicy string
+
+const (
+	SyncNever    SyncPolicy = "never"    //从不主动fsync,交给操作系统
+	SyncInterval SyncPolicy = "interval" //每隔一段时间fsync一次
+	SyncBytes    SyncPolicy = "bytes"    //每写入一定字节数fsync一次
+	SyncOnRotate SyncPolicy = "rotate"   //只在切割文件(以及关闭)时fsync
+)
+
 // FileWriter 结构体，包含文件路径、大小限制和时间格式
 type FileWriter struct {
 	//文件后缀默认为.log
@@ -17,16 +31,83 @@ type FileWriter struct {
 	rotateByTime bool      //是否根据时间来进行切割
 	lastModified time.Time //上次修改的时间
 	lastFileName string    //上一次编辑的文件
+	lastBaseName string    //上一次编辑的文件在按大小切割之前的名称
 	currentFile  *os.File  // 当前打开的文件
+	size         int64     //当前文件的大小(包括缓冲区中还没写入的部分)
+
+	buffer     *bufio.Writer //写缓冲区,为nil时直接写文件
+	bufferSize int           //写缓冲区的大小,小于等于0为不使用缓冲区
+	syncPolicy SyncPolicy    //为空时等同于SyncNever
+	syncBytes  int64         //syncPolicy为SyncBytes时,每写入多少字节fsync一次
+	unsynced   int64         //上次fsync之后写入的字节数
+
+	indexer *fileIndexer //为nil时不建立索引
+
+	stop     chan struct{} //通知后台定时刷新的协程退出,为nil时没有后台协程
+	done     chan struct{}
+	stopOnce sync.Once //Close可能被并发或者重复调用,只停止一次
 
 	mutex sync.Mutex
 }
 
+// startTicker 启动后台协程,每隔interval把缓冲区刷到文件,syncPolicy为SyncInterval时同时fsync
+func (f *FileWriter) startTicker(interval time.Duration) {
+	f.stop = make(chan struct{})
+	f.done = make(chan struct{})
+	go func() {
+		defer close(f.done)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				f.mutex.Lock()
+				err := f.flushLocked(f.syncPolicy == SyncInterval)
+				f.mutex.Unlock()
+				if err != nil {
+					logging.Component("writer", "dir", f.filePath, "file", f.filename).Error("flush file failed", "error", err)
+				}
+			case <-f.stop:
+				return
+			}
+		}
+	}()
+}
+
+// Flush 把缓冲区中的数据写入文件,syncPolicy不为SyncNever时同时fsync
+func (f *FileWriter) Flush() error {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	return f.flushLocked(f.syncPolicy != "" && f.syncPolicy != SyncNever)
+}
+
+// Rotate 立即切割文件,之后的日志写入按大小切割的命名规则得到的新文件,例如 app-(1).log
+// 还没有写入过日志时不做任何事
+func (f *FileWriter) Rotate() error {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	if f.currentFile == nil {
+		return nil
+	}
+	//lastBaseName为当前文件在按大小切割之前的名称,新的文件和按大小切割的文件一起编号
+	return f.createFile(f.getRotateNameBySize(f.lastBaseName) + ".log")
+}
+
+// Close 停止后台刷新并关闭文件,可以重复调用
 func (f *FileWriter) Close() error {
+	//后台协程刷新时需要持有锁,不能在持有锁时等待它退出
+	f.stopOnce.Do(func() {
+		if f.stop != nil {
+			close(f.stop)
+			<-f.done
+		}
+	})
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
 	if f.currentFile == nil {
 		return nil
 	}
-	return f.currentFile.Close()
+	return f.closeFile()
 }
 
 // Write 将数据写入文件，支持时间和大小切割
@@ -35,13 +116,122 @@ func (f *FileWriter) Write(data []byte) error {
 	f.mutex.Lock()
 	defer f.mutex.Unlock()
 
+	if err := f.prepareFile(); err != nil {
+		return err
+	}
+	// 写入数据,保证每条日志以换行结尾
+	if len(data) == 0 || data[len(data)-1] != '\n' {
+		data = appendLine(make([]byte, 0, len(data)+1), data)
+	}
+	offset := f.size
+	if err := f.writeLocked(data); err != nil {
+		return err
+	}
+	if f.indexer != nil {
+		f.indexer.add(offset, int64(len(data)), data)
+	}
+	return nil
+}
+
+// WriteBatch 将一批数据合并后一次写入文件
+// 切割只在写入前判断一次,所以文件大小可能超出maxSize一个批次的大小
+func (f *FileWriter) WriteBatch(batch [][]byte) error {
+	return f.writeBatch(batch)
+}
+
+// WriteMessages 同WriteBatch
+func (f *FileWriter) WriteMessages(msgs []*message.Message) error {
+	return f.writeBatch(message.Values(msgs))
+}
+
+func (f *FileWriter) writeBatch(batch [][]byte) error {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	if err := f.prepareFile(); err != nil {
+		return err
+	}
+	var n int
+	for _, data := range batch {
+		n += len(data)
+	}
+	buf := make([]byte, 0, n+len(batch))
+	for _, data := range batch {
+		buf = appendLine(buf, data)
+	}
+	offset := f.size
+	if err := f.writeLocked(buf); err != nil {
+		return err
+	}
+	if f.indexer != nil {
+		for _, data := range batch {
+			//和appendLine一致,没有以换行结尾的日志多一个字节
+			size := int64(len(data))
+			if len(data) == 0 || data[len(data)-1] != '\n' {
+				size++
+			}
+			f.indexer.add(offset, size, data)
+			offset += size
+		}
+	}
+	return nil
+}
+
+// writeLocked 写入数据并记录文件大小,调用前需要持有锁
+func (f *FileWriter) writeLocked(data []byte) error {
+	var (
+		n   int
+		err error
+	)
+	if f.buffer != nil {
+		n, err = f.buffer.Write(data)
+	} else {
+		n, err = f.currentFile.Write(data)
+	}
+	f.size += int64(n)
+	f.unsynced += int64(n)
+	if err != nil {
+		return fmt.Errorf("failed to write data to file: %v", err)
+	}
+	if f.syncPolicy == SyncBytes && f.unsynced >= f.syncBytes {
+		return f.flushLocked(true)
+	}
+	return nil
+}
+
+// flushLocked 把缓冲区中的数据写入文件,sync为true时再fsync,调用前需要持有锁
+func (f *FileWriter) flushLocked(sync bool) error {
+	if f.currentFile == nil {
+		return nil
+	}
+	if f.buffer != nil {
+		if err := f.buffer.Flush(); err != nil {
+			return fmt.Errorf("failed to flush data to file: %v", err)
+		}
+	}
+	if sync && f.unsynced > 0 {
+		if err := f.currentFile.Sync(); err != nil {
+			return fmt.Errorf("failed to sync file: %v", err)
+		}
+		f.unsynced = 0
+	}
+	return nil
+}
+
+// prepareFile 根据时间和大小判断是否需要切割,并打开需要写入的文件
+func (f *FileWriter) prepareFile() error {
 	currentTime := time.Now()
-	newFileName := filepath.Join(f.filePath, f.filename)
+	baseName := filepath.Join(f.filePath, f.filename)
 	if f.rotateByTime && f.shouldRotateByTime(currentTime) {
-		newFileName = f.concat(newFileName, currentTime.Format("2006_01_02"))
+		baseName = f.concat(baseName, currentTime.Format("2006_01_02"))
 	}
-	if f.shouldRotateBySize() {
-		newFileName = f.getRotateNameBySize(newFileName)
+	newFileName := baseName
+	//基础文件名没有变化时,继续写上次的文件,超出大小再切割
+	if f.currentFile != nil && baseName == f.lastBaseName {
+		newFileName = strings.TrimSuffix(f.lastFileName, ".log")
+		if f.shouldRotateBySize() {
+			newFileName = f.getRotateNameBySize(baseName)
+		}
 	}
 	//如果currentFile是空指针，要创建文件
 	//如果这次创建的文件和上次创建的文件名不一样,也需要创建文件
@@ -52,11 +242,7 @@ func (f *FileWriter) Write(data []byte) error {
 			return err
 		}
 	}
-	// 写入数据
-	_, err := f.currentFile.Write(data)
-	if err != nil {
-		return fmt.Errorf("failed to write data to file: %v", err)
-	}
+	f.lastBaseName = baseName
 	return nil
 }
 
@@ -77,13 +263,8 @@ func (f *FileWriter) shouldRotateBySize() bool {
 	if f.currentFile == nil {
 		return false
 	}
-
-	// 获取当前文件的大小
-	fileInfo, err := f.currentFile.Stat()
-	if err != nil {
-		return false
-	}
-	return fileInfo.Size() > f.maxSize
+	//文件大小在写入时记录,不需要每次都Stat
+	return f.size > f.maxSize
 }
 
 // 为因为大小分割的文件命名
@@ -114,8 +295,9 @@ func (f *FileWriter) concat(oldname string, newpart string) string {
 func (f *FileWriter) createFile(fn string) error {
 	//如果需要创建新的文件,应该释放原来的文件句柄
 	if f.currentFile != nil {
-		f.currentFile.Close()
-		f.currentFile = nil
+		if err := f.closeFile(); err != nil {
+			return err
+		}
 	}
 
 	var err error
@@ -123,6 +305,38 @@ func (f *FileWriter) createFile(fn string) error {
 	if err != nil {
 		return fmt.Errorf("failed to create file: %v", err)
 	}
+	//只在打开文件时获取一次大小,之后由写入时记录
+	info, err := f.currentFile.Stat()
+	if err != nil {
+		f.currentFile.Close()
+		f.currentFile = nil
+		return fmt.Errorf("failed to stat file: %v", err)
+	}
+	f.size = info.Size()
+	f.unsynced = 0
+	if f.bufferSize > 0 {
+		if f.buffer == nil {
+			f.buffer = bufio.NewWriterSize(f.currentFile, f.bufferSize)
+		} else {
+			f.buffer.Reset(f.currentFile)
+		}
+	}
 	f.lastFileName = fn
+	if f.indexer != nil {
+		f.indexer.open(fn, f.size)
+	}
 	return nil
 }
+
+// closeFile 把缓冲区写入文件后关闭文件,除了SyncNever以外的策略在关闭前都会fsync
+func (f *FileWriter) closeFile() error {
+	err := f.flushLocked(f.syncPolicy != "" && f.syncPolicy != SyncNever)
+	if cerr := f.currentFile.Close(); err == nil && cerr != nil {
+		err = fmt.Errorf("failed to close file: %v", cerr)
+	}
+	f.currentFile = nil
+	if f.indexer != nil {
+		f.indexer.close()
+	}
+	return err
+}
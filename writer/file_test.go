@@ -2,7 +2,10 @@ package writer
 
 import (
 	"fmt"
+	"log-collector/fileindex"
+	"log-collector/message"
 	"os"
+	"sync"
 	"testing"
 	"time"
 )
@@ -55,65 +58,57 @@ func TestShouldRotateByTime(t *testing.T) {
 }
 func TestShouldRotateBySize(t *testing.T) {
 	// 创建一个临时文件
-	tempFile, err := os.CreateTemp("test", "test_file_")
+	tempFile, err := os.CreateTemp(t.TempDir(), "test_file_")
 	if err != nil {
 		t.Fatalf("Failed to create temp file: %v", err)
 	}
-	defer os.Remove(tempFile.Name()) // 确保测试结束后删除临时文件
+	defer tempFile.Close()
 
 	tests := []struct {
 		name        string
 		maxSize     int64
+		size        int64 // 写入时记录的文件大小
 		currentFile *os.File
 		expected    bool
-		setup       func() // 用于在测试中设置文件大小
 	}{
 		{
 			name:        "maxSize <= 0",
 			maxSize:     0,
+			size:        1000,
 			currentFile: tempFile,
 			expected:    false, // maxSize <= 0 不需要切割
 		},
 		{
 			name:        "no currentFile",
 			maxSize:     100,
+			size:        1000,
 			currentFile: nil,
 			expected:    false, // 没有文件时不需要切割
 		},
 		{
 			name:        "file size exceeds maxSize",
 			maxSize:     100,
+			size:        130,
 			currentFile: tempFile,
 			expected:    true, // 文件大小超出最大限制
-			setup: func() {
-				// 设置文件的大小超过 100 字节
-				tempFile.WriteString("This is a test content:sadhajdnaksjndkandckasnjkasncasnkdcnaskdnaksndkassndkjasndkjasndjkankjdnaskndkjasndkandknaskjdnaskndkasndkja")
-			},
 		},
 		{
 			name:        "file size does not exceed maxSize",
 			maxSize:     100,
+			size:        11,
 			currentFile: tempFile,
 			expected:    false, // 文件大小不超过最大限制
-			setup: func() {
-				// 设置文件的大小小于 100 字节
-				tempFile.WriteString("Small file.")
-			},
 		},
 	}
 
 	// Loop through the test cases
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			// 设置文件内容
-			if tt.setup != nil {
-				tt.setup()
-			}
-
 			// 创建 FileWriter 实例
 			fw := &FileWriter{
 				currentFile: tt.currentFile,
 				maxSize:     tt.maxSize,
+				size:        tt.size,
 			}
 
 			// 调用 shouldRotateBySize 函数并验证结果
@@ -345,3 +340,212 @@ func TestFileWriter_Write(t *testing.T) {
 		})
 	}
 }
+
+func TestFileWriter_WriteBatch(t *testing.T) {
+	dir := t.TempDir()
+	f := &FileWriter{
+		filePath: dir,
+		filename: "batch",
+	}
+	defer f.Close()
+	if err := f.WriteBatch([][]byte{[]byte("line1\n"), []byte("line2\n")}); err != nil {
+		t.Fatalf("WriteBatch() error = %v", err)
+	}
+	got, err := os.ReadFile(dir + "/batch.log")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != "line1\nline2\n" {
+		t.Errorf("unexpected file content: %q", got)
+	}
+}
+
+func TestFileWriter_RotateBySizeContinues(t *testing.T) {
+	dir := t.TempDir()
+	f := &FileWriter{
+		filePath: dir,
+		filename: "app",
+		maxSize:  10,
+	}
+	defer f.Close()
+	// 每条6字节,超过10字节后切割,切割后的文件继续写到超出大小为止
+	for i := 0; i < 6; i++ {
+		if err := f.Write([]byte("12345\n")); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for name, want := range map[string]string{
+		"app.log":     "12345\n12345\n",
+		"app-(1).log": "12345\n12345\n",
+		"app-(2).log": "12345\n12345\n",
+	} {
+		got, err := os.ReadFile(dir + "/" + name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(got) != want {
+			t.Errorf("%s = %q, want %q", name, got, want)
+		}
+	}
+}
+
+func TestFileWriter_Rotate(t *testing.T) {
+	dir := t.TempDir()
+	f := &FileWriter{
+		filePath: dir,
+		filename: "app",
+	}
+	defer f.Close()
+	// 还没有打开文件时不切割
+	if err := f.Rotate(); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.Write([]byte("before\n")); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.Rotate(); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.Write([]byte("after\n")); err != nil {
+		t.Fatal(err)
+	}
+	for name, want := range map[string]string{
+		"app.log":     "before\n",
+		"app-(1).log": "after\n",
+	} {
+		got, err := os.ReadFile(dir + "/" + name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(got) != want {
+			t.Errorf("%s = %q, want %q", name, got, want)
+		}
+	}
+}
+
+func TestFileWriter_Buffered(t *testing.T) {
+	tests := []struct {
+		name       string
+		syncPolicy SyncPolicy
+		syncBytes  int64
+		wantOnDisk string // 没有Flush时文件中的内容
+	}{
+		{"never", SyncNever, 0, ""},
+		{"rotate", SyncOnRotate, 0, ""},
+		{"bytes", SyncBytes, 8, "1234\n5678\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			w, err := NewFileWriterBuilder(dir, "buf", 0, false).
+				WithBuffer(4096, time.Hour).
+				WithSync(tt.syncPolicy, 0, tt.syncBytes).
+				Build()
+			if err != nil {
+				t.Fatal(err)
+			}
+			f := w.(*FileWriter)
+			f.Write([]byte("1234\n"))
+			f.Write([]byte("5678\n"))
+			if f.size != 10 {
+				t.Errorf("expected tracked size 10, got %d", f.size)
+			}
+			got, _ := os.ReadFile(dir + "/buf.log")
+			if string(got) != tt.wantOnDisk {
+				t.Errorf("before flush: got %q, want %q", got, tt.wantOnDisk)
+			}
+			if err := f.Close(); err != nil {
+				t.Fatal(err)
+			}
+			got, _ = os.ReadFile(dir + "/buf.log")
+			if string(got) != "1234\n5678\n" {
+				t.Errorf("after close: got %q", got)
+			}
+		})
+	}
+}
+
+func TestFileWriter_CloseTwice(t *testing.T) {
+	w, err := NewFileWriterBuilder(t.TempDir(), "app", 0, false).
+		WithBuffer(4096, time.Millisecond).
+		Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Write([]byte("1\n")); err != nil {
+		t.Fatal(err)
+	}
+	//并发和重复关闭都不会panic
+	var wg sync.WaitGroup
+	for i := 0; i < 2; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := w.Close(); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestFileWriterBuilder_UnknownSyncPolicy(t *testing.T) {
+	_, err := NewFileWriterBuilder(t.TempDir(), "app", 0, false).WithSync("sometimes", 0, 0).Build()
+	if err == nil {
+		t.Fatal("expected error for unknown sync policy")
+	}
+}
+
+func TestFileWriter_Index(t *testing.T) {
+	dir := t.TempDir()
+	w, err := NewFileWriterBuilder(dir, "app", 40, false).WithIndex(30, time.Hour).Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	f := w.(*FileWriter)
+	base := time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC)
+	// 每条18字节,每段30字节,超过40字节后切割
+	// 索引使用日志中的时间,而不是元数据中的时间(例如很晚才写入的kafka消息)
+	for i := 0; i < 4; i++ {
+		value := fmt.Sprintf(`{"ts":%d}`, base.Add(time.Duration(i)*time.Minute).Unix())
+		m := &message.Message{Value: []byte(value), Timestamp: base.Add(24 * time.Hour)}
+		if err := f.WriteMessages([]*message.Message{m}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := f.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	idx, err := fileindex.Read(dir + "/app.log")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if idx.Count != 3 || idx.Size != 54 || len(idx.Segments) != 2 || idx.Segments[1].Offset != 36 {
+		t.Errorf("unexpected index %+v", idx)
+	}
+	if !idx.MinTime.Equal(base) || !idx.MaxTime.Equal(base.Add(2*time.Minute)) {
+		t.Errorf("unexpected time bounds %v - %v", idx.MinTime, idx.MaxTime)
+	}
+	m, err := fileindex.ReadManifest(dir, "app")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(m.Files) != 2 || m.Files[0].File != "app.log" || m.Files[1].File != "app-(1).log" || m.Files[1].Count != 1 {
+		t.Errorf("unexpected manifest %+v", m.Files)
+	}
+
+	// 重新打开时继续使用原来的索引,没有时间的日志记为不知道时间的段
+	w, err = NewFileWriterBuilder(dir, "app", 0, false).WithIndex(30, time.Hour).Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.Write([]byte("67890"))
+	w.Close()
+	if idx, err = fileindex.Read(dir + "/app.log"); err != nil || idx.Count != 3 || idx.Size != 60 || len(idx.Segments) != 3 || !idx.Segments[2].MinTime.IsZero() {
+		t.Errorf("unexpected index after reopen %+v, %v", idx, err)
+	}
+}
@@ -0,0 +1,68 @@
+package writer
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// maxErrorBody 错误信息中最多保留的响应内容
+const maxErrorBody = 1024
+
+// httpError 目的地返回的非2xx响应
+type httpError struct {
+	status     int
+	body       string
+	retryAfter time.Duration
+}
+
+// newHTTPError 读取响应的状态码、部分内容和Retry-After
+func newHTTPError(resp *http.Response) *httpError {
+	b, _ := io.ReadAll(io.LimitReader(resp.Body, maxErrorBody))
+	return &httpError{
+		status:     resp.StatusCode,
+		body:       strings.TrimSpace(string(b)),
+		retryAfter: parseRetryAfter(resp.Header.Get("Retry-After")),
+	}
+}
+
+func (e *httpError) Error() string {
+	if e.body == "" {
+		return fmt.Sprintf("unexpected status %d", e.status)
+	}
+	return fmt.Sprintf("unexpected status %d: %s", e.status, e.body)
+}
+
+// Permanent 除了408和429,4xx的请求重试也不会成功
+func (e *httpError) Permanent() bool {
+	return e.status >= 400 && e.status < 500 &&
+		e.status != http.StatusRequestTimeout && e.status != http.StatusTooManyRequests
+}
+
+// RetryAfter 目的地要求的最短等待时间
+func (e *httpError) RetryAfter() time.Duration {
+	return e.retryAfter
+}
+
+// parseRetryAfter 解析Retry-After,支持秒数和HTTP时间两种格式
+func parseRetryAfter(v string) time.Duration {
+	if v == "" {
+		return 0
+	}
+	if secs, err := strconv.Atoi(v); err == nil && secs > 0 {
+		return time.Duration(secs) * time.Second
+	}
+	if t, err := http.ParseTime(v); err == nil {
+		return max(time.Until(t), 0)
+	}
+	return 0
+}
+
+// drainBody 读完并关闭响应,以便复用连接
+func drainBody(resp *http.Response) {
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+	resp.Body.Close()
+}
@@ -0,0 +1,74 @@
+package writer
+
+import (
+	"fmt"
+	"log-collector/config"
+	"log-collector/internal/kafkaauth"
+)
+
+// KafkaConfig 配置文件中kafka writer的配置
+type KafkaConfig struct {
+	BrokersAddr []string           `yaml:"brokersAddr"` //broker的地址
+	Topic       string             `yaml:"topic"`       //topic
+	TLS         bool               `yaml:"tls"`         //是否使用TLS连接broker
+	SASL        *config.SASLConfig `yaml:"sasl"`        //SASL认证
+}
+
+func init() {
+	Register("kafka", newKafkaBuilder)
+}
+
+// newKafkaBuilder 解析并检查kafka writer的配置
+func newKafkaBuilder(options map[string]interface{}) (Builder, error) {
+	var conf KafkaConfig
+	if err := config.Decode(options, &conf); err != nil {
+		return nil, err
+	}
+	var errs config.ValidationErrors
+	config.ValidateKafka(&errs, conf.BrokersAddr, conf.Topic, conf.SASL)
+	if len(errs) > 0 {
+		return nil, errs
+	}
+	b := NewKafkaWriterBuilder(conf.BrokersAddr, conf.Topic).WithTLS(conf.TLS)
+	if conf.SASL != nil {
+		b.WithSASL(conf.SASL.User, conf.SASL.Password)
+	}
+	return b, nil
+}
+
+type KafkaWriterBuilder struct {
+	BrokersAddr  []string
+	Topic        string
+	TLS          bool   //是否使用TLS连接broker
+	SASLUser     string //SASL/PLAIN认证的用户名,为空时不认证
+	SASLPassword string
+}
+
+func NewKafkaWriterBuilder(addr []string, topic string) *KafkaWriterBuilder {
+	return &KafkaWriterBuilder{
+		BrokersAddr: addr,
+		Topic:       topic,
+	}
+}
+
+// WithTLS 设置是否使用TLS连接broker
+func (k *KafkaWriterBuilder) WithTLS(enable bool) *KafkaWriterBuilder {
+	k.TLS = enable
+	return k
+}
+
+// WithSASL 使用SASL/PLAIN认证
+func (k *KafkaWriterBuilder) WithSASL(user, password string) *KafkaWriterBuilder {
+	k.SASLUser = user
+	k.SASLPassword = password
+	return k
+}
+
+func (k *KafkaWriterBuilder) Build() (Writer, error) {
+	auth := kafkaauth.Auth{TLS: k.TLS, User: k.SASLUser, Password: k.SASLPassword}
+	w, err := newKafkaWriter(k.BrokersAddr, k.Topic, auth)
+	if err != nil {
+		return nil, fmt.Errorf("error creating Kafka %w", err)
+	}
+	return w, nil
+}
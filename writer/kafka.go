@@ -0,0 +1,50 @@
+package writer
+
+import (
+	"errors"
+	"fmt"
+	"github.com/IBM/sarama"
+	"log-collector/internal/kafkaauth"
+)
+
+//将日志写入到kafka的topic中
+
+type KafkaWriter struct {
+	producer sarama.SyncProducer
+	topic    string
+}
+
+// newKafkaWriter 初始化 KafkaWriter
+func newKafkaWriter(brokers []string, topic string, auth kafkaauth.Auth) (*KafkaWriter, error) {
+	config := sarama.NewConfig()
+	config.Producer.Return.Successes = true // SyncProducer 需要
+	config.Producer.RequiredAcks = sarama.WaitForAll
+	auth.Apply(config)
+
+	producer, err := sarama.NewSyncProducer(brokers, config)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create producer: %v", err)
+	}
+	return &KafkaWriter{
+		producer: producer,
+		topic:    topic,
+	}, nil
+}
+
+func (k *KafkaWriter) Write(data []byte) error {
+	_, _, err := k.producer.SendMessage(&sarama.ProducerMessage{
+		Topic: k.topic,
+		Value: sarama.ByteEncoder(data),
+	})
+	if err != nil {
+		// 消息本身有问题的情况重试也没有用
+		if errors.Is(err, sarama.ErrMessageSizeTooLarge) || errors.Is(err, sarama.ErrInvalidMessage) {
+			return Permanent(fmt.Errorf("failed to send message: %w", err))
+		}
+		return fmt.Errorf("failed to send message: %w", err)
+	}
+	return nil
+}
+func (k *KafkaWriter) Close() error {
+	return k.producer.Close()
+}
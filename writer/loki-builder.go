@@ -0,0 +1,152 @@
+package writer
+
+import (
+	"fmt"
+	"log-collector/config"
+	"net/http"
+	"net/url"
+	"regexp"
+	"time"
+)
+
+var lokiLabelName = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+
+// LokiConfig 配置文件中loki writer的配置
+type LokiConfig struct {
+	URL          string            `yaml:"url"`          //Loki的地址,例如 http://loki:3100
+	Format       string            `yaml:"format"`       //protobuf(默认)|json
+	TenantID     string            `yaml:"tenantId"`     //多租户时的租户ID
+	Labels       map[string]string `yaml:"labels"`       //label名称 -> 字段名称,@开头的为元数据,例如 topic: "@topic"
+	StaticLabels map[string]string `yaml:"staticLabels"` //固定的label,默认为 job: log-collector
+	Username     string            `yaml:"username"`     //basic认证
+	Password     string            `yaml:"password"`
+	Timeout      time.Duration     `yaml:"timeout"` //请求的超时时间,默认10s
+}
+
+func init() {
+	Register("loki", newLokiBuilder)
+}
+
+// newLokiBuilder 解析并检查loki writer的配置
+func newLokiBuilder(options map[string]interface{}) (Builder, error) {
+	var conf LokiConfig
+	if err := config.Decode(options, &conf); err != nil {
+		return nil, err
+	}
+	var errs config.ValidationErrors
+	if u, err := url.Parse(conf.URL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		errs.Add("url", "%q is not a valid http(s) url", conf.URL)
+	}
+	switch LokiFormat(conf.Format) {
+	case "", LokiProtobuf, LokiJSON:
+	default:
+		errs.Add("format", "unknown format %q, expected protobuf or json", conf.Format)
+	}
+	for name := range conf.Labels {
+		if !lokiLabelName.MatchString(name) {
+			errs.Add("labels."+name, "invalid label name")
+		}
+	}
+	for name := range conf.StaticLabels {
+		if !lokiLabelName.MatchString(name) {
+			errs.Add("staticLabels."+name, "invalid label name")
+		}
+	}
+	if conf.Timeout < 0 {
+		errs.Add("timeout", "must not be negative")
+	}
+	if len(errs) > 0 {
+		return nil, errs
+	}
+	return NewLokiWriterBuilder(conf.URL).
+		WithFormat(LokiFormat(conf.Format)).
+		WithLabels(conf.Labels, conf.StaticLabels).
+		WithTenant(conf.TenantID).
+		WithBasicAuth(conf.Username, conf.Password).
+		WithTimeout(conf.Timeout), nil
+}
+
+type LokiWriterBuilder struct {
+	URL          string
+	Format       LokiFormat
+	Labels       map[string]string //label名称 -> 字段名称
+	StaticLabels map[string]string
+	TenantID     string
+	Username     string
+	Password     string
+	Timeout      time.Duration
+}
+
+// NewLokiWriterBuilder addr为Loki的地址,没有路径时使用 /loki/api/v1/push
+func NewLokiWriterBuilder(addr string) *LokiWriterBuilder {
+	return &LokiWriterBuilder{URL: addr}
+}
+
+// WithFormat 设置推送请求的编码,默认为LokiProtobuf
+func (l *LokiWriterBuilder) WithFormat(format LokiFormat) *LokiWriterBuilder {
+	l.Format = format
+	return l
+}
+
+// WithLabels labels为label名称到字段名称的映射,static为固定的label
+func (l *LokiWriterBuilder) WithLabels(labels, static map[string]string) *LokiWriterBuilder {
+	l.Labels = labels
+	l.StaticLabels = static
+	return l
+}
+
+// WithTenant 设置租户ID,通过X-Scope-OrgID发送
+func (l *LokiWriterBuilder) WithTenant(tenantID string) *LokiWriterBuilder {
+	l.TenantID = tenantID
+	return l
+}
+
+// WithBasicAuth 使用basic认证,user为空时不认证
+func (l *LokiWriterBuilder) WithBasicAuth(user, password string) *LokiWriterBuilder {
+	l.Username = user
+	l.Password = password
+	return l
+}
+
+// WithTimeout 设置请求的超时时间,小于等于0时为10s
+func (l *LokiWriterBuilder) WithTimeout(timeout time.Duration) *LokiWriterBuilder {
+	l.Timeout = timeout
+	return l
+}
+
+func (l *LokiWriterBuilder) Build() (Writer, error) {
+	u, err := url.Parse(l.URL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid loki url: %w", err)
+	}
+	if u.Path == "" || u.Path == "/" {
+		u.Path = lokiPushPath
+	}
+	format := l.Format
+	switch format {
+	case "":
+		format = LokiProtobuf
+	case LokiProtobuf, LokiJSON:
+	default:
+		return nil, fmt.Errorf("unknown loki format: %q", format)
+	}
+	static := l.StaticLabels
+	if len(static) == 0 {
+		//Loki要求每个stream至少有一个label
+		static = map[string]string{"job": "log-collector"}
+	}
+	timeout := l.Timeout
+	if timeout <= 0 {
+		timeout = 10 * time.Second
+	}
+	return &LokiWriter{
+		url:          u.String(),
+		client:       &http.Client{Timeout: timeout},
+		format:       format,
+		labels:       l.Labels,
+		staticLabels: static,
+		tenantID:     l.TenantID,
+		username:     l.Username,
+		password:     l.Password,
+	}, nil
+}
@@ -0,0 +1,243 @@
+package writer
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"log-collector/logging"
+	"log-collector/message"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/golang/snappy"
+)
+
+// LokiFormat 推送请求的编码
+type LokiFormat string
+
+const (
+	LokiProtobuf LokiFormat = "protobuf" //protobuf+snappy,Loki推荐的格式
+	LokiJSON     LokiFormat = "json"
+)
+
+const lokiPushPath = "/loki/api/v1/push"
+
+// LokiWriter 把日志推送到Grafana Loki的push接口
+// 日志按照label分成多个stream,label的值可以来自日志的字段,也可以来自元数据(例如@topic)
+type LokiWriter struct {
+	url          string
+	client       *http.Client
+	format       LokiFormat
+	labels       map[string]string //label名称 -> 字段名称
+	staticLabels map[string]string //固定的label
+	tenantID     string            //多租户时的X-Scope-OrgID
+	username     string
+	password     string
+}
+
+// lokiStream 一组label相同的日志
+type lokiStream struct {
+	labels  string //{a="x", b="y"}
+	values  map[string]string
+	entries []lokiEntry
+}
+
+type lokiEntry struct {
+	ts   time.Time
+	line string
+}
+
+func (l *LokiWriter) Write(data []byte) error {
+	return l.WriteMessages([]*message.Message{message.New(data)})
+}
+
+func (l *LokiWriter) WriteBatch(batch [][]byte) error {
+	msgs := make([]*message.Message, len(batch))
+	for i, data := range batch {
+		msgs[i] = message.New(data)
+	}
+	return l.WriteMessages(msgs)
+}
+
+// WriteMessages 把一批日志分成stream后在一个请求中推送
+// 只有部分日志因为乱序或者太旧被拒绝时,其他日志已经写入,不返回错误(重试只会重复写入)
+func (l *LokiWriter) WriteMessages(msgs []*message.Message) error {
+	if len(msgs) == 0 {
+		return nil
+	}
+	var (
+		body        []byte
+		contentType string
+		err         error
+	)
+	streams := l.group(msgs)
+	switch l.format {
+	case LokiJSON:
+		body, err = encodeLokiJSON(streams)
+		contentType = "application/json"
+	default:
+		body = snappy.Encode(nil, encodeLokiProto(streams))
+		contentType = "application/x-protobuf"
+	}
+	if err != nil {
+		return Permanent(fmt.Errorf("loki: encode failed: %w", err))
+	}
+
+	req, err := http.NewRequest(http.MethodPost, l.url, bytes.NewReader(body))
+	if err != nil {
+		return Permanent(fmt.Errorf("loki: %w", err))
+	}
+	req.Header.Set("Content-Type", contentType)
+	if l.tenantID != "" {
+		req.Header.Set("X-Scope-OrgID", l.tenantID)
+	}
+	if l.username != "" {
+		req.SetBasicAuth(l.username, l.password)
+	}
+	resp, err := l.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("loki: push failed: %w", err)
+	}
+	defer drainBody(resp)
+	if resp.StatusCode/100 == 2 {
+		return nil
+	}
+	herr := newHTTPError(resp)
+	if resp.StatusCode == http.StatusBadRequest && lokiRejectedEntries(herr.body) {
+		logging.Component("writer", "url", l.url).Warn("loki rejected some entries", "response", herr.body)
+		return nil
+	}
+	return fmt.Errorf("loki: push failed: %w", herr)
+}
+
+func (l *LokiWriter) Close() error {
+	l.client.CloseIdleConnections()
+	return nil
+}
+
+// group 按照label把日志分组,同一个stream中的日志按时间排序
+func (l *LokiWriter) group(msgs []*message.Message) []*lokiStream {
+	index := make(map[string]*lokiStream)
+	var streams []*lokiStream
+	for _, m := range msgs {
+		values := make(map[string]string, len(l.staticLabels)+len(l.labels))
+		for name, v := range l.staticLabels {
+			values[name] = v
+		}
+		for name, field := range l.labels {
+			if v, ok := m.LookupString(field); ok && v != "" {
+				values[name] = v
+			}
+		}
+		key := lokiLabels(values)
+		s, ok := index[key]
+		if !ok {
+			s = &lokiStream{labels: key, values: values}
+			index[key] = s
+			streams = append(streams, s)
+		}
+		ts := m.Timestamp
+		if ts.IsZero() {
+			ts = time.Now()
+		}
+		s.entries = append(s.entries, lokiEntry{ts: ts, line: string(m.Value)})
+	}
+	//旧版本的Loki会拒绝同一个stream中时间倒退的日志
+	for _, s := range streams {
+		sort.SliceStable(s.entries, func(i, j int) bool {
+			return s.entries[i].ts.Before(s.entries[j].ts)
+		})
+	}
+	return streams
+}
+
+// lokiLabels 把label转换为Loki的格式,按名称排序: {a="x", b="y"}
+func lokiLabels(values map[string]string) string {
+	names := make([]string, 0, len(values))
+	for name := range values {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var b strings.Builder
+	b.WriteByte('{')
+	for i, name := range names {
+		if i > 0 {
+			b.WriteString(", ")
+		}
+		b.WriteString(name)
+		b.WriteByte('=')
+		b.WriteString(strconv.Quote(values[name]))
+	}
+	b.WriteByte('}')
+	return b.String()
+}
+
+// lokiRejectedEntries 400的响应是否只是因为部分日志乱序或者太旧被拒绝
+func lokiRejectedEntries(body string) bool {
+	for _, reason := range []string{"out of order", "too far behind", "too old"} {
+		if strings.Contains(body, reason) {
+			return true
+		}
+	}
+	return false
+}
+
+// encodeLokiJSON {"streams":[{"stream":{...},"values":[["<纳秒>","<日志>"]]}]}
+func encodeLokiJSON(streams []*lokiStream) ([]byte, error) {
+	type jsonStream struct {
+		Stream map[string]string `json:"stream"`
+		Values [][2]string       `json:"values"`
+	}
+	req := struct {
+		Streams []jsonStream `json:"streams"`
+	}{Streams: make([]jsonStream, 0, len(streams))}
+	for _, s := range streams {
+		js := jsonStream{Stream: s.values, Values: make([][2]string, 0, len(s.entries))}
+		for _, e := range s.entries {
+			js.Values = append(js.Values, [2]string{strconv.FormatInt(e.ts.UnixNano(), 10), e.line})
+		}
+		req.Streams = append(req.Streams, js)
+	}
+	return json.Marshal(req)
+}
+
+// encodeLokiProto 按照Loki的push.proto编码:
+//
+//	PushRequest   { repeated StreamAdapter streams = 1; }
+//	StreamAdapter { string labels = 1; repeated EntryAdapter entries = 2; }
+//	EntryAdapter  { google.protobuf.Timestamp timestamp = 1; string line = 2; }
+//	Timestamp     { int64 seconds = 1; int32 nanos = 2; }
+func encodeLokiProto(streams []*lokiStream) []byte {
+	var req, stream, entry, ts []byte
+	for _, s := range streams {
+		stream = appendProtoBytes(stream[:0], 1, []byte(s.labels))
+		for _, e := range s.entries {
+			ts = ts[:0]
+			ts = appendProtoVarint(ts, 1, uint64(e.ts.Unix()))
+			ts = appendProtoVarint(ts, 2, uint64(e.ts.Nanosecond()))
+			entry = appendProtoBytes(entry[:0], 1, ts)
+			entry = appendProtoBytes(entry, 2, []byte(e.line))
+			stream = appendProtoBytes(stream, 2, entry)
+		}
+		req = appendProtoBytes(req, 1, stream)
+	}
+	return req
+}
+
+func appendProtoVarint(b []byte, field int, v uint64) []byte {
+	if v == 0 {
+		return b
+	}
+	b = binary.AppendUvarint(b, uint64(field)<<3)
+	return binary.AppendUvarint(b, v)
+}
+
+func appendProtoBytes(b []byte, field int, v []byte) []byte {
+	b = binary.AppendUvarint(b, uint64(field)<<3|2)
+	b = binary.AppendUvarint(b, uint64(len(v)))
+	return append(b, v...)
+}
@@ -0,0 +1,150 @@
+package writer
+
+import (
+	"encoding/json"
+	"io"
+	"log-collector/message"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang/snappy"
+)
+
+// lokiServer 记录收到的推送请求,总是返回status和body
+type lokiServer struct {
+	*httptest.Server
+	requests []*http.Request
+	bodies   [][]byte
+}
+
+func newLokiServer(t *testing.T, status int, body string, header map[string]string) *lokiServer {
+	s := &lokiServer{}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := io.ReadAll(r.Body)
+		s.requests = append(s.requests, r)
+		s.bodies = append(s.bodies, b)
+		for k, v := range header {
+			w.Header().Set(k, v)
+		}
+		w.WriteHeader(status)
+		io.WriteString(w, body)
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
+
+func TestLokiWriter_JSON(t *testing.T) {
+	srv := newLokiServer(t, http.StatusNoContent, "", nil)
+	w, err := NewLokiWriterBuilder(srv.URL).
+		WithFormat(LokiJSON).
+		WithLabels(map[string]string{"topic": "@topic", "level": "level"}, map[string]string{"job": "test"}).
+		WithTenant("team-a").
+		Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+
+	base := time.Unix(1700000000, 0)
+	msgs := []*message.Message{
+		{Value: []byte(`{"level":"error","msg":"second"}`), Topic: "a", Timestamp: base.Add(time.Second)},
+		{Value: []byte(`{"level":"error","msg":"first"}`), Topic: "a", Timestamp: base},
+		{Value: []byte(`plain`), Topic: "b", Timestamp: base},
+	}
+	if err := w.(MessageWriter).WriteMessages(msgs); err != nil {
+		t.Fatalf("WriteMessages() error = %v", err)
+	}
+	if len(srv.requests) != 1 {
+		t.Fatalf("expected 1 request, got %d", len(srv.requests))
+	}
+	r := srv.requests[0]
+	if r.URL.Path != lokiPushPath || r.Header.Get("X-Scope-OrgID") != "team-a" || r.Header.Get("Content-Type") != "application/json" {
+		t.Errorf("unexpected request %s %v", r.URL.Path, r.Header)
+	}
+	var req struct {
+		Streams []struct {
+			Stream map[string]string `json:"stream"`
+			Values [][2]string       `json:"values"`
+		} `json:"streams"`
+	}
+	if err := json.Unmarshal(srv.bodies[0], &req); err != nil {
+		t.Fatal(err)
+	}
+	if len(req.Streams) != 2 {
+		t.Fatalf("expected 2 streams, got %+v", req.Streams)
+	}
+	first := req.Streams[0]
+	if first.Stream["topic"] != "a" || first.Stream["level"] != "error" || first.Stream["job"] != "test" {
+		t.Errorf("unexpected labels %v", first.Stream)
+	}
+	//同一个stream中按时间排序
+	if len(first.Values) != 2 || !strings.Contains(first.Values[0][1], "first") || first.Values[0][0] != "1700000000000000000" {
+		t.Errorf("unexpected values %v", first.Values)
+	}
+	if _, ok := req.Streams[1].Stream["level"]; ok {
+		t.Errorf("missing field should not become a label: %v", req.Streams[1].Stream)
+	}
+}
+
+func TestLokiWriter_Protobuf(t *testing.T) {
+	srv := newLokiServer(t, http.StatusNoContent, "", nil)
+	w, err := NewLokiWriterBuilder(srv.URL).WithLabels(map[string]string{"topic": "@topic"}, nil).Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+	if err := w.(MessageWriter).WriteMessages([]*message.Message{{Value: []byte("hello loki"), Topic: "applog"}}); err != nil {
+		t.Fatal(err)
+	}
+	if ct := srv.requests[0].Header.Get("Content-Type"); ct != "application/x-protobuf" {
+		t.Errorf("Content-Type = %s", ct)
+	}
+	body, err := snappy.Decode(nil, srv.bodies[0])
+	if err != nil {
+		t.Fatalf("body is not snappy encoded: %v", err)
+	}
+	for _, want := range []string{`{job="log-collector", topic="applog"}`, "hello loki"} {
+		if !strings.Contains(string(body), want) {
+			t.Errorf("expected %q in body %q", want, body)
+		}
+	}
+}
+
+func TestLokiWriter_Errors(t *testing.T) {
+	tests := []struct {
+		name          string
+		status        int
+		body          string
+		header        map[string]string
+		wantErr       bool
+		wantPermanent bool
+		wantRetry     time.Duration
+	}{
+		{"rate limited", http.StatusTooManyRequests, "ingestion rate limit exceeded", map[string]string{"Retry-After": "2"}, true, false, 2 * time.Second},
+		{"server error", http.StatusBadGateway, "", nil, true, false, 0},
+		{"out of order", http.StatusBadRequest, "entry with timestamp 2023 ignored, reason: 'entry out of order'", nil, false, false, 0},
+		{"bad request", http.StatusBadRequest, "error parsing labels", nil, true, true, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := newLokiServer(t, tt.status, tt.body, tt.header)
+			w, err := NewLokiWriterBuilder(srv.URL).Build()
+			if err != nil {
+				t.Fatal(err)
+			}
+			err = w.Write([]byte("x"))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Write() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if IsPermanent(err) != tt.wantPermanent {
+				t.Errorf("IsPermanent() = %v, want %v", IsPermanent(err), tt.wantPermanent)
+			}
+			if got := retryAfter(err); got != tt.wantRetry {
+				t.Errorf("retryAfter() = %v, want %v", got, tt.wantRetry)
+			}
+		})
+	}
+}
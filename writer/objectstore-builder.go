@@ -0,0 +1,215 @@
+package writer
+
+import (
+	"fmt"
+	"log-collector/config"
+	"net/http"
+	"net/url"
+	"strings"
+	"text/template"
+	"time"
+)
+
+const minPartSize = 5 << 20 //S3要求除最后一个分片外,每个分片至少5MiB
+
+// ObjectStoreConfig 配置文件中s3 writer的配置
+type ObjectStoreConfig struct {
+	Endpoint     string        `yaml:"endpoint"`     //例如 http://minio:9000,默认为 https://s3.<region>.amazonaws.com
+	Region       string        `yaml:"region"`       //默认us-east-1
+	Bucket       string        `yaml:"bucket"`       //桶名称,必填
+	AccessKey    string        `yaml:"accessKey"`    //访问密钥ID,必填
+	SecretKey    string        `yaml:"secretKey"`    //可以用secretKey_file从文件中读取
+	SessionToken string        `yaml:"sessionToken"` //临时凭证
+	PathStyle    bool          `yaml:"pathStyle"`    //使用 endpoint/bucket/key 的地址,MinIO一般需要开启
+	KeyTemplate  string        `yaml:"keyTemplate"`  //对象名称的模板(text/template),字段见ObjectKey
+	Compression  string        `yaml:"compression"`  //gzip(默认)|none
+	PartSize     int64         `yaml:"partSize"`     //超过该大小的对象使用分片上传,默认8MiB,最小5MiB
+	Timeout      time.Duration `yaml:"timeout"`      //每个请求的超时时间,默认60s
+	TLS          *TLSOptions   `yaml:"tls"`
+}
+
+func init() {
+	Register("s3", newObjectStoreBuilder)
+}
+
+// newObjectStoreBuilder 解析并检查s3 writer的配置
+func newObjectStoreBuilder(options map[string]interface{}) (Builder, error) {
+	var conf ObjectStoreConfig
+	if err := config.Decode(options, &conf); err != nil {
+		return nil, err
+	}
+	var errs config.ValidationErrors
+	if conf.Endpoint != "" {
+		if u, err := url.Parse(conf.Endpoint); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			errs.Add("endpoint", "%q is not a valid http(s) url", conf.Endpoint)
+		}
+	}
+	if conf.Bucket == "" {
+		errs.Add("bucket", "bucket must not be empty")
+	}
+	if conf.AccessKey == "" {
+		errs.Add("accessKey", "accessKey must not be empty")
+	}
+	if conf.SecretKey == "" {
+		errs.Add("secretKey", "secretKey must not be empty (or set secretKey_file)")
+	}
+	if conf.KeyTemplate != "" {
+		if _, err := template.New("key").Parse(conf.KeyTemplate); err != nil {
+			errs.Add("keyTemplate", "invalid template: %v", err)
+		} else if !strings.Contains(conf.KeyTemplate, ".ID") {
+			errs.Add("keyTemplate", "must contain {{.ID}}, otherwise objects overwrite each other")
+		}
+	}
+	switch conf.Compression {
+	case "", "gzip", "none":
+	default:
+		errs.Add("compression", "unknown compression %q, expected gzip or none", conf.Compression)
+	}
+	if conf.PartSize != 0 && conf.PartSize < minPartSize {
+		errs.Add("partSize", "must be at least %d", minPartSize)
+	}
+	if conf.Timeout < 0 {
+		errs.Add("timeout", "must not be negative")
+	}
+	if conf.TLS != nil {
+		conf.TLS.validate(&errs, "tls")
+	}
+	if len(errs) > 0 {
+		return nil, errs
+	}
+	b := NewObjectStoreWriterBuilder(conf.Endpoint, conf.Region, conf.Bucket).
+		WithCredentials(conf.AccessKey, conf.SecretKey, conf.SessionToken).
+		WithPathStyle(conf.PathStyle).
+		WithKeyTemplate(conf.KeyTemplate).
+		WithCompression(conf.Compression != "none").
+		WithPartSize(conf.PartSize).
+		WithTimeout(conf.Timeout)
+	if conf.TLS != nil {
+		b.WithTLS(*conf.TLS)
+	}
+	return b, nil
+}
+
+type ObjectStoreWriterBuilder struct {
+	Endpoint     string
+	Region       string
+	Bucket       string
+	AccessKey    string
+	SecretKey    string
+	SessionToken string
+	PathStyle    bool
+	KeyTemplate  string
+	Gzip         bool
+	PartSize     int64
+	Timeout      time.Duration
+	TLS          *TLSOptions
+}
+
+// NewObjectStoreWriterBuilder endpoint为空时使用AWS S3,region为空时为us-east-1,默认gzip压缩
+func NewObjectStoreWriterBuilder(endpoint, region, bucket string) *ObjectStoreWriterBuilder {
+	return &ObjectStoreWriterBuilder{
+		Endpoint: endpoint,
+		Region:   region,
+		Bucket:   bucket,
+		Gzip:     true,
+	}
+}
+
+// WithCredentials 设置访问凭证,sessionToken只在使用临时凭证时需要
+func (o *ObjectStoreWriterBuilder) WithCredentials(accessKey, secretKey, sessionToken string) *ObjectStoreWriterBuilder {
+	o.AccessKey = accessKey
+	o.SecretKey = secretKey
+	o.SessionToken = sessionToken
+	return o
+}
+
+// WithPathStyle 使用 endpoint/bucket/key 的地址
+func (o *ObjectStoreWriterBuilder) WithPathStyle(enable bool) *ObjectStoreWriterBuilder {
+	o.PathStyle = enable
+	return o
+}
+
+// WithKeyTemplate 设置对象名称的模板,为空时为DefaultObjectKeyTemplate
+func (o *ObjectStoreWriterBuilder) WithKeyTemplate(tmpl string) *ObjectStoreWriterBuilder {
+	o.KeyTemplate = tmpl
+	return o
+}
+
+// WithCompression 设置是否gzip压缩对象
+func (o *ObjectStoreWriterBuilder) WithCompression(gzip bool) *ObjectStoreWriterBuilder {
+	o.Gzip = gzip
+	return o
+}
+
+// WithPartSize 设置分片的大小,小于等于0时为8MiB
+func (o *ObjectStoreWriterBuilder) WithPartSize(size int64) *ObjectStoreWriterBuilder {
+	o.PartSize = size
+	return o
+}
+
+// WithTimeout 设置每个请求的超时时间,小于等于0时为60s
+func (o *ObjectStoreWriterBuilder) WithTimeout(timeout time.Duration) *ObjectStoreWriterBuilder {
+	o.Timeout = timeout
+	return o
+}
+
+// WithTLS 设置https连接的TLS配置
+func (o *ObjectStoreWriterBuilder) WithTLS(opts TLSOptions) *ObjectStoreWriterBuilder {
+	o.TLS = &opts
+	return o
+}
+
+func (o *ObjectStoreWriterBuilder) Build() (Writer, error) {
+	region := o.Region
+	if region == "" {
+		region = "us-east-1"
+	}
+	endpoint := o.Endpoint
+	if endpoint == "" {
+		endpoint = "https://s3." + region + ".amazonaws.com"
+	}
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return nil, fmt.Errorf("invalid s3 endpoint: %w", err)
+	}
+	tmplText := o.KeyTemplate
+	if tmplText == "" {
+		tmplText = DefaultObjectKeyTemplate
+	}
+	tmpl, err := template.New("key").Option("missingkey=error").Parse(tmplText)
+	if err != nil {
+		return nil, fmt.Errorf("invalid object key template: %w", err)
+	}
+	partSize := o.PartSize
+	if partSize <= 0 {
+		partSize = 8 << 20
+	}
+	timeout := o.Timeout
+	if timeout <= 0 {
+		timeout = 60 * time.Second
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if o.TLS != nil {
+		tlsConf, err := o.TLS.build()
+		if err != nil {
+			return nil, err
+		}
+		transport.TLSClientConfig = tlsConf
+	}
+	return &ObjectStoreWriter{
+		client: &s3Client{
+			endpoint:     u,
+			region:       region,
+			bucket:       o.Bucket,
+			accessKey:    o.AccessKey,
+			secretKey:    o.SecretKey,
+			sessionToken: o.SessionToken,
+			pathStyle:    o.PathStyle,
+			client:       &http.Client{Timeout: timeout, Transport: transport},
+			now:          time.Now,
+		},
+		keyTmpl:  tmpl,
+		gzip:     o.Gzip,
+		partSize: int(partSize),
+	}, nil
+}
@@ -0,0 +1,133 @@
+package writer
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"log-collector/message"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// DefaultObjectKeyTemplate 默认的对象名称,按小时分目录
+const DefaultObjectKeyTemplate = `logs/{{.Time.Format "2006/01/02/15"}}/{{.ID}}{{.Ext}}`
+
+// ObjectKey 渲染对象名称模板时可以使用的数据
+type ObjectKey struct {
+	Time      time.Time //对象中第一条日志的时间(UTC)
+	Topic     string    //kafka的topic
+	Partition int32     //kafka的partition
+	Source    string    //reader的名称
+	ID        string    //对象内容的hash,同一批日志重试时不变,重复上传会覆盖同一个对象
+	Ext       string    //扩展名,例如 .log.gz
+}
+
+// ObjectStoreWriter 把日志归档到S3兼容的对象存储
+// 每次WriteBatch/WriteMessages的日志按照对象名称分组(名称中除ID以外的部分相同的为一组),每组压缩后上传为一个对象,
+// 所有对象都上传成功后才返回nil,配合batch控制对象的大小,配合spool在上传成功前把日志保存在磁盘上
+type ObjectStoreWriter struct {
+	client   *s3Client
+	keyTmpl  *template.Template
+	gzip     bool
+	partSize int //超过该大小的对象使用分片上传
+}
+
+func (o *ObjectStoreWriter) Write(data []byte) error {
+	return o.WriteMessages([]*message.Message{message.New(data)})
+}
+
+func (o *ObjectStoreWriter) WriteBatch(batch [][]byte) error {
+	msgs := make([]*message.Message, len(batch))
+	for i, data := range batch {
+		msgs[i] = message.New(data)
+	}
+	return o.WriteMessages(msgs)
+}
+
+func (o *ObjectStoreWriter) WriteMessages(msgs []*message.Message) error {
+	type object struct {
+		key  ObjectKey
+		body bytes.Buffer
+	}
+	var (
+		index   = make(map[string]*object)
+		objects []*object
+	)
+	for _, m := range msgs {
+		k := ObjectKey{
+			Time:      m.Timestamp.UTC(),
+			Topic:     m.Topic,
+			Partition: m.Partition,
+			Source:    m.Source,
+			Ext:       o.ext(),
+		}
+		if m.Timestamp.IsZero() {
+			k.Time = time.Now().UTC()
+		}
+		group, err := o.render(k)
+		if err != nil {
+			return Permanent(err)
+		}
+		obj, ok := index[group]
+		if !ok {
+			obj = &object{key: k}
+			index[group] = obj
+			objects = append(objects, obj)
+		}
+		obj.body.Write(bytes.TrimRight(m.Value, "\n"))
+		obj.body.WriteByte('\n')
+	}
+
+	for _, obj := range objects {
+		content := obj.body.Bytes()
+		obj.key.ID = sha256Hex(content)[:32]
+		key, err := o.render(obj.key)
+		if err != nil {
+			return Permanent(err)
+		}
+		if err := o.upload(key, content); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (o *ObjectStoreWriter) Close() error {
+	o.client.client.CloseIdleConnections()
+	return nil
+}
+
+// upload 压缩后上传,大的对象使用分片上传
+func (o *ObjectStoreWriter) upload(key string, content []byte) error {
+	contentType := "text/plain; charset=utf-8"
+	if o.gzip {
+		var buf bytes.Buffer
+		zw := gzip.NewWriter(&buf)
+		zw.Write(content)
+		if err := zw.Close(); err != nil {
+			return Permanent(fmt.Errorf("s3: gzip failed: %w", err))
+		}
+		content = buf.Bytes()
+		contentType = "application/gzip"
+	}
+	if len(content) > o.partSize {
+		return o.client.multipartUpload(key, content, contentType, o.partSize)
+	}
+	return o.client.putObject(key, content, contentType)
+}
+
+func (o *ObjectStoreWriter) render(k ObjectKey) (string, error) {
+	var b strings.Builder
+	if err := o.keyTmpl.Execute(&b, k); err != nil {
+		return "", fmt.Errorf("s3: render object key failed: %w", err)
+	}
+	return strings.TrimPrefix(b.String(), "/"), nil
+}
+
+func (o *ObjectStoreWriter) ext() string {
+	if o.gzip {
+		return ".log.gz"
+	}
+	return ".log"
+}
@@ -0,0 +1,168 @@
+package writer
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"log-collector/message"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeS3 只实现上传对象需要的接口,路径为 /bucket/key
+type fakeS3 struct {
+	*httptest.Server
+	mutex   sync.Mutex
+	objects map[string][]byte
+	parts   map[string]map[string][]byte //uploadId -> partNumber -> 内容
+	fail    int                          //前fail次PUT返回503
+	aborted int
+}
+
+func newFakeS3(t *testing.T) *fakeS3 {
+	s := &fakeS3{objects: make(map[string][]byte), parts: make(map[string]map[string][]byte)}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.handle))
+	t.Cleanup(s.Close)
+	return s
+}
+
+func (s *fakeS3) handle(w http.ResponseWriter, r *http.Request) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if !strings.HasPrefix(r.Header.Get("Authorization"), "AWS4-HMAC-SHA256 Credential=ak/") {
+		w.WriteHeader(http.StatusForbidden)
+		return
+	}
+	body, _ := io.ReadAll(r.Body)
+	key := strings.TrimPrefix(r.URL.Path, "/bucket/")
+	q := r.URL.Query()
+	switch {
+	case r.Method == http.MethodPut && s.fail > 0:
+		s.fail--
+		w.WriteHeader(http.StatusServiceUnavailable)
+	case r.Method == http.MethodPost && q.Has("uploads"):
+		id := fmt.Sprintf("upload-%d", len(s.parts)+1)
+		s.parts[id] = make(map[string][]byte)
+		fmt.Fprintf(w, "<InitiateMultipartUploadResult><UploadId>%s</UploadId></InitiateMultipartUploadResult>", id)
+	case r.Method == http.MethodPut && q.Has("uploadId"):
+		s.parts[q.Get("uploadId")][q.Get("partNumber")] = body
+		w.Header().Set("ETag", `"etag-`+q.Get("partNumber")+`"`)
+	case r.Method == http.MethodPost && q.Has("uploadId"):
+		parts := s.parts[q.Get("uploadId")]
+		numbers := make([]string, 0, len(parts))
+		for n := range parts {
+			numbers = append(numbers, n)
+		}
+		sort.Strings(numbers)
+		var content []byte
+		for _, n := range numbers {
+			content = append(content, parts[n]...)
+		}
+		s.objects[key] = content
+		io.WriteString(w, "<CompleteMultipartUploadResult></CompleteMultipartUploadResult>")
+	case r.Method == http.MethodDelete:
+		s.aborted++
+	case r.Method == http.MethodPut:
+		s.objects[key] = body
+	default:
+		w.WriteHeader(http.StatusBadRequest)
+	}
+}
+
+func (s *fakeS3) keys() []string {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	keys := make([]string, 0, len(s.objects))
+	for k := range s.objects {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func gunzip(t *testing.T, b []byte) string {
+	t.Helper()
+	zr, err := gzip.NewReader(bytes.NewReader(b))
+	if err != nil {
+		t.Fatal(err)
+	}
+	out, _ := io.ReadAll(zr)
+	return string(out)
+}
+
+func TestObjectStoreWriter_Upload(t *testing.T) {
+	srv := newFakeS3(t)
+	w, err := NewObjectStoreWriterBuilder(srv.URL, "", "bucket").
+		WithCredentials("ak", "sk", "").
+		WithPathStyle(true).
+		WithKeyTemplate(`{{.Topic}}/{{.Time.Format "2006-01-02"}}/{{.ID}}{{.Ext}}`).
+		Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+	ts := time.Date(2024, 3, 1, 10, 0, 0, 0, time.UTC)
+	msgs := []*message.Message{
+		{Value: []byte("a1"), Topic: "a", Timestamp: ts},
+		{Value: []byte("b1"), Topic: "b", Timestamp: ts},
+		{Value: []byte("a2\n"), Topic: "a", Timestamp: ts},
+	}
+	if err := w.(MessageWriter).WriteMessages(msgs); err != nil {
+		t.Fatalf("WriteMessages() error = %v", err)
+	}
+	keys := srv.keys()
+	if len(keys) != 2 || !strings.HasPrefix(keys[0], "a/2024-03-01/") || !strings.HasSuffix(keys[0], ".log.gz") {
+		t.Fatalf("unexpected objects %v", keys)
+	}
+	if got := gunzip(t, srv.objects[keys[0]]); got != "a1\na2\n" {
+		t.Errorf("object content = %q", got)
+	}
+
+	//重试同一批日志会覆盖同一个对象
+	if err := w.(MessageWriter).WriteMessages(msgs); err != nil {
+		t.Fatal(err)
+	}
+	if len(srv.keys()) != 2 {
+		t.Errorf("expected retry to reuse object keys, got %v", srv.keys())
+	}
+}
+
+func TestObjectStoreWriter_Multipart(t *testing.T) {
+	srv := newFakeS3(t)
+	w, err := NewObjectStoreWriterBuilder(srv.URL, "", "bucket").
+		WithCredentials("ak", "sk", "").
+		WithPathStyle(true).
+		WithCompression(false).
+		Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+	w.(*ObjectStoreWriter).partSize = 4
+	if err := w.(BatchWriter).WriteBatch([][]byte{[]byte("hello"), []byte("world")}); err != nil {
+		t.Fatalf("WriteBatch() error = %v", err)
+	}
+	keys := srv.keys()
+	if len(keys) != 1 || !strings.HasPrefix(keys[0], "logs/") || !strings.HasSuffix(keys[0], ".log") {
+		t.Fatalf("unexpected objects %v", keys)
+	}
+	if got := string(srv.objects[keys[0]]); got != "hello\nworld\n" {
+		t.Errorf("object content = %q", got)
+	}
+
+	//上传分片失败时取消上传,返回可以重试的错误
+	srv.fail = 1
+	err = w.Write([]byte("again"))
+	if err == nil || IsPermanent(err) {
+		t.Errorf("expected retryable error, got %v", err)
+	}
+	if srv.aborted != 1 {
+		t.Errorf("expected multipart upload to be aborted, aborted = %d", srv.aborted)
+	}
+}
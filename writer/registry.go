@@ -0,0 +1,62 @@
+package writer
+
+import (
+	"fmt"
+	"log-collector/config"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Factory 根据配置创建Builder,options为配置文件中该writer除name、type以外的部分
+// Factory只解析和检查配置,不连接外部服务;配置有问题时返回config.ValidationErrors(使用相对路径)
+type Factory func(options map[string]interface{}) (Builder, error)
+
+var (
+	registryMutex sync.RWMutex
+	factories     = make(map[string]Factory) //type到Factory的映射
+)
+
+// Register 注册type对应的Factory,一般在包的init()中调用
+// 其他模块中的writer只需要在自己的main包中匿名导入(import _ "xxx")就可以在配置中使用
+// type为空、factory为nil或者同一个type重复注册时会panic
+func Register(typ string, factory Factory) {
+	registryMutex.Lock()
+	defer registryMutex.Unlock()
+	if typ == "" {
+		panic("writer: Register type is empty")
+	}
+	if factory == nil {
+		panic("writer: Register factory is nil for type " + typ)
+	}
+	if _, dup := factories[typ]; dup {
+		panic("writer: Register called twice for type " + typ)
+	}
+	factories[typ] = factory
+}
+
+// NewBuilder 根据type找到对应的Factory并创建Builder
+func NewBuilder(typ string, options map[string]interface{}) (Builder, error) {
+	registryMutex.RLock()
+	f, ok := factories[typ]
+	registryMutex.RUnlock()
+	if !ok {
+		return nil, config.ValidationErrors{{
+			Path:   "type",
+			Reason: fmt.Sprintf("unknown writer type %q, supported types: %s", typ, strings.Join(Types(), ", ")),
+		}}
+	}
+	return f(options)
+}
+
+// Types 返回支持的所有type,按字母排序
+func Types() []string {
+	registryMutex.RLock()
+	defer registryMutex.RUnlock()
+	types := make([]string, 0, len(factories))
+	for typ := range factories {
+		types = append(types, typ)
+	}
+	sort.Strings(types)
+	return types
+}
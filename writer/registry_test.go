@@ -0,0 +1,97 @@
+package writer
+
+import (
+	"errors"
+	"log-collector/config"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestNewBuilder_File(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "logs")
+	b, err := NewBuilder("file", map[string]interface{}{
+		"filepath":      dir,
+		"maxsize":       "1024",
+		"flushinterval": "200ms",
+		"sync":          map[string]interface{}{"policy": "rotate"},
+	})
+	if err != nil {
+		t.Fatalf("NewBuilder() error = %v", err)
+	}
+	fb := b.(*FileWriterBuilder)
+	if fb.FileName != "app" || fb.MaxSize != 1024 || fb.SyncPolicy != SyncOnRotate {
+		t.Errorf("unexpected builder %+v", fb)
+	}
+	//Build时创建目录
+	w, err := b.Build()
+	if err != nil {
+		t.Fatalf("Build() error = %v", err)
+	}
+	defer w.Close()
+	if _, err := os.Stat(dir); err != nil {
+		t.Errorf("expected directory to be created: %v", err)
+	}
+}
+
+func TestNewBuilder_Invalid(t *testing.T) {
+	tests := []struct {
+		name      string
+		typ       string
+		options   map[string]interface{}
+		wantPaths []string
+	}{
+		{"unknown type", "elasticsearch", nil, []string{"type"}},
+		{"file without path", "file", map[string]interface{}{"sync": map[string]interface{}{"policy": "sometimes"}}, []string{"filePath", "sync.policy"}},
+		{"stdout with unknown options", "stdout", map[string]interface{}{"colour": true}, []string{""}},
+		{"stdout with invalid color", "stdout", map[string]interface{}{"pretty": true, "color": "rainbow"}, []string{"color"}},
+		{"kafka without topic", "kafka", map[string]interface{}{"brokersaddr": "127.0.0.1:9092"}, []string{"topic"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewBuilder(tt.typ, tt.options)
+			var verrs config.ValidationErrors
+			if !errors.As(err, &verrs) {
+				t.Fatalf("expected ValidationErrors, got %v", err)
+			}
+			if len(verrs) != len(tt.wantPaths) {
+				t.Fatalf("expected %d problems, got %v", len(tt.wantPaths), verrs)
+			}
+			for i, want := range tt.wantPaths {
+				if verrs[i].Path != want {
+					t.Errorf("problem %d path = %s, want %s", i, verrs[i].Path, want)
+				}
+			}
+		})
+	}
+}
+
+func TestRegister(t *testing.T) {
+	Register("test-mem", func(options map[string]interface{}) (Builder, error) {
+		var conf struct{ Prefix string }
+		if err := config.Decode(options, &conf); err != nil {
+			return nil, err
+		}
+		return memBuilder{}, nil
+	})
+	b, err := NewBuilder("test-mem", map[string]interface{}{"prefix": "x"})
+	if err != nil {
+		t.Fatalf("NewBuilder() error = %v", err)
+	}
+	if _, err := b.Build(); err != nil {
+		t.Fatalf("Build() error = %v", err)
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Error("expected panic when registering the same type twice")
+		}
+	}()
+	Register("file", newFileBuilder)
+}
+
+type memBuilder struct{}
+
+func (memBuilder) Build() (Writer, error) {
+	return &memWriter{}, nil
+}
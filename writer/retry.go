@@ -0,0 +1,328 @@
+package writer
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log-collector/message"
+	"math"
+	"math/rand/v2"
+	"sort"
+	"sync"
+	"time"
+)
+
+// permanentError 标记不需要重试的错误
+type permanentError struct {
+	err error
+}
+
+func (p *permanentError) Error() string {
+	return p.err.Error()
+}
+func (p *permanentError) Unwrap() error {
+	return p.err
+}
+
+// Permanent 把err标记为永久性错误,RetryWriter遇到这类错误不会再重试
+func Permanent(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &permanentError{err: err}
+}
+
+// IsPermanent 判断err是否是永久性错误
+// 由Permanent包装的错误,或者实现了 Permanent() bool 并返回true的错误都是永久性错误
+func IsPermanent(err error) bool {
+	var p *permanentError
+	if errors.As(err, &p) {
+		return true
+	}
+	var classified interface{ Permanent() bool }
+	if errors.As(err, &classified) {
+		return classified.Permanent()
+	}
+	return false
+}
+
+// retryAfter 错误中目的地要求的最短等待时间(例如HTTP 429的Retry-After),没有时为0
+// 实现了 RetryAfter() time.Duration 的错误可以指定
+func retryAfter(err error) time.Duration {
+	var ra interface{ RetryAfter() time.Duration }
+	if errors.As(err, &ra) {
+		return ra.RetryAfter()
+	}
+	return 0
+}
+
+// BatchError 批量写入时只有部分日志失败,其他日志已经写入成功
+// Errors的key是失败的日志在这一批中的下标,RetryWriter和SpoolWriter只会重试其中不是永久性错误的日志,
+// 永久性错误的日志直接写入死信,避免因为一条日志的问题重复写入整批日志
+type BatchError struct {
+	Errors map[int]error
+}
+
+func (b *BatchError) Error() string {
+	indexes := make([]int, 0, len(b.Errors))
+	for i := range b.Errors {
+		indexes = append(indexes, i)
+	}
+	sort.Ints(indexes)
+	if len(indexes) == 0 {
+		return "batch write failed"
+	}
+	return fmt.Sprintf("%d records failed, first (#%d): %v", len(indexes), indexes[0], b.Errors[indexes[0]])
+}
+
+// Permanent 所有失败的日志都是永久性错误时,重试没有意义
+func (b *BatchError) Permanent() bool {
+	for _, err := range b.Errors {
+		if !IsPermanent(err) {
+			return false
+		}
+	}
+	return true
+}
+
+// split 找出msgs中失败的日志和失败的原因,retry为其中可以重试的日志,msgs是返回b的那一批日志
+func (b *BatchError) split(msgs []*message.Message) (retry []*message.Message, causes map[*message.Message]error) {
+	causes = make(map[*message.Message]error, len(b.Errors))
+	for i, m := range msgs {
+		if err, ok := b.Errors[i]; ok {
+			causes[m] = err
+			if !IsPermanent(err) {
+				retry = append(retry, m)
+			}
+		}
+	}
+	return retry, causes
+}
+
+// RetryPolicy 重试策略
+type RetryPolicy struct {
+	MaxAttempts    int           //最大尝试次数(包括第一次),小于等于0时为3
+	InitialBackoff time.Duration //第一次重试前的等待时间,小于等于0时为100ms
+	MaxBackoff     time.Duration //等待时间的上限,小于等于0时为10s
+	Multiplier     float64       //每次重试等待时间的增长倍数,小于1时为2
+	Jitter         float64       //随机抖动的比例(0~1)
+}
+
+// withDefaults 给未设置的字段填上默认值
+func (p RetryPolicy) withDefaults() RetryPolicy {
+	if p.MaxAttempts <= 0 {
+		p.MaxAttempts = 3
+	}
+	if p.InitialBackoff <= 0 {
+		p.InitialBackoff = 100 * time.Millisecond
+	}
+	if p.MaxBackoff <= 0 {
+		p.MaxBackoff = 10 * time.Second
+	}
+	if p.Multiplier < 1 {
+		p.Multiplier = 2
+	}
+	p.Jitter = math.Max(0, math.Min(p.Jitter, 1))
+	return p
+}
+
+// backoff 第attempt次尝试失败后需要等待的时间
+func (p RetryPolicy) backoff(attempt int) time.Duration {
+	d := float64(p.InitialBackoff) * math.Pow(p.Multiplier, float64(attempt-1))
+	d = math.Min(d, float64(p.MaxBackoff))
+	if p.Jitter > 0 {
+		//在[d*(1-jitter), d*(1+jitter)]之间随机
+		d += d * p.Jitter * (rand.Float64()*2 - 1)
+	}
+	return time.Duration(d)
+}
+
+// DeadLetterRecord 重试耗尽后写入死信writer的记录
+type DeadLetterRecord struct {
+	Time     time.Time `json:"time"`
+	Writer   string    `json:"writer"`   //失败的writer
+	Error    string    `json:"error"`    //最后一次失败的原因
+	Attempts int       `json:"attempts"` //尝试的次数
+	Record   string    `json:"record"`   //原始的日志
+}
+
+// RetryWriter 写入失败时按照RetryPolicy重试,
+// 重试耗尽或遇到永久性错误后,把原始日志和失败原因写入死信writer
+type RetryWriter struct {
+	inner      Writer
+	name       string
+	policy     RetryPolicy
+	deadLetter Writer //可以为nil,为nil时直接返回错误
+
+	stop     chan struct{}
+	stopOnce sync.Once
+}
+
+func NewRetryWriter(inner Writer, name string, policy RetryPolicy, deadLetter Writer) *RetryWriter {
+	return &RetryWriter{
+		inner:      inner,
+		name:       name,
+		policy:     policy.withDefaults(),
+		deadLetter: deadLetter,
+		stop:       make(chan struct{}),
+	}
+}
+
+func (r *RetryWriter) Write(data []byte) error {
+	var (
+		err     error
+		attempt int
+	)
+	for attempt = 1; ; attempt++ {
+		err = r.inner.Write(data)
+		if err == nil {
+			return nil
+		}
+		if IsPermanent(err) || attempt >= r.policy.MaxAttempts {
+			break
+		}
+		if !r.sleep(max(r.policy.backoff(attempt), retryAfter(err))) {
+			break
+		}
+	}
+	return r.toDeadLetter(data, err, attempt)
+}
+
+// WriteBatch inner支持批量写入时整批重试,重试耗尽后整批写入死信writer;
+// 否则逐条写入并各自重试,避免重试时重复写入已经成功的日志
+func (r *RetryWriter) WriteBatch(batch [][]byte) error {
+	msgs := make([]*message.Message, len(batch))
+	for i, data := range batch {
+		msgs[i] = &message.Message{Value: data}
+	}
+	return r.WriteMessages(msgs)
+}
+
+// WriteMessages 同WriteBatch,inner实现了MessageWriter时会带上日志的元数据
+// 没有写入死信的失败日志(没有配置死信或者写入死信失败)通过BatchError返回,下标为在msgs中的下标,
+// 外层的SpoolWriter只会重试其中不是永久性错误的日志,不会重复写入已经成功的日志
+func (r *RetryWriter) WriteMessages(msgs []*message.Message) error {
+	failed := make(map[int]error)
+	if !SupportsBatch(r.inner) {
+		for i, m := range msgs {
+			if err := r.Write(m.Value); err != nil {
+				failed[i] = err
+			}
+		}
+		return batchResult(failed)
+	}
+
+	//pending为这次需要写入的日志在msgs中的下标
+	pending := make([]int, len(msgs))
+	for i := range pending {
+		pending[i] = i
+	}
+	for attempt := 1; ; attempt++ {
+		batch := make([]*message.Message, len(pending))
+		for j, i := range pending {
+			batch[j] = msgs[i]
+		}
+		err := Deliver(r.inner, batch)
+		if err == nil {
+			return batchResult(failed)
+		}
+		var be *BatchError
+		if !errors.As(err, &be) {
+			if IsPermanent(err) || attempt >= r.policy.MaxAttempts ||
+				!r.sleep(max(r.policy.backoff(attempt), retryAfter(err))) {
+				r.allToDeadLetter(msgs, pending, err, attempt, failed)
+				return batchResult(failed)
+			}
+			continue
+		}
+		//只有部分日志失败时,只重试失败的日志,永久性错误和重试耗尽的日志按照各自的原因写入死信
+		last := attempt >= r.policy.MaxAttempts
+		var retry []int
+		for j, i := range pending {
+			cause, ok := be.Errors[j]
+			switch {
+			case !ok:
+			case last || IsPermanent(cause):
+				if derr := r.toDeadLetter(msgs[i].Value, cause, attempt); derr != nil {
+					failed[i] = derr
+				}
+			default:
+				retry = append(retry, i)
+			}
+		}
+		if len(retry) == 0 {
+			return batchResult(failed)
+		}
+		pending = retry
+		if !r.sleep(max(r.policy.backoff(attempt), retryAfter(err))) {
+			r.allToDeadLetter(msgs, pending, err, attempt, failed)
+			return batchResult(failed)
+		}
+	}
+}
+
+// allToDeadLetter 把msgs中下标为indexes的日志以同一个原因写入死信writer,没有写入的记录到failed中
+func (r *RetryWriter) allToDeadLetter(msgs []*message.Message, indexes []int, cause error, attempts int, failed map[int]error) {
+	for _, i := range indexes {
+		if derr := r.toDeadLetter(msgs[i].Value, cause, attempts); derr != nil {
+			failed[i] = derr
+		}
+	}
+}
+
+// batchResult 没有失败的日志时返回nil
+func batchResult(failed map[int]error) error {
+	if len(failed) == 0 {
+		return nil
+	}
+	return &BatchError{Errors: failed}
+}
+
+// toDeadLetter 把失败的日志写入死信writer
+func (r *RetryWriter) toDeadLetter(data []byte, cause error, attempts int) error {
+	if r.deadLetter == nil {
+		return fmt.Errorf("%s: write failed after %d attempts: %w", r.name, attempts, cause)
+	}
+	b, err := json.Marshal(DeadLetterRecord{
+		Time:     time.Now(),
+		Writer:   r.name,
+		Error:    cause.Error(),
+		Attempts: attempts,
+		Record:   string(data),
+	})
+	if err != nil {
+		return fmt.Errorf("%s: encode dead letter failed: %v (original error: %w)", r.name, err, cause)
+	}
+	if err := r.deadLetter.Write(append(b, '\n')); err != nil {
+		return fmt.Errorf("%s: write dead letter failed: %v (original error: %w)", r.name, err, cause)
+	}
+	return nil
+}
+
+// sleep 等待d,如果writer已经关闭则返回false
+func (r *RetryWriter) sleep(d time.Duration) bool {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return true
+	case <-r.stop:
+		return false
+	}
+}
+
+// Unwrap 实现Wrapper,返回被包装的writer
+func (r *RetryWriter) Unwrap() Writer {
+	return r.inner
+}
+
+func (r *RetryWriter) Close() error {
+	r.stopOnce.Do(func() { close(r.stop) })
+	err := r.inner.Close()
+	if r.deadLetter != nil {
+		if derr := r.deadLetter.Close(); err == nil {
+			err = derr
+		}
+	}
+	return err
+}
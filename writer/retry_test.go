@@ -0,0 +1,171 @@
+package writer
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+)
+
+// memWriter 把写入的数据保存在内存中
+type memWriter struct {
+	records [][]byte
+}
+
+func (m *memWriter) Write(data []byte) error {
+	m.records = append(m.records, append([]byte(nil), data...))
+	return nil
+}
+func (m *memWriter) Close() error {
+	return nil
+}
+
+// countingWriter 记录调用次数,总是返回err
+type countingWriter struct {
+	calls int
+	err   error
+}
+
+func (c *countingWriter) Write(data []byte) error {
+	c.calls++
+	return c.err
+}
+func (c *countingWriter) Close() error {
+	return nil
+}
+
+var fastPolicy = RetryPolicy{MaxAttempts: 3, InitialBackoff: time.Millisecond, MaxBackoff: time.Millisecond}
+
+func TestRetryWriter_SucceedAfterRetry(t *testing.T) {
+	inner := &flakyWriter{fails: 2}
+	dl := &memWriter{}
+	r := NewRetryWriter(inner, "test", fastPolicy, dl)
+	if err := r.Write([]byte("hello")); err != nil {
+		t.Fatalf("Write() error = %v", err)
+	}
+	if got := inner.received(); len(got) != 1 || got[0] != "hello" {
+		t.Errorf("unexpected records: %v", got)
+	}
+	if len(dl.records) != 0 {
+		t.Errorf("expected no dead letters, got %d", len(dl.records))
+	}
+}
+
+func TestRetryWriter_DeadLetter(t *testing.T) {
+	tests := []struct {
+		name         string
+		err          error
+		wantCalls    int
+		wantAttempts int
+	}{
+		{"retryable error", errors.New("timeout"), 3, 3},
+		{"permanent error", Permanent(errors.New("bad request")), 1, 1},
+		{"wrapped permanent error", fmt.Errorf("wrapped: %w", Permanent(errors.New("bad request"))), 1, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			inner := &countingWriter{err: tt.err}
+			dl := &memWriter{}
+			r := NewRetryWriter(inner, "test", fastPolicy, dl)
+			if err := r.Write([]byte("payload")); err != nil {
+				t.Fatalf("Write() error = %v", err)
+			}
+			if inner.calls != tt.wantCalls {
+				t.Errorf("expected %d calls, got %d", tt.wantCalls, inner.calls)
+			}
+			if len(dl.records) != 1 {
+				t.Fatalf("expected 1 dead letter, got %d", len(dl.records))
+			}
+			var rec DeadLetterRecord
+			if err := json.Unmarshal(dl.records[0], &rec); err != nil {
+				t.Fatal(err)
+			}
+			if rec.Record != "payload" || rec.Writer != "test" || rec.Attempts != tt.wantAttempts || rec.Error != tt.err.Error() {
+				t.Errorf("unexpected dead letter: %+v", rec)
+			}
+		})
+	}
+}
+
+func TestRetryWriter_NoDeadLetter(t *testing.T) {
+	inner := &countingWriter{err: errors.New("timeout")}
+	r := NewRetryWriter(inner, "test", fastPolicy, nil)
+	if err := r.Write([]byte("payload")); err == nil {
+		t.Fatal("expected error without dead letter writer")
+	}
+}
+
+func TestRetryPolicy_Backoff(t *testing.T) {
+	p := RetryPolicy{InitialBackoff: 100 * time.Millisecond, MaxBackoff: time.Second, Multiplier: 2}.withDefaults()
+	tests := []struct {
+		attempt int
+		want    time.Duration
+	}{
+		{1, 100 * time.Millisecond},
+		{2, 200 * time.Millisecond},
+		{3, 400 * time.Millisecond},
+		{5, time.Second},
+	}
+	for _, tt := range tests {
+		if got := p.backoff(tt.attempt); got != tt.want {
+			t.Errorf("backoff(%d) = %v, want %v", tt.attempt, got, tt.want)
+		}
+	}
+
+	p.Jitter = 0.5
+	for i := 0; i < 100; i++ {
+		if got := p.backoff(1); got < 50*time.Millisecond || got > 150*time.Millisecond {
+			t.Fatalf("backoff with jitter out of range: %v", got)
+		}
+	}
+}
+
+// partialWriter 第一次写入时第2条日志返回可以重试的错误,第3条返回永久性错误
+type partialWriter struct {
+	calls   int
+	written []string
+}
+
+func (p *partialWriter) Write(data []byte) error {
+	return p.WriteBatch([][]byte{data})
+}
+func (p *partialWriter) WriteBatch(batch [][]byte) error {
+	p.calls++
+	if p.calls == 1 && len(batch) == 3 {
+		p.written = append(p.written, string(batch[0]))
+		return &BatchError{Errors: map[int]error{
+			1: errors.New("timeout"),
+			2: Permanent(errors.New("type mismatch")),
+		}}
+	}
+	for _, data := range batch {
+		p.written = append(p.written, string(data))
+	}
+	return nil
+}
+func (p *partialWriter) Close() error {
+	return nil
+}
+
+func TestRetryWriter_BatchError(t *testing.T) {
+	inner := &partialWriter{}
+	dl := &memWriter{}
+	r := NewRetryWriter(inner, "test", fastPolicy, dl)
+	if err := r.WriteBatch([][]byte{[]byte("a"), []byte("b"), []byte("c")}); err != nil {
+		t.Fatalf("WriteBatch() error = %v", err)
+	}
+	if inner.calls != 2 || len(inner.written) != 2 || inner.written[0] != "a" || inner.written[1] != "b" {
+		t.Errorf("expected only the retryable record to be retried, calls = %d, written = %v", inner.calls, inner.written)
+	}
+	if len(dl.records) != 1 {
+		t.Fatalf("expected 1 dead letter, got %d", len(dl.records))
+	}
+	var rec DeadLetterRecord
+	if err := json.Unmarshal(dl.records[0], &rec); err != nil {
+		t.Fatal(err)
+	}
+	if rec.Record != "c" || rec.Error != "type mismatch" {
+		t.Errorf("unexpected dead letter %+v", rec)
+	}
+}
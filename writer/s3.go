@@ -0,0 +1,233 @@
+package writer
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// s3Client S3兼容的对象存储(AWS S3、MinIO等)的最小客户端,只支持上传对象,请求使用SigV4签名
+type s3Client struct {
+	endpoint     *url.URL
+	region       string
+	bucket       string
+	accessKey    string
+	secretKey    string
+	sessionToken string
+	pathStyle    bool //使用 endpoint/bucket/key 而不是 bucket.endpoint/key,MinIO一般需要
+	client       *http.Client
+	now          func() time.Time
+}
+
+// putObject 用一个请求上传对象
+func (c *s3Client) putObject(key string, body []byte, contentType string) error {
+	header := http.Header{"Content-Type": {contentType}}
+	resp, err := c.do(http.MethodPut, key, nil, body, header)
+	if err != nil {
+		return err
+	}
+	drainBody(resp)
+	return nil
+}
+
+// multipartUpload 把body分成partSize大小的分片上传,失败时取消上传,避免残留的分片占用空间
+func (c *s3Client) multipartUpload(key string, body []byte, contentType string, partSize int) error {
+	resp, err := c.do(http.MethodPost, key, url.Values{"uploads": {""}}, nil, http.Header{"Content-Type": {contentType}})
+	if err != nil {
+		return err
+	}
+	var initiated struct {
+		UploadID string `xml:"UploadId"`
+	}
+	err = xml.NewDecoder(resp.Body).Decode(&initiated)
+	drainBody(resp)
+	if err != nil || initiated.UploadID == "" {
+		return fmt.Errorf("s3: invalid CreateMultipartUpload response: %v", err)
+	}
+
+	type part struct {
+		PartNumber int    `xml:"PartNumber"`
+		ETag       string `xml:"ETag"`
+	}
+	var parts []part
+	for offset, n := 0, 1; offset < len(body); offset, n = offset+partSize, n+1 {
+		chunk := body[offset:min(offset+partSize, len(body))]
+		query := url.Values{"partNumber": {strconv.Itoa(n)}, "uploadId": {initiated.UploadID}}
+		resp, err := c.do(http.MethodPut, key, query, chunk, nil)
+		if err != nil {
+			c.abort(key, initiated.UploadID)
+			return err
+		}
+		parts = append(parts, part{PartNumber: n, ETag: resp.Header.Get("ETag")})
+		drainBody(resp)
+	}
+
+	complete, err := xml.Marshal(struct {
+		XMLName xml.Name `xml:"CompleteMultipartUpload"`
+		Parts   []part   `xml:"Part"`
+	}{Parts: parts})
+	if err != nil {
+		c.abort(key, initiated.UploadID)
+		return Permanent(err)
+	}
+	resp, err = c.do(http.MethodPost, key, url.Values{"uploadId": {initiated.UploadID}}, complete, http.Header{"Content-Type": {"application/xml"}})
+	if err != nil {
+		c.abort(key, initiated.UploadID)
+		return err
+	}
+	defer drainBody(resp)
+	//CompleteMultipartUpload出错时也可能返回200,错误在响应内容中
+	b, _ := io.ReadAll(io.LimitReader(resp.Body, maxErrorBody))
+	if bytes.Contains(b, []byte("<Error>")) {
+		c.abort(key, initiated.UploadID)
+		return fmt.Errorf("s3: complete multipart upload failed: %s", b)
+	}
+	return nil
+}
+
+func (c *s3Client) abort(key, uploadID string) {
+	resp, err := c.do(http.MethodDelete, key, url.Values{"uploadId": {uploadID}}, nil, nil)
+	if err == nil {
+		drainBody(resp)
+	}
+}
+
+// do 发送签名后的请求,非2xx的响应返回httpError
+func (c *s3Client) do(method, key string, query url.Values, body []byte, header http.Header) (*http.Response, error) {
+	u := *c.endpoint
+	path := "/" + key
+	if c.pathStyle {
+		path = "/" + c.bucket + path
+	} else {
+		u.Host = c.bucket + "." + u.Host
+	}
+	u.RawPath = awsURIEncode(path, false)
+	u.Path = path
+	u.RawQuery = awsCanonicalQuery(query)
+
+	req, err := http.NewRequest(method, u.String(), bytes.NewReader(body))
+	if err != nil {
+		return nil, Permanent(fmt.Errorf("s3: %w", err))
+	}
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	c.sign(req, body)
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("s3: request failed: %w", err)
+	}
+	if resp.StatusCode/100 != 2 {
+		defer drainBody(resp)
+		return nil, fmt.Errorf("s3: %s %s: %w", method, key, newHTTPError(resp))
+	}
+	return resp, nil
+}
+
+// sign 按照AWS Signature Version 4给请求签名,host和除了下面几个以外的请求头都会参与签名
+func (c *s3Client) sign(req *http.Request, body []byte) {
+	now := c.now().UTC()
+	amzDate := now.Format("20060102T150405Z")
+	date := now.Format("20060102")
+	payloadHash := sha256Hex(body)
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+	if c.sessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", c.sessionToken)
+	}
+
+	headers := map[string]string{"host": req.URL.Host}
+	for k, v := range req.Header {
+		switch k = strings.ToLower(k); k {
+		case "authorization", "user-agent", "content-length", "accept-encoding":
+			continue
+		default:
+			headers[k] = strings.TrimSpace(strings.Join(v, ","))
+		}
+	}
+	names := make([]string, 0, len(headers))
+	for k := range headers {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+	var canonicalHeaders strings.Builder
+	for _, k := range names {
+		canonicalHeaders.WriteString(k + ":" + headers[k] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		req.URL.RawQuery,
+		canonicalHeaders.String(),
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+	scope := date + "/" + c.region + "/s3/aws4_request"
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + sha256Hex([]byte(canonicalRequest))
+
+	key := hmacSHA256([]byte("AWS4"+c.secretKey), date)
+	key = hmacSHA256(key, c.region)
+	key = hmacSHA256(key, "s3")
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		c.accessKey, scope, signedHeaders, signature))
+}
+
+// awsCanonicalQuery 按照key排序并编码查询参数
+func awsCanonicalQuery(query url.Values) string {
+	keys := make([]string, 0, len(query))
+	for k := range query {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var parts []string
+	for _, k := range keys {
+		for _, v := range query[k] {
+			parts = append(parts, awsURIEncode(k, true)+"="+awsURIEncode(v, true))
+		}
+	}
+	return strings.Join(parts, "&")
+}
+
+// awsURIEncode 除了A-Za-z0-9-_.~以外的字符都编码,encodeSlash为false时保留/
+func awsURIEncode(s string, encodeSlash bool) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		ch := s[i]
+		switch {
+		case 'A' <= ch && ch <= 'Z', 'a' <= ch && ch <= 'z', '0' <= ch && ch <= '9',
+			ch == '-', ch == '_', ch == '.', ch == '~':
+			b.WriteByte(ch)
+		case ch == '/' && !encodeSlash:
+			b.WriteByte(ch)
+		default:
+			fmt.Fprintf(&b, "%%%02X", ch)
+		}
+	}
+	return b.String()
+}
+
+func sha256Hex(b []byte) string {
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:])
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
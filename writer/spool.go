@@ -0,0 +1,178 @@
+package writer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log-collector/logging"
+	"log-collector/message"
+	"log-collector/spool"
+	"time"
+)
+
+const (
+	spoolMinBackoff = time.Second
+	spoolMaxBackoff = 30 * time.Second
+	spoolBatchSize  = 500 //inner支持批量写入时,每次从队列中读取的条数
+)
+
+// SpoolWriter 在writer前加一层磁盘队列
+// Write只负责把数据追加到队列中,后台协程按顺序把队列中的数据写入到被包装的writer,
+// 写入失败时会一直重试(永久性错误除外),直到目的地恢复,因此目的地不可用时不会阻塞reader,也不会丢数据
+type SpoolWriter struct {
+	inner  Writer
+	dir    string
+	queue  *spool.Queue
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// NewSpoolWriter 打开dir下的队列,并开始把队列中(包括上次退出时残留)的数据写入inner
+func NewSpoolWriter(inner Writer, dir string, opts spool.Options) (*SpoolWriter, error) {
+	q, err := spool.Open(dir, opts)
+	if err != nil {
+		return nil, fmt.Errorf("open spool failed: %w", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	s := &SpoolWriter{
+		inner:  inner,
+		dir:    dir,
+		queue:  q,
+		cancel: cancel,
+		done:   make(chan struct{}),
+	}
+	go s.run(ctx)
+	return s, nil
+}
+
+func (s *SpoolWriter) Write(data []byte) error {
+	return s.queue.Append(message.Marshal(message.New(data)))
+}
+
+func (s *SpoolWriter) WriteBatch(batch [][]byte) error {
+	for _, data := range batch {
+		if err := s.Write(data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// WriteMessages 日志的元数据也会写入队列,补发时一起交给inner
+func (s *SpoolWriter) WriteMessages(msgs []*message.Message) error {
+	for _, m := range msgs {
+		if err := s.queue.Append(message.Marshal(m)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Unwrap 实现Wrapper,返回被包装的writer
+func (s *SpoolWriter) Unwrap() Writer {
+	return s.inner
+}
+
+// Close 停止后台写入,队列中剩余的数据保留在磁盘上,下次启动时继续写入
+func (s *SpoolWriter) Close() error {
+	s.cancel()
+	<-s.done
+	err := s.queue.Close()
+	if ierr := s.inner.Close(); err == nil {
+		err = ierr
+	}
+	return err
+}
+
+// run 把队列中的数据依次写入inner
+func (s *SpoolWriter) run(ctx context.Context) {
+	defer close(s.done)
+	backoff := spoolMinBackoff
+	n := 1
+	if SupportsBatch(s.inner) {
+		n = spoolBatchSize
+	}
+	for {
+		records, err := s.queue.Peek(n)
+		if err != nil {
+			logging.Component("spool", "dir", s.dir).Error("read failed", "error", err)
+			if !sleepCtx(ctx, backoff) {
+				return
+			}
+			continue
+		}
+		if len(records) == 0 {
+			select {
+			case <-s.queue.Wait():
+				continue
+			case <-ctx.Done():
+				return
+			}
+		}
+		if !s.deliver(ctx, s.decodeRecords(records), &backoff) {
+			return
+		}
+		backoff = spoolMinBackoff
+		if err := s.queue.Ack(len(records)); err != nil {
+			logging.Component("spool", "dir", s.dir).Error("ack failed", "error", err)
+		}
+	}
+}
+
+// deliver 把msgs写入inner,直到成功或者遇到永久性错误,只有部分日志失败时只重试失败的日志
+// ctx结束时返回false,这一批日志没有确认,下次启动时会重新写入
+func (s *SpoolWriter) deliver(ctx context.Context, msgs []*message.Message, backoff *time.Duration) bool {
+	for len(msgs) > 0 {
+		err := Deliver(s.inner, msgs)
+		if err == nil {
+			return true
+		}
+		var be *BatchError
+		if errors.As(err, &be) {
+			retry, causes := be.split(msgs)
+			if dropped := len(causes) - len(retry); dropped > 0 {
+				logging.Component("spool", "dir", s.dir).Error("dropping records after permanent error", "count", dropped, "error", err)
+			}
+			if msgs = retry; len(msgs) == 0 {
+				return true
+			}
+		} else if IsPermanent(err) {
+			//永久性错误重试也没有用,丢弃这批日志,避免阻塞后面的日志
+			logging.Component("spool", "dir", s.dir).Error("dropping records after permanent error", "count", len(msgs), "error", err)
+			return true
+		}
+		wait := max(*backoff, retryAfter(err))
+		logging.Component("spool", "dir", s.dir).Warn("write failed, will retry", "retryIn", wait, "error", err)
+		if !sleepCtx(ctx, wait) {
+			return false
+		}
+		*backoff = min(*backoff*2, spoolMaxBackoff)
+	}
+	return true
+}
+
+// decodeRecords 解码队列中的日志,无法解码的日志会被丢弃
+func (s *SpoolWriter) decodeRecords(records [][]byte) []*message.Message {
+	msgs := make([]*message.Message, 0, len(records))
+	for _, rec := range records {
+		m, err := message.Unmarshal(rec)
+		if err != nil {
+			logging.Component("spool", "dir", s.dir).Error("dropping undecodable record", "error", err)
+			continue
+		}
+		msgs = append(msgs, m)
+	}
+	return msgs
+}
+
+// sleepCtx 等待d,如果ctx先结束则返回false
+func sleepCtx(ctx context.Context, d time.Duration) bool {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
@@ -0,0 +1,209 @@
+package writer
+
+import (
+	"errors"
+	"log-collector/message"
+	"log-collector/spool"
+	"sync"
+	"testing"
+	"time"
+)
+
+// flakyWriter 前fails次写入返回错误
+type flakyWriter struct {
+	mutex sync.Mutex
+	fails int
+	got   []string
+}
+
+func (f *flakyWriter) Write(data []byte) error {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	if f.fails > 0 {
+		f.fails--
+		return errors.New("destination unavailable")
+	}
+	f.got = append(f.got, string(data))
+	return nil
+}
+func (f *flakyWriter) Close() error {
+	return nil
+}
+func (f *flakyWriter) received() []string {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	return append([]string(nil), f.got...)
+}
+
+func TestSpoolWriter_DeliverAfterOutage(t *testing.T) {
+	inner := &flakyWriter{fails: 1}
+	s, err := NewSpoolWriter(inner, t.TempDir(), spool.Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	for _, msg := range []string{"a", "b", "c"} {
+		if err := s.Write([]byte(msg)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for len(inner.received()) < 3 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	got := inner.received()
+	if len(got) != 3 || got[0] != "a" || got[1] != "b" || got[2] != "c" {
+		t.Fatalf("unexpected delivered records: %v", got)
+	}
+}
+
+func TestSpoolWriter_ReplayOnRestart(t *testing.T) {
+	dir := t.TempDir()
+	//目的地一直不可用,数据留在队列中
+	down := &flakyWriter{fails: 1 << 30}
+	s, err := NewSpoolWriter(down, dir, spool.Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.Write([]byte("kept"))
+	s.Close()
+
+	up := &flakyWriter{}
+	s, err = NewSpoolWriter(up, dir, spool.Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	deadline := time.Now().Add(5 * time.Second)
+	for len(up.received()) < 1 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if got := up.received(); len(got) != 1 || got[0] != "kept" {
+		t.Fatalf("unexpected replayed records: %v", got)
+	}
+}
+
+// topicWriter 实现MessageWriter,记录收到的日志的topic
+type topicWriter struct {
+	flakyWriter
+	topics []string
+}
+
+func (w *topicWriter) WriteMessages(msgs []*message.Message) error {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	for _, m := range msgs {
+		w.topics = append(w.topics, m.Topic+"/"+string(m.Value))
+	}
+	return nil
+}
+
+func TestSpoolWriter_KeepsMetadata(t *testing.T) {
+	inner := &topicWriter{}
+	s, err := NewSpoolWriter(inner, t.TempDir(), spool.Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	if err := s.WriteMessages([]*message.Message{{Value: []byte("a"), Topic: "t1"}, {Value: []byte("b"), Topic: "t2"}}); err != nil {
+		t.Fatal(err)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		inner.mutex.Lock()
+		n := len(inner.topics)
+		inner.mutex.Unlock()
+		if n == 2 {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	inner.mutex.Lock()
+	defer inner.mutex.Unlock()
+	if len(inner.topics) != 2 || inner.topics[0] != "t1/a" || inner.topics[1] != "t2/b" {
+		t.Fatalf("unexpected delivered records: %v", inner.topics)
+	}
+}
+
+// rowWriter 像clickhouse一样逐条报告失败的日志:bad总是永久性错误,flaky前fails次是可以重试的错误
+type rowWriter struct {
+	mutex sync.Mutex
+	fails int
+	got   []string
+}
+
+func (w *rowWriter) Write(data []byte) error {
+	return w.WriteMessages([]*message.Message{message.New(data)})
+}
+func (w *rowWriter) WriteMessages(msgs []*message.Message) error {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	errs := make(map[int]error)
+	for i, m := range msgs {
+		switch v := string(m.Value); {
+		case v == "bad":
+			errs[i] = Permanent(errors.New("type mismatch"))
+		case v == "flaky" && w.fails > 0:
+			w.fails--
+			errs[i] = errors.New("timeout")
+		default:
+			w.got = append(w.got, v)
+		}
+	}
+	if len(errs) > 0 {
+		return &BatchError{Errors: errs}
+	}
+	return nil
+}
+func (w *rowWriter) Close() error {
+	return nil
+}
+func (w *rowWriter) received() []string {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	return append([]string(nil), w.got...)
+}
+
+func TestSpoolWriter_RetryPartialFailure(t *testing.T) {
+	//重试耗尽后flaky还是失败,交给spool稍后重试;bad是永久性错误,被丢弃;成功的日志不会重复写入
+	inner := &rowWriter{fails: 2}
+	r := NewRetryWriter(inner, "clickhouse", RetryPolicy{MaxAttempts: 2, InitialBackoff: time.Millisecond}, nil)
+	s, err := NewSpoolWriter(r, t.TempDir(), spool.Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	var msgs []*message.Message
+	for _, v := range []string{"a", "bad", "flaky", "b"} {
+		msgs = append(msgs, message.New([]byte(v)))
+	}
+	if err := s.WriteMessages(msgs); err != nil {
+		t.Fatal(err)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for len(inner.received()) < 3 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	//等一会儿,确认没有重复写入
+	time.Sleep(50 * time.Millisecond)
+	if got := inner.received(); len(got) != 3 || got[0] != "a" || got[1] != "b" || got[2] != "flaky" {
+		t.Fatalf("unexpected delivered records: %v", got)
+	}
+}
+
+func TestRetryWriter_PartialFailureWithoutDeadLetter(t *testing.T) {
+	inner := &rowWriter{fails: 5}
+	r := NewRetryWriter(inner, "clickhouse", RetryPolicy{MaxAttempts: 2, InitialBackoff: time.Millisecond}, nil)
+	err := r.WriteMessages([]*message.Message{
+		message.New([]byte("a")), message.New([]byte("bad")), message.New([]byte("flaky")),
+	})
+	var be *BatchError
+	if !errors.As(err, &be) {
+		t.Fatalf("expected BatchError, got %v", err)
+	}
+	if len(be.Errors) != 2 || !IsPermanent(be.Errors[1]) || IsPermanent(be.Errors[2]) {
+		t.Errorf("unexpected errors %v", be.Errors)
+	}
+}
@@ -1,11 +1,81 @@
 package writer
 
-type StdoutWriterBuilder struct{}
+import (
+	"fmt"
+	"log-collector/config"
+	"log-collector/encoder"
+	"os"
+)
+
+// StdoutColor 控制台格式是否带颜色
+type StdoutColor string
+
+const (
+	ColorAuto   StdoutColor = "auto"   //stdout是终端并且没有设置NO_COLOR时带颜色,默认
+	ColorAlways StdoutColor = "always" //总是带颜色,例如输出被重定向到支持颜色的日志查看工具
+	ColorNever  StdoutColor = "never"  //不带颜色
+)
+
+// StdoutConfig 配置文件中stdout writer的配置
+type StdoutConfig struct {
+	Pretty bool   `yaml:"pretty"` //把JSON日志格式化为便于阅读的一行:时间 级别 [服务] 消息 其余字段
+	Color  string `yaml:"color"`  //auto|always|never,只在pretty为true时生效
+}
+
+type StdoutWriterBuilder struct {
+	Pretty bool
+	Color  StdoutColor
+}
 
 func NewStdoutWriterBuilder() *StdoutWriterBuilder {
 	return &StdoutWriterBuilder{}
 }
 
+func init() {
+	Register("stdout", newStdoutBuilder)
+}
+
+// newStdoutBuilder 解析并检查stdout writer的配置
+func newStdoutBuilder(options map[string]interface{}) (Builder, error) {
+	var conf StdoutConfig
+	if err := config.Decode(options, &conf); err != nil {
+		return nil, err
+	}
+	switch StdoutColor(conf.Color) {
+	case "", ColorAuto, ColorAlways, ColorNever:
+	default:
+		return nil, config.ValidationErrors{{Path: "color", Reason: fmt.Sprintf("unknown color mode %q, expected one of auto, always, never", conf.Color)}}
+	}
+	return NewStdoutWriterBuilder().WithPretty(conf.Pretty, StdoutColor(conf.Color)), nil
+}
+
+// WithPretty 设置是否使用便于阅读的控制台格式,color为空时为ColorAuto
+func (s *StdoutWriterBuilder) WithPretty(pretty bool, color StdoutColor) *StdoutWriterBuilder {
+	s.Pretty = pretty
+	s.Color = color
+	return s
+}
+
 func (s *StdoutWriterBuilder) Build() (Writer, error) {
-	return &StdoutWriter{}, nil
+	w := &StdoutWriter{}
+	if s.Pretty {
+		var color bool
+		switch s.Color {
+		case "", ColorAuto:
+			color = isTerminal(os.Stdout) && os.Getenv("NO_COLOR") == ""
+		case ColorAlways:
+			color = true
+		case ColorNever:
+		default:
+			return nil, fmt.Errorf("unknown color mode: %q", s.Color)
+		}
+		w.console = encoder.NewConsole(color)
+	}
+	return w, nil
+}
+
+// isTerminal f是否是终端,输出被重定向到文件或者管道时不是终端
+func isTerminal(f *os.File) bool {
+	fi, err := f.Stat()
+	return err == nil && fi.Mode()&os.ModeCharDevice != 0
 }
@@ -2,19 +2,39 @@ package writer
 
 import (
 	"fmt"
+	"io"
+	"log-collector/encoder"
+	"log-collector/message"
+	"os"
 	"sync"
 )
 
 //将日志写入到控制台
 
 type StdoutWriter struct {
-	mutex sync.Mutex
+	mutex   sync.Mutex
+	out     io.Writer       //为nil时为os.Stdout
+	console encoder.Encoder //不为nil时使用便于阅读的控制台格式
 }
 
 func (s *StdoutWriter) Write(data []byte) error {
+	line := appendLine(nil, data)
+	if s.console != nil {
+		//控制台格式只用于阅读,格式化失败时输出原始的日志
+		if b, err := s.console.Encode(message.New(data)); err == nil {
+			line = b
+		}
+	}
 	s.mutex.Lock()
 	defer s.mutex.Unlock()
-	fmt.Printf(string(data))
+	out := s.out
+	if out == nil {
+		out = os.Stdout
+	}
+	//不能用fmt.Printf,日志中的%会被当作格式化的占位符
+	if _, err := out.Write(line); err != nil {
+		return fmt.Errorf("failed to write data to stdout: %v", err)
+	}
 	return nil
 }
 func (s *StdoutWriter) Close() error {
@@ -1,6 +1,8 @@
 package writer
 
 import (
+	"bytes"
+	"strings"
 	"testing"
 )
 
@@ -25,3 +27,19 @@ func TestStdoutWriter_Write(t *testing.T) {
 		})
 	}
 }
+
+func TestStdoutWriter_Pretty(t *testing.T) {
+	w, err := NewStdoutWriterBuilder().WithPretty(true, ColorNever).Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out bytes.Buffer
+	s := w.(*StdoutWriter)
+	s.out = &out
+	s.Write([]byte(`{"level":"warn","msg":"100% full"}`))
+	s.Write([]byte("raw %d line"))
+	lines := strings.Split(out.String(), "\n")
+	if len(lines) != 3 || !strings.HasSuffix(lines[0], " WARN  100% full") || lines[1] != "raw %d line" {
+		t.Errorf("unexpected output %q", out.String())
+	}
+}
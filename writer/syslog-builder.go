@@ -0,0 +1,202 @@
+package writer
+
+import (
+	"fmt"
+	"log-collector/config"
+	"net"
+	"os"
+	"strings"
+	"time"
+)
+
+// SyslogConfig 配置文件中syslog writer的配置
+type SyslogConfig struct {
+	Network    string        `yaml:"network"`    //udp|tcp|tls,默认udp
+	Address    string        `yaml:"address"`    //host:port
+	Framing    string        `yaml:"framing"`    //TCP和TLS的分帧方式:octet-counting(默认)|non-transparent
+	Facility   string        `yaml:"facility"`   //默认local0
+	Severity   string        `yaml:"severity"`   //日志中没有level时的severity,默认info
+	LevelField string        `yaml:"levelField"` //日志级别的字段,默认level
+	Hostname   string        `yaml:"hostname"`   //默认为本机的hostname
+	AppName    string        `yaml:"appName"`    //默认log-collector
+	Timeout    time.Duration `yaml:"timeout"`    //连接和写入的超时时间,默认10s
+	TLS        *TLSOptions   `yaml:"tls"`
+}
+
+func init() {
+	Register("syslog", newSyslogBuilder)
+}
+
+// newSyslogBuilder 解析并检查syslog writer的配置
+func newSyslogBuilder(options map[string]interface{}) (Builder, error) {
+	var conf SyslogConfig
+	if err := config.Decode(options, &conf); err != nil {
+		return nil, err
+	}
+	var errs config.ValidationErrors
+	switch conf.Network {
+	case "", "udp", "tcp", "tls":
+	default:
+		errs.Add("network", "unknown network %q, expected one of udp, tcp, tls", conf.Network)
+	}
+	if _, _, err := net.SplitHostPort(conf.Address); err != nil {
+		errs.Add("address", "%q is not a valid host:port", conf.Address)
+	}
+	switch SyslogFraming(conf.Framing) {
+	case "", SyslogOctetCounting, SyslogNonTransparent:
+	default:
+		errs.Add("framing", "unknown framing %q, expected octet-counting or non-transparent", conf.Framing)
+	}
+	if _, ok := syslogFacilities[strings.ToLower(conf.Facility)]; conf.Facility != "" && !ok {
+		errs.Add("facility", "unknown facility %q", conf.Facility)
+	}
+	if _, ok := parseSyslogSeverity(conf.Severity); conf.Severity != "" && !ok {
+		errs.Add("severity", "unknown severity %q", conf.Severity)
+	}
+	if conf.Timeout < 0 {
+		errs.Add("timeout", "must not be negative")
+	}
+	if conf.TLS != nil {
+		if conf.Network != "tls" {
+			errs.Add("tls", "only allowed when network is tls")
+		}
+		conf.TLS.validate(&errs, "tls")
+	}
+	if len(errs) > 0 {
+		return nil, errs
+	}
+	b := NewSyslogWriterBuilder(conf.Network, conf.Address).
+		WithFraming(SyslogFraming(conf.Framing)).
+		WithFacility(conf.Facility).
+		WithSeverity(conf.Severity, conf.LevelField).
+		WithHeader(conf.Hostname, conf.AppName).
+		WithTimeout(conf.Timeout)
+	if conf.TLS != nil {
+		b.WithTLS(*conf.TLS)
+	}
+	return b, nil
+}
+
+type SyslogWriterBuilder struct {
+	Network    string
+	Address    string
+	Framing    SyslogFraming
+	Facility   string
+	Severity   string
+	LevelField string
+	Hostname   string
+	AppName    string
+	Timeout    time.Duration
+	TLS        *TLSOptions
+}
+
+// NewSyslogWriterBuilder network为udp、tcp或者tls,为空时为udp
+func NewSyslogWriterBuilder(network, addr string) *SyslogWriterBuilder {
+	return &SyslogWriterBuilder{Network: network, Address: addr}
+}
+
+// WithFraming 设置TCP和TLS连接的分帧方式,为空时为SyslogOctetCounting
+func (s *SyslogWriterBuilder) WithFraming(framing SyslogFraming) *SyslogWriterBuilder {
+	s.Framing = framing
+	return s
+}
+
+// WithFacility 设置facility的名称,例如local0、daemon,为空时为local0
+func (s *SyslogWriterBuilder) WithFacility(facility string) *SyslogWriterBuilder {
+	s.Facility = facility
+	return s
+}
+
+// WithSeverity severity为日志中没有level时的severity(为空时为info),levelField为日志级别的字段(为空时为level)
+func (s *SyslogWriterBuilder) WithSeverity(severity, levelField string) *SyslogWriterBuilder {
+	s.Severity = severity
+	s.LevelField = levelField
+	return s
+}
+
+// WithHeader 设置消息头中的HOSTNAME和APP-NAME,hostname为空时为本机的hostname,appName为空时为log-collector
+func (s *SyslogWriterBuilder) WithHeader(hostname, appName string) *SyslogWriterBuilder {
+	s.Hostname = hostname
+	s.AppName = appName
+	return s
+}
+
+// WithTimeout 设置连接和写入的超时时间,小于等于0时为10s
+func (s *SyslogWriterBuilder) WithTimeout(timeout time.Duration) *SyslogWriterBuilder {
+	s.Timeout = timeout
+	return s
+}
+
+// WithTLS 设置network为tls时的TLS配置
+func (s *SyslogWriterBuilder) WithTLS(opts TLSOptions) *SyslogWriterBuilder {
+	s.TLS = &opts
+	return s
+}
+
+func (s *SyslogWriterBuilder) Build() (Writer, error) {
+	network := s.Network
+	switch network {
+	case "":
+		network = "udp"
+	case "udp", "tcp", "tls":
+	default:
+		return nil, fmt.Errorf("unknown syslog network: %q", network)
+	}
+	framing := s.Framing
+	if framing == "" {
+		framing = SyslogOctetCounting
+	}
+	facility := "local0"
+	if s.Facility != "" {
+		facility = strings.ToLower(s.Facility)
+	}
+	facilityCode, ok := syslogFacilities[facility]
+	if !ok {
+		return nil, fmt.Errorf("unknown syslog facility: %q", s.Facility)
+	}
+	severity := 6
+	if s.Severity != "" {
+		if severity, ok = parseSyslogSeverity(s.Severity); !ok {
+			return nil, fmt.Errorf("unknown syslog severity: %q", s.Severity)
+		}
+	}
+	levelField := s.LevelField
+	if levelField == "" {
+		levelField = "level"
+	}
+	hostname := s.Hostname
+	if hostname == "" {
+		hostname, _ = os.Hostname()
+	}
+	appName := s.AppName
+	if appName == "" {
+		appName = "log-collector"
+	}
+	timeout := s.Timeout
+	if timeout <= 0 {
+		timeout = 10 * time.Second
+	}
+	w := &SyslogWriter{
+		network:    network,
+		address:    s.Address,
+		framing:    framing,
+		facility:   facilityCode,
+		severity:   severity,
+		levelField: levelField,
+		hostname:   syslogHeaderField(hostname, 255),
+		appName:    syslogHeaderField(appName, 48),
+		timeout:    timeout,
+	}
+	if network == "tls" {
+		opts := TLSOptions{}
+		if s.TLS != nil {
+			opts = *s.TLS
+		}
+		tlsConf, err := opts.build()
+		if err != nil {
+			return nil, err
+		}
+		w.tlsConfig = tlsConf
+	}
+	return w, nil
+}
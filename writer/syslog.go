@@ -0,0 +1,257 @@
+package writer
+
+import (
+	"bytes"
+	"crypto/tls"
+	"fmt"
+	"log-collector/logging"
+	"log-collector/message"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// SyslogFraming TCP和TLS连接中分隔消息的方式
+type SyslogFraming string
+
+const (
+	SyslogOctetCounting  SyslogFraming = "octet-counting"  //RFC 6587/5425,消息前加上长度,默认
+	SyslogNonTransparent SyslogFraming = "non-transparent" //每条消息以\n结尾
+)
+
+// syslogFacilities facility的名称
+var syslogFacilities = map[string]int{
+	"kern": 0, "user": 1, "mail": 2, "daemon": 3, "auth": 4, "syslog": 5, "lpr": 6, "news": 7,
+	"uucp": 8, "cron": 9, "authpriv": 10, "ftp": 11, "ntp": 12, "security": 13, "console": 14, "solaris-cron": 15,
+	"local0": 16, "local1": 17, "local2": 18, "local3": 19, "local4": 20, "local5": 21, "local6": 22, "local7": 23,
+}
+
+// syslogSeverities 日志级别到severity的映射,不区分大小写
+var syslogSeverities = map[string]int{
+	"emerg": 0, "emergency": 0, "panic": 0,
+	"alert": 1,
+	"crit":  2, "critical": 2, "fatal": 2,
+	"err": 3, "error": 3,
+	"warn": 4, "warning": 4,
+	"notice": 5,
+	"info":   6, "informational": 6, "information": 6,
+	"debug": 7, "trace": 7,
+}
+
+// parseSyslogSeverity 解析日志级别,也可以直接是0~7的数字
+func parseSyslogSeverity(level string) (int, bool) {
+	level = strings.ToLower(strings.TrimSpace(level))
+	if sev, ok := syslogSeverities[level]; ok {
+		return sev, true
+	}
+	if n, err := strconv.Atoi(level); err == nil && n >= 0 && n <= 7 {
+		return n, true
+	}
+	return 0, false
+}
+
+// SyslogWriter 把日志按照RFC 5424的格式发送到syslog服务器,支持UDP、TCP和TLS
+// severity来自日志的level字段,找不到或者无法识别时使用默认的severity;
+// 连接断开后下次写入时重新连接,写入失败时重新连接并重发一次,仍然失败时返回错误,由RetryWriter按照退避策略重试
+type SyslogWriter struct {
+	network    string //udp|tcp|tls
+	address    string
+	tlsConfig  *tls.Config
+	framing    SyslogFraming
+	facility   int
+	severity   int //找不到level时的severity
+	levelField string
+	hostname   string
+	appName    string
+	timeout    time.Duration
+
+	mutex  sync.Mutex
+	conn   net.Conn
+	closed chan struct{} //TCP和TLS连接被对方关闭后关闭,由watch设置
+}
+
+func (s *SyslogWriter) Write(data []byte) error {
+	return s.WriteMessages([]*message.Message{message.New(data)})
+}
+
+func (s *SyslogWriter) WriteBatch(batch [][]byte) error {
+	msgs := make([]*message.Message, len(batch))
+	for i, data := range batch {
+		msgs[i] = message.New(data)
+	}
+	return s.WriteMessages(msgs)
+}
+
+// WriteMessages TCP和TLS在一次写入中发送整批消息,UDP每条消息一个数据报
+func (s *SyslogWriter) WriteMessages(msgs []*message.Message) error {
+	if len(msgs) == 0 {
+		return nil
+	}
+	var (
+		buf    bytes.Buffer
+		frames [][]byte
+		ends   []int //TCP和TLS中每一帧在buf中结束的位置
+	)
+	for _, m := range msgs {
+		line := s.format(m)
+		if s.network == "udp" {
+			frames = append(frames, line)
+			continue
+		}
+		if s.framing == SyslogNonTransparent {
+			buf.Write(bytes.ReplaceAll(line, []byte("\n"), []byte(" ")))
+			buf.WriteByte('\n')
+		} else {
+			buf.WriteString(strconv.Itoa(len(line)))
+			buf.WriteByte(' ')
+			buf.Write(line)
+		}
+		ends = append(ends, buf.Len())
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.network != "udp" {
+		return s.send(buf.Bytes(), ends)
+	}
+	for _, frame := range frames {
+		if err := s.send(frame, []int{len(frame)}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// send 发送data,ends为data中每一帧结束的位置;失败时重新连接并重发一次
+// 重发时跳过已经完整写入连接的帧,只有写了一半的帧会在新的连接上完整地重发,因此服务器不会收到重复的消息
+// 写入连接不代表服务器已经收到,连接断开时已经写入的帧可能丢失
+func (s *SyslogWriter) send(data []byte, ends []int) error {
+	var err error
+	for attempt := 0; attempt < 2; attempt++ {
+		if s.conn == nil || s.peerClosed() {
+			if err = s.connect(); err != nil {
+				continue
+			}
+		}
+		s.conn.SetWriteDeadline(time.Now().Add(s.timeout))
+		var n int
+		if n, err = s.conn.Write(data); err == nil {
+			return nil
+		}
+		data, ends = unwritten(data, ends, n)
+		logging.Component("writer", "address", s.address).Warn("write to syslog failed, reconnecting", "error", err, "written", n)
+		s.closeConn()
+	}
+	return fmt.Errorf("syslog: send to %s failed: %w", s.address, err)
+}
+
+// unwritten 写入了n个字节后还需要发送的数据,从第一个没有完整写入的帧开始
+func unwritten(data []byte, ends []int, n int) ([]byte, []int) {
+	done, i := 0, 0
+	for ; i < len(ends) && ends[i] <= n; i++ {
+		done = ends[i]
+	}
+	rest := make([]int, 0, len(ends)-i)
+	for _, end := range ends[i:] {
+		rest = append(rest, end-done)
+	}
+	return data[done:], rest
+}
+
+func (s *SyslogWriter) connect() error {
+	s.closeConn()
+	dialer := &net.Dialer{Timeout: s.timeout}
+	var (
+		conn net.Conn
+		err  error
+	)
+	if s.network == "tls" {
+		conn, err = tls.DialWithDialer(dialer, "tcp", s.address, s.tlsConfig)
+	} else {
+		conn, err = dialer.Dial(s.network, s.address)
+	}
+	if err != nil {
+		return err
+	}
+	s.conn = conn
+	if s.network != "udp" {
+		s.closed = make(chan struct{})
+		go watch(conn, s.closed)
+	}
+	return nil
+}
+
+// watch 在后台读取TCP连接,syslog服务器不会发送数据,读到EOF或者出错说明连接已经断开,此时关闭closed
+// 这样可以在写入前发现断开的连接,而不是把数据写入已经断开的连接后才发现;连接被closeConn关闭时也会退出
+func watch(conn net.Conn, closed chan struct{}) {
+	var b [1]byte
+	for {
+		if _, err := conn.Read(b[:]); err != nil {
+			close(closed)
+			return
+		}
+	}
+}
+
+// peerClosed 连接是否已经被对方关闭
+func (s *SyslogWriter) peerClosed() bool {
+	select {
+	case <-s.closed:
+		return true
+	default:
+		return false
+	}
+}
+
+func (s *SyslogWriter) closeConn() {
+	if s.conn != nil {
+		s.conn.Close()
+		s.conn = nil
+	}
+}
+
+func (s *SyslogWriter) Close() error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.closeConn()
+	return nil
+}
+
+// format 按照RFC 5424格式化一条日志:
+// <PRI>1 TIMESTAMP HOSTNAME APP-NAME PROCID MSGID STRUCTURED-DATA MSG
+func (s *SyslogWriter) format(m *message.Message) []byte {
+	severity := s.severity
+	if level, ok := m.LookupString(s.levelField); ok {
+		if sev, ok := parseSyslogSeverity(level); ok {
+			severity = sev
+		}
+	}
+	ts := m.Timestamp
+	if ts.IsZero() {
+		ts = time.Now()
+	}
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "<%d>1 %s %s %s - - - ", s.facility*8+severity,
+		ts.Format("2006-01-02T15:04:05.000000Z07:00"), s.hostname, s.appName)
+	b.Write(bytes.TrimRight(m.Value, "\r\n"))
+	return b.Bytes()
+}
+
+// syslogHeaderField RFC 5424头部的字段只能是可打印的ASCII字符,为空时为"-"
+func syslogHeaderField(v string, maxLen int) string {
+	if v == "" {
+		return "-"
+	}
+	b := []byte(v)
+	for i, ch := range b {
+		if ch < 33 || ch > 126 {
+			b[i] = '_'
+		}
+	}
+	if len(b) > maxLen {
+		b = b[:maxLen]
+	}
+	return string(b)
+}
@@ -0,0 +1,208 @@
+package writer
+
+import (
+	"bufio"
+	"crypto/tls"
+	"io"
+	"log-collector/message"
+	"net"
+	"net/http/httptest"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// readOctetCounted 读取一条 "LEN SP MSG" 格式的消息
+func readOctetCounted(r *bufio.Reader) (string, error) {
+	n, err := r.ReadString(' ')
+	if err != nil {
+		return "", err
+	}
+	size, err := strconv.Atoi(strings.TrimSpace(n))
+	if err != nil {
+		return "", err
+	}
+	b := make([]byte, size)
+	_, err = io.ReadFull(r, b)
+	return string(b), err
+}
+
+func TestSyslogWriter_Format(t *testing.T) {
+	w, err := NewSyslogWriterBuilder("udp", "127.0.0.1:514").
+		WithFacility("auth").
+		WithSeverity("notice", "lvl").
+		WithHeader("my host", "app").
+		Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := w.(*SyslogWriter)
+	ts := time.Date(2024, 3, 1, 10, 0, 0, 123456789, time.UTC)
+	tests := []struct {
+		value string
+		want  string
+	}{
+		{`{"lvl":"ERROR","msg":"x"}`, `<35>1 2024-03-01T10:00:00.123456Z my_host app - - - {"lvl":"ERROR","msg":"x"}`},
+		{`{"lvl":"warning"}`, `<36>1 2024-03-01T10:00:00.123456Z my_host app - - - {"lvl":"warning"}`},
+		{`{"lvl":7}`, `<39>1 2024-03-01T10:00:00.123456Z my_host app - - - {"lvl":7}`},
+		{"plain text\n", `<37>1 2024-03-01T10:00:00.123456Z my_host app - - - plain text`},
+	}
+	for _, tt := range tests {
+		if got := string(s.format(&message.Message{Value: []byte(tt.value), Timestamp: ts})); got != tt.want {
+			t.Errorf("format(%s) = %q, want %q", tt.value, got, tt.want)
+		}
+	}
+}
+
+func TestSyslogWriter_UDP(t *testing.T) {
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pc.Close()
+	w, err := NewSyslogWriterBuilder("udp", pc.LocalAddr().String()).WithHeader("host", "app").Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+	if err := w.(BatchWriter).WriteBatch([][]byte{[]byte("a"), []byte("b")}); err != nil {
+		t.Fatal(err)
+	}
+	pc.SetReadDeadline(time.Now().Add(5 * time.Second))
+	buf := make([]byte, 1024)
+	for _, want := range []string{"a", "b"} {
+		n, _, err := pc.ReadFrom(buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := string(buf[:n]); !strings.HasPrefix(got, "<134>1 ") || !strings.HasSuffix(got, " host app - - - "+want) {
+			t.Errorf("unexpected datagram %q", got)
+		}
+	}
+}
+
+func TestSyslogWriter_TCPReconnect(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	received := make(chan string, 10)
+	closed := make(chan struct{})
+	go func() {
+		for i := 0; ; i++ {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			r := bufio.NewReader(conn)
+			msg, err := readOctetCounted(r)
+			if err == nil {
+				received <- msg
+			}
+			//第一个连接读到一条消息后就关闭,模拟服务器重启
+			if i == 0 {
+				conn.Close()
+				close(closed)
+				continue
+			}
+			for {
+				msg, err := readOctetCounted(r)
+				if err != nil {
+					break
+				}
+				received <- msg
+			}
+			conn.Close()
+		}
+	}()
+
+	w, err := NewSyslogWriterBuilder("tcp", ln.Addr().String()).Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+	if err := w.Write([]byte("first\nline")); err != nil {
+		t.Fatal(err)
+	}
+	<-closed
+	time.Sleep(50 * time.Millisecond)
+	if err := w.Write([]byte("second")); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"first\nline", "second"} {
+		select {
+		case got := <-received:
+			if !strings.HasSuffix(got, " - - - "+want) {
+				t.Errorf("unexpected message %q", got)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("timeout waiting for %q", want)
+		}
+	}
+}
+
+func TestUnwritten(t *testing.T) {
+	data := []byte("3 aaa3 bbb3 ccc")
+	ends := []int{5, 10, 15}
+	tests := []struct {
+		n        int
+		want     string
+		wantEnds []int
+	}{
+		{0, "3 aaa3 bbb3 ccc", []int{5, 10, 15}},
+		{3, "3 aaa3 bbb3 ccc", []int{5, 10, 15}}, //写了一半的帧需要完整地重发
+		{5, "3 bbb3 ccc", []int{5, 10}},
+		{12, "3 ccc", []int{5}},
+	}
+	for _, tt := range tests {
+		got, gotEnds := unwritten(data, ends, tt.n)
+		if string(got) != tt.want || !reflect.DeepEqual(gotEnds, tt.wantEnds) {
+			t.Errorf("unwritten(%d) = %q %v, want %q %v", tt.n, got, gotEnds, tt.want, tt.wantEnds)
+		}
+	}
+}
+
+func TestSyslogWriter_TLS(t *testing.T) {
+	//借用httptest的自签名证书
+	srv := httptest.NewTLSServer(nil)
+	cert := srv.TLS.Certificates[0]
+	srv.Close()
+	ln, err := tls.Listen("tcp", "127.0.0.1:0", &tls.Config{Certificates: []tls.Certificate{cert}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	received := make(chan string, 1)
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		line, _ := bufio.NewReader(conn).ReadString('\n')
+		received <- line
+	}()
+
+	w, err := NewSyslogWriterBuilder("tls", ln.Addr().String()).
+		WithFraming(SyslogNonTransparent).
+		WithTLS(TLSOptions{InsecureSkipVerify: true}).
+		Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+	if err := w.Write([]byte(`{"level":"debug"}`)); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case got := <-received:
+		if !strings.HasPrefix(got, "<135>1 ") || !strings.HasSuffix(got, ` {"level":"debug"}`+"\n") {
+			t.Errorf("unexpected message %q", got)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("timeout")
+	}
+}
@@ -0,0 +1,52 @@
+package writer
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"log-collector/config"
+	"os"
+)
+
+// TLSOptions 连接目的地时的TLS配置,证书文件都是PEM格式
+type TLSOptions struct {
+	InsecureSkipVerify bool   `yaml:"insecureSkipVerify"` //不校验服务端证书,只用于测试
+	CAFile             string `yaml:"caFile"`             //校验服务端证书的CA,为空时使用系统的CA
+	CertFile           string `yaml:"certFile"`           //客户端证书,和keyFile一起使用
+	KeyFile            string `yaml:"keyFile"`
+	ServerName         string `yaml:"serverName"` //校验证书时使用的服务端名称,默认为连接的地址
+}
+
+// build 加载证书并创建tls.Config
+func (o *TLSOptions) build() (*tls.Config, error) {
+	conf := &tls.Config{
+		InsecureSkipVerify: o.InsecureSkipVerify,
+		ServerName:         o.ServerName,
+	}
+	if o.CAFile != "" {
+		pem, err := os.ReadFile(o.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("read ca file failed: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificate found in %s", o.CAFile)
+		}
+		conf.RootCAs = pool
+	}
+	if o.CertFile != "" || o.KeyFile != "" {
+		cert, err := tls.LoadX509KeyPair(o.CertFile, o.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("load client certificate failed: %w", err)
+		}
+		conf.Certificates = []tls.Certificate{cert}
+	}
+	return conf, nil
+}
+
+// validate 检查配置,证书文件在创建writer时才读取
+func (o *TLSOptions) validate(errs *config.ValidationErrors, path string) {
+	if (o.CertFile == "") != (o.KeyFile == "") {
+		errs.Add(path+".certFile", "certFile and keyFile must be set together")
+	}
+}
@@ -0,0 +1,187 @@
+package writer
+
+import (
+	"fmt"
+	"log-collector/config"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// WebhookConfig 配置文件中webhook writer的配置
+type WebhookConfig struct {
+	URL         string            `yaml:"url"`
+	Method      string            `yaml:"method"`      //默认POST
+	Headers     map[string]string `yaml:"headers"`     //额外的请求头
+	Format      string            `yaml:"format"`      //raw|json|ndjson,默认json
+	Gzip        bool              `yaml:"gzip"`        //是否gzip压缩请求内容
+	Timeout     time.Duration     `yaml:"timeout"`     //请求的超时时间,默认10s
+	Username    string            `yaml:"username"`    //basic认证
+	Password    string            `yaml:"password"`    //basic认证的密码
+	BearerToken string            `yaml:"bearerToken"` //bearer认证,和basic认证二选一
+	MaxAttempts int               `yaml:"maxAttempts"` //5xx、429和网络错误时的最大尝试次数,默认3
+	TLS         *TLSOptions       `yaml:"tls"`
+}
+
+func init() {
+	Register("webhook", newWebhookBuilder)
+}
+
+// newWebhookBuilder 解析并检查webhook writer的配置
+func newWebhookBuilder(options map[string]interface{}) (Builder, error) {
+	var conf WebhookConfig
+	if err := config.Decode(options, &conf); err != nil {
+		return nil, err
+	}
+	var errs config.ValidationErrors
+	if u, err := url.Parse(conf.URL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		errs.Add("url", "%q is not a valid http(s) url", conf.URL)
+	}
+	switch WebhookFormat(conf.Format) {
+	case "", WebhookRaw, WebhookJSON, WebhookNDJSON:
+	default:
+		errs.Add("format", "unknown format %q, expected one of raw, json, ndjson", conf.Format)
+	}
+	if conf.Timeout < 0 {
+		errs.Add("timeout", "must not be negative")
+	}
+	if conf.MaxAttempts < 0 {
+		errs.Add("maxAttempts", "must not be negative")
+	}
+	if conf.Username != "" && conf.BearerToken != "" {
+		errs.Add("bearerToken", "only one of basic auth and bearerToken can be configured")
+	}
+	if conf.TLS != nil {
+		conf.TLS.validate(&errs, "tls")
+	}
+	if len(errs) > 0 {
+		return nil, errs
+	}
+	b := NewWebhookWriterBuilder(conf.URL).
+		WithMethod(conf.Method).
+		WithHeaders(conf.Headers).
+		WithFormat(WebhookFormat(conf.Format)).
+		WithGzip(conf.Gzip).
+		WithTimeout(conf.Timeout).
+		WithBasicAuth(conf.Username, conf.Password).
+		WithBearerToken(conf.BearerToken).
+		WithMaxAttempts(conf.MaxAttempts)
+	if conf.TLS != nil {
+		b.WithTLS(*conf.TLS)
+	}
+	return b, nil
+}
+
+type WebhookWriterBuilder struct {
+	URL         string
+	Method      string
+	Headers     map[string]string
+	Format      WebhookFormat
+	Gzip        bool
+	Timeout     time.Duration
+	Username    string
+	Password    string
+	BearerToken string
+	MaxAttempts int
+	TLS         *TLSOptions
+}
+
+func NewWebhookWriterBuilder(addr string) *WebhookWriterBuilder {
+	return &WebhookWriterBuilder{URL: addr}
+}
+
+// WithMethod 设置请求的方法,为空时为POST
+func (w *WebhookWriterBuilder) WithMethod(method string) *WebhookWriterBuilder {
+	w.Method = method
+	return w
+}
+
+// WithHeaders 设置额外的请求头,会覆盖默认的Content-Type等请求头
+func (w *WebhookWriterBuilder) WithHeaders(headers map[string]string) *WebhookWriterBuilder {
+	w.Headers = headers
+	return w
+}
+
+// WithFormat 设置请求内容的格式,为空时为WebhookJSON
+func (w *WebhookWriterBuilder) WithFormat(format WebhookFormat) *WebhookWriterBuilder {
+	w.Format = format
+	return w
+}
+
+// WithGzip 设置是否gzip压缩请求内容
+func (w *WebhookWriterBuilder) WithGzip(enable bool) *WebhookWriterBuilder {
+	w.Gzip = enable
+	return w
+}
+
+// WithTimeout 设置请求的超时时间,小于等于0时为10s
+func (w *WebhookWriterBuilder) WithTimeout(timeout time.Duration) *WebhookWriterBuilder {
+	w.Timeout = timeout
+	return w
+}
+
+// WithBasicAuth 使用basic认证,user为空时不认证
+func (w *WebhookWriterBuilder) WithBasicAuth(user, password string) *WebhookWriterBuilder {
+	w.Username = user
+	w.Password = password
+	return w
+}
+
+// WithBearerToken 使用bearer认证,token为空时不认证
+func (w *WebhookWriterBuilder) WithBearerToken(token string) *WebhookWriterBuilder {
+	w.BearerToken = token
+	return w
+}
+
+// WithMaxAttempts 设置可以重试的错误的最大尝试次数,小于等于0时为3
+func (w *WebhookWriterBuilder) WithMaxAttempts(n int) *WebhookWriterBuilder {
+	w.MaxAttempts = n
+	return w
+}
+
+// WithTLS 设置https连接的TLS配置
+func (w *WebhookWriterBuilder) WithTLS(opts TLSOptions) *WebhookWriterBuilder {
+	w.TLS = &opts
+	return w
+}
+
+func (w *WebhookWriterBuilder) Build() (Writer, error) {
+	format := w.Format
+	switch format {
+	case "":
+		format = WebhookJSON
+	case WebhookRaw, WebhookJSON, WebhookNDJSON:
+	default:
+		return nil, fmt.Errorf("unknown webhook format: %q", format)
+	}
+	method := strings.ToUpper(w.Method)
+	if method == "" {
+		method = http.MethodPost
+	}
+	timeout := w.Timeout
+	if timeout <= 0 {
+		timeout = 10 * time.Second
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if w.TLS != nil {
+		tlsConf, err := w.TLS.build()
+		if err != nil {
+			return nil, err
+		}
+		transport.TLSClientConfig = tlsConf
+	}
+	return &WebhookWriter{
+		url:         w.URL,
+		method:      method,
+		headers:     w.Headers,
+		format:      format,
+		gzip:        w.Gzip,
+		username:    w.Username,
+		password:    w.Password,
+		bearerToken: w.BearerToken,
+		client:      &http.Client{Timeout: timeout, Transport: transport},
+		policy:      RetryPolicy{MaxAttempts: w.MaxAttempts}.withDefaults(),
+		stop:        make(chan struct{}),
+	}, nil
+}
@@ -0,0 +1,184 @@
+package writer
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// WebhookFormat 请求内容的格式
+type WebhookFormat string
+
+const (
+	WebhookRaw    WebhookFormat = "raw"    //每条日志单独一个请求,内容为日志本身
+	WebhookJSON   WebhookFormat = "json"   //一批日志为一个JSON数组,是JSON的日志原样放入,否则作为字符串
+	WebhookNDJSON WebhookFormat = "ndjson" //一批日志一行一条
+)
+
+// WebhookWriter 把日志通过HTTP请求发送到任意的地址
+// 5xx、429和网络错误会按照policy重试,其他4xx为永久性错误
+type WebhookWriter struct {
+	url         string
+	method      string
+	headers     map[string]string
+	format      WebhookFormat
+	gzip        bool
+	username    string
+	password    string
+	bearerToken string
+	client      *http.Client
+	policy      RetryPolicy
+
+	stop     chan struct{}
+	stopOnce sync.Once
+}
+
+func (w *WebhookWriter) Write(data []byte) error {
+	return w.WriteBatch([][]byte{data})
+}
+
+func (w *WebhookWriter) WriteBatch(batch [][]byte) error {
+	if len(batch) == 0 {
+		return nil
+	}
+	if w.format == WebhookRaw {
+		return w.sendEach(batch)
+	}
+	body, err := w.encode(batch)
+	if err != nil {
+		return Permanent(fmt.Errorf("webhook: encode failed: %w", err))
+	}
+	return w.send(body)
+}
+
+// sendEach 每条日志单独发送,失败后不再发送后面的日志
+// 失败的日志和后面没有发送的日志通过BatchError返回,重试时不会重复发送已经成功的日志
+func (w *WebhookWriter) sendEach(batch [][]byte) error {
+	for i, data := range batch {
+		err := w.send(data)
+		if err == nil {
+			continue
+		}
+		if len(batch) == 1 {
+			return err
+		}
+		errs := map[int]error{i: err}
+		for j := i + 1; j < len(batch); j++ {
+			errs[j] = fmt.Errorf("webhook: not sent because record %d failed", i)
+		}
+		return &BatchError{Errors: errs}
+	}
+	return nil
+}
+
+func (w *WebhookWriter) Close() error {
+	w.stopOnce.Do(func() { close(w.stop) })
+	w.client.CloseIdleConnections()
+	return nil
+}
+
+// encode 按照format把一批日志编码为请求的内容
+func (w *WebhookWriter) encode(batch [][]byte) ([]byte, error) {
+	var buf bytes.Buffer
+	switch w.format {
+	case WebhookNDJSON:
+		for _, data := range batch {
+			buf.Write(bytes.TrimRight(data, "\n"))
+			buf.WriteByte('\n')
+		}
+	default:
+		records := make([]json.RawMessage, len(batch))
+		for i, data := range batch {
+			data = bytes.TrimSpace(data)
+			if json.Valid(data) {
+				records[i] = data
+				continue
+			}
+			s, err := json.Marshal(string(data))
+			if err != nil {
+				return nil, err
+			}
+			records[i] = s
+		}
+		if err := json.NewEncoder(&buf).Encode(records); err != nil {
+			return nil, err
+		}
+	}
+	return buf.Bytes(), nil
+}
+
+// send 发送一个请求,可以重试的错误按照policy重试
+func (w *WebhookWriter) send(body []byte) error {
+	if w.gzip {
+		var buf bytes.Buffer
+		zw := gzip.NewWriter(&buf)
+		zw.Write(body)
+		if err := zw.Close(); err != nil {
+			return Permanent(fmt.Errorf("webhook: gzip failed: %w", err))
+		}
+		body = buf.Bytes()
+	}
+	var err error
+	for attempt := 1; ; attempt++ {
+		err = w.do(body)
+		if err == nil || IsPermanent(err) || attempt >= w.policy.MaxAttempts {
+			return err
+		}
+		if !w.sleep(max(w.policy.backoff(attempt), retryAfter(err))) {
+			return err
+		}
+	}
+}
+
+func (w *WebhookWriter) do(body []byte) error {
+	req, err := http.NewRequest(w.method, w.url, bytes.NewReader(body))
+	if err != nil {
+		return Permanent(fmt.Errorf("webhook: %w", err))
+	}
+	switch w.format {
+	case WebhookJSON:
+		req.Header.Set("Content-Type", "application/json")
+	case WebhookNDJSON:
+		req.Header.Set("Content-Type", "application/x-ndjson")
+	default:
+		req.Header.Set("Content-Type", "text/plain; charset=utf-8")
+	}
+	if w.gzip {
+		req.Header.Set("Content-Encoding", "gzip")
+	}
+	switch {
+	case w.bearerToken != "":
+		req.Header.Set("Authorization", "Bearer "+w.bearerToken)
+	case w.username != "":
+		req.SetBasicAuth(w.username, w.password)
+	}
+	//配置中的header优先
+	for k, v := range w.headers {
+		req.Header.Set(k, v)
+	}
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("webhook: request failed: %w", err)
+	}
+	defer drainBody(resp)
+	if resp.StatusCode/100 == 2 {
+		return nil
+	}
+	return fmt.Errorf("webhook: %w", newHTTPError(resp))
+}
+
+// sleep 等待d,如果writer已经关闭则返回false
+func (w *WebhookWriter) sleep(d time.Duration) bool {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return true
+	case <-w.stop:
+		return false
+	}
+}
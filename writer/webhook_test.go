@@ -0,0 +1,166 @@
+package writer
+
+import (
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+)
+
+// webhookServer 记录收到的请求,前fails次返回failStatus
+type webhookServer struct {
+	*httptest.Server
+	mutex      sync.Mutex
+	fails      int
+	failStatus int
+	requests   []*http.Request
+	bodies     []string
+}
+
+func newWebhookServer(t *testing.T, fails, failStatus int) *webhookServer {
+	s := &webhookServer{fails: fails, failStatus: failStatus}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.mutex.Lock()
+		defer s.mutex.Unlock()
+		var body io.Reader = r.Body
+		if r.Header.Get("Content-Encoding") == "gzip" {
+			zr, err := gzip.NewReader(r.Body)
+			if err != nil {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			body = zr
+		}
+		b, _ := io.ReadAll(body)
+		s.requests = append(s.requests, r)
+		s.bodies = append(s.bodies, string(b))
+		if s.fails > 0 {
+			s.fails--
+			w.WriteHeader(s.failStatus)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
+
+func TestWebhookWriter_Formats(t *testing.T) {
+	batch := [][]byte{[]byte(`{"a":1}`), []byte("plain text\n")}
+	tests := []struct {
+		format      WebhookFormat
+		wantBodies  []string
+		contentType string
+	}{
+		{WebhookJSON, []string{`[{"a":1},"plain text"]` + "\n"}, "application/json"},
+		{WebhookNDJSON, []string{"{\"a\":1}\nplain text\n"}, "application/x-ndjson"},
+		{WebhookRaw, []string{`{"a":1}`, "plain text\n"}, "text/plain; charset=utf-8"},
+	}
+	for _, tt := range tests {
+		t.Run(string(tt.format), func(t *testing.T) {
+			srv := newWebhookServer(t, 0, 0)
+			w, err := NewWebhookWriterBuilder(srv.URL).
+				WithFormat(tt.format).
+				WithGzip(true).
+				WithMethod("put").
+				WithBearerToken("token").
+				WithHeaders(map[string]string{"X-Source": "collector"}).
+				Build()
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer w.Close()
+			if err := w.(BatchWriter).WriteBatch(batch); err != nil {
+				t.Fatalf("WriteBatch() error = %v", err)
+			}
+			if len(srv.bodies) != len(tt.wantBodies) {
+				t.Fatalf("expected %d requests, got %d", len(tt.wantBodies), len(srv.bodies))
+			}
+			for i, want := range tt.wantBodies {
+				if srv.bodies[i] != want {
+					t.Errorf("body %d = %q, want %q", i, srv.bodies[i], want)
+				}
+			}
+			r := srv.requests[0]
+			if r.Method != http.MethodPut || r.Header.Get("Authorization") != "Bearer token" ||
+				r.Header.Get("X-Source") != "collector" || r.Header.Get("Content-Type") != tt.contentType {
+				t.Errorf("unexpected request %s %v", r.Method, r.Header)
+			}
+		})
+	}
+}
+
+func TestWebhookWriter_Retry(t *testing.T) {
+	//5xx会重试
+	srv := newWebhookServer(t, 2, http.StatusServiceUnavailable)
+	w, err := NewWebhookWriterBuilder(srv.URL).WithMaxAttempts(3).Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+	w.(*WebhookWriter).policy = fastPolicy
+	if err := w.Write([]byte("x")); err != nil {
+		t.Fatalf("Write() error = %v", err)
+	}
+	if len(srv.requests) != 3 {
+		t.Errorf("expected 3 requests, got %d", len(srv.requests))
+	}
+
+	//4xx不会重试
+	srv = newWebhookServer(t, 1, http.StatusUnauthorized)
+	w, err = NewWebhookWriterBuilder(srv.URL).WithBasicAuth("user", "pw").Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+	err = w.Write([]byte("x"))
+	if !IsPermanent(err) {
+		t.Errorf("expected permanent error, got %v", err)
+	}
+	if len(srv.requests) != 1 {
+		t.Errorf("expected 1 request, got %d", len(srv.requests))
+	}
+	if user, pw, ok := srv.requests[0].BasicAuth(); !ok || user != "user" || pw != "pw" {
+		t.Errorf("unexpected basic auth %q %q", user, pw)
+	}
+}
+
+func TestWebhookWriter_RawPartialFailure(t *testing.T) {
+	var (
+		mutex  sync.Mutex
+		bodies []string
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := io.ReadAll(r.Body)
+		mutex.Lock()
+		bodies = append(bodies, string(b))
+		mutex.Unlock()
+		//第二个请求失败
+		if string(b) == "b" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer srv.Close()
+	w, err := NewWebhookWriterBuilder(srv.URL).WithFormat(WebhookRaw).Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+
+	err = w.(BatchWriter).WriteBatch([][]byte{[]byte("a"), []byte("b"), []byte("c")})
+	be, ok := err.(*BatchError)
+	if !ok {
+		t.Fatalf("expected BatchError, got %v", err)
+	}
+	//已经发送的a不需要重试,b是永久性错误,没有发送的c可以重试
+	if len(be.Errors) != 2 || !IsPermanent(be.Errors[1]) || be.Errors[2] == nil || IsPermanent(be.Errors[2]) {
+		t.Errorf("unexpected record errors: %v", be.Errors)
+	}
+	if len(bodies) != 2 || bodies[0] != "a" || bodies[1] != "b" {
+		t.Errorf("unexpected requests %q", bodies)
+	}
+}
@@ -1,5 +1,7 @@
 package writer
 
+import "log-collector/message"
+
 type Writer interface {
 	Write(data []byte) error
 
@@ -7,6 +9,108 @@ type Writer interface {
 	Close() error
 }
 
+// BatchWriter 支持批量写入的writer
+// collector会检测writer是否实现了该接口,如果实现了,会按照条数、字节数和等待时间攒批后调用WriteBatch
+// WriteBatch返回后不能再持有batch
+type BatchWriter interface {
+	Writer
+	WriteBatch(batch [][]byte) error
+}
+
+// MessageWriter 需要日志元数据(例如kafka的topic、partition)的writer
+// collector会检测writer是否实现了该接口,如果实现了,会按照BatchWriter同样的规则攒批后调用WriteMessages
+// WriteMessages返回后不能再持有msgs,但可以继续持有其中的Message
+type MessageWriter interface {
+	Writer
+	WriteMessages(msgs []*message.Message) error
+}
+
 type Builder interface {
 	Build() (Writer, error)
 }
+
+// Flusher 有缓冲区的writer实现该接口,例如FileWriter
+type Flusher interface {
+	Flush() error
+}
+
+// Rotator 可以手动切割文件的writer实现该接口,例如FileWriter
+type Rotator interface {
+	Rotate() error
+}
+
+// Wrapper 包装了其他writer的writer(编码、重试、磁盘队列等)实现该接口,用于找到里面的writer
+type Wrapper interface {
+	Unwrap() Writer
+}
+
+// Flush 把w以及w包装的所有writer的缓冲区写入,没有实现Flusher的跳过
+func Flush(w Writer) error {
+	for w != nil {
+		if f, ok := w.(Flusher); ok {
+			if err := f.Flush(); err != nil {
+				return err
+			}
+		}
+		wrapper, ok := w.(Wrapper)
+		if !ok {
+			return nil
+		}
+		w = wrapper.Unwrap()
+	}
+	return nil
+}
+
+// Rotate 切割w或者w包装的writer的文件,都没有实现Rotator时返回false
+func Rotate(w Writer) (bool, error) {
+	for w != nil {
+		if r, ok := w.(Rotator); ok {
+			return true, r.Rotate()
+		}
+		wrapper, ok := w.(Wrapper)
+		if !ok {
+			return false, nil
+		}
+		w = wrapper.Unwrap()
+	}
+	return false, nil
+}
+
+// WriteBatch 批量写入,如果w没有实现BatchWriter就逐条写入,遇到错误立即返回
+func WriteBatch(w Writer, batch [][]byte) error {
+	if bw, ok := w.(BatchWriter); ok {
+		return bw.WriteBatch(batch)
+	}
+	for _, data := range batch {
+		if err := w.Write(data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Deliver 把日志写入w,w实现了MessageWriter时带上元数据,否则只写入日志的内容
+func Deliver(w Writer, msgs []*message.Message) error {
+	if mw, ok := w.(MessageWriter); ok {
+		return mw.WriteMessages(msgs)
+	}
+	return WriteBatch(w, message.Values(msgs))
+}
+
+// SupportsBatch w是否支持批量写入(实现了MessageWriter或者BatchWriter)
+func SupportsBatch(w Writer) bool {
+	switch w.(type) {
+	case MessageWriter, BatchWriter:
+		return true
+	}
+	return false
+}
+
+// appendLine 把data追加到dst,data不是以换行结尾时补上换行,用于按行写入的writer
+func appendLine(dst, data []byte) []byte {
+	dst = append(dst, data...)
+	if len(data) == 0 || data[len(data)-1] != '\n' {
+		dst = append(dst, '\n')
+	}
+	return dst
+}